@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"alex/internal/llm"
+)
+
+// imageMentionPattern matches @path mentions of image files, e.g. "why is @ui/broken.png off?"
+var imageMentionPattern = regexp.MustCompile(`(?i)(?:^|\s)@(\S+\.(?:png|jpe?g|gif|webp))`)
+
+// collectImages returns the images attached with --image and mentioned as @image.png in prompt.
+// Flag values must exist; mentions of missing files are left as plain text.
+func collectImages(prompt string, flagImages []string) ([]llm.ContentPart, error) {
+	var images []llm.ContentPart
+	seen := make(map[string]bool)
+	add := func(part llm.ContentPart, key string) {
+		if !seen[key] {
+			seen[key] = true
+			images = append(images, part)
+		}
+	}
+
+	for _, image := range flagImages {
+		if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+			add(llm.ImageURLPart(image), image)
+			continue
+		}
+		path, err := imageFilePath(image)
+		if err != nil {
+			return nil, err
+		}
+		add(llm.ImageFilePart(path), path)
+	}
+
+	for _, match := range imageMentionPattern.FindAllStringSubmatch(prompt, -1) {
+		if path, err := imageFilePath(match[1]); err == nil {
+			add(llm.ImageFilePart(path), path)
+		}
+	}
+	return images, nil
+}
+
+// imageFilePath checks that path is a readable image file and makes it absolute, so the
+// session can load it again from any working directory
+func imageFilePath(path string) (string, error) {
+	if !llm.IsImageFile(path) {
+		return "", fmt.Errorf("%s is not a supported image (png, jpg, gif or webp)", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot attach image: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("cannot attach image: %s is a directory", path)
+	}
+	return filepath.Abs(path)
+}
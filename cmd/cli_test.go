@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -304,3 +306,24 @@ func TestCLI_InputQueue(t *testing.T) {
 		t.Fatal("Failed to read from input queue")
 	}
 }
+
+// TestCollectImages 测试 --image 参数和 @image.png 提及
+func TestCollectImages(t *testing.T) {
+	dir := t.TempDir()
+	screenshot := filepath.Join(dir, "screenshot.png")
+	if err := os.WriteFile(screenshot, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := collectImages("why is @"+screenshot+" broken? see @missing.png and me@example.com", []string{"https://example.com/a.jpg", screenshot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[0].URL != "https://example.com/a.jpg" || images[1].Path != screenshot {
+		t.Errorf("unexpected images %+v", images)
+	}
+
+	if _, err := collectImages("", []string{filepath.Join(dir, "notes.txt")}); err == nil {
+		t.Error("--image should reject files that are not images")
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"alex/evaluation/swe_bench"
+	appconfig "alex/internal/config"
+	"alex/internal/llm"
 
 	"github.com/spf13/cobra"
 )
@@ -133,6 +135,11 @@ Examples:
 				log.Printf("Warning: Failed to save config: %v", err)
 			}
 
+			// Price batch tasks with the user's pricing overrides
+			if appConfig, err := appconfig.NewManager(); err == nil {
+				llm.ConfigurePricing(appConfig.GetConfig().Pricing)
+			}
+
 			// Check if resuming from previous run
 			if config.ResumeFrom != "" {
 				return runResumeCommand(ctx, config, quiet, progress)
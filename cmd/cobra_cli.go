@@ -16,6 +16,8 @@ import (
 
 	"alex/internal/agent"
 	"alex/internal/config"
+	"alex/internal/context/message"
+	"alex/internal/llm"
 	"alex/internal/utils"
 )
 
@@ -24,6 +26,11 @@ func isTTY() bool {
 	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
 }
 
+// canPrompt checks if the user can answer prompts; stdout may still be piped
+func canPrompt() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 // Color definitions for Claude Code style output
 var (
 	blue   = color.New(color.FgBlue).SprintFunc()
@@ -77,6 +84,7 @@ type CLI struct {
 	verbose               bool
 	debug                 bool
 	useTUI                bool // Whether to use Bubble Tea TUI
+	nonInteractive        bool // Never prompt for tool permissions (CI runs)
 	currentTermCtrl       *TerminalController
 	currentStartTime      time.Time
 	contentBuffer         strings.Builder // Buffer for accumulating streaming content (using strings.Builder for better performance)
@@ -88,6 +96,11 @@ type CLI struct {
 	totalTokensUsed       int             // Total tokens used in session
 	totalPromptTokens     int             // Total prompt tokens used
 	totalCompletionTokens int             // Total completion tokens used
+	totalCost             float64         // Total cost in USD
+	totalCacheReadTokens  int             // Prompt tokens served from the provider's prompt cache
+	totalCacheWriteTokens int             // Prompt tokens written to the provider's prompt cache
+	reasoningChars        int             // Length of the reasoning block being shown collapsed
+	imageFlags            []string        // Images attached to a single prompt with --image
 }
 
 // NewRootCommand creates the root cobra command
@@ -112,6 +125,8 @@ through streaming responses and advanced tool calling capabilities.
   alex                           # Interactive mode
   alex "analyze this project"    # Single prompt
   alex -r session_123            # Resume session
+  alex --output-schema out.json "list the TODOs"  # JSON answer on stdout
+  alex "why is the header cut off? @screenshot.png"  # Attach an image
   
   alex config provider kimi      # Select AI provider  
   alex config apikey sk-xxx     # Set API key
@@ -135,8 +150,14 @@ through streaming responses and advanced tool calling capabilities.
 					return err
 				}
 				prompt := strings.Join(args, " ")
+				if schemaPath, _ := cmd.Flags().GetString("output-schema"); schemaPath != "" {
+					return cli.runStructuredPrompt(prompt, schemaPath)
+				}
 				return cli.runSinglePrompt(prompt)
 			}
+			if schemaPath, _ := cmd.Flags().GetString("output-schema"); schemaPath != "" {
+				return fmt.Errorf("--output-schema requires a prompt")
+			}
 			// Check if we have a TTY before starting interactive mode
 			if !isTTY() {
 				// No TTY available (CI environment), show help instead
@@ -156,10 +177,16 @@ through streaming responses and advanced tool calling capabilities.
 	rootCmd.PersistentFlags().BoolVarP(&cli.verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.PersistentFlags().BoolVarP(&cli.debug, "debug", "d", false, "Debug mode")
 	rootCmd.PersistentFlags().BoolVar(&cli.useTUI, "tui", false, "Use Bubble Tea TUI (experimental)")
+	rootCmd.PersistentFlags().BoolVar(&cli.nonInteractive, "non-interactive", false, "Never prompt for tool permissions; use permissions.non_interactive_action instead")
 	rootCmd.PersistentFlags().StringP("resume", "r", "", "Resume session by ID")
+	rootCmd.PersistentFlags().String("compression", "", "Context compression strategy for this session: "+strings.Join(message.CompressionStrategyNames(), ", ")+" (default: compression.strategy in the config)")
+	rootCmd.PersistentFlags().String("llm-cassette", "", "Record or replay LLM traffic with this cassette file (env: "+llm.CassetteEnvVar+")")
+	rootCmd.PersistentFlags().String("llm-cassette-mode", "replay", "Cassette mode: record or replay (env: "+llm.CassetteModeEnvVar+")")
 	rootCmd.PersistentFlags().StringP("model", "m", "", "Specify model")
-	rootCmd.PersistentFlags().IntP("tokens", "t", 2000, "Max tokens")
+	rootCmd.PersistentFlags().IntP("tokens", "t", 0, "Max output tokens (default: the model's max output)")
 	rootCmd.PersistentFlags().Float64P("temperature", "", 0.7, "Temperature")
+	rootCmd.Flags().StringArrayVar(&cli.imageFlags, "image", nil, "Single prompt mode: attach an image file or URL (repeatable); @image.png in the prompt also works")
+	rootCmd.Flags().String("output-schema", "", "Single prompt mode: print the final answer as JSON validated against this JSON Schema file")
 
 	// Add subcommands
 	rootCmd.AddCommand(newConfigCommand(cli))
@@ -170,6 +197,7 @@ through streaming responses and advanced tool calling capabilities.
 	rootCmd.AddCommand(newBatchCommand())
 	rootCmd.AddCommand(newVersionCommand())
 	rootCmd.AddCommand(newInitCommand(cli))
+	rootCmd.AddCommand(newContextCommand(cli))
 
 	// Configure viper
 	viper.SetConfigName("alex-config")
@@ -407,6 +435,14 @@ func (cli *CLI) initialize(cmd *cobra.Command) error {
 		return fmt.Errorf("failed to create config manager: %w", err)
 	}
 	cli.config = configManager
+	if maxTokens, _ := cmd.Flags().GetInt("tokens"); maxTokens > 0 {
+		configManager.SetMaxTokensOverride(maxTokens)
+	}
+
+	// Record or replay LLM traffic before any client is created
+	if err := enableLLMCassette(cmd); err != nil {
+		return err
+	}
 
 	// Create agent
 	agentInstance, err := agent.NewReactAgent(configManager)
@@ -415,6 +451,14 @@ func (cli *CLI) initialize(cmd *cobra.Command) error {
 	}
 	cli.agent = agentInstance
 
+	// Tool calls that need approval are confirmed on the terminal unless running unattended
+	if cli.nonInteractive || !canPrompt() {
+		cli.agent.SetNonInteractive(true)
+		cli.agent.SetPermissionNotifier(cli.notifyPermissionDenied)
+	} else {
+		cli.agent.SetPermissionPrompter(cli.promptPermission)
+	}
+
 	// Handle session resume
 	if resumeID, _ := cmd.Flags().GetString("resume"); resumeID != "" {
 		if _, err := cli.agent.RestoreSession(resumeID); err != nil {
@@ -426,7 +470,33 @@ func (cli *CLI) initialize(cmd *cobra.Command) error {
 			return fmt.Errorf("failed to start session: %w", err)
 		}
 	}
+	if strategy, _ := cmd.Flags().GetString("compression"); strategy != "" {
+		if err := cli.agent.SetSessionCompressionStrategy(strategy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enableLLMCassette enables the cassette from --llm-cassette, falling back to the environment
+func enableLLMCassette(cmd *cobra.Command) error {
+	path, _ := cmd.Flags().GetString("llm-cassette")
+	if path == "" {
+		if err := llm.EnableCassetteFromEnv(); err != nil {
+			return fmt.Errorf("failed to enable LLM cassette: %w", err)
+		}
+		return nil
+	}
 
+	modeName, _ := cmd.Flags().GetString("llm-cassette-mode")
+	mode, err := llm.ParseCassetteMode(modeName)
+	if err != nil {
+		return err
+	}
+	if err := llm.EnableCassette(path, mode); err != nil {
+		return fmt.Errorf("failed to enable LLM cassette: %w", err)
+	}
 	return nil
 }
 
@@ -458,6 +528,12 @@ func (cli *CLI) updateWorkingIndicatorMessage(message string) {
 func (cli *CLI) deepCodingStreamCallback(chunk agent.StreamChunk) {
 	var content string
 
+	// Close a collapsed reasoning block once the model moves on
+	if chunk.Type != "reasoning" && cli.reasoningChars > 0 {
+		cli.printStreamContent(gray(fmt.Sprintf(" (%d chars, use --verbose to show)", cli.reasoningChars)) + "\n")
+		cli.reasoningChars = 0
+	}
+
 	switch chunk.Type {
 	case "token_usage":
 		// Update token counters
@@ -471,6 +547,11 @@ func (cli *CLI) deepCodingStreamCallback(chunk agent.StreamChunk) {
 		if chunk.CompletionTokens > 0 {
 			cli.totalCompletionTokens += chunk.CompletionTokens
 		}
+		if chunk.TotalCost > 0 {
+			cli.totalCost = chunk.TotalCost
+		}
+		cli.totalCacheReadTokens += chunk.CacheReadTokens
+		cli.totalCacheWriteTokens += chunk.CacheWriteTokens
 		
 		// Display token usage information in a subtle way
 		content = gray(fmt.Sprintf("💎 %s", chunk.Content)) + "\n"
@@ -488,6 +569,11 @@ func (cli *CLI) deepCodingStreamCallback(chunk agent.StreamChunk) {
 			cli.updateWorkingIndicatorMessage("Thinking")
 		}
 	case "thinking_result":
+		// Content was already printed token by token
+		if isStreamedChunk(chunk) {
+			content = "\n"
+			break
+		}
 		// Render thinking result as markdown if it contains markdown
 		content = RenderMarkdown(chunk.Content)
 		content = "\n" + DeepCodingResult(content)
@@ -495,17 +581,28 @@ func (cli *CLI) deepCodingStreamCallback(chunk agent.StreamChunk) {
 			content += "\n"
 		}
 	case "final_answer":
+		if isStreamedChunk(chunk) {
+			content = "\n"
+			break
+		}
 		content = RenderMarkdown(chunk.Content)
 		content = "\n" + DeepCodingResult(content)
 		if !strings.HasSuffix(content, "\n") {
 			content += "\n"
 		}
 	case "reasoning":
-		// Handle OpenAI reasoning tokens
-		content = DeepCodingReasoning("Reasoning: " + chunk.Content)
-		if !strings.HasSuffix(content, "\n") {
-			content += "\n"
+		// Reasoning is shown in full with --verbose, otherwise collapsed into one line
+		if cli.verbose {
+			content = gray(chunk.Content)
+			if streaming, _ := chunk.Metadata["streaming"].(bool); !streaming {
+				content = DeepCodingReasoning("Reasoning: "+chunk.Content) + "\n"
+			}
+			break
+		}
+		if cli.reasoningChars == 0 {
+			content = "\n" + DeepCodingReasoning("Thinking...")
 		}
+		cli.reasoningChars += len([]rune(chunk.Content))
 	case "reasoning_summary":
 		// Handle OpenAI reasoning summary
 		content = DeepCodingReasoning("Summary: " + chunk.Content)
@@ -536,10 +633,27 @@ func (cli *CLI) deepCodingStreamCallback(chunk agent.StreamChunk) {
 			content = DeepCodingReasoning("ReAct iteration: "+chunk.Content) + "\n"
 		}
 	case "llm_content", "content":
+		// Token deltas are printed as they arrive
+		if streaming, _ := chunk.Metadata["streaming"].(bool); streaming {
+			content = chunk.Content
+			break
+		}
 		// Accumulate streaming content for better markdown processing
 		cli.contentBuffer.WriteString(chunk.Content)
 	case "error":
 		content = DeepCodingError(chunk.Content) + "\n"
+	case "model_route":
+		// Regular iterations only show the serving model in debug mode
+		if kind, _ := chunk.Metadata["kind"].(string); kind != "execution" || cli.debug {
+			content = gray(chunk.Content) + "\n"
+		}
+	case "budget_warning", "model_switch":
+		content = "\n" + yellow(chunk.Content) + "\n"
+	case "budget_exceeded":
+		content = "\n" + DeepCodingResult(RenderMarkdown(chunk.Content))
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
 	case "complete":
 		// Update final token count from chunk if available
 		if chunk.TotalTokensUsed > 0 {
@@ -570,14 +684,25 @@ func (cli *CLI) deepCodingStreamCallback(chunk agent.StreamChunk) {
 
 	// Output the content if it's not empty
 	if content != "" && chunk.Type != "complete" {
-		if cli.currentTermCtrl != nil {
-			cli.currentTermCtrl.PrintInScrollRegion(content)
-		} else {
-			fmt.Print(content)
-		}
+		cli.printStreamContent(content)
 	}
 }
 
+// printStreamContent prints streamed output inside the scroll region when one is active
+func (cli *CLI) printStreamContent(content string) {
+	if cli.currentTermCtrl != nil {
+		cli.currentTermCtrl.PrintInScrollRegion(content)
+	} else {
+		fmt.Print(content)
+	}
+}
+
+// isStreamedChunk reports whether the chunk's content was already delivered as token deltas
+func isStreamedChunk(chunk agent.StreamChunk) bool {
+	streamed, _ := chunk.Metadata["streamed"].(bool)
+	return streamed
+}
+
 // shouldStreamAsMarkdown determines if content should be rendered as markdown in real-time
 func (cli *CLI) shouldStreamAsMarkdown(content string) bool {
 	// Don't try streaming markdown for very short content
@@ -617,6 +742,9 @@ func (cli *CLI) runSinglePrompt(prompt string) error {
 	cli.totalTokensUsed = 0
 	cli.totalPromptTokens = 0
 	cli.totalCompletionTokens = 0
+	cli.totalCost = 0
+	cli.totalCacheReadTokens = 0
+	cli.totalCacheWriteTokens = 0
 
 	// Record start time
 	startTime := time.Now()
@@ -625,8 +753,16 @@ func (cli *CLI) runSinglePrompt(prompt string) error {
 		fmt.Printf("%s Processing: %s\n", blue("⚡"), prompt)
 	}
 
+	images, err := collectImages(prompt, cli.imageFlags)
+	if err != nil {
+		return err
+	}
+	if len(images) > 0 && cli.verbose {
+		fmt.Printf("%s Attached %d image(s)\n", blue("🖼"), len(images))
+	}
+
 	ctx := context.Background()
-	err := cli.agent.ProcessMessageStream(ctx, prompt, cli.config.GetConfig(), cli.deepCodingStreamCallback)
+	err = cli.agent.ProcessMessageStreamWithImages(ctx, prompt, images, cli.config.GetConfig(), cli.deepCodingStreamCallback)
 
 	// Calculate and display completion time
 	duration := time.Since(startTime)
@@ -659,13 +795,33 @@ func (cli *CLI) runSinglePrompt(prompt string) error {
 	return err
 }
 
-// formatTokenUsage formats token usage information with input/output breakdown
+// formatTokenUsage formats token usage information with input/output breakdown and cost
 func (cli *CLI) formatTokenUsage() string {
+	usage := fmt.Sprintf("%d tokens", cli.totalTokensUsed)
 	if cli.totalPromptTokens > 0 && cli.totalCompletionTokens > 0 {
-		return fmt.Sprintf("%d tokens (in: %d, out: %d)",
+		usage = fmt.Sprintf("%d tokens (in: %d, out: %d)",
 			cli.totalTokensUsed, cli.totalPromptTokens, cli.totalCompletionTokens)
 	}
-	return fmt.Sprintf("%d tokens", cli.totalTokensUsed)
+	if cli.totalCacheReadTokens > 0 || cli.totalCacheWriteTokens > 0 {
+		usage += fmt.Sprintf(" · cache: %d read / %d write", cli.totalCacheReadTokens, cli.totalCacheWriteTokens)
+	}
+	if cli.totalCost > 0 {
+		usage += fmt.Sprintf(" · $%.4f", cli.totalCost)
+	}
+	return usage
+}
+
+// formatMaxTokens shows the configured max tokens, or the model's max output when unset
+func formatMaxTokens(maxTokens int, model string) string {
+	if maxTokens > 0 {
+		return fmt.Sprintf("%d", maxTokens)
+	}
+	return fmt.Sprintf("auto (%d)", llm.LookupCapabilities(model).MaxOutput)
+}
+
+// formatModelLimits shows the context window and max output of a model
+func formatModelLimits(caps llm.ModelCapabilities) string {
+	return fmt.Sprintf("%s: %d tokens, %s: %d tokens", "Context Window", caps.ContextWindow, "Max Output", caps.MaxOutput)
 }
 
 func (cli *CLI) showConfig() {
@@ -674,10 +830,43 @@ func (cli *CLI) showConfig() {
 
 	// Display legacy config (for compatibility)
 	config += fmt.Sprintf("  %s: %s\n", bold("Model"), blue(cfg.Model))
-	config += fmt.Sprintf("  %s: %s\n", bold("Max Tokens"), blue(fmt.Sprintf("%d", cfg.MaxTokens)))
+	config += fmt.Sprintf("  %s: %s\n", bold("Max Tokens"), blue(formatMaxTokens(cfg.MaxTokens, cfg.Model)))
+	config += fmt.Sprintf("  %s: %s\n", bold("Context Window"), blue(fmt.Sprintf("%d tokens", llm.LookupCapabilities(cfg.Model).ContextWindow)))
 	config += fmt.Sprintf("  %s: %s\n", bold("Temperature"), blue(fmt.Sprintf("%.1f", cfg.Temperature)))
 	config += fmt.Sprintf("  %s: %s\n", bold("Base URL"), blue(cfg.BaseURL))
 	config += fmt.Sprintf("  %s: %s\n", bold("Max Turns"), blue(fmt.Sprintf("%d", cfg.MaxTurns)))
+	if cfg.MaxTaskTokens > 0 {
+		config += fmt.Sprintf("  %s: %s\n", bold("Max Task Tokens"), blue(fmt.Sprintf("%d", cfg.MaxTaskTokens)))
+	}
+	if cfg.MaxTaskCost > 0 {
+		config += fmt.Sprintf("  %s: %s\n", bold("Max Task Cost"), blue(fmt.Sprintf("$%.2f", cfg.MaxTaskCost)))
+	}
+	if cfg.TaskTimeout > 0 {
+		config += fmt.Sprintf("  %s: %s\n", bold("Task Timeout"), blue(fmt.Sprintf("%ds", cfg.TaskTimeout)))
+	}
+	if cfg.ThinkingBudget > 0 {
+		config += fmt.Sprintf("  %s: %s\n", bold("Thinking Budget"), blue(fmt.Sprintf("%d tokens", cfg.ThinkingBudget)))
+	}
+	if cfg.Routing != nil {
+		policy := agent.RoutingPolicyFromConfig(cfg.Routing)
+		synthesis := string(policy.Synthesis)
+		if synthesis == "" {
+			synthesis = "off"
+		}
+		config += fmt.Sprintf("  %s: %s\n", bold("Model Routing"), blue(fmt.Sprintf("planning=%s, debugging=%s (after %d failures), synthesis=%s, compression=%s, default=%s",
+			policy.Planning, policy.Debugging, policy.FailureThreshold, synthesis, policy.Compression, policy.Default)))
+	}
+	if cfg.Compression != nil && cfg.Compression.Strategy != "" {
+		compression := cfg.Compression.Strategy
+		if cfg.Compression.Strategy == message.StrategySlidingWindow {
+			window := cfg.Compression.Window
+			if window <= 0 {
+				window = message.DefaultSlidingWindow
+			}
+			compression += fmt.Sprintf(" (last %d tool rounds)", window)
+		}
+		config += fmt.Sprintf("  %s: %s\n", bold("Compression"), blue(compression))
+	}
 
 	// Display tool configuration
 	if cfg.TavilyAPIKey != "" {
@@ -701,7 +890,7 @@ func (cli *CLI) showConfig() {
 		for modelType, modelConfig := range cfg.Models {
 			config += fmt.Sprintf("\n  %s %s:\n", bold("📋"), bold(string(modelType)))
 			config += fmt.Sprintf("    %s: %s\n", "Model", blue(modelConfig.Model))
-			config += fmt.Sprintf("    %s: %s\n", "Max Tokens", blue(fmt.Sprintf("%d", modelConfig.MaxTokens)))
+			config += fmt.Sprintf("    %s: %s\n", "Max Tokens", blue(formatMaxTokens(modelConfig.MaxTokens, modelConfig.Model)))
 			config += fmt.Sprintf("    %s: %s\n", "Temperature", blue(fmt.Sprintf("%.1f", modelConfig.Temperature)))
 			config += fmt.Sprintf("    %s: %s\n", "Base URL", blue(modelConfig.BaseURL))
 			// Mask API key for security
@@ -793,7 +982,7 @@ func (cli *CLI) setProvider(providerName, modelName, apiKey string) error {
 	fmt.Printf("%s Successfully configured %s provider\n", green("✅"), bold(preset.DisplayName))
 	if selectedModel != nil {
 		fmt.Printf("  %s: %s (%s)\n", "Model", blue(selectedModel.DisplayName), gray(selectedModel.Model))
-		fmt.Printf("  %s: %d tokens\n", "Max Tokens", selectedModel.MaxTokens)
+		fmt.Printf("  %s\n", formatModelLimits(selectedModel.Capabilities()))
 		fmt.Printf("  %s: %.1f\n", "Temperature", selectedModel.Temperature)
 	}
 	fmt.Printf("  %s: %s\n", "Base URL", blue(preset.BaseURL))
@@ -829,7 +1018,7 @@ func (cli *CLI) showModels(providerName string) error {
 		
 		output += fmt.Sprintf("\n%s %s%s:\n", bold("📋"), bold(model.DisplayName), defaultMarker)
 		output += fmt.Sprintf("  %s: %s\n", "Model ID", blue(model.Model))
-		output += fmt.Sprintf("  %s: %d tokens\n", "Max Tokens", model.MaxTokens)
+		output += fmt.Sprintf("  %s\n", formatModelLimits(model.Capabilities()))
 		output += fmt.Sprintf("  %s: %.1f\n", "Temperature", model.Temperature)
 		
 		// Show usage example
@@ -874,7 +1063,7 @@ func (cli *CLI) selectProvider(providerName, modelName string) error {
 	fmt.Printf("%s Successfully selected %s provider\n", green("✅"), bold(preset.DisplayName))
 	if selectedModel != nil {
 		fmt.Printf("  %s: %s (%s)\n", "Model", blue(selectedModel.DisplayName), gray(selectedModel.Model))
-		fmt.Printf("  %s: %d tokens\n", "Max Tokens", selectedModel.MaxTokens)
+		fmt.Printf("  %s\n", formatModelLimits(selectedModel.Capabilities()))
 		fmt.Printf("  %s: %.1f\n", "Temperature", selectedModel.Temperature)
 	}
 	fmt.Printf("  %s: %s\n", "Base URL", blue(preset.BaseURL))
@@ -934,7 +1123,8 @@ func (cli *CLI) setSearchKey(apiKey string) error {
 func runCobraCLI() {
 	rootCmd := NewRootCommand()
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Printf("%s %v\n", red("Error:"), err)
+		// 错误写到 stderr，保持 stdout 可以直接交给管道处理
+		fmt.Fprintf(os.Stderr, "%s %v\n", red("Error:"), err)
 		os.Exit(1)
 	}
 }
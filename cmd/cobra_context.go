@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"alex/internal/agent"
+)
+
+// newContextCommand creates the command that shows what the model sees next
+func newContextCommand(cli *CLI) *cobra.Command {
+	var sessionID string
+	var raw bool
+
+	cmd := &cobra.Command{
+		Use:   "context [task]",
+		Short: "🔍 Show the context the model sees next",
+		Long: `Rebuild the request the agent would send first for the next task: the system prompt
+with the ALEX.md memory, the session history and the tool definitions. Shows the
+estimated tokens of each section and marks the messages in the cacheable prefix.
+A task, when given, is added as the next user message without being saved.`,
+		Example: `  alex context --session session_123
+  alex context --session session_123 --json > request.json
+  alex context "add a --dry-run flag"`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := cli.initialize(cmd); err != nil {
+				return err
+			}
+			if sessionID != "" {
+				if _, err := cli.agent.RestoreSession(sessionID); err != nil {
+					return fmt.Errorf("failed to load session %s: %w", sessionID, err)
+				}
+			}
+			task := ""
+			if len(args) > 0 {
+				task = args[0]
+			}
+			return cli.showContext(task, raw)
+		},
+	}
+	cmd.Flags().StringVarP(&sessionID, "session", "s", "", "Session to inspect (default: a new session)")
+	cmd.Flags().BoolVar(&raw, "json", false, "Print the raw JSON request instead of the breakdown")
+	return cmd
+}
+
+// showContext prints the next request of the current session
+func (cli *CLI) showContext(task string, raw bool) error {
+	snapshot, err := cli.agent.InspectContext(context.Background(), task)
+	if err != nil {
+		return err
+	}
+	if raw {
+		data, err := json.MarshalIndent(snapshot.Request, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Print(formatContextSnapshot(snapshot))
+	return nil
+}
+
+// formatContextSnapshot renders the token breakdown and the message list of a snapshot;
+// the TUI shows the same text for /context
+func formatContextSnapshot(snapshot *agent.ContextSnapshot) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Context for session %s (model %s, compression %s)\n\n", snapshot.SessionID, snapshot.Model, snapshot.Strategy)
+
+	for _, section := range snapshot.Sections {
+		line := fmt.Sprintf("  %-18s %7d tokens", section.Name, section.Tokens)
+		if section.Messages > 0 {
+			line += fmt.Sprintf("  (%d messages)", section.Messages)
+		}
+		b.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&b, "  %-18s %7d tokens\n", "Total", snapshot.TotalTokens)
+	fmt.Fprintf(&b, "  %-18s %7d tokens  (tools and the first %d messages)\n", "Cacheable prefix", snapshot.CacheablePrefixTokens, snapshot.CacheablePrefix)
+
+	b.WriteString("\nMessages (* = cacheable prefix):\n")
+	for _, msg := range snapshot.Messages {
+		marker := " "
+		if msg.Cacheable {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %3d %-9s %6d  %s\n", marker, msg.Index, msg.Role, msg.Tokens, msg.Preview)
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,9 @@ import (
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
+
+	"alex/internal/checkpoint"
+	"alex/internal/session"
 )
 
 
@@ -75,6 +79,33 @@ func newSessionCommand(cli *CLI) *cobra.Command {
 		},
 	}
 
+	// session rewind
+	rewindCmd := &cobra.Command{
+		Use:   "rewind <session-id>",
+		Short: "Undo file changes made by the agent",
+		Long: `Restore files modified by the agent to an earlier checkpoint.
+
+Without --to-iteration the most recent checkpoint is undone.
+Use --to-iteration 0 to undo every change made in the session.
+
+Only changes made with file_edit and file_replace are checkpointed; files
+changed by bash commands or MCP tools are not restored. A session cannot be
+rewound while a task is still running in it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if list, _ := cmd.Flags().GetBool("list"); list {
+				return cli.listCheckpoints(args[0])
+			}
+			toIteration := -1
+			if cmd.Flags().Changed("to-iteration") {
+				toIteration, _ = cmd.Flags().GetInt("to-iteration")
+			}
+			return cli.rewindSession(args[0], toIteration)
+		},
+	}
+	rewindCmd.Flags().Int("to-iteration", 0, "Restore files to their state after this iteration")
+	rewindCmd.Flags().Bool("list", false, "List available checkpoints instead of rewinding")
+
 	// session interactive
 	interactiveCmd := &cobra.Command{
 		Use:     "interactive",
@@ -86,7 +117,7 @@ func newSessionCommand(cli *CLI) *cobra.Command {
 		},
 	}
 
-	sessionCmd.AddCommand(listCmd, showCmd, resumeCmd, deleteCmd, cleanupCmd, interactiveCmd)
+	sessionCmd.AddCommand(listCmd, showCmd, resumeCmd, deleteCmd, cleanupCmd, rewindCmd, interactiveCmd)
 	return sessionCmd
 }
 
@@ -123,11 +154,14 @@ func (cli *CLI) listSessions() error {
 				continue
 			}
 
+			tokens, cost := readSessionUsage(filepath.Join(sessionsDir, entry.Name()))
 			dateKey := info.ModTime().Format("2006-01-02")
 			sessionsByDate[dateKey] = append(sessionsByDate[dateKey], sessionInfo{
 				ID:       sessionID,
 				Modified: info.ModTime(),
 				Size:     info.Size(),
+				Tokens:   tokens,
+				Cost:     cost,
 			})
 		}
 	}
@@ -138,10 +172,14 @@ func (cli *CLI) listSessions() error {
 		for _, session := range sessions {
 			timeStr := session.Modified.Format("15:04:05")
 			sizeStr := formatFileSize(session.Size)
+			details := fmt.Sprintf("%s, %s", timeStr, sizeStr)
+			if session.Tokens > 0 {
+				details += fmt.Sprintf(", %d tokens, $%.4f", session.Tokens, session.Cost)
+			}
 			fmt.Printf("  %s %s %s\n",
 				blue("•"),
 				session.ID,
-				gray(fmt.Sprintf("(%s, %s)", timeStr, sizeStr)))
+				gray("("+details+")"))
 		}
 		fmt.Println()
 	}
@@ -191,7 +229,21 @@ func (cli *CLI) deleteSession(sessionID string) error {
 		return nil
 	}
 
-	// TODO: Implement actual session deletion
+	manager, err := session.NewManager()
+	if err != nil {
+		return err
+	}
+	if err := manager.DeleteSession(sessionID); err != nil {
+		return err
+	}
+	// 会话的文件检查点一起删除
+	store, err := checkpoint.NewStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Remove(sessionID); err != nil {
+		fmt.Printf("%s Failed to remove checkpoints: %v\n", yellow("⚠️"), err)
+	}
 	fmt.Printf("%s Session '%s' deleted\n", green("✅"), sessionID)
 	return nil
 }
@@ -200,9 +252,116 @@ func (cli *CLI) deleteSession(sessionID string) error {
 func (cli *CLI) cleanupSessions() error {
 	fmt.Printf("%s Cleaning up old sessions...\n", blue("🧹"))
 
-	// TODO: Implement actual cleanup logic
-	fmt.Printf("%s Removed 3 sessions older than 30 days\n", green("✅"))
-	fmt.Printf("%s Cleaned up 1.2MB of storage\n", green("✅"))
+	manager, err := session.NewManager()
+	if err != nil {
+		return err
+	}
+	before, _ := manager.ListSessions()
+	// 过期会话连同它们的 todo 文件和保存的工具输出一起删除
+	if err := manager.CleanupExpiredSessions(sessionMaxAge); err != nil {
+		return err
+	}
+	after, _ := manager.ListSessions()
+	fmt.Printf("%s Removed %d sessions older than 30 days\n", green("✅"), len(before)-len(after))
+
+	removed, err := removeOrphanCheckpoints(after)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		fmt.Printf("%s Removed checkpoints of %d deleted sessions\n", green("✅"), removed)
+	}
+	return nil
+}
+
+// removeOrphanCheckpoints deletes the checkpoints of sessions that no longer exist
+func removeOrphanCheckpoints(sessionIDs []string) (int, error) {
+	store, err := checkpoint.NewStore()
+	if err != nil {
+		return 0, err
+	}
+	checkpointed, err := store.Sessions()
+	if err != nil {
+		return 0, err
+	}
+
+	existing := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		existing[id] = true
+	}
+	removed := 0
+	for _, id := range checkpointed {
+		if existing[id] {
+			continue
+		}
+		// 正在运行的会话可能还没有保存，Remove 会跳过它
+		if err := store.Remove(id); err != nil {
+			fmt.Printf("%s Kept checkpoints of session %s: %v\n", yellow("⚠️"), id, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// sessionMaxAge - session cleanup 删除超过这个时间未更新的会话
+const sessionMaxAge = 30 * 24 * time.Hour
+
+// listCheckpoints displays the file checkpoints recorded for a session
+func (cli *CLI) listCheckpoints(sessionID string) error {
+	store, err := checkpoint.NewStore()
+	if err != nil {
+		return err
+	}
+
+	checkpoints, err := store.List(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	if len(checkpoints) == 0 {
+		fmt.Printf("%s No checkpoints for session %s\n", yellow("⚠️"), sessionID)
+		return nil
+	}
+
+	fmt.Printf("\n%s Checkpoints for %s:\n", bold("⏪"), blue(sessionID))
+	for _, cp := range checkpoints {
+		fmt.Printf("  %s iteration %d %s\n", blue("•"), cp.Iteration, gray(cp.Timestamp.Format("2006-01-02 15:04:05")))
+		for _, file := range cp.Files {
+			fmt.Printf("      %s\n", file)
+		}
+	}
+	return nil
+}
+
+// rewindSession restores files to an earlier checkpoint; a negative iteration undoes the latest one
+func (cli *CLI) rewindSession(sessionID string, toIteration int) error {
+	store, err := checkpoint.NewStore()
+	if err != nil {
+		return err
+	}
+
+	var restored []string
+	if toIteration < 0 {
+		var iteration int
+		iteration, restored, err = store.Undo(sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to rewind session: %w", err)
+		}
+		fmt.Printf("%s Undid iteration %d\n", green("✅"), iteration)
+	} else {
+		restored, err = store.Rewind(sessionID, toIteration)
+		if err != nil {
+			return fmt.Errorf("failed to rewind session: %w", err)
+		}
+		fmt.Printf("%s Rewound to iteration %d\n", green("✅"), toIteration)
+	}
+
+	if len(restored) == 0 {
+		fmt.Printf("%s No files needed to be restored\n", gray("💡"))
+	}
+	for _, path := range restored {
+		fmt.Printf("  %s %s\n", blue("↺"), path)
+	}
 	return nil
 }
 
@@ -291,5 +450,23 @@ type sessionInfo struct {
 	ID       string
 	Modified time.Time
 	Size     int64
+	Tokens   int
+	Cost     float64
+}
+
+// readSessionUsage reads the accumulated token usage and cost from a session file
+func readSessionUsage(path string) (int, float64) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	var usage struct {
+		TokensUsed int     `json:"tokens_used"`
+		Cost       float64 `json:"cost"`
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return 0, 0
+	}
+	return usage.TokensUsed, usage.Cost
 }
 
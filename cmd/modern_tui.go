@@ -14,6 +14,7 @@ import (
 	"alex/internal/agent"
 	"alex/internal/config"
 	"alex/internal/context/message"
+	"alex/internal/permissions"
 )
 
 // Modern TUI with clean, professional interface
@@ -76,6 +77,11 @@ type (
 	processingDoneMsg struct{}
 	errorOccurredMsg  struct{ err error }
 	tickerMsg         struct{}
+	// permissionRequestMsg asks the user to approve a tool call; the answer is sent on reply
+	permissionRequestMsg struct {
+		req   permissions.Request
+		reply chan permissions.Approval
+	}
 )
 
 // ModernChatModel represents the clean TUI model
@@ -91,10 +97,11 @@ type ModernChatModel struct {
 	currentInput        string
 	execTimer           ExecutionTimer
 	program             *tea.Program
-	currentMessage      *ChatMessage    // Track current streaming message
-	sessionStartTime    time.Time       // Track session start time
-	contentBuffer       strings.Builder // Buffer for accumulating streaming content
-	lastRenderedContent string          // Last rendered markdown content to avoid re-rendering
+	currentMessage      *ChatMessage          // Track current streaming message
+	sessionStartTime    time.Time             // Track session start time
+	contentBuffer       strings.Builder       // Buffer for accumulating streaming content
+	lastRenderedContent string                // Last rendered markdown content to avoid re-rendering
+	pendingPermission   *permissionRequestMsg // Tool call waiting for approval
 }
 
 // ChatMessage represents a chat message with type and content
@@ -138,7 +145,7 @@ func NewModernChatModel(agent *agent.ReactAgent, config *config.Manager) *Modern
 		},
 		{
 			Type:    "system",
-			Content: "💡 Type your coding questions and press Enter to get help",
+			Content: "💡 Type your coding questions and press Enter to get help (/undo reverts the last file changes, /context shows what the model sees)",
 			Time:    welcomeTime,
 		},
 	}
@@ -214,6 +221,11 @@ func (m *ModernChatModel) Init() tea.Cmd {
 func (m *ModernChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var tiCmd tea.Cmd
 
+	// While a permission prompt is open, keys answer the prompt instead of editing input
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.pendingPermission != nil {
+		return m.handlePermissionKey(keyMsg)
+	}
+
 	m.textarea, tiCmd = m.textarea.Update(msg)
 
 	switch msg := msg.(type) {
@@ -235,11 +247,26 @@ func (m *ModernChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.KeyCtrlC:
 			return m, tea.Quit
 		case tea.KeyEnter:
+			// 任务运行中撤销会和正在进行的文件修改竞争
+			if m.processing && strings.TrimSpace(m.textarea.Value()) == "/undo" {
+				m.textarea.Reset()
+				m.addMessage(ChatMessage{Type: "system", Content: "⚠️ Wait for the current task to finish before using /undo", Time: time.Now()})
+				return m, nil
+			}
 			if !m.processing && m.textarea.Value() != "" {
 				input := strings.TrimSpace(m.textarea.Value())
 				m.currentInput = input
 				m.textarea.Reset()
 
+				if input == "/undo" {
+					m.undoLastCheckpoint()
+					return m, nil
+				}
+				if input == "/context" {
+					m.showContext()
+					return m, nil
+				}
+
 				// Add user message
 				m.addMessage(ChatMessage{
 					Type:    "user",
@@ -372,6 +399,15 @@ func (m *ModernChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.execTimer.Duration = time.Since(m.execTimer.StartTime)
 		}
 
+	case permissionRequestMsg:
+		m.pendingPermission = &msg
+		m.addMessage(ChatMessage{
+			Type:    "system",
+			Content: formatPermissionRequest(msg.req),
+			Time:    time.Now(),
+		})
+		return m, nil
+
 	case errorOccurredMsg:
 		// Remove processing message
 		if len(m.messages) > 0 && m.messages[len(m.messages)-1].Type == "processing" {
@@ -397,6 +433,73 @@ func (m *ModernChatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tiCmd
 }
 
+// undoLastCheckpoint reverts the file changes of the agent's most recent iteration
+func (m *ModernChatModel) undoLastCheckpoint() {
+	iteration, restored, err := m.agent.UndoLastCheckpoint()
+	if err != nil {
+		m.addMessage(ChatMessage{Type: "error", Content: fmt.Sprintf("Undo failed: %v", err), Time: time.Now()})
+		return
+	}
+
+	content := fmt.Sprintf("⏪ Undid iteration %d", iteration)
+	for _, path := range restored {
+		content += "\n  ↺ " + path
+	}
+	m.addMessage(ChatMessage{Type: "system", Content: content, Time: time.Now()})
+}
+
+// showContext shows the token breakdown of the context the model sees next
+func (m *ModernChatModel) showContext() {
+	snapshot, err := m.agent.InspectContext(context.Background(), "")
+	if err != nil {
+		m.addMessage(ChatMessage{Type: "error", Content: fmt.Sprintf("Context inspection failed: %v", err), Time: time.Now()})
+		return
+	}
+	m.addMessage(ChatMessage{Type: "system", Content: formatContextSnapshot(snapshot), Time: time.Now()})
+}
+
+// handlePermissionKey answers the pending permission prompt
+func (m *ModernChatModel) handlePermissionKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	approval := permissions.ApprovalDeny
+	switch msg.String() {
+	case "1", "y":
+		approval = permissions.ApprovalOnce
+	case "2", "s":
+		approval = permissions.ApprovalSession
+	case "3", "a":
+		approval = permissions.ApprovalAlways
+	case "4", "n", "esc":
+	case "ctrl+c":
+		m.pendingPermission.reply <- permissions.ApprovalDeny
+		m.pendingPermission = nil
+		return m, tea.Quit
+	default:
+		return m, nil
+	}
+
+	m.pendingPermission.reply <- approval
+	m.pendingPermission = nil
+	for _, choice := range permissionChoices {
+		if choice.approval == approval {
+			m.addMessage(ChatMessage{Type: "system", Content: "🔐 " + choice.label, Time: time.Now()})
+		}
+	}
+	return m, nil
+}
+
+// requestPermission is the agent's permission prompter; it blocks until the user answers
+func (m *ModernChatModel) requestPermission(ctx context.Context, req permissions.Request) (permissions.Approval, error) {
+	reply := make(chan permissions.Approval, 1)
+	m.program.Send(permissionRequestMsg{req: req, reply: reply})
+
+	select {
+	case approval := <-reply:
+		return approval, nil
+	case <-ctx.Done():
+		return permissions.ApprovalDeny, ctx.Err()
+	}
+}
+
 func (m *ModernChatModel) addMessage(msg ChatMessage) {
 	m.messages = append(m.messages, msg)
 }
@@ -413,10 +516,20 @@ func (m *ModernChatModel) processUserInput(input string) tea.Cmd {
 
 		// Start processing and send immediate start message
 		go func() {
+			// Reasoning is collapsed into one line per block
+			reasoningChars := 0
 			streamCallback := func(chunk agent.StreamChunk) {
+				if chunk.Type != "reasoning" && reasoningChars > 0 {
+					m.program.Send(streamChunkMsg{content: fmt.Sprintf("💭 Thought for %d chars\n", reasoningChars)})
+					reasoningChars = 0
+				}
+
 				// Send each chunk immediately as it arrives
 				var content string
 				switch chunk.Type {
+				case "reasoning":
+					reasoningChars += len([]rune(chunk.Content))
+					return
 				case "status":
 					if chunk.Content != "" {
 						content = "📋 " + chunk.Content + "\n"
@@ -438,7 +551,10 @@ func (m *ModernChatModel) processUserInput(input string) tea.Cmd {
 						content = "❌ " + chunk.Content + "\n"
 					}
 				case "final_answer":
-					if chunk.Content != "" {
+					if isStreamedChunk(chunk) {
+						// Already shown through llm_content deltas
+						content = "\n"
+					} else if chunk.Content != "" {
 						content = "✨ " + chunk.Content + "\n"
 					}
 				case "llm_content":
@@ -449,9 +565,13 @@ func (m *ModernChatModel) processUserInput(input string) tea.Cmd {
 					if chunk.Content != "" {
 						content = "✅ " + chunk.Content + "\n"
 					}
-				case "max_iterations":
+				case "budget_warning", "model_switch":
 					if chunk.Content != "" {
-						content = "⚠️ " + chunk.Content + "\n"
+						content = chunk.Content + "\n"
+					}
+				case "budget_exceeded":
+					if chunk.Content != "" {
+						content = chunk.Content + "\n"
 					}
 				case "context_management":
 					if chunk.Content != "" {
@@ -467,7 +587,12 @@ func (m *ModernChatModel) processUserInput(input string) tea.Cmd {
 				}
 			}
 
-			err := m.agent.ProcessMessageStream(ctx, input, m.config.GetConfig(), streamCallback)
+			// @image.png 提及的图片随消息一起发送
+			images, _ := collectImages(input, nil)
+			if len(images) > 0 {
+				m.program.Send(streamChunkMsg{content: fmt.Sprintf("🖼 Attached %d image(s)\n", len(images))})
+			}
+			err := m.agent.ProcessMessageStreamWithImages(ctx, input, images, m.config.GetConfig(), streamCallback)
 			if err != nil {
 				m.program.Send(errorOccurredMsg{err: err})
 			} else {
@@ -537,7 +662,9 @@ func (m *ModernChatModel) View() string {
 
 	// Input area
 	var inputArea string
-	if m.processing {
+	if m.pendingPermission != nil {
+		inputArea = inputStyle.Render(processingStyle.Render("[1/y] Allow once  [2/s] Allow for session  [3/a] Always allow  [4/n] Deny"))
+	} else if m.processing {
 		inputArea = inputStyle.Render(processingStyle.Render(message.GetRandomProcessingMessageWithEmoji()))
 	} else {
 		inputArea = inputStyle.Render(m.textarea.View())
@@ -629,6 +756,7 @@ func runModernTUI(agent *agent.ReactAgent, config *config.Manager) error {
 
 	// Set the program reference for streaming callbacks
 	model.program = program
+	agent.SetPermissionPrompter(model.requestPermission)
 
 	_, err := program.Run()
 	return err
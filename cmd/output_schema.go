@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"alex/internal/agent"
+	"alex/internal/schema"
+)
+
+// runStructuredPrompt runs a single prompt whose answer must match the JSON Schema at
+// schemaPath. Only the validated JSON goes to stdout so the output can be piped; progress
+// and corrections go to stderr.
+func (cli *CLI) runStructuredPrompt(prompt, schemaPath string) error {
+	outputSchema, err := schema.Load(schemaPath)
+	if err != nil {
+		return err
+	}
+	cli.agent.SetOutputSchema(outputSchema)
+	images, err := collectImages(prompt, cli.imageFlags)
+	if err != nil {
+		return err
+	}
+
+	var answer string
+	callback := func(chunk agent.StreamChunk) {
+		switch chunk.Type {
+		case "final_answer":
+			answer = chunk.Content
+		case "schema_correction":
+			fmt.Fprintf(os.Stderr, "%s Answer does not match the schema, asking for a correction: %s\n", yellow("⚠️"), chunk.Content)
+		case "tool_start", "budget_warning":
+			if cli.verbose {
+				fmt.Fprintln(os.Stderr, chunk.Content)
+			}
+		case "budget_exceeded":
+			fmt.Fprintln(os.Stderr, chunk.Content)
+		}
+	}
+
+	if err := cli.agent.ProcessMessageStreamWithImages(context.Background(), prompt, images, cli.config.GetConfig(), callback); err != nil {
+		return err
+	}
+	if answer == "" {
+		return fmt.Errorf("task stopped before producing an answer")
+	}
+	fmt.Println(answer)
+	return nil
+}
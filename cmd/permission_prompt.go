@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/manifoldco/promptui"
+	"golang.org/x/term"
+
+	"alex/internal/permissions"
+)
+
+// permissionChoices are the answers offered for a tool call that needs approval, in display order
+var permissionChoices = []struct {
+	label    string
+	approval permissions.Approval
+}{
+	{"Allow once", permissions.ApprovalOnce},
+	{"Allow for this session", permissions.ApprovalSession},
+	{"Always allow", permissions.ApprovalAlways},
+	{"Deny", permissions.ApprovalDeny},
+}
+
+// formatPermissionRequest describes a pending tool call and the rule a broader approval would add
+func formatPermissionRequest(req permissions.Request) string {
+	target := req.Tool
+	if req.Subject != "" {
+		target = fmt.Sprintf("%s(%s)", req.Tool, req.Subject)
+	}
+	scope := req.Tool
+	if req.Pattern != "" {
+		scope = fmt.Sprintf("%s(%s)", req.Tool, req.Pattern)
+	}
+	return fmt.Sprintf("🔐 Permission required: %s\n   Session/always approvals apply to %s", target, scope)
+}
+
+// promptPermission asks for approval on the terminal. When stdout is piped the prompt goes to
+// stderr so it does not end up in the output.
+func (cli *CLI) promptPermission(ctx context.Context, req permissions.Request) (permissions.Approval, error) {
+	if err := ctx.Err(); err != nil {
+		return permissions.ApprovalDeny, err
+	}
+
+	out := os.Stdout
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "\n%s\n", yellow(formatPermissionRequest(req)))
+
+	labels := make([]string, len(permissionChoices))
+	for i, choice := range permissionChoices {
+		labels[i] = choice.label
+	}
+
+	prompt := promptui.Select{
+		Label:  "Run this tool call?",
+		Items:  labels,
+		Stdout: nopWriteCloser{out},
+	}
+	index, _, err := prompt.Run()
+	if err != nil {
+		return permissions.ApprovalDeny, err
+	}
+	return permissionChoices[index].approval, nil
+}
+
+// notifyPermissionDenied reports a tool call refused because no one could approve it
+func (cli *CLI) notifyPermissionDenied(req permissions.Request) {
+	target := req.Tool
+	if req.Subject != "" {
+		target = fmt.Sprintf("%s(%s)", req.Tool, req.Subject)
+	}
+	fmt.Fprintf(os.Stderr, "%s Denied %s: it needs approval but no one can be asked (stdin is not a terminal or --non-interactive is set). Allow it with a rule in permissions.rules or set permissions.non_interactive_action.\n", yellow("⛔"), target)
+}
+
+// nopWriteCloser keeps the prompt from closing the stream it writes to
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
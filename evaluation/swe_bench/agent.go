@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"alex/internal/llm"
 )
 
 // This file contains a simplified agent implementation for SWE-bench batch processing
@@ -250,21 +252,7 @@ func (sa *SimpleAgent) estimateTokenUsage(instance Instance) int {
 
 func (sa *SimpleAgent) estimateCost(instance Instance) float64 {
 	tokens := sa.estimateTokenUsage(instance)
-
-	// Mock cost calculation (varies by model)
-	var costPerToken float64
-	switch {
-	case contains(sa.config.Agent.Model.Name, "gpt-4"):
-		costPerToken = 0.00003 // $0.03 per 1K tokens
-	case contains(sa.config.Agent.Model.Name, "gpt-3.5"):
-		costPerToken = 0.000002 // $0.002 per 1K tokens
-	case contains(sa.config.Agent.Model.Name, "deepseek"):
-		costPerToken = 0.0000005 // Very low cost for free tier
-	default:
-		costPerToken = 0.000005 // Default estimate
-	}
-
-	return float64(tokens) * costPerToken
+	return llm.CallCost(sa.config.Agent.Model.Name, llm.Usage{PromptTokens: tokens, TotalTokens: tokens})
 }
 
 // Helper functions
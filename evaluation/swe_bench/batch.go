@@ -7,6 +7,8 @@ import (
 	"math/rand"
 	"sync"
 	"time"
+
+	"alex/internal/llm"
 )
 
 // BatchProcessorImpl implements the BatchProcessor interface
@@ -52,6 +54,9 @@ func (bp *BatchProcessorImpl) ProcessBatch(ctx context.Context, instances []Inst
 	bp.results = make([]WorkerResult, 0, len(instances))
 	bp.mu.Unlock()
 
+	// 所有 worker 共享同一服务商的限流器
+	llm.ConfigureRateLimits(config.Agent.RateLimits)
+
 	// Start monitoring and progress reporting
 	if err := bp.monitor.StartMonitoring(ctx); err != nil {
 		log.Printf("Warning: Failed to start monitoring: %v", err)
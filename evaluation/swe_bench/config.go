@@ -260,6 +260,9 @@ func (cm *ConfigManager) MergeConfigs(base *BatchConfig, override *BatchConfig)
 	if override.Agent.Timeout != 0 {
 		result.Agent.Timeout = override.Agent.Timeout
 	}
+	if len(override.Agent.RateLimits) > 0 {
+		result.Agent.RateLimits = override.Agent.RateLimits
+	}
 
 	// Override dataset configuration
 	if override.Instances.Type != "" {
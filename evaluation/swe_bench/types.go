@@ -2,6 +2,8 @@ package swe_bench
 
 import (
 	"time"
+
+	"alex/internal/llm"
 )
 
 // Instance represents a single SWE-Bench problem instance
@@ -50,6 +52,9 @@ type BatchConfig struct {
 		MaxTurns  int     `json:"max_turns,omitempty" yaml:"max_turns,omitempty"`
 		CostLimit float64 `json:"cost_limit,omitempty" yaml:"cost_limit,omitempty"`
 		Timeout   int     `json:"timeout,omitempty" yaml:"timeout,omitempty"` // seconds
+
+		// Rate limits shared by all workers, keyed by provider host
+		RateLimits map[string]llm.RateLimits `json:"rate_limits,omitempty" yaml:"rate_limits,omitempty"`
 	} `json:"agent" yaml:"agent"`
 
 	// Dataset configuration
@@ -185,6 +190,8 @@ func DefaultBatchConfig() *BatchConfig {
 			MaxTurns  int     `json:"max_turns,omitempty" yaml:"max_turns,omitempty"`
 			CostLimit float64 `json:"cost_limit,omitempty" yaml:"cost_limit,omitempty"`
 			Timeout   int     `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+			RateLimits map[string]llm.RateLimits `json:"rate_limits,omitempty" yaml:"rate_limits,omitempty"`
 		}{
 			Model: struct {
 				Name        string  `json:"name" yaml:"name"`
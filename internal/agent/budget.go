@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"alex/internal/llm"
+	"alex/pkg/types"
+)
+
+// budgetWarningRatio - 资源消耗达到上限的该比例时向模型发出警告
+const budgetWarningRatio = 0.8
+
+// BudgetLimits - 单个任务的资源上限，0表示不限制
+type BudgetLimits struct {
+	MaxIterations int
+	MaxTokens     int
+	MaxCost       float64
+	MaxDuration   time.Duration
+}
+
+// BudgetLimitsFromConfig - 从ReAct配置构建预算上限
+func BudgetLimitsFromConfig(cfg *types.ReactConfig) BudgetLimits {
+	if cfg == nil {
+		return BudgetLimits{}
+	}
+	return BudgetLimits{
+		MaxIterations: cfg.MaxIterations,
+		MaxTokens:     cfg.MaxTaskTokens,
+		MaxCost:       cfg.MaxTaskCost,
+		MaxDuration:   cfg.TaskTimeout,
+	}
+}
+
+// BudgetGovernor - 跟踪单个任务的迭代次数、token、费用和耗时
+type BudgetGovernor struct {
+	limits           BudgetLimits
+	startTime        time.Time
+	iterations       int
+	promptTokens     int
+	completionTokens int
+	cost             float64
+	warned           map[string]bool
+}
+
+// NewBudgetGovernor - 创建预算管理器
+func NewBudgetGovernor(limits BudgetLimits) *BudgetGovernor {
+	return &BudgetGovernor{
+		limits:    limits,
+		startTime: time.Now(),
+		warned:    make(map[string]bool),
+	}
+}
+
+// Limits - 返回当前的预算上限
+func (b *BudgetGovernor) Limits() BudgetLimits {
+	return b.limits
+}
+
+// StartIteration - 记录新一轮迭代的开始
+func (b *BudgetGovernor) StartIteration() {
+	b.iterations++
+}
+
+// RecordUsage - 记录一次LLM调用的token消耗和费用
+func (b *BudgetGovernor) RecordUsage(promptTokens, completionTokens int, cost float64) {
+	b.promptTokens += promptTokens
+	b.completionTokens += completionTokens
+	b.cost += cost
+}
+
+// Iterations - 已开始的迭代次数
+func (b *BudgetGovernor) Iterations() int {
+	return b.iterations
+}
+
+// TotalTokens - 累计token消耗
+func (b *BudgetGovernor) TotalTokens() int {
+	return b.promptTokens + b.completionTokens
+}
+
+// Cost - 累计费用（美元）
+func (b *BudgetGovernor) Cost() float64 {
+	return b.cost
+}
+
+// Elapsed - 任务已耗时
+func (b *BudgetGovernor) Elapsed() time.Duration {
+	return time.Since(b.startTime)
+}
+
+// Deadline - 任务的截止时间，未设置时间上限时返回false
+func (b *BudgetGovernor) Deadline() (time.Time, bool) {
+	if b.limits.MaxDuration <= 0 {
+		return time.Time{}, false
+	}
+	return b.startTime.Add(b.limits.MaxDuration), true
+}
+
+// CanStartIteration - 检查是否还能开始下一轮迭代
+func (b *BudgetGovernor) CanStartIteration() bool {
+	return b.limits.MaxIterations <= 0 || b.iterations < b.limits.MaxIterations
+}
+
+// Exceeded - 返回第一个已超出的预算项描述，未超出时返回空字符串
+func (b *BudgetGovernor) Exceeded() string {
+	if b.limits.MaxTokens > 0 && b.TotalTokens() >= b.limits.MaxTokens {
+		return fmt.Sprintf("token budget exhausted (%d/%d tokens)", b.TotalTokens(), b.limits.MaxTokens)
+	}
+	if b.limits.MaxCost > 0 && b.cost >= b.limits.MaxCost {
+		return fmt.Sprintf("cost budget exhausted ($%.4f/$%.4f)", b.cost, b.limits.MaxCost)
+	}
+	if b.limits.MaxDuration > 0 && b.Elapsed() >= b.limits.MaxDuration {
+		return fmt.Sprintf("time budget exhausted (%s/%s)", b.Elapsed().Round(time.Second), b.limits.MaxDuration)
+	}
+	return ""
+}
+
+// Warnings - 返回新接近上限的预算项提示，每项只提示一次
+func (b *BudgetGovernor) Warnings() []string {
+	var warnings []string
+
+	check := func(key string, used, limit float64, format string) {
+		if limit <= 0 || b.warned[key] || used < limit*budgetWarningRatio {
+			return
+		}
+		b.warned[key] = true
+		warnings = append(warnings, fmt.Sprintf(format, used, limit))
+	}
+
+	check("iterations", float64(b.iterations), float64(b.limits.MaxIterations), "iterations: %.0f of %.0f used")
+	check("tokens", float64(b.TotalTokens()), float64(b.limits.MaxTokens), "tokens: %.0f of %.0f used")
+	check("cost", b.cost, b.limits.MaxCost, "cost: $%.4f of $%.4f used")
+	check("time", b.Elapsed().Seconds(), b.limits.MaxDuration.Seconds(), "time: %.0fs of %.0fs used")
+
+	return warnings
+}
+
+// WarningMessage - 构建注入给模型的预算警告
+func (b *BudgetGovernor) WarningMessage(warnings []string) string {
+	return fmt.Sprintf("⚠️ Budget notice: you are close to this task's limits (%s). "+
+		"Wrap up: avoid exploratory tool calls and give your final answer as soon as possible.",
+		strings.Join(warnings, "; "))
+}
+
+// Summary - 预算使用情况的单行摘要
+func (b *BudgetGovernor) Summary() string {
+	return fmt.Sprintf("%d iterations, %d tokens, ~$%.4f, %s",
+		b.iterations, b.TotalTokens(), b.cost, b.Elapsed().Round(time.Second))
+}
+
+// buildPartialResult - 预算耗尽时根据已执行的步骤生成部分结果摘要
+func buildPartialResult(taskCtx *types.ReactTaskContext, reason string, budget *BudgetGovernor) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⚠️ Task stopped before completion: %s.\n\n", reason))
+	sb.WriteString(fmt.Sprintf("Budget used: %s.\n", budget.Summary()))
+
+	if len(taskCtx.History) == 0 {
+		sb.WriteString("\nNo steps were completed.")
+		return sb.String()
+	}
+
+	sb.WriteString("\nProgress so far:\n")
+	var lastThought string
+	for _, step := range taskCtx.History {
+		if step.Thought != "" {
+			lastThought = step.Thought
+		}
+		if len(step.ToolCall) == 0 {
+			continue
+		}
+		var calls []string
+		for _, tc := range step.ToolCall {
+			calls = append(calls, tc.Name)
+		}
+		failed := 0
+		for _, result := range step.Result {
+			if result != nil && !result.Success {
+				failed++
+			}
+		}
+		line := fmt.Sprintf("- Step %d: %s", step.Number, strings.Join(calls, ", "))
+		if failed > 0 {
+			line += fmt.Sprintf(" (%d failed)", failed)
+		}
+		sb.WriteString(line + "\n")
+	}
+
+	if lastThought != "" {
+		runes := []rune(lastThought)
+		if len(runes) > 500 {
+			lastThought = string(runes[:500]) + "..."
+		}
+		sb.WriteString("\nLast reasoning:\n" + lastThought + "\n")
+	}
+
+	return sb.String()
+}
+
+// callCost - 按价格表计算一次调用的费用（美元），响应中的模型不在价格表中时按配置的模型计价
+func callCost(servedModel, configuredModel string, usage llm.Usage) float64 {
+	if _, known := llm.LookupPrice(servedModel); known || configuredModel == "" {
+		return llm.CallCost(servedModel, usage)
+	}
+	return llm.CallCost(configuredModel, usage)
+}
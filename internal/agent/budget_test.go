@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"alex/internal/config"
+	"alex/pkg/types"
+)
+
+// TestBudgetGovernor_Limits 测试预算警告和超限判断
+func TestBudgetGovernor_Limits(t *testing.T) {
+	budget := NewBudgetGovernor(BudgetLimits{MaxIterations: 5, MaxTokens: 1000})
+
+	for i := 0; i < 3; i++ {
+		budget.StartIteration()
+	}
+	budget.RecordUsage(500, 100, 0.001)
+	if warnings := budget.Warnings(); len(warnings) != 0 {
+		t.Errorf("expected no warnings below threshold, got %v", warnings)
+	}
+
+	budget.StartIteration()
+	budget.RecordUsage(200, 50, 0.0005)
+	warnings := budget.Warnings()
+	if len(warnings) != 2 {
+		t.Fatalf("expected iteration and token warnings, got %v", warnings)
+	}
+	if again := budget.Warnings(); len(again) != 0 {
+		t.Errorf("warnings should only be reported once, got %v", again)
+	}
+	if reason := budget.Exceeded(); reason != "" {
+		t.Errorf("budget should not be exceeded yet: %s", reason)
+	}
+
+	budget.RecordUsage(200, 0, 0.0002)
+	if reason := budget.Exceeded(); !strings.Contains(reason, "token budget") {
+		t.Errorf("expected token budget to be exceeded, got %q", reason)
+	}
+
+	budget.StartIteration()
+	if budget.CanStartIteration() {
+		t.Error("expected iteration limit to be reached")
+	}
+	if cost := budget.Cost(); cost < 0.00169 || cost > 0.00171 {
+		t.Errorf("expected recorded costs to accumulate, got %v", cost)
+	}
+}
+
+// TestBudgetGovernor_Unlimited 测试未设置上限时不受限制
+func TestBudgetGovernor_Unlimited(t *testing.T) {
+	budget := NewBudgetGovernor(BudgetLimitsFromConfig(&types.ReactConfig{}))
+	for i := 0; i < 100; i++ {
+		budget.StartIteration()
+		budget.RecordUsage(100000, 100000, 1)
+	}
+	if !budget.CanStartIteration() || budget.Exceeded() != "" || len(budget.Warnings()) != 0 {
+		t.Error("zero limits should be treated as unlimited")
+	}
+	if _, ok := budget.Deadline(); ok {
+		t.Error("expected no deadline without a time limit")
+	}
+}
+
+// TestBuildPartialResult 测试预算耗尽时的部分结果摘要
+func TestBuildPartialResult(t *testing.T) {
+	taskCtx := &types.ReactTaskContext{
+		History: []types.ReactExecutionStep{
+			{
+				Number:   1,
+				Thought:  "Reading the config first",
+				ToolCall: []*types.ReactToolCall{{Name: "file_read"}},
+				Result:   []*types.ReactToolResult{{Success: true}},
+			},
+			{
+				Number:   2,
+				ToolCall: []*types.ReactToolCall{{Name: "bash"}},
+				Result:   []*types.ReactToolResult{{Success: false}},
+			},
+		},
+	}
+	budget := NewBudgetGovernor(BudgetLimits{MaxDuration: time.Minute})
+
+	summary := buildPartialResult(taskCtx, "iteration limit reached (2 iterations)", budget)
+	for _, want := range []string{"iteration limit reached", "Step 1: file_read", "Step 2: bash (1 failed)", "Reading the config first"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+}
+
+// TestNewReactConfigFromManager 测试未配置时不改变迭代上限和超时的默认行为
+func TestNewReactConfigFromManager(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	configMgr, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = configMgr.Set("max_turns", 0)
+
+	reactConfig := newReactConfigFromManager(configMgr)
+	if reactConfig.MaxIterations != defaultMaxTurns || reactConfig.TaskTimeout != 0 {
+		t.Errorf("expected %d iterations and no timeout, got %d and %v", defaultMaxTurns, reactConfig.MaxIterations, reactConfig.TaskTimeout)
+	}
+
+	_ = configMgr.Set("max_turns", 8)
+	_ = configMgr.Set("task_timeout", 60)
+	reactConfig = newReactConfigFromManager(configMgr)
+	if reactConfig.MaxIterations != 8 || reactConfig.TaskTimeout != time.Minute {
+		t.Errorf("expected configured limits, got %d and %v", reactConfig.MaxIterations, reactConfig.TaskTimeout)
+	}
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"alex/internal/llm"
+	"alex/internal/session"
+	"alex/pkg/types"
+)
+
+// ContextSnapshot is the request ReactCore would send for the next step of a task,
+// with a token breakdown for inspecting what the model sees
+type ContextSnapshot struct {
+	SessionID string
+	Model     string
+	Strategy  string
+	// Request is the chat request as ReactCore builds it, before provider-specific encoding
+	Request  *llm.ChatRequest
+	Sections []ContextSection
+	Messages []ContextMessage
+	// CacheablePrefix is the number of leading messages in the stable prefix that providers cache
+	CacheablePrefix       int
+	CacheablePrefixTokens int
+	TotalTokens           int
+}
+
+// ContextSection is a part of the request and its estimated tokens
+type ContextSection struct {
+	Name     string
+	Tokens   int
+	Messages int
+}
+
+// ContextMessage describes one message of the request
+type ContextMessage struct {
+	Index     int
+	Role      string
+	Tokens    int
+	Cacheable bool
+	Preview   string
+}
+
+// InspectContext rebuilds the request the next task would send first: the system prompt with
+// the ALEX.md memory and the repository map, the session history and the tool definitions,
+// routed like the first iteration. task, when not empty, is added as the next user message
+// without saving it. Like the first iteration, the history is not compressed; the inspection
+// does not call any model or write anything.
+func (r *ReactAgent) InspectContext(ctx context.Context, task string) (*ContextSnapshot, error) {
+	r.mu.RLock()
+	sess := r.currentSession
+	r.mu.RUnlock()
+	if sess == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+	core, ok := r.reactCore.(*ReactCore)
+	if !ok {
+		return nil, fmt.Errorf("context inspection is not supported by this ReAct core")
+	}
+	return core.inspectContext(ctx, sess, task)
+}
+
+// inspectContext - 按 SolveTask 第一次迭代的方式构建请求，但不调用模型、不修改会话
+func (rc *ReactCore) inspectContext(ctx context.Context, sess *session.Session, task string) (*ContextSnapshot, error) {
+	taskCtx := types.NewReactTaskContext(generateTaskID(), task)
+	systemPrompt := rc.buildSystemPrompt(taskCtx)
+
+	history := sess.GetMessages()
+	if task != "" {
+		history = append(history, &session.Message{Role: "user", Content: task, Timestamp: time.Now()})
+	}
+	rc.selectCompressionStrategy()
+
+	route := rc.router.RouteIteration(1, 0)
+	messages := []llm.Message{{Role: "system", Content: systemPrompt}}
+	messages = append(messages, rc.sessionHistory(history)...)
+
+	request := rc.newChatRequest(messages, rc.toolHandler.buildToolDefinitions(), route)
+	request.Model = route.Model
+	// 和发送前一样按剩余的上下文窗口调低 max_tokens
+	if err := rc.llmHandler.validateLLMRequest(request); err != nil {
+		log.Printf("[WARN] ReactCore: the next request would be rejected: %v", err)
+	}
+
+	estimator := rc.messageProcessor.TokenEstimator()
+	snapshot := &ContextSnapshot{
+		SessionID:       sess.ID,
+		Model:           route.Model,
+		Strategy:        rc.messageProcessor.CompressionStrategy(),
+		Request:         request,
+		CacheablePrefix: llm.CacheablePrefixLen(messages),
+	}
+
+	// ALEX.md 已渲染在系统提示中，单独列出它的 token
+	memoryTokens := 0
+	builder := rc.promptHandler.promptBuilder
+	if _, err := os.Stat(filepath.Join(taskCtx.WorkingDir, "ALEX.md")); err == nil && builder != nil && builder.promptLoader != nil {
+		if memory := builder.promptLoader.ProjectMemory(taskCtx.WorkingDir); strings.Contains(systemPrompt, memory) {
+			memoryTokens = estimator.EstimateString(memory)
+		}
+	}
+	repoMapTokens := 0
+	if taskCtx.RepoMap != "" {
+		repoMapTokens = estimator.EstimateString(taskCtx.RepoMap)
+	}
+
+	var systemTokens, historyTokens, systemCount int
+	for i, msg := range messages {
+		tokens := estimator.EstimateLLMMessages([]llm.Message{msg})
+		if msg.Role == "system" {
+			systemTokens += tokens
+			systemCount++
+		} else {
+			historyTokens += tokens
+		}
+		cacheable := i < snapshot.CacheablePrefix
+		if cacheable {
+			snapshot.CacheablePrefixTokens += tokens
+		}
+		snapshot.Messages = append(snapshot.Messages, ContextMessage{
+			Index:     i,
+			Role:      msg.Role,
+			Tokens:    tokens,
+			Cacheable: cacheable,
+			Preview:   messagePreview(msg),
+		})
+	}
+	toolTokens := estimator.EstimateTools(request.Tools)
+	// 工具定义位于缓存前缀的最前面
+	if snapshot.CacheablePrefix > 0 {
+		snapshot.CacheablePrefixTokens += toolTokens
+	}
+
+	snapshot.Sections = []ContextSection{
+		{Name: "System prompt", Tokens: max(systemTokens-memoryTokens-repoMapTokens, 0), Messages: systemCount},
+		{Name: "ALEX.md memory", Tokens: min(memoryTokens, systemTokens)},
+		{Name: "Repository map", Tokens: min(repoMapTokens, max(systemTokens-memoryTokens, 0))},
+		{Name: "History", Tokens: historyTokens, Messages: len(messages) - systemCount},
+		{Name: "Tool definitions", Tokens: toolTokens},
+	}
+	snapshot.TotalTokens = systemTokens + historyTokens + toolTokens
+	return snapshot, nil
+}
+
+// messagePreview - 消息内容的单行摘要
+func messagePreview(msg llm.Message) string {
+	var calls []string
+	for _, tc := range msg.ToolCalls {
+		calls = append(calls, tc.Function.Name)
+	}
+	text := strings.Join(strings.Fields(msg.Content), " ")
+	if len(calls) > 0 {
+		text = strings.TrimSpace(text + " → " + strings.Join(calls, ", "))
+	}
+	if msg.ToolCallId != "" {
+		text = msg.ToolCallId + ": " + text
+	}
+	if runes := []rune(text); len(runes) > 100 {
+		text = string(runes[:100]) + "..."
+	}
+	return text
+}
@@ -2,11 +2,14 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
 	"time"
 
+	"alex/internal/checkpoint"
+	"alex/internal/config"
 	"alex/internal/context/message"
 	"alex/internal/llm"
 	"alex/internal/session"
@@ -22,22 +25,34 @@ type ReactCore struct {
 	llmHandler       *LLMHandler
 	toolHandler      *ToolHandler
 	promptHandler    *PromptHandler
+	router           *ModelRouter
 }
 
 // NewReactCore - 创建ReAct核心实例
 func NewReactCore(agent *ReactAgent) *ReactCore {
-	llmClient, err := llm.GetLLMInstance(llm.BasicModel)
+	var routingConfig *config.RoutingConfig
+	if agent.configManager != nil {
+		routingConfig = agent.configManager.GetConfig().Routing
+	}
+	router := NewModelRouter(RoutingPolicyFromConfig(routingConfig), agent.llmConfig)
+
+	// 压缩摘要使用路由指定的（通常是便宜的）模型
+	compression := router.RouteCompression()
+	llmClient, err := llm.GetLLMInstance(compression.ModelType)
 	if err != nil {
 		log.Printf("[ERROR] NewReactCore: Failed to get LLM instance: %v", err)
 		llmClient = nil
 	}
+	messageProcessor := message.NewMessageProcessor(llmClient, agent.sessionManager)
+	messageProcessor.SetCompressionModel(llmClient, compression.ModelType, agent.llmConfig)
 
 	return &ReactCore{
 		agent:            agent,
-		messageProcessor: message.NewMessageProcessor(llmClient, agent.sessionManager),
+		messageProcessor: messageProcessor,
 		llmHandler:       NewLLMHandler(agent.sessionManager, nil), // Will be set per request
 		toolHandler:      NewToolHandler(agent.tools),
 		promptHandler:    NewPromptHandler(agent.promptBuilder),
+		router:           router,
 	}
 }
 
@@ -61,11 +76,10 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 	}
 
 	// 构建系统提示（只需构建一次）
-	systemPrompt := rc.promptHandler.buildToolDrivenTaskPrompt(taskCtx)
 	messages := []llm.Message{
 		{
 			Role:    "system",
-			Content: systemPrompt,
+			Content: rc.buildSystemPrompt(taskCtx),
 		},
 	}
 
@@ -79,12 +93,42 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 		},
 		Timestamp: time.Now(),
 	}
+	if images, ok := ctx.Value(taskImagesKey{}).([]llm.ContentPart); ok {
+		userMsg.Parts = toSessionParts(images)
+	}
 	rc.agent.currentSession.AddMessage(userMsg)
+	rc.selectCompressionStrategy()
+
+	// 初始化任务预算：迭代次数、token、预估费用和耗时
+	budget := NewBudgetGovernor(BudgetLimitsFromConfig(rc.agent.config))
+	if deadline, ok := budget.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	// 检查点迭代编号在会话内递增，避免多个任务之间冲突
+	checkpointBase := 0
+	if rc.agent.checkpoints != nil && rc.agent.currentSession != nil {
+		checkpointBase = rc.agent.checkpoints.LatestIteration(rc.agent.currentSession.ID)
+		// 任务运行期间禁止撤销，避免和正在进行的文件修改竞争
+		if release, err := rc.agent.checkpoints.Begin(rc.agent.currentSession.ID); err != nil {
+			log.Printf("[WARN] ReactCore: %v", err)
+		} else {
+			defer release()
+		}
+	}
+
+	// 连续失败的工具调用次数，用于切换到调试模型
+	consecutiveFailures := 0
 
 	// 执行工具驱动的ReAct循环
-	maxIterations := 100 // 减少迭代次数，依赖智能工具调用
+	for iteration := 1; budget.CanStartIteration(); iteration++ {
+		if reason := budget.Exceeded(); reason != "" {
+			return rc.stopOnBudget(taskCtx, reason, budget, streamCallback), nil
+		}
+		budget.StartIteration()
 
-	for iteration := 1; iteration <= maxIterations; iteration++ {
 		step := types.ReactExecutionStep{
 			Number:    iteration,
 			Timestamp: time.Now(),
@@ -97,37 +141,24 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 				Metadata: map[string]any{"iteration": iteration, "phase": "tool_driven_processing"}})
 		}
 
+		// 按迭代类型选择基础模型或推理模型
+		route := rc.router.RouteIteration(iteration, consecutiveFailures)
+		rc.reportRoute(iteration, route)
+
 		// 第一次迭代更新消息列表，添加最新的会话内容
 		if iteration == 1 {
-			sess := rc.agent.currentSession
-			// 使用新的上下文管理器优化消息
-			sessionMessages := sess.GetMessages()
-
-			// 使用统一消息系统进行转换
-			unifiedMessages := rc.messageProcessor.ConvertSessionToUnified(sessionMessages)
-			llmMessages := rc.messageProcessor.ConvertUnifiedToLLM(unifiedMessages)
-			messages = append(messages, llmMessages...)
+			messages = append(messages, rc.sessionHistory(rc.agent.currentSession.GetMessages())...)
 		} else {
-			// 使用AI综合压缩系统进行压缩
-			unifiedMessages := rc.messageProcessor.ConvertLLMToUnified(messages)
-			sessionMessages := rc.messageProcessor.ConvertUnifiedToSession(unifiedMessages)
-			compressedSessionMessages := rc.messageProcessor.CompressMessages(ctx, sessionMessages)
-			compressedUnified := rc.messageProcessor.ConvertSessionToUnified(compressedSessionMessages)
-			messages = rc.messageProcessor.ConvertUnifiedToLLM(compressedUnified)
+			var report *message.CompressionReport
+			messages, report = rc.compressHistory(ctx, messages, route)
+			rc.recordCompression(report)
 		}
 		// 构建可用工具列表 - 每轮都包含工具定义以确保模型能调用工具
 		tools := rc.toolHandler.buildToolDefinitions()
 
-		request := &llm.ChatRequest{
-			Messages:   messages,
-			ModelType:  llm.BasicModel,
-			Tools:      tools,
-			ToolChoice: "auto",
-			Config:     rc.agent.llmConfig,
-			MaxTokens:  rc.agent.llmConfig.MaxTokens,
-		}
+		request := rc.newChatRequest(messages, tools, route)
 		// 获取LLM实例
-		client, err := llm.GetLLMInstance(llm.BasicModel)
+		client, err := llm.GetLLMInstance(route.ModelType)
 		if err != nil {
 			log.Printf("[ERROR] ReactCore: Failed to get LLM instance at iteration %d: %v", iteration, err)
 			if isStreaming {
@@ -145,9 +176,25 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 			return nil, fmt.Errorf("invalid LLM request at iteration %d: %w", iteration, err)
 		}
 
-		// 执行LLM调用，带重试机制
-		response, err := rc.llmHandler.callLLMWithRetry(ctx, client, request, 3)
+		// 执行LLM调用，带重试机制；流式模式下内容会实时推送给回调
+		// 开启最终回答改写时，使用过工具后的回答可能被替换，先不发送给用户
+		_, synthesize := rc.router.RouteSynthesis(route)
+		draft := isStreaming && synthesize && iteration > 1
+		var response *llm.ChatResponse
+		streamed := false
+		switch {
+		case draft:
+			response, err = rc.llmHandler.callLLMDraft(ctx, client, request, 3)
+		case isStreaming:
+			response, streamed, err = rc.llmHandler.callLLMStreamWithRetry(ctx, client, request, 3)
+		default:
+			response, err = rc.llmHandler.callLLMWithRetry(ctx, client, request, 3)
+		}
 		if err != nil {
+			// 时间预算耗尽导致的取消按预算停止处理，而不是报错
+			if reason := budget.Exceeded(); reason != "" {
+				return rc.stopOnBudget(taskCtx, reason, budget, streamCallback), nil
+			}
 			log.Printf("[ERROR] ReactCore: LLM call failed at iteration %d after retries: %v", iteration, err)
 			if isStreaming {
 				streamCallback(StreamChunk{Type: "error", Content: fmt.Sprintf("❌ LLM call failed: %v", err)})
@@ -173,39 +220,29 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 			return nil, fmt.Errorf("no response choices received at iteration %d - API response format issue", iteration)
 		}
 
-		choice := response.Choices[0]
-		step.Thought = strings.TrimSpace(choice.Message.Content)
-
-		// Extract token usage from response using compatible method
-		usage := response.GetUsage()
-		tokensUsed := usage.GetTotalTokens()
-		promptTokens := usage.GetPromptTokens()
-		completionTokens := usage.GetCompletionTokens()
+		step.TokensUsed = rc.recordUsage(taskCtx, budget, request, response, iteration)
+		rc.saveResponseChain(request.ResponseChain)
 
-		// Update task context with token usage
-		taskCtx.TokensUsed += tokensUsed
-		taskCtx.PromptTokens += promptTokens
-		taskCtx.CompletionTokens += completionTokens
-		step.TokensUsed = tokensUsed
-
-		// Send token usage via stream callback
-		if isStreaming && tokensUsed > 0 {
-			streamCallback(StreamChunk{
-				Type:             "token_usage",
-				Content:          fmt.Sprintf("Tokens used: %d (prompt: %d, completion: %d)", tokensUsed, promptTokens, completionTokens),
-				TokensUsed:       tokensUsed,
-				TotalTokensUsed:  taskCtx.TokensUsed,
-				PromptTokens:     promptTokens,
-				CompletionTokens: completionTokens,
-				Metadata:         map[string]any{"iteration": iteration, "phase": "token_accounting"},
-			})
+		choice := response.Choices[0]
+		// 使用过工具的任务由路由指定的模型写最终回答
+		if len(choice.Message.ToolCalls) == 0 && iteration > 1 {
+			synthesized, synthesizedStreamed, tokens, ok := rc.synthesizeFinalAnswer(ctx, messages, tools, route, taskCtx, budget, iteration)
+			step.TokensUsed += tokens
+			if ok {
+				choice.Message = *synthesized
+				streamed = synthesizedStreamed
+			} else if draft {
+				// 改写失败，草稿就是最终回答
+				streamCallback(StreamChunk{Type: "llm_content", Content: choice.Message.Content, Metadata: map[string]any{"streaming": false}})
+			}
 		}
+		step.Thought = strings.TrimSpace(choice.Message.Content)
 
-		if len(choice.Message.Content) > 0 && len(choice.Message.ToolCalls) > 0 {
+		if isStreaming && len(choice.Message.Content) > 0 && len(choice.Message.ToolCalls) > 0 {
 			streamCallback(StreamChunk{
 				Type:     "thinking_result",
 				Content:  choice.Message.Content,
-				Metadata: map[string]any{"iteration": iteration, "phase": "thinking_result"}})
+				Metadata: map[string]any{"iteration": iteration, "phase": "thinking_result", "streamed": streamed}})
 		}
 		// 添加assistant消息到对话历史和session
 		// 重要修复：即使没有content，也要添加包含工具调用的assistant消息
@@ -231,9 +268,15 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 			step.Action = "tool_execution"
 			step.ToolCall = toolCalls // 记录所有工具调用
 
-			// 执行工具调用
-			toolResult := rc.agent.executeSerialToolsStream(ctx, toolCalls, streamCallback)
+			// 执行工具调用，文件修改前的快照记录在本次迭代的检查点中
+			toolCtx := ctx
+			if rc.agent.checkpoints != nil && rc.agent.currentSession != nil {
+				recorder := rc.agent.checkpoints.Recorder(rc.agent.currentSession.ID, checkpointBase+iteration)
+				toolCtx = checkpoint.WithRecorder(ctx, recorder)
+			}
+			toolResult := rc.agent.executeToolsStream(toolCtx, toolCalls, streamCallback)
 			step.Result = toolResult
+			consecutiveFailures = countConsecutiveFailures(consecutiveFailures, toolResult)
 
 			log.Printf("[DEBUG] ReactCore: Tool execution returned %d results", len(toolResult))
 			for i, result := range toolResult {
@@ -242,9 +285,7 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 
 			// 将工具结果添加到对话历史和session
 			if toolResult != nil {
-				isGemini := strings.Contains(request.Config.BaseURL, "googleapis")
-				log.Printf("[DEBUG] ReactCore: Building tool messages, isGemini: %v", isGemini)
-				toolMessages := rc.toolHandler.buildToolMessages(toolResult, isGemini)
+				toolMessages := rc.toolHandler.buildToolMessages(toolResult)
 				log.Printf("[DEBUG] ReactCore: Built %d tool messages", len(toolMessages))
 
 				for i, msg := range toolMessages {
@@ -308,6 +349,9 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 					}
 				}
 
+				if imagesMessage, ok := rc.toolHandler.buildToolImagesMessage(toolResult); ok {
+					toolMessages = append(toolMessages, imagesMessage)
+				}
 				messages = append(messages, toolMessages...)
 
 				// 将工具消息添加到session供memory系统学习
@@ -330,6 +374,18 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 			}
 		} else {
 			finalAnswer := choice.Message.Content
+			if rc.agent.outputSchema != nil {
+				validated, tokens, err := rc.enforceOutputSchema(ctx, messages, tools, finalAnswer, route, taskCtx, budget, iteration)
+				step.TokensUsed += tokens
+				if err != nil {
+					log.Printf("[ERROR] ReactCore: %v", err)
+					if isStreaming {
+						streamCallback(StreamChunk{Type: "error", Content: fmt.Sprintf("❌ %v", err)})
+					}
+					return nil, err
+				}
+				finalAnswer = validated
+			}
 
 			step.Action = "direct_answer"
 			step.Observation = finalAnswer
@@ -343,7 +399,7 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 				streamCallback(StreamChunk{
 					Type:     "final_answer",
 					Content:  finalAnswer,
-					Metadata: map[string]any{"iteration": iteration, "phase": "final_answer"}})
+					Metadata: map[string]any{"iteration": iteration, "phase": "final_answer", "streamed": streamed}})
 			}
 			return result, nil
 		}
@@ -351,18 +407,175 @@ func (rc *ReactCore) SolveTask(ctx context.Context, task string, streamCallback
 		step.Duration = time.Since(step.Timestamp)
 		taskCtx.History = append(taskCtx.History, step)
 		taskCtx.LastUpdate = time.Now()
+
+		// 接近预算上限时提醒模型尽快收尾
+		if warnings := budget.Warnings(); len(warnings) > 0 {
+			warningMsg := budget.WarningMessage(warnings)
+			messages = append(messages, llm.Message{Role: "user", Content: warningMsg})
+			log.Printf("[WARN] ReactCore: %s", warningMsg)
+			if isStreaming {
+				streamCallback(StreamChunk{
+					Type:     "budget_warning",
+					Content:  warningMsg,
+					Metadata: map[string]any{"iteration": iteration, "warnings": warnings}})
+			}
+		}
 	}
 
 	// 达到最大迭代次数
-	log.Printf("[WARN] ReactCore: Maximum iterations (%d) reached", maxIterations)
-	if isStreaming {
+	reason := fmt.Sprintf("iteration limit reached (%d iterations)", budget.Iterations())
+	return rc.stopOnBudget(taskCtx, reason, budget, streamCallback), nil
+}
+
+// reportRoute - 通过流回调报告本次迭代使用的模型
+func (rc *ReactCore) reportRoute(iteration int, route ModelRoute) {
+	log.Printf("[DEBUG] ReactCore: Iteration %d routed to %s model %s (%s)", iteration, route.ModelType, route.Model, route.Kind)
+	if rc.streamCallback == nil {
+		return
+	}
+
+	content := fmt.Sprintf("🧠 Iteration %d: %s model %s", iteration, route.ModelType, route.Model)
+	if route.Reason != "" {
+		content += fmt.Sprintf(" (%s)", route.Reason)
+	}
+	rc.streamCallback(StreamChunk{
+		Type:    "model_route",
+		Content: content,
+		Model:   route.Model,
+		Metadata: map[string]any{
+			"iteration":  iteration,
+			"kind":       string(route.Kind),
+			"model_type": string(route.ModelType),
+			"reason":     route.Reason,
+		}})
+}
+
+// recordUsage - 累计一次LLM调用的token和费用并通过流回调报告，返回本次使用的token数
+func (rc *ReactCore) recordUsage(taskCtx *types.ReactTaskContext, budget *BudgetGovernor, request *llm.ChatRequest, response *llm.ChatResponse, iteration int) int {
+	// Extract token usage from response using compatible method
+	usage := response.GetUsage()
+	tokensUsed := usage.GetTotalTokens()
+	promptTokens := usage.GetPromptTokens()
+	completionTokens := usage.GetCompletionTokens()
+
+	model := llm.ModelFor(rc.agent.llmConfig, request.ModelType)
+	cost := callCost(response.Model, model, usage)
+
+	// Update task context with token usage
+	taskCtx.TokensUsed += tokensUsed
+	taskCtx.PromptTokens += promptTokens
+	taskCtx.CompletionTokens += completionTokens
+	taskCtx.Cost += cost
+	budget.RecordUsage(promptTokens, completionTokens, cost)
+	if rc.agent.currentSession != nil {
+		rc.agent.currentSession.AddUsage(tokensUsed, cost)
+	}
+
+	// Send token usage via stream callback
+	if rc.streamCallback != nil && tokensUsed > 0 {
+		if response.Model != "" {
+			model = response.Model
+		}
+		rc.streamCallback(StreamChunk{
+			Type:             "token_usage",
+			Content:          fmt.Sprintf("Tokens used: %d (prompt: %d, completion: %d, cost: $%.4f)", tokensUsed, promptTokens, completionTokens, cost),
+			TokensUsed:       tokensUsed,
+			TotalTokensUsed:  taskCtx.TokensUsed,
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			Cost:             cost,
+			TotalCost:        taskCtx.Cost,
+			CacheReadTokens:  usage.GetCachedTokens(),
+			CacheWriteTokens: usage.CacheWriteTokens,
+			Model:            model,
+			Metadata:         map[string]any{"iteration": iteration, "phase": "token_accounting"},
+		})
+	}
+	return tokensUsed
+}
+
+// synthesizeFinalAnswer - 由路由指定的模型根据同样的上下文重写最终回答
+// 无需重写或调用失败时返回 ok=false，保留原回答
+func (rc *ReactCore) synthesizeFinalAnswer(ctx context.Context, messages []llm.Message, tools []llm.Tool, served ModelRoute,
+	taskCtx *types.ReactTaskContext, budget *BudgetGovernor, iteration int) (*llm.Message, bool, int, bool) {
+	route, ok := rc.router.RouteSynthesis(served)
+	if !ok {
+		return nil, false, 0, false
+	}
+	rc.reportRoute(iteration, route)
+
+	request := &llm.ChatRequest{
+		Messages:       messages,
+		ModelType:      route.ModelType,
+		Tools:          tools,
+		ToolChoice:     "none",
+		ResponseFormat: rc.responseFormat(),
+		Config:         rc.agent.llmConfig,
+		MaxTokens:      llm.ResolveMaxTokens(route.Model, rc.agent.llmConfig.MaxTokens),
+		ResponseChain:  rc.responseChain(),
+	}
+	if err := rc.llmHandler.validateLLMRequest(request); err != nil {
+		log.Printf("[WARN] ReactCore: Skipping final answer synthesis: %v", err)
+		return nil, false, 0, false
+	}
+	client, err := llm.GetLLMInstance(route.ModelType)
+	if err != nil {
+		log.Printf("[WARN] ReactCore: Skipping final answer synthesis: %v", err)
+		return nil, false, 0, false
+	}
+
+	var response *llm.ChatResponse
+	streamed := false
+	if rc.streamCallback != nil {
+		response, streamed, err = rc.llmHandler.callLLMStreamWithRetry(ctx, client, request, 3)
+	} else {
+		response, err = rc.llmHandler.callLLMWithRetry(ctx, client, request, 3)
+	}
+	if err != nil || response == nil || len(response.Choices) == 0 {
+		log.Printf("[WARN] ReactCore: Final answer synthesis failed, keeping the draft: %v", err)
+		return nil, false, 0, false
+	}
+
+	tokensUsed := rc.recordUsage(taskCtx, budget, request, response, iteration)
+	rc.saveResponseChain(request.ResponseChain)
+	answer := response.Choices[0].Message
+	if strings.TrimSpace(answer.Content) == "" || len(answer.ToolCalls) > 0 {
+		log.Printf("[WARN] ReactCore: Final answer synthesis returned no answer, keeping the draft")
+		return nil, false, tokensUsed, false
+	}
+	return &answer, streamed, tokensUsed, true
+}
+
+// countConsecutiveFailures - 按执行顺序累计连续失败的工具调用，成功的调用清零
+func countConsecutiveFailures(failures int, results []*types.ReactToolResult) int {
+	for _, result := range results {
+		if result == nil || result.Success {
+			failures = 0
+			continue
+		}
+		failures++
+	}
+	return failures
+}
+
+// stopOnBudget - 预算耗尽时优雅停止，返回包含已完成进度的部分结果
+func (rc *ReactCore) stopOnBudget(taskCtx *types.ReactTaskContext, reason string, budget *BudgetGovernor, streamCallback StreamCallback) *types.ReactTaskResult {
+	log.Printf("[WARN] ReactCore: Stopping task - %s (%s)", reason, budget.Summary())
+
+	summary := buildPartialResult(taskCtx, reason, budget)
+	if streamCallback != nil {
 		streamCallback(StreamChunk{
-			Type:     "max_iterations",
-			Content:  fmt.Sprintf("⚠️ Reached maximum iterations (%d)", maxIterations),
-			Metadata: map[string]any{"max_iterations": maxIterations}})
+			Type:    "budget_exceeded",
+			Content: summary,
+			Metadata: map[string]any{
+				"reason":     reason,
+				"iterations": budget.Iterations(),
+				"tokens":     budget.TotalTokens(),
+				"cost":       budget.Cost(),
+			}})
 	}
 
-	return buildFinalResult(taskCtx, "Maximum iterations reached without completion", 0.5, false), nil
+	return buildFinalResult(taskCtx, summary, 0.3, false)
 }
 
 // addMessageToSession - 将LLM消息添加到session中供memory系统学习
@@ -375,9 +588,12 @@ func (rc *ReactCore) addMessageToSession(llmMsg *llm.Message) {
 
 	// 转换LLM消息为session消息格式
 	sessionMsg := &session.Message{
-		Role:      llmMsg.Role,
-		Content:   llmMsg.Content,
-		Timestamp: time.Now(),
+		Role:              llmMsg.Role,
+		Content:           llmMsg.Content,
+		Reasoning:         llmMsg.Reasoning,
+		ThinkingSignature: llmMsg.ThinkingSignature,
+		Parts:             toSessionParts(llmMsg.Parts),
+		Timestamp:         time.Now(),
 		Metadata: map[string]interface{}{
 			"source":    "llm_response",
 			"timestamp": time.Now().Unix(),
@@ -390,8 +606,10 @@ func (rc *ReactCore) addMessageToSession(llmMsg *llm.Message) {
 			// 将Arguments字符串解析为map[string]interface{}
 			var args map[string]interface{}
 			if tc.Function.Arguments != "" {
-				// 简单处理：如果是JSON字符串尝试解析，否则存为字符串
-				args = map[string]interface{}{"raw": tc.Function.Arguments}
+				// 如果是JSON字符串尝试解析，否则存为字符串
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+					args = map[string]interface{}{"raw": tc.Function.Arguments}
+				}
 			}
 
 			sessionMsg.ToolCalls = append(sessionMsg.ToolCalls, session.ToolCall{
@@ -408,6 +626,123 @@ func (rc *ReactCore) addMessageToSession(llmMsg *llm.Message) {
 	sess.AddMessage(sessionMsg)
 }
 
+// toSessionParts - 转换消息的图片等内容片段用于保存到session
+func toSessionParts(parts []llm.ContentPart) []session.ContentPart {
+	if len(parts) == 0 {
+		return nil
+	}
+	result := make([]session.ContentPart, len(parts))
+	for i, part := range parts {
+		result[i] = session.ContentPart{
+			Type:      string(part.Type),
+			Text:      part.Text,
+			Path:      part.Path,
+			Data:      part.Data,
+			MediaType: part.MediaType,
+			URL:       part.URL,
+		}
+	}
+	return result
+}
+
+// responseChain - 取出会话保存的 Responses API 响应链，请求成功后客户端会原地更新它
+func (rc *ReactCore) responseChain() *llm.ResponseChain {
+	chain := &llm.ResponseChain{}
+	if sess := rc.agent.currentSession; sess != nil {
+		if saved := sess.GetResponseChain(); saved != nil {
+			*chain = llm.ResponseChain(*saved)
+		}
+	}
+	return chain
+}
+
+// saveResponseChain - 把新的响应链存入会话，之后的请求（包括后续任务）只需发送新增消息
+func (rc *ReactCore) saveResponseChain(chain *llm.ResponseChain) {
+	sess := rc.agent.currentSession
+	if sess == nil || chain == nil || chain.ResponseID == "" {
+		return
+	}
+	if saved := sess.GetResponseChain(); saved != nil && *saved == session.ResponseChain(*chain) {
+		return
+	}
+	saved := session.ResponseChain(*chain)
+	sess.SetResponseChain(&saved)
+}
+
+// buildSystemPrompt - 构建任务的系统提示（含仓库结构图），要求结构化输出时附加 schema 说明
+func (rc *ReactCore) buildSystemPrompt(taskCtx *types.ReactTaskContext) string {
+	taskCtx.RepoMap = rc.buildRepoMap(taskCtx)
+	systemPrompt := rc.promptHandler.buildToolDrivenTaskPrompt(taskCtx)
+	if rc.agent.outputSchema != nil {
+		systemPrompt += schemaInstructions(rc.agent.outputSchema)
+	}
+	return systemPrompt
+}
+
+// compressHistory - 使用AI综合压缩系统进行压缩，按目标模型的分词器计数
+func (rc *ReactCore) compressHistory(ctx context.Context, messages []llm.Message, route ModelRoute) ([]llm.Message, *message.CompressionReport) {
+	rc.messageProcessor.SetModel(route.Model)
+	unifiedMessages := rc.messageProcessor.ConvertLLMToUnified(messages)
+	sessionMessages := rc.messageProcessor.ConvertUnifiedToSession(unifiedMessages)
+	compressedSessionMessages, report := rc.messageProcessor.CompressMessages(ctx, sessionMessages)
+	compressedUnified := rc.messageProcessor.ConvertSessionToUnified(compressedSessionMessages)
+	return rc.messageProcessor.ConvertUnifiedToLLM(compressedUnified), report
+}
+
+// sessionHistory - 使用统一消息系统把会话消息转换成第一次迭代请求中的历史
+func (rc *ReactCore) sessionHistory(sessionMessages []*session.Message) []llm.Message {
+	unifiedMessages := rc.messageProcessor.ConvertSessionToUnified(sessionMessages)
+	return rc.messageProcessor.ConvertUnifiedToLLM(unifiedMessages)
+}
+
+// newChatRequest - 构建一次迭代的LLM请求
+func (rc *ReactCore) newChatRequest(messages []llm.Message, tools []llm.Tool, route ModelRoute) *llm.ChatRequest {
+	return &llm.ChatRequest{
+		Messages:      messages,
+		ModelType:     route.ModelType,
+		Tools:         tools,
+		ToolChoice:    "auto",
+		Config:        rc.agent.llmConfig,
+		MaxTokens:     llm.ResolveMaxTokens(route.Model, rc.agent.llmConfig.MaxTokens),
+		ResponseChain: rc.responseChain(),
+	}
+}
+
+// selectCompressionStrategy - 按会话配置选择压缩策略，会话未指定时使用全局配置
+func (rc *ReactCore) selectCompressionStrategy() {
+	var strategy string
+	var window, elideAfter int
+	if rc.agent.configManager != nil {
+		if compression := rc.agent.configManager.GetConfig().Compression; compression != nil {
+			strategy, window, elideAfter = compression.Strategy, compression.Window, compression.ElideAfter
+		}
+	}
+	rc.messageProcessor.SetElideAfter(elideAfter)
+	if sess := rc.agent.currentSession; sess != nil {
+		if value, ok := sess.GetConfig(compressionStrategyKey); ok {
+			if name, ok := value.(string); ok && name != "" {
+				strategy = name
+			}
+		}
+	}
+	if err := rc.messageProcessor.SetCompressionStrategy(strategy, window); err != nil {
+		log.Printf("[WARN] ReactCore: %v, using %s", err, message.StrategyCacheFriendly)
+		_ = rc.messageProcessor.SetCompressionStrategy(message.StrategyCacheFriendly, 0)
+	}
+}
+
+// recordCompression - 在会话元数据中记录压缩策略和节省的token
+func (rc *ReactCore) recordCompression(report *message.CompressionReport) {
+	if report == nil {
+		return
+	}
+	log.Printf("[INFO] ReactCore: compression (strategy %q, %d outputs elided): %d -> %d messages, %d -> %d tokens",
+		report.Strategy, report.Elided, report.MessagesBefore, report.MessagesAfter, report.TokensBefore, report.TokensAfter)
+	if sess := rc.agent.currentSession; sess != nil {
+		sess.RecordCompression(report.Strategy, report.Elided, report.TokensBefore, report.TokensAfter)
+	}
+}
+
 // addToolMessagesToSession - 将工具消息添加到session中供memory系统学习
 func (rc *ReactCore) addToolMessagesToSession(toolMessages []llm.Message, toolResults []*types.ReactToolResult) {
 	// 获取当前会话
@@ -421,6 +756,7 @@ func (rc *ReactCore) addToolMessagesToSession(toolMessages []llm.Message, toolRe
 		sessionMsg := &session.Message{
 			Role:      toolMsg.Role,
 			Content:   toolMsg.Content,
+			Parts:     toSessionParts(toolMsg.Parts),
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
 				"source":    "tool_result",
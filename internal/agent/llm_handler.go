@@ -2,12 +2,12 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"time"
 
+	"alex/internal/context/message"
 	"alex/internal/llm"
 	"alex/internal/session"
 )
@@ -16,6 +16,8 @@ import (
 type LLMHandler struct {
 	streamCallback StreamCallback
 	sessionManager *session.Manager
+	// activeModel is the last model announced to the user by a failover client
+	activeModel string
 }
 
 // NewLLMHandler creates a new LLM handler
@@ -28,100 +30,21 @@ func NewLLMHandler(sessionManager *session.Manager, streamCallback StreamCallbac
 
 // isNetworkError checks if an error is network-related and should not be retried
 func (h *LLMHandler) isNetworkError(err error) bool {
-	errStr := err.Error()
-
-	// Extract HTTP status code if present
-	if strings.Contains(errStr, "HTTP error ") {
-		// Look for pattern "HTTP error XXX:"
-		parts := strings.Split(errStr, "HTTP error ")
-		if len(parts) > 1 {
-			statusPart := strings.Split(parts[1], ":")
-			if len(statusPart) > 0 {
-				if statusCode, parseErr := strconv.Atoi(statusPart[0]); parseErr == nil {
-					// Network-related HTTP status codes that shouldn't be retried
-					switch statusCode {
-					case 400, 401, 403, 404, 405, 406, 408, 409, 410, 411, 412, 413, 414, 415, 416, 417, 418, 421, 422, 423, 424, 425, 426, 428, 429, 431, 451:
-						// Client errors (4xx) - usually indicate request issues, not transient network problems
-						return true
-					case 500: // Server error - request format issue
-						return true
-						// Note: 502, 503, 504 are temporary server issues and should be retried
-					}
-				}
-			}
-		}
-	}
-
-	// Check for common network error patterns
-	networkErrorPatterns := []string{
-		"connection refused",
-		"connection reset",
-		"connection timeout",
-		"dial timeout",
-		"read timeout",
-		"write timeout",
-		"network is unreachable",
-		"no route to host",
-		"host is down",
-		"dns lookup failed",
-		"tls handshake timeout",
-		"certificate verify failed",
-		"ssl handshake failed",
-	}
-
-	lowerErr := strings.ToLower(errStr)
-	for _, pattern := range networkErrorPatterns {
-		if strings.Contains(lowerErr, pattern) {
-			return true
-		}
-	}
-
-	return false
+	return llm.IsNetworkError(err)
 }
 
 // isRetriableError checks if an error should be retried (opposite of network error)
 func (h *LLMHandler) isRetriableError(err error) bool {
-	errStr := err.Error()
-
-	// Timeout errors from HTTP client should be retried
-	if strings.Contains(errStr, "timeout") || strings.Contains(errStr, "deadline exceeded") {
-		return true
-	}
-
-	// Extract HTTP status code if present
-	if strings.Contains(errStr, "HTTP error ") {
-		parts := strings.Split(errStr, "HTTP error ")
-		if len(parts) > 1 {
-			statusPart := strings.Split(parts[1], ":")
-			if len(statusPart) > 0 {
-				if statusCode, parseErr := strconv.Atoi(statusPart[0]); parseErr == nil {
-					// Temporary server issues that should be retried
-					switch statusCode {
-					case 502, 503, 504, 429: // Bad Gateway, Service Unavailable, Gateway Timeout, Rate Limited
-						return true
-					}
-				}
-			}
-		}
-	}
+	return llm.IsRetriableError(err)
+}
 
-	// Temporary network issues that should be retried
-	retriablePatterns := []string{
-		"temporary failure",
-		"server temporarily unavailable",
-		"connection reset by peer",
-		"broken pipe",
-		"EOF",
+// retryDelay 使用服务端 Retry-After 建议的等待时间，若其长于默认退避时间
+func retryDelay(err error, backoff time.Duration) time.Duration {
+	var rateLimitErr *llm.RateLimitError
+	if errors.As(err, &rateLimitErr) && rateLimitErr.RetryAfter > backoff {
+		return rateLimitErr.RetryAfter
 	}
-
-	lowerErr := strings.ToLower(errStr)
-	for _, pattern := range retriablePatterns {
-		if strings.Contains(lowerErr, pattern) {
-			return true
-		}
-	}
-
-	return false
+	return backoff
 }
 
 // callLLMWithRetry - 带重试机制的非流式LLM调用
@@ -131,6 +54,16 @@ func (h *LLMHandler) callLLMWithRetry(ctx context.Context, client llm.Client, re
 
 // callLLMWithRetryAndBackoff - 带重试机制和可配置退避策略的非流式LLM调用
 func (h *LLMHandler) callLLMWithRetryAndBackoff(ctx context.Context, client llm.Client, request *llm.ChatRequest, maxRetries int, backoffFunc func(int) time.Duration) (*llm.ChatResponse, error) {
+	return h.callLLM(ctx, client, request, maxRetries, backoffFunc, true)
+}
+
+// callLLMDraft - 非流式调用，不把内容发送给回调，用于可能被最终回答替换的草稿
+func (h *LLMHandler) callLLMDraft(ctx context.Context, client llm.Client, request *llm.ChatRequest, maxRetries int) (*llm.ChatResponse, error) {
+	return h.callLLM(ctx, client, request, maxRetries, nil, false)
+}
+
+// callLLM - 非流式调用的重试循环，forward 为 true 时把完整内容发送给回调
+func (h *LLMHandler) callLLM(ctx context.Context, client llm.Client, request *llm.ChatRequest, maxRetries int, backoffFunc func(int) time.Duration, forward bool) (*llm.ChatResponse, error) {
 	var lastErr error
 	sessionID, _ := h.sessionManager.GetSessionID()
 	// 默认的快速重试策略（100ms 间隔）
@@ -155,7 +88,7 @@ func (h *LLMHandler) callLLMWithRetryAndBackoff(ctx context.Context, client llm.
 
 			// 如果是可重试的错误（如超时、临时服务器错误），则重试
 			if attempt < maxRetries && (h.isRetriableError(err) || !h.isNetworkError(err)) {
-				backoffDuration := backoffFunc(attempt)
+				backoffDuration := retryDelay(err, backoffFunc(attempt))
 				log.Printf("[WARN] LLMHandler: Retrying in %v (retriable: %v, network: %v)",
 					backoffDuration, h.isRetriableError(err), h.isNetworkError(err))
 				select {
@@ -170,8 +103,16 @@ func (h *LLMHandler) callLLMWithRetryAndBackoff(ctx context.Context, client llm.
 
 		// 直接返回完整响应
 		if response != nil {
+			h.announceActiveModel(client)
 			// 如果有回调，可以一次性发送完整内容
-			if h.streamCallback != nil && len(response.Choices) > 0 {
+			if forward && h.streamCallback != nil && len(response.Choices) > 0 {
+				if reasoning := response.Choices[0].Message.Reasoning; reasoning != "" {
+					h.streamCallback(StreamChunk{
+						Type:     "reasoning",
+						Content:  reasoning,
+						Metadata: map[string]any{"streaming": false},
+					})
+				}
 				h.streamCallback(StreamChunk{
 					Type:     "llm_content",
 					Content:  response.Choices[0].Message.Content,
@@ -199,6 +140,151 @@ func (h *LLMHandler) callLLMWithRetryAndBackoff(ctx context.Context, client llm.
 	return nil, fmt.Errorf("LLM call failed after %d attempts: %w", maxRetries, lastErr)
 }
 
+// callLLMStreamWithRetry - 流式LLM调用，将增量内容实时转发给回调
+// 客户端不支持流式或流式调用在发送内容前失败时回退到一次非流式调用。返回值 streamed 表示内容是否已经实时发送
+func (h *LLMHandler) callLLMStreamWithRetry(ctx context.Context, client llm.Client, request *llm.ChatRequest, maxRetries int) (*llm.ChatResponse, bool, error) {
+	streamingClient, ok := client.(llm.StreamingClient)
+	if !ok || !streamingClient.SupportsStreaming() || h.streamCallback == nil || !modelSupportsStreaming(request) {
+		response, err := h.callLLMWithRetry(ctx, client, request, maxRetries)
+		return response, false, err
+	}
+
+	sessionID, _ := h.sessionManager.GetSessionID()
+	var lastErr error
+
+	// 最后一次尝试留给非流式调用，总调用次数不超过 maxRetries
+	streamAttempts := max(maxRetries-1, 1)
+	for attempt := 1; attempt <= streamAttempts; attempt++ {
+		response, forwarded, err := h.consumeStream(ctx, streamingClient, request, sessionID)
+		if err == nil {
+			return response, true, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+
+		// 已经转发的内容无法撤回，重试会让用户看到重复的回答
+		if forwarded {
+			log.Printf("[ERROR] LLMHandler: Stream failed after content was sent, not retrying: %v", err)
+			return nil, true, fmt.Errorf("stream failed after content was sent: %w", err)
+		}
+
+		log.Printf("[WARN] LLMHandler: ChatStream call failed (attempt %d): %v", attempt, err)
+		if h.isNetworkError(err) && !h.isRetriableError(err) {
+			log.Printf("[ERROR] LLMHandler: Permanent network error detected, not retrying: %v", err)
+			return nil, false, fmt.Errorf("permanent network error - not retrying: %w", err)
+		}
+
+		if attempt < streamAttempts {
+			select {
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			case <-time.After(retryDelay(err, 100*time.Millisecond)):
+			}
+		}
+	}
+
+	// 流式调用失败，回退到一次非流式调用
+	log.Printf("[WARN] LLMHandler: Falling back to non-streaming call: %v", lastErr)
+	response, err := h.callLLMWithRetry(ctx, client, request, 1)
+	return response, false, err
+}
+
+// modelSupportsStreaming 根据模型能力表判断请求的模型是否支持流式输出
+func modelSupportsStreaming(request *llm.ChatRequest) bool {
+	if request.Config == nil {
+		return true
+	}
+	return llm.LookupCapabilities(llm.ModelFor(request.Config, request.ModelType)).Streaming
+}
+
+// announceActiveModel 在故障转移切换模型后通知用户当前使用的模型
+func (h *LLMHandler) announceActiveModel(client llm.Client) {
+	reporter, ok := client.(llm.ActiveModelReporter)
+	if !ok {
+		return
+	}
+
+	model, primary := reporter.Active()
+	if model == "" {
+		return
+	}
+	previous := h.activeModel
+	h.activeModel = model
+	// 第一次调用使用主模型时无需提示
+	if model == previous || (previous == "" && primary) || h.streamCallback == nil {
+		return
+	}
+
+	content := fmt.Sprintf("⚠️ Primary model unavailable, switched to fallback model %s", model)
+	if primary {
+		content = fmt.Sprintf("✅ Primary model %s is available again", model)
+	}
+	h.streamCallback(StreamChunk{
+		Type:     "model_switch",
+		Content:  content,
+		Metadata: map[string]any{"model": model, "fallback": !primary},
+	})
+}
+
+// consumeStream 读取一次流式响应，转发内容增量并组装完整响应
+// forwarded 表示失败前是否已有内容发送给回调
+func (h *LLMHandler) consumeStream(ctx context.Context, client llm.StreamingClient, request *llm.ChatRequest, sessionID string) (response *llm.ChatResponse, forwarded bool, err error) {
+	deltas, err := client.ChatStream(ctx, request, sessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	h.announceActiveModel(client)
+
+	accumulator := llm.NewStreamAccumulator()
+	var streamErr error
+	for delta := range deltas {
+		if delta.Err != nil {
+			streamErr = delta.Err
+			continue
+		}
+		accumulator.Add(delta)
+		for _, choice := range delta.Choices {
+			if choice.Index != 0 {
+				continue
+			}
+			// 推理内容使用单独的类型，界面可以折叠显示
+			if choice.Delta.Reasoning != "" {
+				forwarded = true
+				h.streamCallback(StreamChunk{
+					Type:     "reasoning",
+					Content:  choice.Delta.Reasoning,
+					Metadata: map[string]any{"streaming": true},
+				})
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			forwarded = true
+			h.streamCallback(StreamChunk{
+				Type:     "llm_content",
+				Content:  choice.Delta.Content,
+				Metadata: map[string]any{"streaming": true},
+			})
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, forwarded, err
+	}
+	if streamErr != nil {
+		return nil, forwarded, streamErr
+	}
+
+	if accumulator.Empty() {
+		return nil, forwarded, fmt.Errorf("received empty stream (%d deltas)", accumulator.DeltaCount())
+	}
+
+	return accumulator.Response(), forwarded, nil
+}
+
 // validateLLMRequest - 验证LLM请求参数
 func (h *LLMHandler) validateLLMRequest(request *llm.ChatRequest) error {
 	if request == nil {
@@ -213,5 +299,18 @@ func (h *LLMHandler) validateLLMRequest(request *llm.ChatRequest) error {
 		return fmt.Errorf("config is nil")
 	}
 
+	// 使用目标模型的分词器预估prompt大小，避免发送注定超出上下文窗口的请求
+	// max_tokens 超出剩余窗口时调低，而不是让压缩之前的长任务失败
+	model := llm.ModelFor(request.Config, request.ModelType)
+	estimator := message.NewTokenEstimatorForModel(model)
+	promptTokens := estimator.EstimateRequest(request)
+	maxTokens, ok := llm.FitMaxTokens(model, promptTokens, request.MaxTokens)
+	if !ok {
+		return fmt.Errorf("request exceeds context window of %s: %d prompt tokens leave less than %d tokens for the reply in %d (%s)",
+			model, promptTokens, llm.MinOutputTokens, llm.LookupCapabilities(model).ContextWindow, estimator.Tokenizer().Name())
+	}
+	request.MaxTokens = maxTokens
+	log.Printf("[DEBUG] LLMHandler: pre-flight estimate %d prompt tokens for %s", promptTokens, model)
+
 	return nil
 }
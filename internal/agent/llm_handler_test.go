@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"alex/internal/context/message"
+	"alex/internal/llm"
+	"alex/internal/session"
+)
+
+// fakeStreamClient 按顺序返回预设的流，非流式调用总是失败
+type fakeStreamClient struct {
+	streams     [][]llm.StreamDelta
+	streamCalls int
+	chatCalls   int
+}
+
+func (c *fakeStreamClient) Chat(ctx context.Context, req *llm.ChatRequest, sessionID string) (*llm.ChatResponse, error) {
+	c.chatCalls++
+	return nil, errors.New("HTTP error 503: unavailable")
+}
+
+func (c *fakeStreamClient) ChatStream(ctx context.Context, req *llm.ChatRequest, sessionID string) (<-chan llm.StreamDelta, error) {
+	deltas := c.streams[min(c.streamCalls, len(c.streams)-1)]
+	c.streamCalls++
+	out := make(chan llm.StreamDelta, len(deltas))
+	for _, delta := range deltas {
+		out <- delta
+	}
+	close(out)
+	return out, nil
+}
+
+func (c *fakeStreamClient) SupportsStreaming() bool  { return true }
+func (c *fakeStreamClient) SetStreamingEnabled(bool) {}
+func (c *fakeStreamClient) Close() error             { return nil }
+
+func contentDelta(content string) llm.StreamDelta {
+	return llm.StreamDelta{Choices: []llm.Choice{{Delta: llm.Message{Role: "assistant", Content: content}}}}
+}
+
+// TestLLMHandler_StreamErrors 测试中断的流报错、已发送内容后不重试、非流式回退只调用一次
+func TestLLMHandler_StreamErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sessionManager, err := session.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := llm.StreamDelta{Err: errors.New("stream interrupted: unexpected EOF")}
+	request := &llm.ChatRequest{Messages: []llm.Message{{Role: "user", Content: "hi"}}}
+
+	var content []string
+	handler := NewLLMHandler(sessionManager, func(chunk StreamChunk) {
+		if chunk.Type == "llm_content" {
+			content = append(content, chunk.Content)
+		}
+	})
+
+	// 内容已经转发后中断：返回错误，不重复发送
+	client := &fakeStreamClient{streams: [][]llm.StreamDelta{{contentDelta("Hel"), broken}, {contentDelta("Hello")}}}
+	if _, streamed, err := handler.callLLMStreamWithRetry(context.Background(), client, request, 3); err == nil || !streamed {
+		t.Fatalf("expected a truncated stream to fail, got streamed=%v err=%v", streamed, err)
+	}
+	if client.streamCalls != 1 || client.chatCalls != 0 || strings.Join(content, "") != "Hel" {
+		t.Errorf("expected no retry after content was sent, got %d streams, %d chats, content %q", client.streamCalls, client.chatCalls, content)
+	}
+
+	// 发送内容前中断：重试流式调用，最后只回退一次非流式调用
+	client = &fakeStreamClient{streams: [][]llm.StreamDelta{{broken}}}
+	if _, _, err := handler.callLLMStreamWithRetry(context.Background(), client, request, 3); err == nil {
+		t.Fatal("expected the call to fail")
+	}
+	if client.streamCalls+client.chatCalls != 3 || client.chatCalls != 1 {
+		t.Errorf("expected 3 calls with one non-streaming fallback, got %d streams and %d chats", client.streamCalls, client.chatCalls)
+	}
+
+	// 失败后重试成功
+	content = nil
+	client = &fakeStreamClient{streams: [][]llm.StreamDelta{{broken}, {contentDelta("Hello")}}}
+	response, streamed, err := handler.callLLMStreamWithRetry(context.Background(), client, request, 3)
+	if err != nil || !streamed || response.Choices[0].Message.Content != "Hello" || strings.Join(content, "") != "Hello" {
+		t.Errorf("expected the retried stream to succeed, got %v %v %q", response, err, content)
+	}
+}
+
+// TestLLMHandler_ValidateFitsMaxTokens 测试刚超过压缩阈值的请求调低 max_tokens 而不是报错
+func TestLLMHandler_ValidateFitsMaxTokens(t *testing.T) {
+	const model = "deepseek-reasoner"
+	handler := NewLLMHandler(nil, nil)
+	caps := llm.LookupCapabilities(model)
+	estimator := message.NewTokenEstimatorForModel(model)
+
+	// 构造约有 tokens 个 token 的 prompt
+	requestOf := func(tokens int) *llm.ChatRequest {
+		perWord := estimator.EstimateString(strings.Repeat("hello ", 1000))
+		content := strings.Repeat("hello ", tokens*1000/perWord)
+		return &llm.ChatRequest{
+			Messages:  []llm.Message{{Role: "user", Content: content}},
+			Config:    &llm.Config{Model: model},
+			MaxTokens: llm.ResolveMaxTokens(model, 0),
+		}
+	}
+
+	threshold := int(float64(caps.ContextWindow-caps.OutputReserve()) * 0.9)
+	request := requestOf(threshold + 2000)
+	if err := handler.validateLLMRequest(request); err != nil {
+		t.Fatalf("a prompt just above the compression threshold should be sent, got %v", err)
+	}
+	promptTokens := estimator.EstimateRequest(request)
+	if request.MaxTokens >= caps.MaxOutput || promptTokens+request.MaxTokens > caps.ContextWindow {
+		t.Errorf("max_tokens should shrink to the room left: %d prompt + %d > %d", promptTokens, request.MaxTokens, caps.ContextWindow)
+	}
+
+	if err := handler.validateLLMRequest(requestOf(caps.ContextWindow - 200)); err == nil {
+		t.Error("a prompt that leaves no room for the reply should be rejected")
+	}
+}
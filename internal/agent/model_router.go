@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+
+	"alex/internal/config"
+	"alex/internal/llm"
+)
+
+// StepKind - 迭代的类型，决定使用哪个模型
+type StepKind string
+
+const (
+	StepExecution   StepKind = "execution"   // 常规的工具调用迭代
+	StepPlanning    StepKind = "planning"    // 任务的第一次迭代
+	StepDebugging   StepKind = "debugging"   // 工具连续失败后的迭代
+	StepSynthesis   StepKind = "synthesis"   // 使用过工具的任务的最终回答
+	StepCompression StepKind = "compression" // 上下文压缩摘要
+)
+
+// defaultFailureThreshold - 连续失败多少次工具调用后切换到调试模型
+const defaultFailureThreshold = 2
+
+// RoutingPolicy - 每类迭代使用的模型类型
+type RoutingPolicy struct {
+	Default          llm.ModelType
+	Planning         llm.ModelType
+	Debugging        llm.ModelType
+	FailureThreshold int
+	Synthesis        llm.ModelType
+	Compression      llm.ModelType
+}
+
+// DefaultRoutingPolicy - 规划和调试交给推理模型，其余使用基础模型。
+// 最终回答的改写需要额外一次完整上下文的调用，默认关闭
+func DefaultRoutingPolicy() RoutingPolicy {
+	return RoutingPolicy{
+		Default:          llm.BasicModel,
+		Planning:         llm.ReasoningModel,
+		Debugging:        llm.ReasoningModel,
+		FailureThreshold: defaultFailureThreshold,
+		Compression:      llm.BasicModel,
+	}
+}
+
+// RoutingPolicyFromConfig - 用户配置覆盖默认路由策略中设置了的字段
+func RoutingPolicyFromConfig(cfg *config.RoutingConfig) RoutingPolicy {
+	policy := DefaultRoutingPolicy()
+	if cfg == nil {
+		return policy
+	}
+
+	override := func(target *llm.ModelType, value llm.ModelType) {
+		if value != "" {
+			*target = value
+		}
+	}
+	override(&policy.Default, cfg.Default)
+	override(&policy.Planning, cfg.Planning)
+	override(&policy.Debugging, cfg.Debugging)
+	override(&policy.Synthesis, cfg.Synthesis)
+	override(&policy.Compression, cfg.Compression)
+	if cfg.FailureThreshold > 0 {
+		policy.FailureThreshold = cfg.FailureThreshold
+	}
+	return policy
+}
+
+// ModelRoute - 一次迭代的路由结果
+type ModelRoute struct {
+	Kind      StepKind
+	ModelType llm.ModelType
+	Model     string
+	Reason    string
+}
+
+// ModelRouter - 根据迭代状态在基础模型和推理模型之间选择
+type ModelRouter struct {
+	policy    RoutingPolicy
+	llmConfig *llm.Config
+}
+
+// NewModelRouter - 创建模型路由器
+func NewModelRouter(policy RoutingPolicy, llmConfig *llm.Config) *ModelRouter {
+	return &ModelRouter{policy: policy, llmConfig: llmConfig}
+}
+
+// Policy - 返回路由策略
+func (r *ModelRouter) Policy() RoutingPolicy {
+	return r.policy
+}
+
+// RouteIteration - 选择一次ReAct迭代使用的模型
+func (r *ModelRouter) RouteIteration(iteration, consecutiveFailures int) ModelRoute {
+	switch {
+	case r.policy.FailureThreshold > 0 && consecutiveFailures >= r.policy.FailureThreshold:
+		return r.routeWithTools(StepDebugging, r.policy.Debugging, fmt.Sprintf("%d consecutive tool failures", consecutiveFailures))
+	case iteration == 1:
+		return r.routeWithTools(StepPlanning, r.policy.Planning, "planning the task")
+	default:
+		return r.route(StepExecution, r.policy.Default, "")
+	}
+}
+
+// RouteSynthesis - 选择最终回答使用的模型。served 为起草回答的模型，ok 为 false 表示无需改写
+func (r *ModelRouter) RouteSynthesis(served ModelRoute) (ModelRoute, bool) {
+	if r.policy.Synthesis == "" {
+		return ModelRoute{}, false
+	}
+	route := r.route(StepSynthesis, r.policy.Synthesis, "writing the final answer")
+	// 同一个模型重新生成没有意义
+	if route.Model == served.Model {
+		return route, false
+	}
+	return route, true
+}
+
+// RouteCompression - 选择上下文压缩摘要使用的模型
+func (r *ModelRouter) RouteCompression() ModelRoute {
+	return r.route(StepCompression, r.policy.Compression, "summarizing context")
+}
+
+// routeWithTools - 迭代需要调用工具，模型不支持工具调用时退回默认模型
+func (r *ModelRouter) routeWithTools(kind StepKind, modelType llm.ModelType, reason string) ModelRoute {
+	route := r.route(kind, modelType, reason)
+	if modelType != r.policy.Default && !llm.LookupCapabilities(route.Model).Tools {
+		log.Printf("[WARN] ModelRouter: %s does not support tool calling, using the %s model for %s", route.Model, r.policy.Default, kind)
+		return r.route(kind, r.policy.Default, reason)
+	}
+	return route
+}
+
+func (r *ModelRouter) route(kind StepKind, modelType llm.ModelType, reason string) ModelRoute {
+	if modelType == "" {
+		modelType = llm.BasicModel
+	}
+	return ModelRoute{
+		Kind:      kind,
+		ModelType: modelType,
+		Model:     llm.ModelFor(r.llmConfig, modelType),
+		Reason:    reason,
+	}
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"testing"
+
+	"alex/internal/config"
+	"alex/internal/llm"
+	"alex/pkg/types"
+)
+
+func newRouterTestConfig(basic, reasoning string) *llm.Config {
+	return &llm.Config{
+		Models: map[llm.ModelType]*llm.ModelConfig{
+			llm.BasicModel:     {Model: basic},
+			llm.ReasoningModel: {Model: reasoning},
+		},
+	}
+}
+
+// TestModelRouter_RouteIteration 测试规划、调试和常规迭代的模型选择
+func TestModelRouter_RouteIteration(t *testing.T) {
+	router := NewModelRouter(DefaultRoutingPolicy(), newRouterTestConfig("deepseek-chat", "claude-sonnet-4"))
+
+	tests := []struct {
+		name      string
+		iteration int
+		failures  int
+		kind      StepKind
+		model     string
+	}{
+		{"first iteration plans", 1, 0, StepPlanning, "claude-sonnet-4"},
+		{"regular iteration", 2, 1, StepExecution, "deepseek-chat"},
+		{"repeated failures", 3, 2, StepDebugging, "claude-sonnet-4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := router.RouteIteration(tt.iteration, tt.failures)
+			if route.Kind != tt.kind || route.Model != tt.model {
+				t.Errorf("RouteIteration(%d, %d) = %s/%s, want %s/%s", tt.iteration, tt.failures, route.Kind, route.Model, tt.kind, tt.model)
+			}
+		})
+	}
+
+	if route := router.RouteCompression(); route.Model != "deepseek-chat" {
+		t.Errorf("compression should use the basic model, got %s", route.Model)
+	}
+}
+
+// TestModelRouter_ToolsFallback 测试推理模型不支持工具调用时退回默认模型
+func TestModelRouter_ToolsFallback(t *testing.T) {
+	router := NewModelRouter(DefaultRoutingPolicy(), newRouterTestConfig("deepseek-chat", "deepseek-reasoner"))
+
+	if route := router.RouteIteration(1, 0); route.Model != "deepseek-chat" || route.Kind != StepPlanning {
+		t.Errorf("planning should fall back to the basic model, got %s/%s", route.Kind, route.Model)
+	}
+
+	// 最终回答改写默认关闭
+	served := router.RouteIteration(2, 0)
+	if _, ok := router.RouteSynthesis(served); ok {
+		t.Error("synthesis should be off by default")
+	}
+
+	// 最终回答不需要工具，仍使用推理模型
+	policy := DefaultRoutingPolicy()
+	policy.Synthesis = llm.ReasoningModel
+	router = NewModelRouter(policy, newRouterTestConfig("deepseek-chat", "deepseek-reasoner"))
+	route, ok := router.RouteSynthesis(served)
+	if !ok || route.Model != "deepseek-reasoner" {
+		t.Errorf("RouteSynthesis() = %s, %v; want deepseek-reasoner, true", route.Model, ok)
+	}
+}
+
+// TestModelRouter_SameModel 测试两类模型相同时不重写最终回答
+func TestModelRouter_SameModel(t *testing.T) {
+	policy := DefaultRoutingPolicy()
+	policy.Synthesis = llm.ReasoningModel
+	router := NewModelRouter(policy, newRouterTestConfig("kimi-k2", "kimi-k2"))
+	if _, ok := router.RouteSynthesis(router.RouteIteration(2, 0)); ok {
+		t.Error("synthesis should be skipped when the draft came from the same model")
+	}
+}
+
+// TestRoutingPolicyFromConfig 测试用户配置覆盖默认策略
+func TestRoutingPolicyFromConfig(t *testing.T) {
+	policy := RoutingPolicyFromConfig(&config.RoutingConfig{Planning: llm.BasicModel, FailureThreshold: 4})
+
+	want := DefaultRoutingPolicy()
+	want.Planning = llm.BasicModel
+	want.FailureThreshold = 4
+	if policy != want {
+		t.Errorf("RoutingPolicyFromConfig() = %+v, want %+v", policy, want)
+	}
+}
+
+// TestCountConsecutiveFailures 测试成功的工具调用会清零失败计数
+func TestCountConsecutiveFailures(t *testing.T) {
+	results := []*types.ReactToolResult{{Success: false}, {Success: true}, {Success: false}, {Success: false}}
+	if got := countConsecutiveFailures(1, results); got != 2 {
+		t.Errorf("countConsecutiveFailures() = %d, want 2", got)
+	}
+	if got := countConsecutiveFailures(2, []*types.ReactToolResult{{Success: false}}); got != 3 {
+		t.Errorf("countConsecutiveFailures() = %d, want 3", got)
+	}
+}
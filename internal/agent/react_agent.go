@@ -7,9 +7,13 @@ import (
 	"sync"
 	"time"
 
+	"alex/internal/checkpoint"
 	"alex/internal/config"
+	"alex/internal/context/message"
 	"alex/internal/llm"
+	"alex/internal/permissions"
 	"alex/internal/prompts"
+	"alex/internal/schema"
 	"alex/internal/session"
 	"alex/internal/tools/builtin"
 	"alex/internal/tools/mcp"
@@ -31,6 +35,9 @@ type ReactAgent struct {
 	config         *types.ReactConfig
 	llmConfig      *llm.Config
 	currentSession *session.Session
+	permissions    *permissions.Manager
+	checkpoints    *checkpoint.Store
+	outputSchema   *schema.Schema // 非空时最终回答必须是符合该 schema 的 JSON
 
 	// 核心组件
 	reactCore     ReactCoreInterface
@@ -59,6 +66,11 @@ type StreamChunk struct {
 	TotalTokensUsed  int                    `json:"total_tokens_used,omitempty"`
 	PromptTokens     int                    `json:"prompt_tokens,omitempty"`
 	CompletionTokens int                    `json:"completion_tokens,omitempty"`
+	Cost             float64                `json:"cost,omitempty"`
+	TotalCost        float64                `json:"total_cost,omitempty"`
+	CacheReadTokens  int                    `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int                    `json:"cache_write_tokens,omitempty"`
+	Model            string                 `json:"model,omitempty"` // 本次调用实际使用的模型
 }
 
 // StreamCallback - 流式回调函数
@@ -102,13 +114,21 @@ func NewReactAgent(configManager *config.Manager) (*ReactAgent, error) {
 		tools[tool.Name()] = tool
 	}
 
+	// 创建文件检查点存储，失败时不影响正常使用，只是无法撤销
+	checkpoints, err := checkpoint.NewStore()
+	if err != nil {
+		log.Printf("[WARN] ReactAgent: Checkpoints disabled: %v", err)
+	}
+
 	agent := &ReactAgent{
 		llm:            llmClient,
 		configManager:  configManager,
 		sessionManager: sessionManager,
 		tools:          tools,
-		config:         types.NewReactConfig(),
+		config:         newReactConfigFromManager(configManager),
 		llmConfig:      llmConfig,
+		permissions:    permissions.NewManager(configManager.GetConfig().Permissions, configManager.AddPermissionRule),
+		checkpoints:    checkpoints,
 
 		promptBuilder: NewLightPromptBuilder(),
 	}
@@ -122,6 +142,87 @@ func NewReactAgent(configManager *config.Manager) (*ReactAgent, error) {
 	return agent, nil
 }
 
+// SetPermissionPrompter - 设置工具调用需要用户确认时使用的交互函数
+func (r *ReactAgent) SetPermissionPrompter(prompter permissions.Prompter) {
+	r.permissions.SetPrompter(prompter)
+}
+
+// SetPermissionNotifier - 设置非交互模式下自动拒绝工具调用时的通知
+func (r *ReactAgent) SetPermissionNotifier(notifier permissions.Notifier) {
+	r.permissions.SetNotifier(notifier)
+}
+
+// SetNonInteractive - 非交互模式下不弹出确认，按配置的非交互策略处理
+func (r *ReactAgent) SetNonInteractive(nonInteractive bool) {
+	r.permissions.SetNonInteractive(nonInteractive)
+}
+
+// SetOutputSchema - 要求最终回答是符合 schema 的 JSON，nil 表示不限制
+func (r *ReactAgent) SetOutputSchema(s *schema.Schema) {
+	r.outputSchema = s
+}
+
+// UndoLastCheckpoint - 撤销当前会话最近一次迭代对文件的修改
+func (r *ReactAgent) UndoLastCheckpoint() (int, []string, error) {
+	r.mu.RLock()
+	currentSession := r.currentSession
+	r.mu.RUnlock()
+
+	if currentSession == nil {
+		return 0, nil, fmt.Errorf("no active session")
+	}
+	if r.checkpoints == nil {
+		return 0, nil, fmt.Errorf("checkpoints are not available")
+	}
+	return r.checkpoints.Undo(currentSession.ID)
+}
+
+// compressionStrategyKey - 会话配置中覆盖全局压缩策略的键
+const compressionStrategyKey = "compression_strategy"
+
+// SetSessionCompressionStrategy - 为当前会话选择压缩策略，保存在会话中，恢复会话时继续使用
+func (r *ReactAgent) SetSessionCompressionStrategy(strategy string) error {
+	if _, err := message.NewCompressionStrategy(nil, strategy, 0); err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	currentSession := r.currentSession
+	r.mu.RUnlock()
+
+	if currentSession == nil {
+		return fmt.Errorf("no active session")
+	}
+	currentSession.SetConfig(compressionStrategyKey, strategy)
+	return nil
+}
+
+// defaultMaxTurns - 配置中没有 max_turns 时的迭代上限
+const defaultMaxTurns = 100
+
+// newReactConfigFromManager - 使用用户配置中的迭代次数和任务预算覆盖默认ReAct配置
+func newReactConfigFromManager(configManager *config.Manager) *types.ReactConfig {
+	reactConfig := types.NewReactConfig()
+	reactConfig.MaxIterations = defaultMaxTurns
+	// 只有配置了 task_timeout 才限制任务耗时
+	reactConfig.TaskTimeout = 0
+	cfg := configManager.GetConfig()
+	if cfg == nil {
+		return reactConfig
+	}
+
+	if cfg.MaxTurns > 0 {
+		reactConfig.MaxIterations = cfg.MaxTurns
+	}
+	if cfg.TaskTimeout > 0 {
+		reactConfig.TaskTimeout = time.Duration(cfg.TaskTimeout) * time.Second
+	}
+	reactConfig.MaxTaskTokens = cfg.MaxTaskTokens
+	reactConfig.MaxTaskCost = cfg.MaxTaskCost
+
+	return reactConfig
+}
+
 // ========== 会话管理 ==========
 
 // StartSession - 开始会话
@@ -153,6 +254,17 @@ func (r *ReactAgent) RestoreSession(sessionID string) (*session.Session, error)
 	return session, nil
 }
 
+// taskImagesKey - 用户随消息附加的图片，通过context传给SolveTask
+type taskImagesKey struct{}
+
+// ProcessMessageStreamWithImages - 流式处理附带图片的消息
+func (r *ReactAgent) ProcessMessageStreamWithImages(ctx context.Context, userMessage string, images []llm.ContentPart, config *config.Config, callback StreamCallback) error {
+	if len(images) > 0 {
+		ctx = context.WithValue(ctx, taskImagesKey{}, images)
+	}
+	return r.ProcessMessageStream(ctx, userMessage, config, callback)
+}
+
 // ProcessMessageStream - 流式处理消息
 func (r *ReactAgent) ProcessMessageStream(ctx context.Context, userMessage string, config *config.Config, callback StreamCallback) error {
 	log.Printf("[DEBUG] ====== ProcessMessageStream called with message: %s", userMessage)
@@ -198,11 +310,17 @@ func (r *ReactAgent) ProcessMessageStream(ctx context.Context, userMessage strin
 			"streaming":   true,
 			"confidence":  result.Confidence,
 			"tokens_used": result.TokensUsed,
+			"cost":        result.Cost,
 		},
 		Timestamp: time.Now(),
 	}
 	currentSession.AddMessage(assistantMsg)
 
+	// 持久化会话，保存累计的token和费用
+	if err := r.sessionManager.SaveSession(currentSession); err != nil {
+		log.Printf("[WARN] ReactAgent: Failed to save session %s: %v", currentSession.ID, err)
+	}
+
 	// Memory generation removed
 
 	// 发送完成信号
@@ -214,6 +332,7 @@ func (r *ReactAgent) ProcessMessageStream(ctx context.Context, userMessage strin
 			TotalTokensUsed:  result.TokensUsed,
 			PromptTokens:     result.PromptTokens,
 			CompletionTokens: result.CompletionTokens,
+			TotalCost:        result.Cost,
 		})
 	}
 
@@ -259,9 +378,9 @@ func (r *ReactAgent) parseToolCalls(message *llm.Message) []*types.ReactToolCall
 	return r.toolExecutor.parseToolCalls(message)
 }
 
-// executeSerialToolsStream - 委托给ToolExecutor
-func (r *ReactAgent) executeSerialToolsStream(ctx context.Context, toolCalls []*types.ReactToolCall, callback StreamCallback) []*types.ReactToolResult {
-	return r.toolExecutor.executeSerialToolsStream(ctx, toolCalls, callback)
+// executeToolsStream - 委托给ToolExecutor
+func (r *ReactAgent) executeToolsStream(ctx context.Context, toolCalls []*types.ReactToolCall, callback StreamCallback) []*types.ReactToolResult {
+	return r.toolExecutor.executeToolsStream(ctx, toolCalls, callback)
 }
 
 // ========== 组件创建函数 ==========
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"alex/internal/context/repomap"
+	"alex/internal/session"
+	"alex/pkg/types"
+)
+
+// fileTools are the tools whose path argument marks a file the session worked on
+var fileTools = map[string]bool{"file_read": true, "file_edit": true, "file_replace": true}
+
+// buildRepoMap - 生成工作目录的代码结构图，按任务和会话最近操作的文件排序
+func (rc *ReactCore) buildRepoMap(taskCtx *types.ReactTaskContext) string {
+	budget := 0
+	if rc.agent.configManager != nil {
+		budget = rc.agent.configManager.GetConfig().RepoMapTokens
+	}
+	if budget < 0 || taskCtx.WorkingDir == "" {
+		return ""
+	}
+	// 在主目录或根目录中运行时不扫描
+	if home, err := os.UserHomeDir(); err == nil && filepath.Clean(taskCtx.WorkingDir) == filepath.Clean(home) {
+		return ""
+	}
+	if filepath.Dir(taskCtx.WorkingDir) == taskCtx.WorkingDir {
+		return ""
+	}
+
+	generator, err := repomap.NewGenerator(taskCtx.WorkingDir)
+	if err != nil {
+		log.Printf("[WARN] ReactCore: repo map disabled: %v", err)
+		return ""
+	}
+	generator.SetTokenizer(rc.messageProcessor.TokenEstimator().Tokenizer())
+
+	var touched []string
+	if sess := rc.agent.currentSession; sess != nil {
+		touched = touchedFiles(sess.GetMessages())
+	}
+	repoMap, err := generator.Generate(repomap.Options{Task: taskCtx.Goal, Touched: touched, Budget: budget})
+	if err != nil {
+		log.Printf("[WARN] ReactCore: failed to build repo map: %v", err)
+		return ""
+	}
+	return repoMap
+}
+
+// touchedFiles returns the files the session read or edited, most recent first
+func touchedFiles(messages []*session.Message) []string {
+	var files []string
+	for i := len(messages) - 1; i >= 0; i-- {
+		for _, tc := range messages[i].ToolCalls {
+			if !fileTools[tc.Name] {
+				continue
+			}
+			path, _ := tc.Args["file_path"].(string)
+			if path == "" {
+				path, _ = tc.Args["path"].(string)
+			}
+			if path != "" {
+				files = append(files, path)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,302 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"alex/internal/config"
+	"alex/internal/context/message"
+	"alex/internal/llm"
+	"alex/internal/llm/llmtest"
+	"alex/internal/permissions"
+)
+
+// newScenarioAgent - 创建指向 modelConfig 的 agent，需要确认的工具调用一律放行。
+// capabilities 覆盖模型能力表，例如缩小上下文窗口
+func newScenarioAgent(t *testing.T, modelConfig *llm.ModelConfig, capabilities map[string]llm.ModelCapabilities) (*ReactAgent, *config.Manager) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	configMgr, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, modelType := range []llm.ModelType{llm.BasicModel, llm.ReasoningModel} {
+		if err := configMgr.SetModelConfig(modelType, modelConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if capabilities != nil {
+		if err := configMgr.Set("capabilities", capabilities); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { llm.ConfigureCapabilities(nil) })
+	}
+	agent, err := NewReactAgent(configMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent.SetPermissionPrompter(func(ctx context.Context, req permissions.Request) (permissions.Approval, error) {
+		return permissions.ApprovalOnce, nil
+	})
+	return agent, configMgr
+}
+
+// runScenario - 执行任务并返回最终回答
+func runScenario(t *testing.T, agent *ReactAgent, configMgr *config.Manager, task string) string {
+	t.Helper()
+	var answer string
+	err := agent.ProcessMessageStream(context.Background(), task, configMgr.GetConfig(), func(chunk StreamChunk) {
+		if chunk.Type == "final_answer" {
+			answer = chunk.Content
+		}
+	})
+	if err != nil {
+		t.Fatalf("task failed: %v", err)
+	}
+	return answer
+}
+
+// TestScenario_EditRunAnswer 测试完整的工具循环：修改文件、运行 bash、给出回答
+func TestScenario_EditRunAnswer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greeting.txt")
+	if err := os.WriteFile(path, []byte("hello world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := llmtest.NewServer(t,
+		llmtest.CallTools(llmtest.ToolCall("call_edit", "file_edit", map[string]any{
+			"file_path": path, "old_string": "hello world", "new_string": "hello alex",
+		})).Named("edit").Expect(
+			llmtest.OffersTool("file_edit"), llmtest.OffersTool("bash"), llmtest.Contains("greeting.txt"), llmtest.Streaming(true)),
+		llmtest.CallTools(llmtest.ToolCall("call_bash", "bash", map[string]any{"command": "cat " + path})).Named("bash").Expect(
+			llmtest.ToolCallsPaired(), llmtest.HasToolResult("call_edit", "")),
+		llmtest.Reply("greeting.txt now says hello alex.").Named("answer").Expect(
+			llmtest.ToolCallsPaired(), llmtest.HasToolResult("call_bash", "hello alex")),
+	)
+
+	agent, configMgr := newScenarioAgent(t, server.ModelConfig("gpt-4o"), nil)
+	answer := runScenario(t, agent, configMgr, "Change the greeting in "+path+" to hello alex")
+
+	server.AssertDone()
+	if !strings.Contains(answer, "hello alex") {
+		t.Errorf("unexpected final answer %q", answer)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "hello alex\n" {
+		t.Errorf("file_edit did not change the file: %q, %v", data, err)
+	}
+}
+
+// TestScenario_CompressionKeepsToolPairing 测试长工具循环触发压缩后请求仍然合法
+func TestScenario_CompressionKeepsToolPairing(t *testing.T) {
+	dir := t.TempDir()
+	var turns []llmtest.Turn
+	const reads = 10
+	for i := 1; i <= reads; i++ {
+		// 最后一次读取的结果超过压缩阈值；压缩后它被摘要替代，请求重新回到窗口内
+		lines := 5
+		if i == reads {
+			lines = 2000
+		}
+		path := filepath.Join(dir, fmt.Sprintf("notes_%d.txt", i))
+		if err := os.WriteFile(path, []byte(strings.Repeat(fmt.Sprintf("note %d of the long investigation\n", i), lines)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		turns = append(turns, llmtest.CallTools(llmtest.ToolCall(fmt.Sprintf("call_%d", i), "file_read", map[string]any{"file_path": path})).
+			Named(fmt.Sprintf("read %d", i)).Expect(llmtest.ToolCallsPaired()))
+	}
+	// 第 11 次迭代前消息数和 token 都超过阈值，摘要请求先于该迭代发出
+	turns = append(turns,
+		llmtest.Reply("Read ten note files about the investigation.").Named("summary").Expect(
+			llmtest.Contains("note 10 of the long investigation")),
+		llmtest.Reply("The notes describe a long investigation.").Named("answer").Expect(
+			llmtest.ToolCallsPaired(),
+			llmtest.Contains("Read ten note files"),
+			llmtest.Lacks("note 10 of the long investigation"),
+			llmtest.MaxMessages(12)),
+	)
+
+	client := llmtest.NewClient(t, turns...).Install()
+	agent, configMgr := newScenarioAgent(t, &llm.ModelConfig{BaseURL: "http://llmtest.invalid", APIKey: "llmtest", Model: "tiny-model"},
+		map[string]llm.ModelCapabilities{"tiny-model": {ContextWindow: 16000, MaxOutput: 2000, Tools: true, Streaming: true}})
+	// 大输出留在对话中，由压缩处理
+	if err := configMgr.Set("tool_output_limit", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	answer := runScenario(t, agent, configMgr, "Read the notes in "+dir)
+
+	client.AssertDone()
+	if answer != "The notes describe a long investigation." {
+		t.Errorf("unexpected final answer %q", answer)
+	}
+	if stats := agent.currentSession.GetCompressionStats(); stats == nil || stats.Strategy != message.StrategyCacheFriendly || stats.TokensSaved <= 0 {
+		t.Errorf("the compression should be recorded in the session, got %+v", stats)
+	}
+}
+
+// TestScenario_SlidingWindowCompression 测试会话选择的滑动窗口策略：不请求摘要，只保留最近的工具调用
+func TestScenario_SlidingWindowCompression(t *testing.T) {
+	dir := t.TempDir()
+	var turns []llmtest.Turn
+	const reads = 8
+	for i := 1; i <= reads; i++ {
+		// 第 3 次读取的结果很大，压缩时它已在窗口之外
+		lines := 5
+		if i == 3 {
+			lines = 2800
+		}
+		path := filepath.Join(dir, fmt.Sprintf("notes_%d.txt", i))
+		if err := os.WriteFile(path, []byte(strings.Repeat(fmt.Sprintf("note %d of the long investigation\n", i), lines)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		turns = append(turns, llmtest.CallTools(llmtest.ToolCall(fmt.Sprintf("call_%d", i), "file_read", map[string]any{"file_path": path})).
+			Named(fmt.Sprintf("read %d", i)).Expect(llmtest.ToolCallsPaired()))
+	}
+	turns = append(turns, llmtest.Reply("Done reading.").Named("answer").Expect(
+		llmtest.ToolCallsPaired(),
+		llmtest.Contains("note 8 of the long investigation"),
+		llmtest.Lacks("note 3 of the long investigation")))
+
+	client := llmtest.NewClient(t, turns...).Install()
+	agent, configMgr := newScenarioAgent(t, &llm.ModelConfig{BaseURL: "http://llmtest.invalid", APIKey: "llmtest", Model: "tiny-model"},
+		map[string]llm.ModelCapabilities{"tiny-model": {ContextWindow: 40000, MaxOutput: 2000, Tools: true, Streaming: true}})
+	if err := configMgr.Set("compression", &config.CompressionConfig{Window: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := configMgr.Set("tool_output_limit", -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.StartSession(""); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.SetSessionCompressionStrategy(message.StrategySlidingWindow); err != nil {
+		t.Fatal(err)
+	}
+
+	runScenario(t, agent, configMgr, "Read the notes in "+dir)
+
+	client.AssertDone()
+	if stats := agent.currentSession.GetCompressionStats(); stats == nil || stats.Strategy != message.StrategySlidingWindow {
+		t.Errorf("the session strategy should be used, got %+v", stats)
+	}
+}
+
+// TestScenario_ElidesSupersededRead 测试再次读取同一文件后，之前的输出被替换为指向溢出文件的存根
+func TestScenario_ElidesSupersededRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.go")
+	if err := os.WriteFile(path, []byte(strings.Repeat("// generated line\n", 200)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := func(id string) llmtest.Turn {
+		return llmtest.CallTools(llmtest.ToolCall(id, "file_read", map[string]any{"file_path": path}))
+	}
+
+	client := llmtest.NewClient(t,
+		read("call_1").Named("first read"),
+		read("call_2").Named("second read"),
+		llmtest.Reply("Read it twice.").Named("answer").Expect(
+			llmtest.ToolCallsPaired(),
+			llmtest.HasToolResult("call_1", "[elided file_read output (file_path="+path+")"),
+			llmtest.HasToolResult("call_2", "generated line")),
+	).Install()
+	agent, configMgr := newScenarioAgent(t, &llm.ModelConfig{BaseURL: "http://llmtest.invalid", APIKey: "llmtest", Model: "gpt-4o"}, nil)
+	if _, err := agent.StartSession(""); err != nil {
+		t.Fatal(err)
+	}
+
+	runScenario(t, agent, configMgr, "Read "+path+" twice")
+
+	client.AssertDone()
+	if stats := agent.currentSession.GetCompressionStats(); stats == nil || stats.Elided != 1 || stats.Runs != 0 {
+		t.Errorf("the elision should be recorded without a strategy run, got %+v", stats)
+	}
+}
+
+// TestScenario_SpillsLargeOutput 测试超过限制的输出只以预览进入对话，read_output 可以在溢出文件中搜索
+func TestScenario_SpillsLargeOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.log")
+	var log strings.Builder
+	for i := 1; i <= 3000; i++ {
+		fmt.Fprintf(&log, "step %d compiled\n", i)
+	}
+	if err := os.WriteFile(path, []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := llmtest.NewClient(t,
+		llmtest.CallTools(llmtest.ToolCall("call_1", "file_read", map[string]any{"file_path": path})).Named("read log"),
+		llmtest.CallTools(llmtest.ToolCall("call_2", "read_output", map[string]any{"handle": "call_1", "pattern": "step 1500 "})).Named("search").Expect(
+			llmtest.HasToolResult("call_1", `saved as handle "call_1"`),
+			llmtest.HasToolResult("call_1", "step 1 compiled"),
+			llmtest.HasToolResult("call_1", "step 3000 compiled"),
+			llmtest.Lacks("step 1500 compiled")),
+		llmtest.Reply("Step 1500 compiled.").Named("answer").Expect(
+			llmtest.ToolCallsPaired(),
+			llmtest.HasToolResult("call_2", "step 1500 compiled")),
+	).Install()
+	agent, configMgr := newScenarioAgent(t, &llm.ModelConfig{BaseURL: "http://llmtest.invalid", APIKey: "llmtest", Model: "gpt-4o"}, nil)
+	sess, err := agent.StartSession("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runScenario(t, agent, configMgr, "Did step 1500 compile? The log is "+path)
+
+	client.AssertDone()
+	if _, err := agent.GetSessionManager().ToolOutputPath(sess.ID, "call_1"); err != nil {
+		t.Errorf("the full output should be saved: %v", err)
+	}
+}
+
+// TestScenario_SynthesisStreamsOneAnswer 测试开启最终回答改写时，用户只看到改写后的回答
+func TestScenario_SynthesisStreamsOneAnswer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("release on friday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := llmtest.NewClient(t,
+		llmtest.CallTools(llmtest.ToolCall("call_1", "file_read", map[string]any{"file_path": path})).Named("read"),
+		llmtest.Reply("draft: friday").Named("draft"),
+		llmtest.Reply("The release is on Friday.").Named("synthesis").Expect(llmtest.Lacks("draft: friday")),
+	).Install()
+
+	t.Setenv("HOME", t.TempDir())
+	configMgr, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for modelType, model := range map[llm.ModelType]string{llm.BasicModel: "gpt-4o-mini", llm.ReasoningModel: "gpt-4o"} {
+		if err := configMgr.SetModelConfig(modelType, &llm.ModelConfig{BaseURL: "http://llmtest.invalid", APIKey: "llmtest", Model: model}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := configMgr.Set("routing", &config.RoutingConfig{Synthesis: llm.ReasoningModel}); err != nil {
+		t.Fatal(err)
+	}
+	agent, err := NewReactAgent(configMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var content strings.Builder
+	err = agent.ProcessMessageStream(context.Background(), "When is the release? See "+path, configMgr.GetConfig(), func(chunk StreamChunk) {
+		if chunk.Type == "llm_content" {
+			content.WriteString(chunk.Content)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.AssertDone()
+	if strings.Contains(content.String(), "draft") || strings.Count(content.String(), "The release is on Friday.") != 1 {
+		t.Errorf("expected only the synthesized answer to be streamed, got %q", content.String())
+	}
+}
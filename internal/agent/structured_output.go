@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"alex/internal/llm"
+	"alex/internal/schema"
+	"alex/pkg/types"
+)
+
+// maxSchemaCorrections - 最终回答不符合 schema 时最多给模型几次修正机会
+const maxSchemaCorrections = 2
+
+// schemaInstructions - 追加到系统提示，要求最终回答是符合 schema 的 JSON
+func schemaInstructions(s *schema.Schema) string {
+	return fmt.Sprintf("\n\n## Output Format\n\nYour final answer (the reply without tool calls) must be a single JSON value that validates against the JSON Schema below. "+
+		"Reply with the JSON only: no markdown code fence and no text before or after it.\n\n%s\n", s.Raw())
+}
+
+// responseFormat - 模型支持时请求 JSON 输出；服务商的 JSON 模式只接受对象
+func (rc *ReactCore) responseFormat() *llm.ResponseFormat {
+	s := rc.agent.outputSchema
+	if s == nil || s.RootType() != "object" {
+		return nil
+	}
+	return &llm.ResponseFormat{
+		Type:       llm.StructuredOutputJSONSchema,
+		JSONSchema: &llm.JSONSchemaFormat{Name: "final_answer", Schema: s.Raw()},
+	}
+}
+
+// enforceOutputSchema - 校验最终回答，失败时先用 jsonrepair 修复，再让模型修正。
+// 返回格式化后的 JSON 和修正消耗的 token
+func (rc *ReactCore) enforceOutputSchema(ctx context.Context, messages []llm.Message, tools []llm.Tool, answer string, route ModelRoute,
+	taskCtx *types.ReactTaskContext, budget *BudgetGovernor, iteration int) (string, int, error) {
+	s := rc.agent.outputSchema
+	tokensUsed := 0
+
+	for attempt := 0; ; attempt++ {
+		result, err := s.Decode(answer)
+		if err == nil {
+			if result.Repaired {
+				log.Printf("[DEBUG] ReactCore: Final answer repaired to match the output schema")
+			}
+			return result.JSON, tokensUsed, nil
+		}
+		if attempt == maxSchemaCorrections {
+			return "", tokensUsed, fmt.Errorf("final answer does not match the output schema after %d corrections: %w", attempt, err)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", tokensUsed, fmt.Errorf("final answer does not match the output schema: %w", err)
+		}
+
+		log.Printf("[WARN] ReactCore: Final answer rejected by the output schema (attempt %d): %v", attempt+1, err)
+		if rc.streamCallback != nil {
+			rc.streamCallback(StreamChunk{
+				Type:     "schema_correction",
+				Content:  err.Error(),
+				Metadata: map[string]any{"iteration": iteration, "attempt": attempt + 1}})
+		}
+
+		messages = append(messages, llm.Message{Role: "user", Content: schemaCorrectionPrompt(err)})
+		request := &llm.ChatRequest{
+			Messages:       messages,
+			ModelType:      route.ModelType,
+			Tools:          tools,
+			ToolChoice:     "none",
+			ResponseFormat: rc.responseFormat(),
+			Config:         rc.agent.llmConfig,
+			MaxTokens:      llm.ResolveMaxTokens(route.Model, rc.agent.llmConfig.MaxTokens),
+		}
+		client, clientErr := llm.GetLLMInstance(route.ModelType)
+		if clientErr != nil {
+			return "", tokensUsed, fmt.Errorf("failed to correct the final answer: %w", clientErr)
+		}
+		response, callErr := rc.llmHandler.callLLMWithRetry(ctx, client, request, 3)
+		if callErr != nil {
+			return "", tokensUsed, fmt.Errorf("failed to correct the final answer: %w", callErr)
+		}
+		if response == nil || len(response.Choices) == 0 {
+			return "", tokensUsed, fmt.Errorf("failed to correct the final answer: empty response")
+		}
+		tokensUsed += rc.recordUsage(taskCtx, budget, request, response, iteration)
+
+		corrected := response.Choices[0].Message
+		messages = append(messages, corrected)
+		answer = corrected.Content
+	}
+}
+
+// schemaCorrectionPrompt - 告诉模型回答哪里不符合 schema
+func schemaCorrectionPrompt(err error) string {
+	var validationErr *schema.ValidationError
+	if errors.As(err, &validationErr) {
+		return "Your final answer does not validate against the required JSON Schema:\n- " +
+			strings.Join(validationErr.Problems, "\n- ") + "\nReply again with only the corrected JSON."
+	}
+	return "Your final answer is not valid JSON. Reply again with only the JSON value required by the schema, without any other text."
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"alex/internal/llm"
+	"alex/internal/tools/builtin"
 	"alex/internal/utils"
 	"alex/pkg/types"
 
@@ -17,12 +19,20 @@ import (
 
 // ToolExecutor - 工具执行器
 type ToolExecutor struct {
-	agent *ReactAgent
+	agent   *ReactAgent
+	outputs *ToolOutputManager
 }
 
 // NewToolExecutor - 创建工具执行器
 func NewToolExecutor(agent *ReactAgent) *ToolExecutor {
-	return &ToolExecutor{agent: agent}
+	// 每次调用时读取限制，配置修改立即生效
+	outputs := NewToolOutputManager(agent.sessionManager, func() int {
+		if agent.configManager == nil {
+			return 0
+		}
+		return agent.configManager.GetConfig().ToolOutputLimit
+	})
+	return &ToolExecutor{agent: agent, outputs: outputs}
 }
 
 // parseToolCalls - 解析 OpenAI 标准工具调用格式和文本格式工具调用
@@ -196,8 +206,13 @@ func (te *ToolExecutor) parseIndividualTextToolCall(callContent string) *types.R
 	}
 }
 
-// executeSerialToolsStream - 串行执行工具调用（流式版本）
-func (te *ToolExecutor) executeSerialToolsStream(ctx context.Context, toolCalls []*types.ReactToolCall, callback StreamCallback) []*types.ReactToolResult {
+// maxConcurrentTools - 并行执行只读工具调用时的最大worker数量
+const maxConcurrentTools = 4
+
+// executeToolsStream - 执行一轮中的全部工具调用（流式版本）
+// 连续的只读工具调用并行执行，修改状态的工具调用按原顺序串行执行；
+// 返回结果的顺序与输入的工具调用顺序（CallID顺序）一致
+func (te *ToolExecutor) executeToolsStream(ctx context.Context, toolCalls []*types.ReactToolCall, callback StreamCallback) []*types.ReactToolResult {
 	if len(toolCalls) == 0 {
 		return []*types.ReactToolResult{
 			{
@@ -207,135 +222,189 @@ func (te *ToolExecutor) executeSerialToolsStream(ctx context.Context, toolCalls
 		}
 	}
 
-	log.Printf("[DEBUG] executeSerialToolsStream: Starting execution of %d tool calls", len(toolCalls))
+	if callback == nil {
+		callback = func(StreamChunk) {}
+	}
+
+	log.Printf("[DEBUG] executeToolsStream: Starting execution of %d tool calls", len(toolCalls))
 	for i, tc := range toolCalls {
-		log.Printf("[DEBUG] executeSerialToolsStream: Tool call %d - Name: '%s', CallID: '%s'", i, tc.Name, tc.CallID)
+		log.Printf("[DEBUG] executeToolsStream: Tool call %d - Name: '%s', CallID: '%s'", i, tc.Name, tc.CallID)
 	}
 
-	// 串行执行工具调用，按顺序一个接一个执行
 	// 确保为每个输入的工具调用都产生一个对应的结果
-	combinedResult := make([]*types.ReactToolResult, 0, len(toolCalls))
+	results := make([]*types.ReactToolResult, len(toolCalls))
+
+	for start := 0; start < len(toolCalls); {
+		end := start + 1
+		if te.isReadOnlyCall(toolCalls[start]) {
+			for end < len(toolCalls) && te.isReadOnlyCall(toolCalls[end]) {
+				end++
+			}
+		}
+
+		if end-start > 1 {
+			log.Printf("[DEBUG] executeToolsStream: Running tool calls %d-%d concurrently", start+1, end)
+			te.executeParallelToolsStream(ctx, toolCalls[start:end], results[start:end], start, callback)
+		} else {
+			results[start] = te.executeSingleToolStream(ctx, start, toolCalls[start], callback)
+		}
+		start = end
+	}
+
+	log.Printf("[DEBUG] executeToolsStream: Completed execution, returning %d results", len(results))
+	return results
+}
+
+// isReadOnlyCall - 判断工具调用是否为只读调用，未知工具按修改状态处理
+func (te *ToolExecutor) isReadOnlyCall(toolCall *types.ReactToolCall) bool {
+	tool, exists := te.agent.tools[toolCall.Name]
+	return exists && builtin.IsReadOnlyTool(tool)
+}
+
+// executeParallelToolsStream - 使用有限的worker并行执行只读工具调用
+// 每个调用的流式输出先缓存，全部完成后按原顺序回放，保证显示顺序与串行执行一致
+func (te *ToolExecutor) executeParallelToolsStream(ctx context.Context, toolCalls []*types.ReactToolCall, results []*types.ReactToolResult, offset int, callback StreamCallback) {
+	chunks := make([][]StreamChunk, len(toolCalls))
+	semaphore := make(chan struct{}, maxConcurrentTools)
+	var wg sync.WaitGroup
 
 	for i, toolCall := range toolCalls {
-		log.Printf("[DEBUG] executeSerialToolsStream: Processing tool call %d/%d - Name: '%s', CallID: '%s'", i+1, len(toolCalls), toolCall.Name, toolCall.CallID)
-
-		// 发送工具开始信号
-		toolCallStr := te.formatToolCallForDisplay(toolCall.Name, toolCall.Arguments)
-		callback(StreamChunk{Type: "tool_start", Content: toolCallStr})
-
-		// 确保每个工具调用都产生一个结果，无论什么情况
-		var finalResult *types.ReactToolResult
-
-		// 使用defer确保即使panic也能恢复并生成错误结果
-		func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("[ERROR] executeSerialToolsStream: Tool call %d panicked: %v", i+1, r)
-					finalResult = &types.ReactToolResult{
-						Success:  false,
-						Error:    fmt.Sprintf("tool execution panicked: %v", r),
-						ToolName: toolCall.Name,
-						ToolArgs: toolCall.Arguments,
-						CallID:   toolCall.CallID,
-					}
-					callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: panic occurred", toolCall.Name)})
-				}
-			}()
+		wg.Add(1)
+		go func(i int, toolCall *types.ReactToolCall) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			bufferCallback := func(chunk StreamChunk) {
+				chunks[i] = append(chunks[i], chunk)
+			}
+			results[i] = te.executeSingleToolStream(ctx, offset+i, toolCall, bufferCallback)
+		}(i, toolCall)
+	}
+	wg.Wait()
+
+	for _, callChunks := range chunks {
+		for _, chunk := range callChunks {
+			callback(chunk)
+		}
+	}
+}
+
+// executeSingleToolStream - 执行单个工具调用并通过回调发送进度，保证总是返回带正确CallID的结果
+func (te *ToolExecutor) executeSingleToolStream(ctx context.Context, index int, toolCall *types.ReactToolCall, callback StreamCallback) *types.ReactToolResult {
+	log.Printf("[DEBUG] executeSingleToolStream: Processing tool call %d - Name: '%s', CallID: '%s'", index+1, toolCall.Name, toolCall.CallID)
 
-			// 执行工具
-			result, err := te.executeTool(ctx, toolCall.Name, toolCall.Arguments, toolCall.CallID)
+	// 发送工具开始信号
+	toolCallStr := te.formatToolCallForDisplay(toolCall.Name, toolCall.Arguments)
+	callback(StreamChunk{Type: "tool_start", Content: toolCallStr})
 
-			if err != nil {
-				log.Printf("[DEBUG] executeSerialToolsStream: Tool call %d failed with error: %v", i+1, err)
-				callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: %v", toolCall.Name, err)})
+	// 确保每个工具调用都产生一个结果，无论什么情况
+	var finalResult *types.ReactToolResult
+
+	// 使用defer确保即使panic也能恢复并生成错误结果
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[ERROR] executeSingleToolStream: Tool call %d panicked: %v", index+1, r)
 				finalResult = &types.ReactToolResult{
 					Success:  false,
-					Error:    err.Error(),
+					Error:    fmt.Sprintf("tool execution panicked: %v", r),
 					ToolName: toolCall.Name,
 					ToolArgs: toolCall.Arguments,
 					CallID:   toolCall.CallID,
 				}
-			} else if result != nil {
-				log.Printf("[DEBUG] executeSerialToolsStream: Tool call %d succeeded", i+1)
-				// 发送工具结果信号
-				var contentStr = result.Content
-
-				// Show diff for file modifications with clean formatting
-				if result.Data != nil {
-					if diffStr, hasDiff := result.Data["diff"].(string); hasDiff && diffStr != "" {
-						cleanDiff := formatDiffForDisplay(diffStr)
-						if cleanDiff != "" {
-							contentStr = result.Content + "\n" + cleanDiff
-						}
-					}
-				}
+				callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: panic occurred", toolCall.Name)})
+			}
+		}()
 
-				// Standard display limit for tool output
-				var displayLimit = 200
+		// 执行工具
+		result, err := te.executeTool(ctx, toolCall.Name, toolCall.Arguments, toolCall.CallID)
 
-				// Use rune-based slicing to properly handle UTF-8 characters like Chinese text
-				runes := []rune(contentStr)
-				if len(runes) > displayLimit {
-					contentStr = string(runes[:displayLimit]) + "..."
+		if err != nil {
+			log.Printf("[DEBUG] executeSingleToolStream: Tool call %d failed with error: %v", index+1, err)
+			callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: %v", toolCall.Name, err)})
+			finalResult = &types.ReactToolResult{
+				Success:  false,
+				Error:    err.Error(),
+				ToolName: toolCall.Name,
+				ToolArgs: toolCall.Arguments,
+				CallID:   toolCall.CallID,
+			}
+		} else if result != nil {
+			log.Printf("[DEBUG] executeSingleToolStream: Tool call %d succeeded", index+1)
+			// 发送工具结果信号
+			var contentStr = result.Content
+
+			// Show diff for file modifications with clean formatting
+			if result.Data != nil {
+				if diffStr, hasDiff := result.Data["diff"].(string); hasDiff && diffStr != "" {
+					cleanDiff := formatDiffForDisplay(diffStr)
+					if cleanDiff != "" {
+						contentStr = result.Content + "\n" + cleanDiff
+					}
 				}
-				callback(StreamChunk{Type: "tool_result", Content: contentStr})
+			}
 
-				// 确保关键字段都正确设置
-				if result.ToolName == "" {
-					result.ToolName = toolCall.Name
-				}
-				if result.CallID == "" {
-					result.CallID = toolCall.CallID
-				}
-				// 确保工具参数也被保存
-				if result.ToolArgs == nil {
-					result.ToolArgs = toolCall.Arguments
-				}
+			// Standard display limit for tool output
+			var displayLimit = 200
 
-				finalResult = result
+			// Use rune-based slicing to properly handle UTF-8 characters like Chinese text
+			runes := []rune(contentStr)
+			if len(runes) > displayLimit {
+				contentStr = string(runes[:displayLimit]) + "..."
+			}
+			callback(StreamChunk{Type: "tool_result", Content: contentStr})
 
-				if !result.Success {
-					callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: %s", toolCall.Name, result.Error)})
-				}
-			} else {
-				// 这种情况不应该发生：err == nil 但 result == nil
-				log.Printf("[ERROR] executeSerialToolsStream: Tool call %d returned nil result without error", i+1)
-				finalResult = &types.ReactToolResult{
-					Success:  false,
-					Error:    "tool execution returned nil result",
-					ToolName: toolCall.Name,
-					ToolArgs: toolCall.Arguments,
-					CallID:   toolCall.CallID,
-				}
-				callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: nil result", toolCall.Name)})
+			// 确保关键字段都正确设置
+			if result.ToolName == "" {
+				result.ToolName = toolCall.Name
+			}
+			if result.CallID == "" {
+				result.CallID = toolCall.CallID
+			}
+			// 确保工具参数也被保存
+			if result.ToolArgs == nil {
+				result.ToolArgs = toolCall.Arguments
 			}
-		}()
 
-		// 最后的安全检查：确保finalResult不为nil且CallID正确
-		if finalResult == nil {
-			log.Printf("[ERROR] executeSerialToolsStream: finalResult is nil for tool call %d, creating emergency fallback", i+1)
+			finalResult = result
+
+			if !result.Success {
+				callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: %s", toolCall.Name, result.Error)})
+			}
+		} else {
+			// 这种情况不应该发生：err == nil 但 result == nil
+			log.Printf("[ERROR] executeSingleToolStream: Tool call %d returned nil result without error", index+1)
 			finalResult = &types.ReactToolResult{
 				Success:  false,
-				Error:    "unknown error: finalResult was nil",
+				Error:    "tool execution returned nil result",
 				ToolName: toolCall.Name,
 				ToolArgs: toolCall.Arguments,
 				CallID:   toolCall.CallID,
 			}
+			callback(StreamChunk{Type: "tool_error", Content: fmt.Sprintf("%s: nil result", toolCall.Name)})
 		}
+	}()
 
-		// 确保CallID一致性的最终检查
-		if finalResult.CallID != toolCall.CallID {
-			log.Printf("[WARN] executeSerialToolsStream: CallID mismatch detected, correcting from '%s' to '%s'", finalResult.CallID, toolCall.CallID)
-			finalResult.CallID = toolCall.CallID
+	// 最后的安全检查：确保finalResult不为nil且CallID正确
+	if finalResult == nil {
+		log.Printf("[ERROR] executeSingleToolStream: finalResult is nil for tool call %d, creating emergency fallback", index+1)
+		finalResult = &types.ReactToolResult{
+			Success:  false,
+			Error:    "unknown error: finalResult was nil",
+			ToolName: toolCall.Name,
+			ToolArgs: toolCall.Arguments,
+			CallID:   toolCall.CallID,
 		}
+	}
 
-		// 确保每个工具调用都有对应的结果
-		combinedResult = append(combinedResult, finalResult)
-		log.Printf("[DEBUG] executeSerialToolsStream: Added result for tool call %d with CallID: '%s'", i+1, finalResult.CallID)
+	// 确保CallID一致性的最终检查
+	if finalResult.CallID != toolCall.CallID {
+		log.Printf("[WARN] executeSingleToolStream: CallID mismatch detected, correcting from '%s' to '%s'", finalResult.CallID, toolCall.CallID)
+		finalResult.CallID = toolCall.CallID
 	}
 
-	log.Printf("[DEBUG] executeSerialToolsStream: Completed execution, returning %d results", len(combinedResult))
-	return combinedResult
+	return finalResult
 }
 
 // formatToolCallForDisplay - 格式化工具调用显示
@@ -430,6 +499,14 @@ func (te *ToolExecutor) executeTool(ctx context.Context, toolName string, args m
 		return nil, fmt.Errorf("tool validation failed: %w", err)
 	}
 
+	// 权限检查：根据规则允许、拒绝或请求用户确认
+	if te.agent.permissions != nil {
+		if err := te.agent.permissions.Check(ctx, toolName, args, builtin.IsReadOnlyTool(tool)); err != nil {
+			log.Printf("[WARN] executeTool: Tool %s blocked: %v", toolName, err)
+			return nil, err
+		}
+	}
+
 	// Session ID injection removed - tools now get session ID directly from manager
 	
 	// 直接执行工具
@@ -453,7 +530,7 @@ func (te *ToolExecutor) executeTool(ctx context.Context, toolName string, args m
 
 	resultObj := &types.ReactToolResult{
 		Success:  true,
-		Content:  strings.TrimLeft(result.Content, " \t"),
+		Content:  te.outputs.Process(callId, toolName, strings.TrimLeft(result.Content, " \t")),
 		Data:     result.Data,
 		Duration: duration,
 		ToolName: toolName,
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"alex/internal/tools/builtin"
+	"alex/pkg/types"
+)
+
+// fakeTool 用于调度测试的工具，记录并发执行数量
+type fakeTool struct {
+	name     string
+	readOnly bool
+	delay    time.Duration
+	running  *int32
+	peak     *int32
+	mu       *sync.Mutex
+	order    *[]string
+}
+
+func (t *fakeTool) Name() string                       { return t.name }
+func (t *fakeTool) Description() string                { return "fake tool" }
+func (t *fakeTool) Parameters() map[string]interface{} { return map[string]interface{}{} }
+func (t *fakeTool) Validate(map[string]interface{}) error {
+	return nil
+}
+func (t *fakeTool) IsReadOnly() bool { return t.readOnly }
+
+func (t *fakeTool) Execute(ctx context.Context, args map[string]interface{}) (*builtin.ToolResult, error) {
+	current := atomic.AddInt32(t.running, 1)
+	for {
+		peak := atomic.LoadInt32(t.peak)
+		if current <= peak || atomic.CompareAndSwapInt32(t.peak, peak, current) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	atomic.AddInt32(t.running, -1)
+
+	t.mu.Lock()
+	*t.order = append(*t.order, fmt.Sprintf("%s:%v", t.name, args["id"]))
+	t.mu.Unlock()
+
+	return &builtin.ToolResult{Content: fmt.Sprintf("%s done", t.name)}, nil
+}
+
+// TestExecuteToolsStream_Scheduling 测试只读工具并行执行、修改工具串行执行且结果保持顺序
+func TestExecuteToolsStream_Scheduling(t *testing.T) {
+	var running, peak int32
+	var mu sync.Mutex
+	var order []string
+
+	newTool := func(name string, readOnly bool) *fakeTool {
+		return &fakeTool{name: name, readOnly: readOnly, delay: 20 * time.Millisecond,
+			running: &running, peak: &peak, mu: &mu, order: &order}
+	}
+
+	agent := &ReactAgent{tools: map[string]builtin.Tool{
+		"file_read": newTool("file_read", true),
+		"file_edit": newTool("file_edit", false),
+	}}
+	executor := NewToolExecutor(agent)
+
+	var toolCalls []*types.ReactToolCall
+	names := []string{"file_read", "file_read", "file_read", "file_edit", "file_read", "file_read"}
+	for i, name := range names {
+		toolCalls = append(toolCalls, &types.ReactToolCall{
+			Name:      name,
+			Arguments: map[string]interface{}{"id": i},
+			CallID:    fmt.Sprintf("call_%d", i),
+		})
+	}
+
+	var chunks []StreamChunk
+	results := executor.executeToolsStream(context.Background(), toolCalls, func(chunk StreamChunk) {
+		chunks = append(chunks, chunk)
+	})
+
+	if len(results) != len(toolCalls) {
+		t.Fatalf("expected %d results, got %d", len(toolCalls), len(results))
+	}
+	for i, result := range results {
+		if result.CallID != toolCalls[i].CallID {
+			t.Errorf("result %d has CallID %s, expected %s", i, result.CallID, toolCalls[i].CallID)
+		}
+		if !result.Success {
+			t.Errorf("result %d failed: %s", i, result.Error)
+		}
+	}
+
+	if peak < 2 {
+		t.Errorf("expected read-only calls to run concurrently, peak concurrency was %d", peak)
+	}
+
+	// file_edit 必须在前三个读取之后、后两个读取之前执行
+	editIndex := -1
+	for i, entry := range order {
+		if entry == "file_edit:3" {
+			editIndex = i
+		}
+	}
+	if editIndex != 3 {
+		t.Errorf("mutating call executed out of order: %v", order)
+	}
+
+	// 流式输出按调用顺序成对出现
+	if len(chunks) != 2*len(toolCalls) {
+		t.Fatalf("expected %d chunks, got %d", 2*len(toolCalls), len(chunks))
+	}
+	for i := 0; i < len(chunks); i += 2 {
+		if chunks[i].Type != "tool_start" || chunks[i+1].Type != "tool_result" {
+			t.Errorf("unexpected chunk order at %d: %s, %s", i, chunks[i].Type, chunks[i+1].Type)
+		}
+	}
+}
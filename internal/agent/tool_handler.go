@@ -44,7 +44,7 @@ func (h *ToolHandler) buildToolDefinitions() []llm.Tool {
 }
 
 // buildToolMessages - 构建工具结果消息
-func (h *ToolHandler) buildToolMessages(actionResult []*types.ReactToolResult, isGemini bool) []llm.Message {
+func (h *ToolHandler) buildToolMessages(actionResult []*types.ReactToolResult) []llm.Message {
 	var toolMessages []llm.Message
 
 	log.Printf("[DEBUG] buildToolMessages: Processing %d tool results", len(actionResult))
@@ -75,26 +75,18 @@ func (h *ToolHandler) buildToolMessages(actionResult []*types.ReactToolResult, i
 			log.Printf("[ERROR] buildToolMessages: - Content length: %d", len(result.Content))
 		}
 
-		// Ensure ToolName is not empty and properly formatted for Gemini API
+		// Ensure ToolName is not empty, some providers match results by name
 		toolName := result.ToolName
 		if toolName == "" {
 			log.Printf("[ERROR] buildToolMessages: Missing ToolName for CallID %s, using 'unknown'", callID)
 			toolName = "unknown"
 		}
 
-		// Debug logging for Gemini API compatibility
 		log.Printf("[DEBUG] buildToolMessages: Creating tool message - Name: '%s', CallID: '%s'", toolName, callID)
 
-		// Gemini API compatibility: ensure tool response format is correct
-		// 兼容所有类型的api
-		role := "tool"
-		if isGemini {
-			content = toolName + " executed result: " + content
-			role = "user"
-		}
-
+		// 统一使用 tool 角色，provider 负责转换为各自的格式
 		toolMessage := llm.Message{
-			Role:       role,
+			Role:       "tool",
 			Content:    content,
 			Name:       toolName,
 			ToolCallId: callID,
@@ -116,6 +108,24 @@ func (h *ToolHandler) buildToolMessages(actionResult []*types.ReactToolResult, i
 	return toolMessages
 }
 
+// buildToolImagesMessage - tool 消息只能是文本，工具读取的图片（file_read 设置 image_path）
+// 放在所有工具结果之后的用户消息中
+func (h *ToolHandler) buildToolImagesMessage(results []*types.ReactToolResult) (llm.Message, bool) {
+	var images []llm.ContentPart
+	for _, result := range results {
+		if result == nil || !result.Success || result.Data == nil {
+			continue
+		}
+		if path, ok := result.Data["image_path"].(string); ok && path != "" {
+			images = append(images, llm.ImageFilePart(path))
+		}
+	}
+	if len(images) == 0 {
+		return llm.Message{}, false
+	}
+	return llm.Message{Role: "user", Content: "Images returned by the tool calls above:", Parts: images}, true
+}
+
 // generateObservation - 生成观察结果
 func (h *ToolHandler) generateObservation(toolResult []*types.ReactToolResult) string {
 	if toolResult == nil {
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"alex/internal/session"
+)
+
+// DefaultToolOutputLimit is the largest tool output, in bytes, sent to the model as is
+const DefaultToolOutputLimit = 32 * 1024
+
+// 超出限制的输出在对话中只保留开头和结尾
+const (
+	outputPreviewHead = 4 * 1024
+	outputPreviewTail = 2 * 1024
+)
+
+// ToolOutputManager saves tool outputs above a size limit under the session directory and
+// replaces them with a head/tail preview and a handle for the read_output tool
+type ToolOutputManager struct {
+	sessionManager *session.Manager
+	limit          func() int
+}
+
+// NewToolOutputManager creates a manager; limit returns the current size limit in bytes,
+// 0 meaning DefaultToolOutputLimit and a negative value no limit
+func NewToolOutputManager(sessionManager *session.Manager, limit func() int) *ToolOutputManager {
+	return &ToolOutputManager{sessionManager: sessionManager, limit: limit}
+}
+
+// Process returns the content to send to the model for the output of a tool call.
+// The output is kept as is when it cannot be saved.
+func (m *ToolOutputManager) Process(callID, toolName, content string) string {
+	limit := DefaultToolOutputLimit
+	if m.limit != nil {
+		if configured := m.limit(); configured != 0 {
+			limit = configured
+		}
+	}
+	// read_output 自身按页返回，不再保存
+	if limit < 0 || len(content) <= limit || toolName == "read_output" || m.sessionManager == nil {
+		return content
+	}
+
+	sessionID, ok := m.sessionManager.GetSessionID()
+	if !ok {
+		return content
+	}
+	if _, err := m.sessionManager.SaveToolOutput(sessionID, callID, content); err != nil {
+		log.Printf("[WARN] ToolOutputManager: failed to save %s output: %v", toolName, err)
+		return content
+	}
+
+	log.Printf("[DEBUG] ToolOutputManager: %s output of %d bytes saved as %s", toolName, len(content), callID)
+	return outputPreview(callID, content, min(outputPreviewHead, limit/2), min(outputPreviewTail, limit/4))
+}
+
+// outputPreview keeps about head bytes from the start and tail bytes from the end of
+// content, cut at line boundaries, around a note with the size and the handle
+func outputPreview(handle, content string, head, tail int) string {
+	start := content[:head]
+	if i := strings.LastIndexByte(start, '\n'); i > 0 {
+		start = start[:i+1]
+	}
+	end := content[len(content)-tail:]
+	if i := strings.IndexByte(end, '\n'); i >= 0 && i < len(end)-1 {
+		end = end[i+1:]
+	}
+	// 按字节截断可能切开多字节字符
+	start = strings.ToValidUTF8(start, "")
+	end = strings.ToValidUTF8(end, "")
+
+	lines := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+	omitted := len(content) - len(start) - len(end)
+	note := fmt.Sprintf("[... %d bytes omitted. The full output (%d lines, %d bytes) is saved as handle %q: use read_output with offset or pattern to see the rest ...]",
+		omitted, lines, len(content), handle)
+
+	if !strings.HasSuffix(start, "\n") {
+		start += "\n"
+	}
+	return start + note + "\n" + end
+}
@@ -26,5 +26,6 @@ func buildFinalResult(taskCtx *types.ReactTaskContext, answer string, confidence
 		TokensUsed:       taskCtx.TokensUsed,
 		PromptTokens:     taskCtx.PromptTokens,
 		CompletionTokens: taskCtx.CompletionTokens,
+		Cost:             taskCtx.Cost,
 	}
 }
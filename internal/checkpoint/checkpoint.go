@@ -0,0 +1,418 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrRunning is returned when files are restored while a task of the session is still editing them
+var ErrRunning = errors.New("a task is still running in this session; wait for it to finish")
+
+// Entry records the state of one file before it was first modified in an iteration
+type Entry struct {
+	Iteration int         `json:"iteration"`
+	Path      string      `json:"path"`
+	Existed   bool        `json:"existed"`
+	Mode      os.FileMode `json:"mode,omitempty"`
+	Blob      string      `json:"blob,omitempty"`
+	// CreatedDir is the top-most parent directory that did not exist before the write
+	CreatedDir string    `json:"created_dir,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Checkpoint groups the entries recorded during one iteration
+type Checkpoint struct {
+	Iteration int
+	Files     []string
+	Timestamp time.Time
+}
+
+// manifest is the on-disk index of a session's checkpoints
+type manifest struct {
+	NextBlob int     `json:"next_blob"`
+	Entries  []Entry `json:"entries"`
+}
+
+// Store keeps file snapshots per session under a base directory
+type Store struct {
+	baseDir string
+	mu      sync.Mutex
+}
+
+// NewStore creates a checkpoint store in the default sessions directory
+func NewStore() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return NewStoreAt(filepath.Join(homeDir, ".deep-coding-sessions", "checkpoints")), nil
+}
+
+// NewStoreAt creates a checkpoint store rooted at dir
+func NewStoreAt(dir string) *Store {
+	return &Store{baseDir: dir}
+}
+
+// Snapshot saves the current state of path for the given session and iteration.
+// Only the first snapshot of a path per iteration is kept, so rewinding restores the pre-iteration state.
+func (s *Store) Snapshot(sessionID string, iteration int, path string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session ID is required for checkpoints")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(sessionID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range m.Entries {
+		if entry.Iteration == iteration && entry.Path == absPath {
+			return nil
+		}
+	}
+
+	entry := Entry{Iteration: iteration, Path: absPath, Timestamp: time.Now()}
+	info, err := os.Stat(absPath)
+	switch {
+	case err == nil:
+		content, err := os.ReadFile(absPath)
+		if err != nil {
+			return fmt.Errorf("failed to read file for checkpoint: %w", err)
+		}
+		entry.Existed = true
+		entry.Mode = info.Mode().Perm()
+		entry.Blob = strconv.Itoa(m.NextBlob)
+		m.NextBlob++
+		if err := os.MkdirAll(s.blobDir(sessionID), 0755); err != nil {
+			return fmt.Errorf("failed to create checkpoint directory: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(s.blobDir(sessionID), entry.Blob), content, 0600); err != nil {
+			return fmt.Errorf("failed to write checkpoint: %w", err)
+		}
+	case os.IsNotExist(err):
+		entry.CreatedDir = firstMissingDir(filepath.Dir(absPath))
+	default:
+		return fmt.Errorf("failed to stat file for checkpoint: %w", err)
+	}
+
+	m.Entries = append(m.Entries, entry)
+	return s.save(sessionID, m)
+}
+
+// List returns the session's checkpoints ordered by iteration
+func (s *Store) List(sessionID string) ([]Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	byIteration := make(map[int]*Checkpoint)
+	for _, entry := range m.Entries {
+		cp, ok := byIteration[entry.Iteration]
+		if !ok {
+			cp = &Checkpoint{Iteration: entry.Iteration, Timestamp: entry.Timestamp}
+			byIteration[entry.Iteration] = cp
+		}
+		cp.Files = append(cp.Files, entry.Path)
+	}
+
+	checkpoints := make([]Checkpoint, 0, len(byIteration))
+	for _, cp := range byIteration {
+		checkpoints = append(checkpoints, *cp)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Iteration < checkpoints[j].Iteration })
+	return checkpoints, nil
+}
+
+// LatestIteration returns the highest iteration with a checkpoint, or 0
+func (s *Store) LatestIteration(sessionID string) int {
+	checkpoints, err := s.List(sessionID)
+	if err != nil || len(checkpoints) == 0 {
+		return 0
+	}
+	return checkpoints[len(checkpoints)-1].Iteration
+}
+
+// Rewind restores every file changed after toIteration to its state at that point, deleting
+// files that did not exist yet, and drops the undone checkpoints. It returns the restored paths.
+func (s *Store) Rewind(sessionID string, toIteration int) ([]string, error) {
+	if s.Running(sessionID) {
+		return nil, ErrRunning
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个文件使用 toIteration 之后最早的快照
+	earliest := make(map[string]Entry)
+	var kept []Entry
+	for _, entry := range m.Entries {
+		if entry.Iteration <= toIteration {
+			kept = append(kept, entry)
+			continue
+		}
+		if current, ok := earliest[entry.Path]; !ok || entry.Iteration < current.Iteration {
+			earliest[entry.Path] = entry
+		}
+	}
+
+	paths := make([]string, 0, len(earliest))
+	for path := range earliest {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := s.restore(sessionID, earliest[path]); err != nil {
+			return nil, err
+		}
+	}
+
+	m.Entries = kept
+	if err := s.save(sessionID, m); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// Undo rewinds the most recent checkpoint and returns its iteration
+func (s *Store) Undo(sessionID string) (int, []string, error) {
+	if s.Running(sessionID) {
+		return 0, nil, ErrRunning
+	}
+
+	checkpoints, err := s.List(sessionID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(checkpoints) == 0 {
+		return 0, nil, fmt.Errorf("no checkpoints to undo")
+	}
+
+	latest := checkpoints[len(checkpoints)-1].Iteration
+	restored, err := s.Rewind(sessionID, latest-1)
+	return latest, restored, err
+}
+
+// Remove deletes all checkpoints of a session
+func (s *Store) Remove(sessionID string) error {
+	if s.Running(sessionID) {
+		return ErrRunning
+	}
+	return os.RemoveAll(s.sessionDir(sessionID))
+}
+
+// Sessions returns the IDs of the sessions that have checkpoints
+func (s *Store) Sessions() ([]string, error) {
+	entries, err := os.ReadDir(s.baseDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint directory: %w", err)
+	}
+
+	var sessionIDs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			sessionIDs = append(sessionIDs, entry.Name())
+		}
+	}
+	return sessionIDs, nil
+}
+
+// Begin marks the session as running a task until the returned function is called.
+// While it is marked, Undo, Rewind and Remove refuse to touch the session, also from other processes.
+func (s *Store) Begin(sessionID string) (func(), error) {
+	if sessionID == "" {
+		return nil, fmt.Errorf("session ID is required for checkpoints")
+	}
+	if err := os.MkdirAll(s.sessionDir(sessionID), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	path := s.runningPath(sessionID)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return nil, fmt.Errorf("failed to mark session as running: %w", err)
+	}
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// Running reports whether a live process is running a task in the session
+func (s *Store) Running(sessionID string) bool {
+	data, err := os.ReadFile(s.runningPath(sessionID))
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	if pid == os.Getpid() {
+		return true
+	}
+	// 进程已退出时标记是崩溃留下的，忽略它
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// restore puts one file back into the state recorded by entry
+func (s *Store) restore(sessionID string, entry Entry) error {
+	if !entry.Existed {
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+		}
+		removeEmptyDirs(filepath.Dir(entry.Path), entry.CreatedDir)
+		return nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.blobDir(sessionID), entry.Blob))
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint for %s: %w", entry.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", entry.Path, err)
+	}
+	if err := os.WriteFile(entry.Path, content, entry.Mode); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", entry.Path, err)
+	}
+	return nil
+}
+
+func (s *Store) sessionDir(sessionID string) string {
+	return filepath.Join(s.baseDir, sessionID)
+}
+
+func (s *Store) runningPath(sessionID string) string {
+	return filepath.Join(s.sessionDir(sessionID), "running")
+}
+
+func (s *Store) blobDir(sessionID string) string {
+	return filepath.Join(s.sessionDir(sessionID), "blobs")
+}
+
+func (s *Store) load(sessionID string) (*manifest, error) {
+	data, err := os.ReadFile(filepath.Join(s.sessionDir(sessionID), "manifest.json"))
+	if os.IsNotExist(err) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint manifest: %w", err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint manifest: %w", err)
+	}
+	return &m, nil
+}
+
+func (s *Store) save(sessionID string, m *manifest) error {
+	if err := os.MkdirAll(s.sessionDir(sessionID), 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint manifest: %w", err)
+	}
+	return os.WriteFile(filepath.Join(s.sessionDir(sessionID), "manifest.json"), data, 0644)
+}
+
+// firstMissingDir returns the top-most ancestor of dir that does not exist yet
+func firstMissingDir(dir string) string {
+	missing := ""
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return missing
+		}
+		missing = dir
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return missing
+		}
+		dir = parent
+	}
+}
+
+// removeEmptyDirs removes dir and its empty parents up to and including stop
+func removeEmptyDirs(dir, stop string) {
+	if stop == "" {
+		return
+	}
+	for {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		if dir == stop {
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// Recorder snapshots files for one session iteration; a nil Recorder does nothing
+type Recorder struct {
+	store     *Store
+	sessionID string
+	iteration int
+}
+
+// Recorder returns a recorder bound to a session iteration
+func (s *Store) Recorder(sessionID string, iteration int) *Recorder {
+	return &Recorder{store: s, sessionID: sessionID, iteration: iteration}
+}
+
+// Snapshot records path before it is modified
+func (r *Recorder) Snapshot(path string) error {
+	if r == nil || r.store == nil {
+		return nil
+	}
+	return r.store.Snapshot(r.sessionID, r.iteration, path)
+}
+
+type recorderKey struct{}
+
+// WithRecorder attaches a recorder to the context passed to tools
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// FromContext returns the recorder attached to ctx, or nil
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
@@ -0,0 +1,116 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_RewindAndUndo(t *testing.T) {
+	workDir := t.TempDir()
+	store := NewStoreAt(t.TempDir())
+	session := "test-session"
+
+	existing := filepath.Join(workDir, "main.go")
+	if err := os.WriteFile(existing, []byte("v0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(workDir, "pkg", "new", "file.go")
+
+	// iteration 1: edit main.go twice, only the first snapshot counts
+	rec := store.Recorder(session, 1)
+	if err := rec.Snapshot(existing); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(existing, []byte("v1"), 0644)
+	if err := rec.Snapshot(existing); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(existing, []byte("v1b"), 0644)
+
+	// iteration 2: edit main.go again and create a new file in new directories
+	rec = store.Recorder(session, 2)
+	_ = rec.Snapshot(existing)
+	_ = os.WriteFile(existing, []byte("v2"), 0644)
+	_ = rec.Snapshot(created)
+	_ = os.MkdirAll(filepath.Dir(created), 0755)
+	_ = os.WriteFile(created, []byte("new"), 0644)
+
+	checkpoints, err := store.List(session)
+	if err != nil || len(checkpoints) != 2 {
+		t.Fatalf("expected 2 checkpoints, got %v (%v)", checkpoints, err)
+	}
+
+	iteration, restored, err := store.Undo(session)
+	if err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if iteration != 2 || len(restored) != 2 {
+		t.Errorf("expected to undo iteration 2 with 2 files, got %d %v", iteration, restored)
+	}
+	if content, _ := os.ReadFile(existing); string(content) != "v1b" {
+		t.Errorf("expected main.go restored to v1b, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "pkg")); !os.IsNotExist(err) {
+		t.Error("expected created file and its new directories to be removed")
+	}
+
+	if _, err := store.Rewind(session, 0); err != nil {
+		t.Fatalf("Rewind failed: %v", err)
+	}
+	if content, _ := os.ReadFile(existing); string(content) != "v0" {
+		t.Errorf("expected main.go restored to v0, got %q", content)
+	}
+	if store.LatestIteration(session) != 0 {
+		t.Error("expected no checkpoints after full rewind")
+	}
+}
+
+func TestRecorder_Context(t *testing.T) {
+	if FromContext(context.Background()) != nil {
+		t.Error("expected nil recorder in empty context")
+	}
+	// a nil recorder must be safe to use
+	if err := FromContext(context.Background()).Snapshot("/tmp/x"); err != nil {
+		t.Errorf("nil recorder returned error: %v", err)
+	}
+
+	rec := NewStoreAt(t.TempDir()).Recorder("s", 1)
+	if FromContext(WithRecorder(context.Background(), rec)) != rec {
+		t.Error("expected recorder from context")
+	}
+}
+
+func TestStore_RunningAndRemove(t *testing.T) {
+	workDir := t.TempDir()
+	store := NewStoreAt(t.TempDir())
+	file := filepath.Join(workDir, "main.go")
+	_ = os.WriteFile(file, []byte("v0"), 0644)
+	_ = store.Recorder("running", 1).Snapshot(file)
+	_ = store.Recorder("idle", 1).Snapshot(file)
+
+	release, err := store.Begin("running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Undo("running"); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected undo to be rejected while a task runs, got %v", err)
+	}
+	if err := store.Remove("running"); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected remove to be rejected while a task runs, got %v", err)
+	}
+	release()
+	if store.Running("running") {
+		t.Error("expected the session to stop running after release")
+	}
+
+	if err := store.Remove("idle"); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := store.Sessions()
+	if err != nil || len(sessions) != 1 || sessions[0] != "running" {
+		t.Errorf("expected only the running session to keep checkpoints, got %v (%v)", sessions, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"alex/internal/llm"
+	"alex/internal/permissions"
 	"alex/pkg/types"
 )
 
@@ -60,6 +61,25 @@ type LoggingConfig struct {
 	LogFile      string `json:"log_file,omitempty"`
 }
 
+// RoutingConfig selects the model type (basic or reasoning) used for each kind of
+// agent step; empty fields use the defaults of the agent's routing policy
+type RoutingConfig struct {
+	Default          llm.ModelType `json:"default,omitempty"`           // Regular tool-calling iterations
+	Planning         llm.ModelType `json:"planning,omitempty"`          // First iteration of a task
+	Debugging        llm.ModelType `json:"debugging,omitempty"`         // Iterations after repeated tool failures
+	FailureThreshold int           `json:"failure_threshold,omitempty"` // Consecutive failed tool calls that start debugging
+	Synthesis        llm.ModelType `json:"synthesis,omitempty"`         // Rewrites the final answer of a task that used tools; off when empty
+	Compression      llm.ModelType `json:"compression,omitempty"`       // Context compression summaries
+}
+
+// CompressionConfig selects how long conversations are compressed
+type CompressionConfig struct {
+	Strategy string `json:"strategy,omitempty"` // cache_friendly (default), sliding_window or importance
+	Window   int    `json:"window,omitempty"`   // Tool call rounds kept by sliding_window
+	// Tool call rounds after which large tool outputs are replaced by stubs (0: default, -1: never)
+	ElideAfter int `json:"elide_after,omitempty"`
+}
+
 // Config holds application configuration with multi-model support
 type Config struct {
 	// Legacy single model config (for backward compatibility)
@@ -68,27 +88,64 @@ type Config struct {
 	Model       string  `json:"model"`
 	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
+	// API selects the OpenAI endpoint: chat_completions (default) or responses
+	API string `json:"api,omitempty"`
 
 	// ReAct agent configuration
 	MaxTurns int `json:"max_turns"`
 
+	// Per-task budget limits (0 means unlimited / use default)
+	MaxTaskTokens int     `json:"max_task_tokens,omitempty"` // Prompt + completion tokens per task
+	MaxTaskCost   float64 `json:"max_task_cost,omitempty"`   // Estimated USD cost per task
+	TaskTimeout   int     `json:"task_timeout,omitempty"`    // Wall-clock limit per task in seconds, unlimited when 0
+
+	// Extended thinking budget in tokens for Anthropic models (0 disables)
+	ThinkingBudget int `json:"thinking_budget,omitempty"`
+
 	// Multi-model configurations
 	Models map[llm.ModelType]*llm.ModelConfig `json:"models,omitempty"`
 
 	// Default model type to use when none specified
 	DefaultModelType llm.ModelType `json:"default_model_type,omitempty"`
 
+	// Which model type serves planning, debugging, synthesis and compression steps
+	Routing *RoutingConfig `json:"routing,omitempty"`
+
+	// Context compression strategy, sessions can override it
+	Compression *CompressionConfig `json:"compression,omitempty"`
+
+	// Ordered fallback models tried when the primary provider is down
+	Fallbacks []*llm.ModelConfig `json:"fallbacks,omitempty"`
+
+	// Client-side rate limits shared by all requests to a provider, keyed by host
+	RateLimits map[string]llm.RateLimits `json:"rate_limits,omitempty"`
+
+	// Model price overrides (USD per million tokens) keyed by provider/model
+	Pricing map[string]llm.ModelPrice `json:"pricing,omitempty"`
+
+	// Model capability entries keyed by provider/model (context window, max output, features)
+	Capabilities map[string]llm.ModelCapabilities `json:"capabilities,omitempty"`
+
 	// Tool configuration
 	TavilyAPIKey string `json:"tavilyApiKey,omitempty"`
+	// Tool outputs above this many bytes are saved to the session and previewed (0: default, -1: never)
+	ToolOutputLimit int `json:"tool_output_limit,omitempty"`
+	// Token budget of the repository map in the system prompt (0: default, -1: no map)
+	RepoMapTokens int `json:"repo_map_tokens,omitempty"`
 
 	// MCP configuration
 	MCP *MCPConfig `json:"mcp,omitempty"`
+
+	// Tool permission rules
+	Permissions *permissions.Config `json:"permissions,omitempty"`
 }
 
 // Manager handles configuration persistence and retrieval
 type Manager struct {
 	configPath string
 	config     *Config
+	// maxTokensOverride comes from the command line and is never saved
+	maxTokensOverride int
 }
 
 // NewManager creates a new configuration manager
@@ -133,12 +190,40 @@ func (m *Manager) Get(key string) (interface{}, error) {
 		return m.config.MaxTokens, nil
 	case "temperature":
 		return m.config.Temperature, nil
+	case "api":
+		return m.config.API, nil
 	case "max_turns":
 		return m.config.MaxTurns, nil
+	case "permissions":
+		return m.config.Permissions, nil
+	case "max_task_tokens":
+		return m.config.MaxTaskTokens, nil
+	case "max_task_cost":
+		return m.config.MaxTaskCost, nil
+	case "task_timeout":
+		return m.config.TaskTimeout, nil
+	case "thinking_budget":
+		return m.config.ThinkingBudget, nil
+	case "tool_output_limit":
+		return m.config.ToolOutputLimit, nil
+	case "repo_map_tokens":
+		return m.config.RepoMapTokens, nil
 	case "default_model_type":
 		return m.config.DefaultModelType, nil
 	case "models":
 		return m.config.Models, nil
+	case "routing":
+		return m.config.Routing, nil
+	case "compression":
+		return m.config.Compression, nil
+	case "fallbacks":
+		return m.config.Fallbacks, nil
+	case "rate_limits":
+		return m.config.RateLimits, nil
+	case "pricing":
+		return m.config.Pricing, nil
+	case "capabilities":
+		return m.config.Capabilities, nil
 	case "tavilyApiKey":
 		return m.config.TavilyAPIKey, nil
 	case "mcp":
@@ -186,6 +271,8 @@ func (m *Manager) getNestedValue(key string) (interface{}, error) {
 			return modelConfig.Temperature, nil
 		case "max_tokens":
 			return modelConfig.MaxTokens, nil
+		case "api":
+			return modelConfig.API, nil
 		default:
 			return nil, fmt.Errorf("unknown model config field: %s", field)
 		}
@@ -223,10 +310,38 @@ func (m *Manager) Set(key string, value interface{}) error {
 		if temp, ok := value.(float64); ok {
 			m.config.Temperature = temp
 		}
+	case "api":
+		if str, ok := value.(string); ok {
+			m.config.API = str
+		}
 	case "max_turns":
 		if num, ok := value.(int); ok {
 			m.config.MaxTurns = num
 		}
+	case "max_task_tokens":
+		if num, ok := value.(int); ok {
+			m.config.MaxTaskTokens = num
+		}
+	case "max_task_cost":
+		if cost, ok := value.(float64); ok {
+			m.config.MaxTaskCost = cost
+		}
+	case "task_timeout":
+		if num, ok := value.(int); ok {
+			m.config.TaskTimeout = num
+		}
+	case "thinking_budget":
+		if num, ok := value.(int); ok {
+			m.config.ThinkingBudget = num
+		}
+	case "tool_output_limit":
+		if num, ok := value.(int); ok {
+			m.config.ToolOutputLimit = num
+		}
+	case "repo_map_tokens":
+		if num, ok := value.(int); ok {
+			m.config.RepoMapTokens = num
+		}
 	case "default_model_type":
 		if modelType, ok := value.(llm.ModelType); ok {
 			m.config.DefaultModelType = modelType
@@ -235,6 +350,30 @@ func (m *Manager) Set(key string, value interface{}) error {
 		if models, ok := value.(map[llm.ModelType]*llm.ModelConfig); ok {
 			m.config.Models = models
 		}
+	case "fallbacks":
+		if fallbacks, ok := value.([]*llm.ModelConfig); ok {
+			m.config.Fallbacks = fallbacks
+		}
+	case "routing":
+		if routing, ok := value.(*RoutingConfig); ok {
+			m.config.Routing = routing
+		}
+	case "compression":
+		if compression, ok := value.(*CompressionConfig); ok {
+			m.config.Compression = compression
+		}
+	case "rate_limits":
+		if limits, ok := value.(map[string]llm.RateLimits); ok {
+			m.config.RateLimits = limits
+		}
+	case "pricing":
+		if pricing, ok := value.(map[string]llm.ModelPrice); ok {
+			m.config.Pricing = pricing
+		}
+	case "capabilities":
+		if capabilities, ok := value.(map[string]llm.ModelCapabilities); ok {
+			m.config.Capabilities = capabilities
+		}
 	case "tavilyApiKey":
 		if str, ok := value.(string); ok {
 			m.config.TavilyAPIKey = str
@@ -243,6 +382,10 @@ func (m *Manager) Set(key string, value interface{}) error {
 		if mcp, ok := value.(*MCPConfig); ok {
 			m.config.MCP = mcp
 		}
+	case "permissions":
+		if perms, ok := value.(*permissions.Config); ok {
+			m.config.Permissions = perms
+		}
 	case "stream_response", "confidence_threshold", "allowed_tools", "max_concurrency", "tool_timeout", "restricted_paths", "session_timeout", "max_messages_per_session":
 		// Legacy fields - ignore for simplified config
 	default:
@@ -311,6 +454,12 @@ func (m *Manager) setNestedValue(key string, value interface{}) error {
 			} else {
 				return fmt.Errorf("max_tokens must be an integer")
 			}
+		case "api":
+			if str, ok := value.(string); ok {
+				m.config.Models[modelType].API = str
+			} else {
+				return fmt.Errorf("api must be a string")
+			}
 		default:
 			return fmt.Errorf("unknown model config field: %s", field)
 		}
@@ -387,20 +536,37 @@ func (m *Manager) GetEffectiveModelType(requested llm.ModelType) llm.ModelType {
 	return llm.BasicModel
 }
 
+// SetMaxTokensOverride overrides max_tokens for this process without saving it (0 clears it)
+func (m *Manager) SetMaxTokensOverride(maxTokens int) {
+	m.maxTokensOverride = maxTokens
+}
+
 // GetLLMConfig converts the config to LLM package format
 func (m *Manager) GetLLMConfig() *llm.Config {
+	maxTokens := m.config.MaxTokens
+	if m.maxTokensOverride > 0 {
+		maxTokens = m.maxTokensOverride
+	}
+
 	return &llm.Config{
 		// Legacy single model config
 		APIKey:      m.config.APIKey,
 		BaseURL:     m.config.BaseURL,
 		Model:       m.config.Model,
 		Temperature: m.config.Temperature,
-		MaxTokens:   m.config.MaxTokens,
+		MaxTokens:   maxTokens,
 		Timeout:     5 * time.Minute,
+		API:         m.config.API,
+
+		ThinkingBudget: m.config.ThinkingBudget,
 
 		// Multi-model configurations
 		Models:           m.config.Models,
 		DefaultModelType: m.config.DefaultModelType,
+		Fallbacks:        m.config.Fallbacks,
+		RateLimits:       m.config.RateLimits,
+		Pricing:          m.config.Pricing,
+		Capabilities:     m.config.Capabilities,
 	}
 }
 
@@ -557,6 +723,15 @@ func (m *Manager) save() error {
 	return os.WriteFile(m.configPath, data, 0644)
 }
 
+// AddPermissionRule appends a tool permission rule and saves the configuration
+func (m *Manager) AddPermissionRule(rule permissions.Rule) error {
+	if m.config.Permissions == nil {
+		m.config.Permissions = &permissions.Config{}
+	}
+	m.config.Permissions.Rules = append(m.config.Permissions.Rules, rule)
+	return m.save()
+}
+
 // Save is an alias for save for backward compatibility
 func (m *Manager) Save() error {
 	return m.save()
@@ -576,11 +751,15 @@ type ModelPreset struct {
 	Name        string  `json:"name"`
 	DisplayName string  `json:"display_name"`
 	Model       string  `json:"model"`
-	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
 	IsDefault   bool    `json:"is_default"`
 }
 
+// Capabilities returns the context window and features of the preset's model
+func (p ModelPreset) Capabilities() llm.ModelCapabilities {
+	return llm.LookupCapabilities(p.Model)
+}
+
 // GetProviderPresets returns all available provider presets
 func GetProviderPresets() map[string]*ProviderPreset {
 	return map[string]*ProviderPreset{
@@ -589,9 +768,9 @@ func GetProviderPresets() map[string]*ProviderPreset {
 			DisplayName: "Kimi (Moonshot)",
 			BaseURL:     "https://api.moonshot.cn/v1",
 			Models: []ModelPreset{
-				{Name: "moonshot-v1-8k", DisplayName: "Kimi K2 (8K)", Model: "moonshot-v1-8k", MaxTokens: 8000, Temperature: 0.7, IsDefault: true},
-				{Name: "moonshot-v1-32k", DisplayName: "Kimi Pro (32K)", Model: "moonshot-v1-32k", MaxTokens: 32000, Temperature: 0.7},
-				{Name: "moonshot-v1-128k", DisplayName: "Kimi Max (128K)", Model: "moonshot-v1-128k", MaxTokens: 128000, Temperature: 0.7},
+				{Name: "moonshot-v1-8k", DisplayName: "Kimi K2 (8K)", Model: "moonshot-v1-8k", Temperature: 0.7, IsDefault: true},
+				{Name: "moonshot-v1-32k", DisplayName: "Kimi Pro (32K)", Model: "moonshot-v1-32k", Temperature: 0.7},
+				{Name: "moonshot-v1-128k", DisplayName: "Kimi Max (128K)", Model: "moonshot-v1-128k", Temperature: 0.7},
 			},
 		},
 		"openrouter": {
@@ -599,9 +778,9 @@ func GetProviderPresets() map[string]*ProviderPreset {
 			DisplayName: "OpenRouter",
 			BaseURL:     "https://openrouter.ai/api/v1",
 			Models: []ModelPreset{
-				{Name: "deepseek-chat", DisplayName: "DeepSeek Chat (Free)", Model: "deepseek/deepseek-chat-v3-0324:free", MaxTokens: 4000, Temperature: 0.7, IsDefault: true},
-				{Name: "claude-3-haiku", DisplayName: "Claude 3 Haiku", Model: "anthropic/claude-3-haiku:beta", MaxTokens: 4000, Temperature: 0.7},
-				{Name: "gpt-4o-mini", DisplayName: "GPT-4o Mini", Model: "openai/gpt-4o-mini", MaxTokens: 4000, Temperature: 0.7},
+				{Name: "deepseek-chat", DisplayName: "DeepSeek Chat (Free)", Model: "deepseek/deepseek-chat-v3-0324:free", Temperature: 0.7, IsDefault: true},
+				{Name: "claude-3-haiku", DisplayName: "Claude 3 Haiku", Model: "anthropic/claude-3-haiku:beta", Temperature: 0.7},
+				{Name: "gpt-4o-mini", DisplayName: "GPT-4o Mini", Model: "openai/gpt-4o-mini", Temperature: 0.7},
 			},
 		},
 		"claude": {
@@ -609,9 +788,9 @@ func GetProviderPresets() map[string]*ProviderPreset {
 			DisplayName: "Anthropic Claude",
 			BaseURL:     "https://api.anthropic.com/v1",
 			Models: []ModelPreset{
-				{Name: "claude-3-5-sonnet", DisplayName: "Claude 3.5 Sonnet", Model: "claude-3-5-sonnet-20241022", MaxTokens: 8192, Temperature: 0.7, IsDefault: true},
-				{Name: "claude-3-5-haiku", DisplayName: "Claude 3.5 Haiku", Model: "claude-3-5-haiku-20241022", MaxTokens: 8192, Temperature: 0.7},
-				{Name: "claude-3-opus", DisplayName: "Claude 3 Opus", Model: "claude-3-opus-20240229", MaxTokens: 4096, Temperature: 0.7},
+				{Name: "claude-3-5-sonnet", DisplayName: "Claude 3.5 Sonnet", Model: "claude-3-5-sonnet-20241022", Temperature: 0.7, IsDefault: true},
+				{Name: "claude-3-5-haiku", DisplayName: "Claude 3.5 Haiku", Model: "claude-3-5-haiku-20241022", Temperature: 0.7},
+				{Name: "claude-3-opus", DisplayName: "Claude 3 Opus", Model: "claude-3-opus-20240229", Temperature: 0.7},
 			},
 			Headers: map[string]string{
 				"anthropic-version": "2023-06-01",
@@ -622,8 +801,8 @@ func GetProviderPresets() map[string]*ProviderPreset {
 			DisplayName: "DeepSeek",
 			BaseURL:     "https://api.deepseek.com/v1",
 			Models: []ModelPreset{
-				{Name: "deepseek-chat", DisplayName: "DeepSeek Chat", Model: "deepseek-chat", MaxTokens: 4096, Temperature: 0.7, IsDefault: true},
-				{Name: "deepseek-coder", DisplayName: "DeepSeek Coder", Model: "deepseek-coder", MaxTokens: 4096, Temperature: 0.3},
+				{Name: "deepseek-chat", DisplayName: "DeepSeek Chat", Model: "deepseek-chat", Temperature: 0.7, IsDefault: true},
+				{Name: "deepseek-coder", DisplayName: "DeepSeek Coder", Model: "deepseek-coder", Temperature: 0.3},
 			},
 		},
 		"doubao": {
@@ -631,9 +810,9 @@ func GetProviderPresets() map[string]*ProviderPreset {
 			DisplayName: "字节豆包 (Doubao)",
 			BaseURL:     "https://ark.cn-beijing.volces.com/api/v3",
 			Models: []ModelPreset{
-				{Name: "doubao-pro-4k", DisplayName: "豆包 Pro 4K", Model: "ep-20241022105817-8vxvs", MaxTokens: 4096, Temperature: 0.7, IsDefault: true},
-				{Name: "doubao-pro-32k", DisplayName: "豆包 Pro 32K", Model: "ep-20241022105835-qvwv9", MaxTokens: 32768, Temperature: 0.7},
-				{Name: "doubao-pro-128k", DisplayName: "豆包 Pro 128K", Model: "ep-20241022105851-bd5fj", MaxTokens: 128000, Temperature: 0.7},
+				{Name: "doubao-pro-4k", DisplayName: "豆包 Pro 4K", Model: "ep-20241022105817-8vxvs", Temperature: 0.7, IsDefault: true},
+				{Name: "doubao-pro-32k", DisplayName: "豆包 Pro 32K", Model: "ep-20241022105835-qvwv9", Temperature: 0.7},
+				{Name: "doubao-pro-128k", DisplayName: "豆包 Pro 128K", Model: "ep-20241022105851-bd5fj", Temperature: 0.7},
 			},
 		},
 		"gemini": {
@@ -641,9 +820,9 @@ func GetProviderPresets() map[string]*ProviderPreset {
 			DisplayName: "Google Gemini",
 			BaseURL:     "https://generativelanguage.googleapis.com/v1beta",
 			Models: []ModelPreset{
-				{Name: "gemini-1.5-flash", DisplayName: "Gemini 1.5 Flash", Model: "gemini-1.5-flash", MaxTokens: 8192, Temperature: 0.7, IsDefault: true},
-				{Name: "gemini-1.5-pro", DisplayName: "Gemini 1.5 Pro", Model: "gemini-1.5-pro", MaxTokens: 8192, Temperature: 0.7},
-				{Name: "gemini-1.0-pro", DisplayName: "Gemini 1.0 Pro", Model: "gemini-1.0-pro", MaxTokens: 4096, Temperature: 0.7},
+				{Name: "gemini-1.5-flash", DisplayName: "Gemini 1.5 Flash", Model: "gemini-1.5-flash", Temperature: 0.7, IsDefault: true},
+				{Name: "gemini-1.5-pro", DisplayName: "Gemini 1.5 Pro", Model: "gemini-1.5-pro", Temperature: 0.7},
+				{Name: "gemini-1.0-pro", DisplayName: "Gemini 1.0 Pro", Model: "gemini-1.0-pro", Temperature: 0.7},
 			},
 		},
 	}
@@ -692,7 +871,8 @@ func (m *Manager) SetCurrentProvider(providerName string, modelName string) erro
 	// Store provider info as metadata (we'll use base URL to track current provider)
 	m.config.BaseURL = preset.BaseURL
 	m.config.Model = selectedModel.Model
-	m.config.MaxTokens = selectedModel.MaxTokens
+	// 0 表示使用模型能力表中的最大输出长度
+	m.config.MaxTokens = 0
 	m.config.Temperature = selectedModel.Temperature
 
 	return m.save()
@@ -896,8 +1076,8 @@ func (m *Manager) ValidateConfig() error {
 	if config.Model == "" {
 		return fmt.Errorf("model is required")
 	}
-	if config.MaxTokens < 1 || config.MaxTokens > 1000000 {
-		return fmt.Errorf("max_tokens must be between 1 and 100000")
+	if config.MaxTokens < 0 || config.MaxTokens > 1000000 {
+		return fmt.Errorf("max_tokens must be between 0 (model maximum) and 1000000")
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package message
 
 import (
+	"alex/internal/llm"
 	"alex/internal/session"
 	"testing"
 	"time"
@@ -137,3 +138,49 @@ func createTestMessages(count int) []*session.Message {
 
 	return messages
 }
+
+func TestMessageProcessor_PreservesReasoning(t *testing.T) {
+	mp := NewMessageProcessor(nil, nil)
+	sessionMessages := []*session.Message{
+		{Role: "user", Content: "hi", Timestamp: time.Now()},
+		{Role: "assistant", Content: "hello", Reasoning: "greet back", ThinkingSignature: "sig", Timestamp: time.Now()},
+	}
+
+	llmMessages := mp.ConvertUnifiedToLLM(mp.ConvertSessionToUnified(sessionMessages))
+	if llmMessages[1].Reasoning != "greet back" || llmMessages[1].ThinkingSignature != "sig" {
+		t.Fatalf("reasoning lost converting session to LLM messages: %+v", llmMessages[1])
+	}
+	if sessionMessages[1].Metadata != nil {
+		t.Error("conversion must not modify session messages")
+	}
+
+	restored := mp.ConvertUnifiedToSession(mp.ConvertLLMToUnified(llmMessages))
+	if restored[1].Reasoning != "greet back" || restored[1].ThinkingSignature != "sig" {
+		t.Errorf("reasoning lost converting LLM to session messages: %+v", restored[1])
+	}
+	if _, ok := restored[1].Metadata["reasoning"]; ok {
+		t.Error("reasoning should be stored in the message field, not metadata")
+	}
+}
+
+// TestMessageProcessor_PreservesImages 测试图片在会话、统一格式和LLM消息之间转换时不丢失
+func TestMessageProcessor_PreservesImages(t *testing.T) {
+	mp := NewMessageProcessor(nil, nil)
+	image := session.ContentPart{Type: "image", Path: "/tmp/screenshot.png", MediaType: "image/png"}
+	sessionMessages := []*session.Message{
+		{Role: "user", Content: "what broke?", Parts: []session.ContentPart{image}, Timestamp: time.Now()},
+	}
+
+	llmMessages := mp.ConvertUnifiedToLLM(mp.ConvertSessionToUnified(sessionMessages))
+	if len(llmMessages[0].Parts) != 1 || llmMessages[0].Parts[0].Type != llm.ContentPartImage || llmMessages[0].Parts[0].Path != image.Path {
+		t.Fatalf("image lost converting session to LLM messages: %+v", llmMessages[0])
+	}
+
+	restored := mp.ConvertUnifiedToSession(mp.ConvertLLMToUnified(llmMessages))
+	if len(restored[0].Parts) != 1 || restored[0].Parts[0] != image {
+		t.Errorf("image lost converting LLM to session messages: %+v", restored[0])
+	}
+	if tokens := mp.TokenEstimator().EstimateSessionMessages(restored); tokens < imageTokens {
+		t.Errorf("images should count towards the context size, got %d tokens", tokens)
+	}
+}
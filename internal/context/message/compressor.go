@@ -16,42 +16,121 @@ type MessageCompressor struct {
 	sessionManager *session.Manager
 	llmClient      llm.Client
 	tokenEstimator *TokenEstimator
+	// capabilities of the model the messages are sent to
+	capabilities llm.ModelCapabilities
+	// summaryModelType is the model type that writes compression summaries
+	summaryModelType llm.ModelType
+	// llmConfig provides the endpoints of summaryModelType; nil uses the global config
+	llmConfig *llm.Config
+	// strategy shortens the conversation once it exceeds the thresholds
+	strategy CompressionStrategy
+	// elideAfter is the number of tool call rounds a tool output stays inline, negative disables elision
+	elideAfter int
+}
+
+// CompressionReport describes one compression run
+type CompressionReport struct {
+	// Strategy is empty when only stale tool outputs were elided
+	Strategy       string
+	Elided         int
+	MessagesBefore int
+	MessagesAfter  int
+	TokensBefore   int
+	TokensAfter    int
 }
 
 // NewMessageCompressor creates a new message compressor
 func NewMessageCompressor(sessionManager *session.Manager, llmClient llm.Client) *MessageCompressor {
-	return &MessageCompressor{
-		sessionManager: sessionManager,
-		llmClient:      llmClient,
-		tokenEstimator: NewTokenEstimator(),
+	mc := &MessageCompressor{
+		sessionManager:   sessionManager,
+		llmClient:        llmClient,
+		tokenEstimator:   NewTokenEstimator(),
+		capabilities:     llm.LookupCapabilities(""),
+		summaryModelType: llm.BasicModel,
+		elideAfter:       DefaultElideAfter,
+	}
+	mc.strategy = &cacheFriendlyStrategy{mc: mc}
+	return mc
+}
+
+// SetStrategy selects the compression strategy by name, see NewCompressionStrategy
+func (mc *MessageCompressor) SetStrategy(name string, window int) error {
+	strategy, err := NewCompressionStrategy(mc, name, window)
+	if err != nil {
+		return err
 	}
+	mc.strategy = strategy
+	return nil
+}
+
+// Strategy returns the name of the selected compression strategy
+func (mc *MessageCompressor) Strategy() string {
+	return mc.strategy.Name()
+}
+
+// SetSummaryModel sets the model type, and the config it is resolved from, used to write compression summaries
+func (mc *MessageCompressor) SetSummaryModel(modelType llm.ModelType, llmConfig *llm.Config) {
+	mc.summaryModelType = modelType
+	mc.llmConfig = llmConfig
 }
 
-// CompressMessages compresses messages using cache-friendly strategy
-// Keeps stable prefix for context caching, compresses middle, preserves recent active
-func (mc *MessageCompressor) CompressMessages(ctx context.Context, messages []*session.Message) []*session.Message {
-	totalTokens := mc.estimateTokens(messages)
+// SetModel adapts the compression threshold to the context window of model
+func (mc *MessageCompressor) SetModel(model string) {
+	mc.capabilities = llm.LookupCapabilities(model)
+}
+
+// tokenThreshold returns the prompt size that triggers compression: 90% of the context
+// window left after reserving room for the reply
+func (mc *MessageCompressor) tokenThreshold() int {
+	window := mc.capabilities.ContextWindow
+	return mc.tokenEstimator.GetCompressionThreshold(window-mc.capabilities.OutputReserve(), 0.9)
+}
+
+// CompressMessages elides stale tool outputs, then compresses messages with the selected
+// strategy once they exceed the message and token thresholds. The report is nil when
+// nothing changed.
+func (mc *MessageCompressor) CompressMessages(ctx context.Context, messages []*session.Message) ([]*session.Message, *CompressionReport) {
+	originalTokens := mc.estimateTokens(messages)
+	messages, elided := mc.elideStaleOutputs(messages)
+	totalTokens := originalTokens
+	if elided > 0 {
+		totalTokens = mc.estimateTokens(messages)
+	}
 	messageCount := len(messages)
 
-	log.Printf("[DEBUG] Token estimation: %d messages, %d estimated tokens", messageCount, totalTokens)
+	log.Printf("[DEBUG] Token estimation: %d messages, %d tokens (%s)", messageCount, totalTokens, mc.tokenEstimator.Tokenizer().Name())
 
-	// Cache-friendly compression thresholds
-	const (
-		TokenThreshold      = 115000 // Kimi K2的128K token上限的90%
-		MessageThreshold    = 20     // 降低消息数量阈值，更早触发压缩
-		CacheablePrefixKeep = 4      // 保留用于缓存的稳定前缀消息数
-	)
+	// Compression thresholds
+	const MessageThreshold = 20           // 降低消息数量阈值，更早触发压缩
+	tokenThreshold := mc.tokenThreshold() // 随模型上下文窗口变化
 
 	// Only compress if we exceed thresholds significantly
-	if messageCount > MessageThreshold && totalTokens > TokenThreshold {
-		log.Printf("[INFO] Cache-friendly compression triggered: %d messages, %d tokens", messageCount, totalTokens)
-		return mc.cacheFriendlyCompress(ctx, messages, CacheablePrefixKeep)
+	if messageCount > MessageThreshold && totalTokens > tokenThreshold {
+		log.Printf("[INFO] %s compression triggered: %d messages, %d tokens", mc.strategy.Name(), messageCount, totalTokens)
+		compressed := mc.strategy.Compress(ctx, messages)
+		return compressed, &CompressionReport{
+			Strategy:       mc.strategy.Name(),
+			Elided:         elided,
+			MessagesBefore: messageCount,
+			MessagesAfter:  len(compressed),
+			TokensBefore:   originalTokens,
+			TokensAfter:    mc.estimateTokens(compressed),
+		}
 	}
 
 	log.Printf("[DEBUG] Compression skipped: %d messages (%d threshold), %d tokens (%d threshold)",
-		messageCount, MessageThreshold, totalTokens, TokenThreshold)
-
-	return messages
+		messageCount, MessageThreshold, totalTokens, tokenThreshold)
+
+	if elided > 0 {
+		return messages, &CompressionReport{
+			Elided:         elided,
+			MessagesBefore: messageCount,
+			MessagesAfter:  messageCount,
+			TokensBefore:   originalTokens,
+			TokensAfter:    totalTokens,
+		}
+	}
+	return messages, nil
 }
 
 // cacheFriendlyCompress implements cache-friendly compression strategy
@@ -210,12 +289,18 @@ func (mc *MessageCompressor) createComprehensiveAISummary(ctx context.Context, m
 				Content: prompt,
 			},
 		},
-		ModelType: llm.BasicModel,
+		ModelType: mc.summaryModelType,
 		Config: &llm.Config{
 			Temperature: 0.2,  // Lower temperature for more consistent summaries
 			MaxTokens:   1000, // More tokens for comprehensive summaries
 		},
 	}
+	if mc.llmConfig != nil {
+		config := *mc.llmConfig
+		config.Temperature = request.Config.Temperature
+		config.MaxTokens = request.Config.MaxTokens
+		request.Config = &config
+	}
 
 	// Use the provided context with timeout to preserve session ID and other values
 	timeoutCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
@@ -362,68 +447,17 @@ func (mc *MessageCompressor) createStatisticalSummary(messages []*session.Messag
 	}
 }
 
-// estimateTokens estimates the total tokens in messages with improved accuracy
+// estimateTokens counts the total tokens in messages with the model's tokenizer
 func (mc *MessageCompressor) estimateTokens(messages []*session.Message) int {
 	total := 0
 	for _, msg := range messages {
-		// Use more accurate token estimation
-		contentTokens := mc.estimateContentTokens(msg.Content)
-
-		// Add overhead for role, metadata, and structure
-		roleTokens := 5                          // role field
-		metadataTokens := len(msg.Metadata) * 10 // rough metadata overhead
-
-		// Add tokens for tool calls
-		toolCallTokens := 0
-		for _, tc := range msg.ToolCalls {
-			toolCallTokens += len(tc.Name)/3 + len(tc.ID)/3 + 15 // Tool call structure overhead
-		}
-
-		messageTotal := contentTokens + roleTokens + metadataTokens + toolCallTokens
+		messageTotal := mc.tokenEstimator.EstimateSessionMessages([]*session.Message{msg})
 		total += messageTotal
 
 		// Debug individual message token count for large messages
-		if contentTokens > 1000 {
-			log.Printf("[DEBUG] Large message: %d content tokens, %d total tokens (role: %d, metadata: %d, tools: %d)",
-				contentTokens, messageTotal, roleTokens, metadataTokens, toolCallTokens)
+		if messageTotal > 1000 {
+			log.Printf("[DEBUG] Large message: %d tokens (%s, %d tool calls)", messageTotal, msg.Role, len(msg.ToolCalls))
 		}
 	}
 	return total
 }
-
-// estimateContentTokens provides more accurate token estimation for message content
-func (mc *MessageCompressor) estimateContentTokens(content string) int {
-	if content == "" {
-		return 0
-	}
-
-	// More sophisticated estimation based on content type
-	length := len(content)
-
-	// Different ratios for different content types
-	var charsPerToken = 4.0 // Default for regular text
-
-	// Adjust for code-heavy content (more token-dense)
-	if strings.Contains(content, "```") || strings.Contains(content, "func ") || strings.Contains(content, "import ") {
-		charsPerToken = 2.5 // Code is more token-dense
-	}
-
-	// Adjust for JSON/structured data
-	if strings.Contains(content, `"role"`) || strings.Contains(content, `{"`) {
-		charsPerToken = 3.0 // JSON is moderately token-dense
-	}
-
-	// Adjust for very long content (usually less token-dense due to repetition)
-	if length > 10000 {
-		charsPerToken = 5.0
-	}
-
-	estimated := int(float64(length) / charsPerToken)
-
-	// Minimum of 1 token for non-empty content
-	if estimated == 0 && length > 0 {
-		estimated = 1
-	}
-
-	return estimated
-}
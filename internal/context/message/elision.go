@@ -0,0 +1,160 @@
+package message
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"alex/internal/session"
+)
+
+// DefaultElideAfter is the number of later tool call rounds after which a tool output is elided
+const DefaultElideAfter = 6
+
+// minElideBytes - 更短的工具输出留在对话中，替换为存根节省不了多少
+const minElideBytes = 1024
+
+// elidedPrefix starts the stub that replaces an elided tool output
+const elidedPrefix = "[elided "
+
+// SetElideAfter sets how many tool call rounds a tool output stays in the conversation;
+// 0 selects DefaultElideAfter and a negative value disables elision
+func (mc *MessageCompressor) SetElideAfter(rounds int) {
+	if rounds == 0 {
+		rounds = DefaultElideAfter
+	}
+	mc.elideAfter = rounds
+}
+
+// elideStaleOutputs replaces large tool outputs that are older than elideAfter tool call
+// rounds, or superseded by a later read of the same file, with a stub pointing at a spill
+// file. Only the content changes, so every tool result stays paired with its call.
+func (mc *MessageCompressor) elideStaleOutputs(messages []*session.Message) ([]*session.Message, int) {
+	if mc.elideAfter < 0 {
+		return messages, 0
+	}
+
+	// 工具调用所在的轮次和调用本身
+	type callInfo struct {
+		round int
+		call  session.ToolCall
+	}
+	calls := make(map[string]callInfo)
+	rounds := 0
+	// 每个文件最后一次完整读取所在的轮次
+	lastRead := make(map[string]int)
+	for _, msg := range messages {
+		if msg.Role != "assistant" || len(msg.ToolCalls) == 0 {
+			continue
+		}
+		rounds++
+		for _, tc := range msg.ToolCalls {
+			calls[tc.ID] = callInfo{round: rounds, call: tc}
+			if path, full := readTarget(tc); path != "" && full {
+				lastRead[path] = rounds
+			}
+		}
+	}
+
+	var result []*session.Message
+	elided := 0
+	for i, msg := range messages {
+		if msg.Role != "tool" || len(msg.Content) < minElideBytes || strings.HasPrefix(msg.Content, elidedPrefix) {
+			continue
+		}
+		info, ok := calls[toolCallID(msg)]
+		if !ok {
+			continue
+		}
+
+		var reason string
+		if path, _ := readTarget(info.call); path != "" && lastRead[path] > info.round {
+			reason = "superseded by a later read of the same file"
+		} else if rounds-info.round >= mc.elideAfter {
+			reason = fmt.Sprintf("older than %d tool rounds", mc.elideAfter)
+		} else {
+			continue
+		}
+
+		path, full, err := mc.spillToolOutput(info.call.ID, msg.Content)
+		if err != nil {
+			log.Printf("[WARN] MessageCompressor: not eliding output of %s: %v", info.call.ID, err)
+			continue
+		}
+
+		if result == nil {
+			result = append([]*session.Message{}, messages...)
+		}
+		stub := *msg
+		stub.Content = elisionStub(info.call, full, reason, path)
+		result[i] = &stub
+		elided++
+	}
+
+	if elided == 0 {
+		return messages, 0
+	}
+	log.Printf("[DEBUG] MessageCompressor: elided %d stale tool outputs", elided)
+	return result, elided
+}
+
+// spillToolOutput saves a tool output under the current session so it can be read again
+// and returns the saved output. A preview of an output that the agent already saved in
+// full does not replace it.
+func (mc *MessageCompressor) spillToolOutput(callID, content string) (string, string, error) {
+	if mc.sessionManager == nil {
+		return "", "", fmt.Errorf("no session manager")
+	}
+	sessionID, ok := mc.sessionManager.GetSessionID()
+	if !ok {
+		return "", "", fmt.Errorf("no active session")
+	}
+	if path, err := mc.sessionManager.ToolOutputPath(sessionID, callID); err == nil {
+		if saved, err := os.ReadFile(path); err == nil && len(saved) > len(content) {
+			return path, string(saved), nil
+		}
+	}
+	path, err := mc.sessionManager.SaveToolOutput(sessionID, callID, content)
+	return path, content, err
+}
+
+// readTarget returns the file a file_read call reads and whether it reads the whole file
+func readTarget(tc session.ToolCall) (string, bool) {
+	if tc.Name != "file_read" {
+		return "", false
+	}
+	path, _ := tc.Args["file_path"].(string)
+	if path == "" {
+		path, _ = tc.Args["path"].(string)
+	}
+	_, ranged := tc.Args["start_line"]
+	_, ended := tc.Args["end_line"]
+	return path, !ranged && !ended
+}
+
+// elisionStub describes an elided tool output: the tool, its arguments, the size of the
+// output and where the full output was saved
+func elisionStub(tc session.ToolCall, content, reason, path string) string {
+	keys := make([]string, 0, len(tc.Args))
+	for key := range tc.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	args := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := fmt.Sprint(tc.Args[key])
+		if runes := []rune(value); len(runes) > 80 {
+			value = string(runes[:80]) + "..."
+		}
+		args = append(args, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	lines := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+	return fmt.Sprintf("%s%s output (%s): %d lines, %d bytes, %s. The full output is saved in %s as handle %q; use read_output with that handle if you need it again.]",
+		elidedPrefix, tc.Name, strings.Join(args, ", "), lines, len(content), reason, path, tc.ID)
+}
@@ -0,0 +1,74 @@
+package message
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"alex/internal/session"
+)
+
+func TestElideStaleOutputs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	manager, err := session.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.StartSession("elision"); err != nil {
+		t.Fatal(err)
+	}
+	mc := NewMessageCompressor(manager, nil)
+	mc.SetElideAfter(4)
+
+	bigFile := strings.Repeat("package a\n", 200)
+	messages := []*session.Message{{Role: "user", Content: "Fix a.go"}}
+	messages = append(messages, toolRound("call_1", "file_read", "", bigFile)...)
+	messages = append(messages, toolRound("call_2", "bash", "", strings.Repeat("ok\n", 600))...)
+	messages = append(messages, toolRound("call_3", "file_read", "", bigFile)...)
+	for i := 4; i <= 6; i++ {
+		messages = append(messages, toolRound(fmt.Sprintf("call_%d", i), "think", "", "short")...)
+	}
+	// 读取调用以 file_path 指定文件
+	for _, i := range []int{1, 5} {
+		messages[i].ToolCalls[0].Args = map[string]interface{}{"file_path": "a.go"}
+	}
+	messages[3].ToolCalls[0].Args = map[string]interface{}{"command": "go test ./..."}
+
+	elided, count := mc.elideStaleOutputs(messages)
+	if count != 2 {
+		t.Fatalf("expected the superseded read and the old bash output to be elided, got %d", count)
+	}
+	assertPaired(t, elided)
+
+	read := elided[2].Content
+	if !strings.HasPrefix(read, "[elided file_read output (file_path=a.go): 200 lines, 2000 bytes, superseded by a later read") {
+		t.Errorf("unexpected stub %q", read)
+	}
+	if !strings.Contains(elided[4].Content, "bash output (command=go test ./...): 600 lines") || !strings.Contains(elided[4].Content, "older than 4 tool rounds") {
+		t.Errorf("unexpected stub %q", elided[4].Content)
+	}
+	if elided[6].Content != bigFile {
+		t.Error("the latest read should stay inline")
+	}
+	if messages[2].Content != bigFile {
+		t.Error("the input messages must not be modified")
+	}
+
+	// 存根指向的文件保存了完整输出
+	path := manager.OutputsDir("elision") + "/call_1.txt"
+	if !strings.Contains(read, path) || !strings.Contains(read, `handle "call_1"; use read_output`) {
+		t.Fatalf("stub should point at %s and its read_output handle: %q", path, read)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != bigFile {
+		t.Errorf("spill file does not hold the output: %v", err)
+	}
+
+	if _, again := mc.elideStaleOutputs(elided); again != 0 {
+		t.Errorf("stubs must not be elided again, got %d", again)
+	}
+	mc.SetElideAfter(-1)
+	if _, disabled := mc.elideStaleOutputs(messages); disabled != 0 {
+		t.Errorf("elision should be disabled, got %d", disabled)
+	}
+}
@@ -20,19 +20,54 @@ type MessageProcessor struct {
 
 // NewMessageProcessor 创建统一的消息处理器
 func NewMessageProcessor(llmClient llm.Client, sessionManager *session.Manager) *MessageProcessor {
+	tokenEstimator := NewTokenEstimator()
+	compressor := NewMessageCompressor(sessionManager, llmClient) // AI压缩器
+	compressor.tokenEstimator = tokenEstimator
 
 	return &MessageProcessor{
 		sessionManager: sessionManager,
-		tokenEstimator: NewTokenEstimator(),
-		adapter:        message.NewAdapter(),                            // 统一消息适配器
-		compressor:     NewMessageCompressor(sessionManager, llmClient), // AI压缩器
+		tokenEstimator: tokenEstimator,
+		adapter:        message.NewAdapter(), // 统一消息适配器
+		compressor:     compressor,
 	}
 }
 
+// SetModel 切换token计数使用的分词器和压缩阈值对应的模型
+func (mp *MessageProcessor) SetModel(model string) {
+	mp.tokenEstimator.SetModel(model)
+	mp.compressor.SetModel(model)
+}
+
+// SetCompressionModel 设置生成压缩摘要的客户端、模型类型及其所在的配置
+func (mp *MessageProcessor) SetCompressionModel(llmClient llm.Client, modelType llm.ModelType, llmConfig *llm.Config) {
+	mp.compressor.llmClient = llmClient
+	mp.compressor.SetSummaryModel(modelType, llmConfig)
+}
+
+// TokenEstimator 返回当前使用的token估算器
+func (mp *MessageProcessor) TokenEstimator() *TokenEstimator {
+	return mp.tokenEstimator
+}
+
 // ========== 消息压缩 ==========
 
-// CompressMessages 使用AI压缩器压缩session消息
-func (mp *MessageProcessor) CompressMessages(ctx context.Context, messages []*session.Message) []*session.Message {
+// SetCompressionStrategy 按名称选择压缩策略，window 是滑动窗口保留的工具调用轮次
+func (mp *MessageProcessor) SetCompressionStrategy(name string, window int) error {
+	return mp.compressor.SetStrategy(name, window)
+}
+
+// CompressionStrategy 返回当前压缩策略的名称
+func (mp *MessageProcessor) CompressionStrategy() string {
+	return mp.compressor.Strategy()
+}
+
+// SetElideAfter 设置工具输出在对话中保留的工具调用轮次，负数表示不省略
+func (mp *MessageProcessor) SetElideAfter(rounds int) {
+	mp.compressor.SetElideAfter(rounds)
+}
+
+// CompressMessages 省略过期的工具输出并使用选定的压缩策略压缩session消息，没有变化时报告为nil
+func (mp *MessageProcessor) CompressMessages(ctx context.Context, messages []*session.Message) ([]*session.Message, *CompressionReport) {
 	return mp.compressor.CompressMessages(ctx, messages)
 }
 
@@ -51,6 +86,10 @@ func (mp *MessageProcessor) ConvertUnifiedToLLM(unifiedMessages []*message.Messa
 			Reasoning:        msg.Reasoning,
 			ReasoningSummary: msg.ReasoningSummary,
 			Think:            msg.Think,
+			Parts:            unifiedPartsToLLM(msg.Parts),
+		}
+		if signature, ok := unifiedMessages[i].Metadata[thinkingSignatureKey].(string); ok {
+			llmMessages[i].ThinkingSignature = signature
 		}
 		// 转换工具调用
 		for _, tc := range msg.ToolCalls {
@@ -81,6 +120,7 @@ func (mp *MessageProcessor) ConvertLLMToUnified(llmMessages []llm.Message) []*me
 			Reasoning:        msg.Reasoning,
 			ReasoningSummary: msg.ReasoningSummary,
 			Think:            msg.Think,
+			Parts:            llmPartsToUnified(msg.Parts),
 		}
 		// 转换工具调用
 		for _, tc := range msg.ToolCalls {
@@ -96,7 +136,14 @@ func (mp *MessageProcessor) ConvertLLMToUnified(llmMessages []llm.Message) []*me
 			})
 		}
 	}
-	return mp.adapter.ConvertLLMMessages(unifiedLLMMessages)
+	unifiedMessages := mp.adapter.ConvertLLMMessages(unifiedLLMMessages)
+	// 统一消息没有签名字段，通过元数据保留
+	for i, msg := range llmMessages {
+		if msg.ThinkingSignature != "" {
+			unifiedMessages[i].AddMetadata(thinkingSignatureKey, msg.ThinkingSignature)
+		}
+	}
+	return unifiedMessages
 }
 
 // ConvertSessionToUnified 将session消息转换为统一消息格式
@@ -107,8 +154,9 @@ func (mp *MessageProcessor) ConvertSessionToUnified(sessionMessages []*session.M
 			Role:      msg.Role,
 			Content:   msg.Content,
 			ToolID:    msg.ToolID,
-			Metadata:  msg.Metadata,
+			Metadata:  reasoningMetadata(msg),
 			Timestamp: msg.Timestamp,
+			Parts:     sessionPartsToUnified(msg.Parts),
 		}
 		// 转换工具调用
 		for _, tc := range msg.ToolCalls {
@@ -133,6 +181,16 @@ func (mp *MessageProcessor) ConvertUnifiedToSession(unifiedMessages []*message.M
 			ToolID:    msg.ToolID,
 			Metadata:  msg.Metadata,
 			Timestamp: msg.Timestamp,
+			Parts:     unifiedPartsToSession(msg.Parts),
+		}
+		// 推理内容和签名在统一格式中以元数据保存，还原为会话消息的字段
+		if reasoning, ok := msg.Metadata[reasoningKey].(string); ok {
+			messages[i].Reasoning = reasoning
+			delete(msg.Metadata, reasoningKey)
+		}
+		if signature, ok := msg.Metadata[thinkingSignatureKey].(string); ok {
+			messages[i].ThinkingSignature = signature
+			delete(msg.Metadata, thinkingSignatureKey)
 		}
 		// 转换工具调用
 		for _, tc := range msg.ToolCalls {
@@ -146,6 +204,92 @@ func (mp *MessageProcessor) ConvertUnifiedToSession(unifiedMessages []*message.M
 	return messages
 }
 
+// 统一消息格式中保存推理内容和思考签名的元数据键
+const (
+	reasoningKey         = "reasoning"
+	thinkingSignatureKey = "thinking_signature"
+)
+
+// reasoningMetadata 返回带有推理内容和签名的元数据副本，不修改会话中的消息
+func reasoningMetadata(msg *session.Message) map[string]interface{} {
+	if msg.Reasoning == "" && msg.ThinkingSignature == "" {
+		return msg.Metadata
+	}
+
+	metadata := make(map[string]interface{}, len(msg.Metadata)+2)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	if msg.Reasoning != "" {
+		metadata[reasoningKey] = msg.Reasoning
+	}
+	if msg.ThinkingSignature != "" {
+		metadata[thinkingSignatureKey] = msg.ThinkingSignature
+	}
+	return metadata
+}
+
+// ========== 多模态内容转换 ==========
+
+func llmPartsToUnified(parts []llm.ContentPart) []message.ContentPart {
+	if len(parts) == 0 {
+		return nil
+	}
+	result := make([]message.ContentPart, len(parts))
+	for i, part := range parts {
+		result[i] = message.ContentPart{
+			Type:      string(part.Type),
+			Text:      part.Text,
+			Path:      part.Path,
+			Data:      part.Data,
+			MediaType: part.MediaType,
+			URL:       part.URL,
+		}
+	}
+	return result
+}
+
+func unifiedPartsToLLM(parts []message.ContentPart) []llm.ContentPart {
+	if len(parts) == 0 {
+		return nil
+	}
+	result := make([]llm.ContentPart, len(parts))
+	for i, part := range parts {
+		result[i] = llm.ContentPart{
+			Type:      llm.ContentPartType(part.Type),
+			Text:      part.Text,
+			Path:      part.Path,
+			Data:      part.Data,
+			MediaType: part.MediaType,
+			URL:       part.URL,
+		}
+	}
+	return result
+}
+
+// 会话与统一格式的内容片段字段相同，可以直接转换
+func sessionPartsToUnified(parts []session.ContentPart) []message.ContentPart {
+	if len(parts) == 0 {
+		return nil
+	}
+	result := make([]message.ContentPart, len(parts))
+	for i, part := range parts {
+		result[i] = message.ContentPart(part)
+	}
+	return result
+}
+
+func unifiedPartsToSession(parts []message.ContentPart) []session.ContentPart {
+	if len(parts) == 0 {
+		return nil
+	}
+	result := make([]session.ContentPart, len(parts))
+	for i, part := range parts {
+		result[i] = session.ContentPart(part)
+	}
+	return result
+}
+
 // ========== 随机消息生成 ==========
 
 var processingMessages = []string{
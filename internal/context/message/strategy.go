@@ -0,0 +1,300 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"alex/internal/llm"
+	"alex/internal/session"
+)
+
+// Compression strategy names used in config and session metadata
+const (
+	StrategyCacheFriendly = "cache_friendly"
+	StrategySlidingWindow = "sliding_window"
+	StrategyImportance    = "importance"
+)
+
+// DefaultSlidingWindow is the number of tool call rounds the sliding window keeps
+const DefaultSlidingWindow = 8
+
+// CompressionStrategy shortens a conversation that no longer fits the compression threshold.
+// Implementations must keep every assistant tool call together with its results.
+type CompressionStrategy interface {
+	// Name identifies the strategy in config and session metadata
+	Name() string
+	// Compress returns the messages to send instead of messages
+	Compress(ctx context.Context, messages []*session.Message) []*session.Message
+}
+
+// CompressionStrategyNames lists the strategies accepted by NewCompressionStrategy
+func CompressionStrategyNames() []string {
+	return []string{StrategyCacheFriendly, StrategySlidingWindow, StrategyImportance}
+}
+
+// NewCompressionStrategy creates the strategy called name; window only applies to the
+// sliding window, 0 selects DefaultSlidingWindow. An empty name selects cache_friendly.
+func NewCompressionStrategy(mc *MessageCompressor, name string, window int) (CompressionStrategy, error) {
+	switch name {
+	case "", StrategyCacheFriendly:
+		return &cacheFriendlyStrategy{mc: mc}, nil
+	case StrategySlidingWindow:
+		if window <= 0 {
+			window = DefaultSlidingWindow
+		}
+		return &slidingWindowStrategy{mc: mc, window: window}, nil
+	case StrategyImportance:
+		return &importanceStrategy{mc: mc}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression strategy %q (available: %s)", name, strings.Join(CompressionStrategyNames(), ", "))
+	}
+}
+
+// cacheFriendlyStrategy keeps the cacheable prefix and replaces everything after it with an AI summary
+type cacheFriendlyStrategy struct {
+	mc *MessageCompressor
+}
+
+func (s *cacheFriendlyStrategy) Name() string { return StrategyCacheFriendly }
+
+func (s *cacheFriendlyStrategy) Compress(ctx context.Context, messages []*session.Message) []*session.Message {
+	return s.mc.cacheFriendlyCompress(ctx, messages, llm.CacheablePrefixMessages)
+}
+
+// slidingWindowStrategy keeps the cacheable prefix and the last window tool call rounds;
+// the messages in between are replaced by a short statistical note without an LLM call
+type slidingWindowStrategy struct {
+	mc     *MessageCompressor
+	window int
+}
+
+func (s *slidingWindowStrategy) Name() string { return StrategySlidingWindow }
+
+func (s *slidingWindowStrategy) Compress(ctx context.Context, messages []*session.Message) []*session.Message {
+	systemMessages, groups := splitConversation(messages)
+	prefixEnd := cacheablePrefixGroups(groups, llm.CacheablePrefixMessages)
+
+	// 从后向前找到第 window 个工具调用轮次，之后的消息全部保留
+	windowStart := prefixEnd
+	rounds := 0
+	for i := len(groups) - 1; i >= prefixEnd; i-- {
+		if groups[i].hasToolCalls() {
+			rounds++
+			if rounds == s.window {
+				windowStart = i
+				break
+			}
+		}
+	}
+	if windowStart == prefixEnd {
+		return messages // 工具调用轮次不足，没有可以丢弃的消息
+	}
+
+	dropped := flattenGroups(groups[prefixEnd:windowStart])
+	note := s.mc.createStatisticalSummary(dropped)
+	note.Metadata["summary_method"] = StrategySlidingWindow
+
+	result := append([]*session.Message{}, systemMessages...)
+	result = append(result, flattenGroups(groups[:prefixEnd])...)
+	result = append(result, note)
+	result = append(result, flattenGroups(groups[windowStart:])...)
+
+	log.Printf("[INFO] Sliding window compression: dropped %d messages, kept last %d tool rounds", len(dropped), s.window)
+	return result
+}
+
+// importanceStrategy keeps user instructions, file edits and errors verbatim and summarizes the rest
+type importanceStrategy struct {
+	mc *MessageCompressor
+}
+
+// 得分达到 importanceKeepScore 的消息组原样保留
+const importanceKeepScore = 2
+
+// editTools are tools whose calls record changes made to the project
+var editTools = map[string]bool{"file_edit": true, "file_replace": true}
+
+func (s *importanceStrategy) Name() string { return StrategyImportance }
+
+func (s *importanceStrategy) Compress(ctx context.Context, messages []*session.Message) []*session.Message {
+	systemMessages, groups := splitConversation(messages)
+	prefixEnd := cacheablePrefixGroups(groups, llm.CacheablePrefixMessages)
+
+	// 最近一轮工具调用及其后的消息是当前的工作状态，不参与评分
+	tailStart := len(groups)
+	for i := len(groups) - 1; i >= prefixEnd; i-- {
+		tailStart = i
+		if groups[i].hasToolCalls() {
+			break
+		}
+	}
+	if tailStart <= prefixEnd {
+		return messages
+	}
+
+	middle := groups[prefixEnd:tailStart]
+	keep := make([]bool, len(middle))
+	var candidates []int
+	for i, group := range middle {
+		if importanceScore(group) >= importanceKeepScore {
+			keep[i] = true
+			candidates = append(candidates, i)
+		}
+	}
+
+	// 保留的消息最多占压缩阈值的一半，超出时先丢弃得分低的、再丢弃较早的
+	budget := s.mc.tokenThreshold() / 2
+	keptTokens := 0
+	for _, i := range candidates {
+		keptTokens += s.mc.estimateTokens(middle[i].messages)
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return importanceScore(middle[candidates[a]]) < importanceScore(middle[candidates[b]])
+	})
+	for _, i := range candidates {
+		if keptTokens <= budget {
+			break
+		}
+		keep[i] = false
+		keptTokens -= s.mc.estimateTokens(middle[i].messages)
+	}
+
+	var dropped, kept []*session.Message
+	for i, group := range middle {
+		if keep[i] {
+			kept = append(kept, group.messages...)
+		} else {
+			dropped = append(dropped, group.messages...)
+		}
+	}
+	if len(dropped) == 0 {
+		return messages
+	}
+
+	result := append([]*session.Message{}, systemMessages...)
+	result = append(result, flattenGroups(groups[:prefixEnd])...)
+	if summary := s.mc.compressRemainingMessages(ctx, dropped); summary != nil {
+		result = append(result, summary)
+	}
+	result = append(result, kept...)
+	result = append(result, flattenGroups(groups[tailStart:])...)
+
+	log.Printf("[INFO] Importance compression: summarized %d messages, kept %d verbatim", len(dropped), len(kept))
+	return result
+}
+
+// importanceScore rates how much a message group matters for continuing the task
+func importanceScore(group messageGroup) int {
+	first := group.messages[0]
+	switch {
+	case group.orphan:
+		return 0
+	case first.Role == "user":
+		// todo 注入是自动生成的，不是用户指令
+		if source, _ := first.Metadata["source"].(string); source == "todo_injection" {
+			return 0
+		}
+		return 3
+	case group.hasToolCalls():
+		score := 0
+		for _, tc := range first.ToolCalls {
+			if editTools[tc.Name] {
+				score = 3
+			}
+		}
+		for _, msg := range group.messages[1:] {
+			if isErrorResult(msg) {
+				score = max(score, 2)
+			}
+		}
+		return score
+	case first.Role == "assistant":
+		return 1
+	}
+	return 0
+}
+
+// isErrorResult reports whether a tool result describes a failure
+func isErrorResult(msg *session.Message) bool {
+	if success, ok := msg.Metadata["tool_success"].(bool); ok {
+		return !success
+	}
+	content := strings.ToLower(msg.Content)
+	for _, marker := range []string{"error", "failed", "panic:", "exit status"} {
+		if strings.Contains(content, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// messageGroup is kept or dropped as a whole: an assistant message with tool calls and
+// the results that follow it, or any single other message
+type messageGroup struct {
+	messages []*session.Message
+	// orphan marks a tool result without a preceding tool call; it is never kept verbatim
+	orphan bool
+}
+
+func (g messageGroup) hasToolCalls() bool {
+	return g.messages[0].Role == "assistant" && len(g.messages[0].ToolCalls) > 0
+}
+
+// splitConversation separates system messages and groups the rest into tool call rounds
+func splitConversation(messages []*session.Message) ([]*session.Message, []messageGroup) {
+	var systemMessages []*session.Message
+	var groups []messageGroup
+	pending := make(map[string]bool)
+
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "system":
+			systemMessages = append(systemMessages, msg)
+		case msg.Role == "tool" && len(groups) > 0 && pending[toolCallID(msg)]:
+			last := &groups[len(groups)-1]
+			last.messages = append(last.messages, msg)
+			delete(pending, toolCallID(msg))
+		default:
+			clear(pending)
+			for _, tc := range msg.ToolCalls {
+				if msg.Role == "assistant" {
+					pending[tc.ID] = true
+				}
+			}
+			groups = append(groups, messageGroup{messages: []*session.Message{msg}, orphan: msg.Role == "tool"})
+		}
+	}
+	return systemMessages, groups
+}
+
+// cacheablePrefixGroups returns how many leading groups cover at least keep messages
+func cacheablePrefixGroups(groups []messageGroup, keep int) int {
+	count := 0
+	for i, group := range groups {
+		if count >= keep {
+			return i
+		}
+		count += len(group.messages)
+	}
+	return len(groups)
+}
+
+func flattenGroups(groups []messageGroup) []*session.Message {
+	var messages []*session.Message
+	for _, group := range groups {
+		messages = append(messages, group.messages...)
+	}
+	return messages
+}
+
+// toolCallID returns the ID of the tool call a tool result answers
+func toolCallID(msg *session.Message) string {
+	if msg.ToolID != "" {
+		return msg.ToolID
+	}
+	id, _ := msg.Metadata["tool_call_id"].(string)
+	return id
+}
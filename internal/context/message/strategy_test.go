@@ -0,0 +1,168 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"alex/internal/llm"
+	"alex/internal/session"
+)
+
+// toolRound 返回一次工具调用及其结果
+func toolRound(id, tool, args, result string) []*session.Message {
+	return []*session.Message{
+		{Role: "assistant", ToolCalls: []session.ToolCall{{ID: id, Name: tool, Args: map[string]interface{}{"arg": args}}}},
+		{Role: "tool", Content: result, Metadata: map[string]interface{}{"tool_call_id": id}},
+	}
+}
+
+// longConversation 构造系统提示、任务和若干轮工具调用，中间穿插一条用户指令、一次编辑和一次失败
+func longConversation(rounds int) []*session.Message {
+	messages := []*session.Message{
+		{Role: "system", Content: "You are Alex."},
+		{Role: "user", Content: "Fix the failing test"},
+	}
+	for i := 1; i <= rounds; i++ {
+		id := fmt.Sprintf("call_%d", i)
+		switch i {
+		case 3:
+			messages = append(messages, &session.Message{Role: "user", Content: "Do not touch the vendor directory"})
+			messages = append(messages, toolRound(id, "file_read", "a.go", strings.Repeat("package a\n", 50))...)
+		case 4:
+			messages = append(messages, toolRound(id, "file_edit", "a.go", "edited a.go")...)
+		case 5:
+			messages = append(messages, toolRound(id, "bash", "go test", "--- FAIL: TestA\nexit status 1")...)
+		default:
+			messages = append(messages, toolRound(id, "file_read", "b.go", strings.Repeat("package b\n", 50))...)
+		}
+		messages = append(messages, &session.Message{Role: "user", Content: "Current TODOs: none", Metadata: map[string]interface{}{"source": "todo_injection"}})
+	}
+	return messages
+}
+
+// assertPaired 检查每个工具调用都紧跟着它的结果，且没有孤立的结果
+func assertPaired(t *testing.T, messages []*session.Message) {
+	t.Helper()
+	pending := map[string]bool{}
+	for i, msg := range messages {
+		switch {
+		case msg.Role == "tool":
+			if !pending[toolCallID(msg)] {
+				t.Fatalf("message %d: orphan tool result %q", i, toolCallID(msg))
+			}
+			delete(pending, toolCallID(msg))
+		case len(pending) > 0:
+			t.Fatalf("message %d: tool calls %v have no result", i, pending)
+		default:
+			for _, tc := range msg.ToolCalls {
+				pending[tc.ID] = true
+			}
+		}
+	}
+}
+
+func containsContent(messages []*session.Message, text string) bool {
+	for _, msg := range messages {
+		if strings.Contains(msg.Content, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewCompressionStrategy(t *testing.T) {
+	mc := NewMessageCompressor(nil, nil)
+	for _, name := range append(CompressionStrategyNames(), "") {
+		if _, err := NewCompressionStrategy(mc, name, 0); err != nil {
+			t.Errorf("NewCompressionStrategy(%q) failed: %v", name, err)
+		}
+	}
+	if err := mc.SetStrategy("lru", 0); err == nil || mc.Strategy() != StrategyCacheFriendly {
+		t.Errorf("an unknown strategy should be rejected and keep the current one, got %v, %s", err, mc.Strategy())
+	}
+}
+
+func TestSlidingWindowStrategy(t *testing.T) {
+	mc := NewMessageCompressor(nil, nil)
+	if err := mc.SetStrategy(StrategySlidingWindow, 3); err != nil {
+		t.Fatal(err)
+	}
+	messages := longConversation(10)
+
+	compressed := mc.strategy.Compress(context.Background(), messages)
+	assertPaired(t, compressed)
+	if compressed[0].Content != "You are Alex." || compressed[1].Content != "Fix the failing test" {
+		t.Errorf("system prompt and task should stay in front: %q, %q", compressed[0].Content, compressed[1].Content)
+	}
+	var calls []string
+	for _, msg := range compressed {
+		for _, tc := range msg.ToolCalls {
+			calls = append(calls, tc.ID)
+		}
+	}
+	// 前缀中的第一轮加上最后三轮
+	if strings.Join(calls, ",") != "call_1,call_8,call_9,call_10" {
+		t.Errorf("expected the prefix round and the last 3 rounds, got %v", calls)
+	}
+	if !containsContent(compressed, "Previous conversation summary") {
+		t.Error("dropped messages should be replaced by a note")
+	}
+}
+
+func TestImportanceStrategy(t *testing.T) {
+	mc := NewMessageCompressor(nil, nil)
+	if err := mc.SetStrategy(StrategyImportance, 0); err != nil {
+		t.Fatal(err)
+	}
+	messages := longConversation(10)
+
+	compressed := mc.strategy.Compress(context.Background(), messages)
+	assertPaired(t, compressed)
+	if len(compressed) >= len(messages) {
+		t.Fatalf("nothing was compressed: %d -> %d messages", len(messages), len(compressed))
+	}
+	for _, kept := range []string{"Do not touch the vendor directory", "edited a.go", "--- FAIL: TestA"} {
+		if !containsContent(compressed, kept) {
+			t.Errorf("%q should be kept verbatim", kept)
+		}
+	}
+	// 最后一轮保留，中间的读取被摘要
+	var calls []string
+	for _, msg := range compressed {
+		for _, tc := range msg.ToolCalls {
+			calls = append(calls, tc.ID)
+		}
+	}
+	if strings.Join(calls, ",") != "call_1,call_4,call_5,call_10" {
+		t.Errorf("expected the prefix round, the edit, the failure and the latest round, got %v", calls)
+	}
+	if !containsContent(compressed, "Previous conversation summary") {
+		t.Error("dropped messages should be summarized")
+	}
+}
+
+func TestMessageCompressor_Report(t *testing.T) {
+	mc := NewMessageCompressor(nil, nil)
+	mc.capabilities = llm.ModelCapabilities{ContextWindow: 1600, MaxOutput: 200}
+	if err := mc.SetStrategy(StrategySlidingWindow, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := longConversation(10)
+	compressed, report := mc.CompressMessages(context.Background(), messages)
+	if report == nil {
+		t.Fatal("expected compression to run")
+	}
+	if report.Strategy != StrategySlidingWindow || report.MessagesBefore != len(messages) || report.MessagesAfter != len(compressed) {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.TokensAfter >= report.TokensBefore {
+		t.Errorf("compression should save tokens: %+v", report)
+	}
+
+	if _, report := mc.CompressMessages(context.Background(), messages[:6]); report != nil {
+		t.Errorf("short conversations are not compressed, got %+v", report)
+	}
+}
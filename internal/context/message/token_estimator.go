@@ -1,25 +1,46 @@
 package message
 
 import (
+	"encoding/json"
+
 	"alex/internal/llm"
 	"alex/internal/session"
-	"regexp"
-	"strings"
+	"alex/internal/tokenizer"
+)
+
+// 每条消息的格式开销（角色、分隔符），与 OpenAI chat 格式一致
+const (
+	messageOverheadTokens  = 4
+	toolCallOverheadTokens = 8
+	toolDefOverheadTokens  = 10
+	replyPrimingTokens     = 3
+	// 图片按分辨率计费，这里按一张约 1024x1024 的图片估算
+	imageTokens = 1000
 )
 
-// TokenEstimator provides unified token estimation logic
+// TokenEstimator counts message tokens with the tokenizer of the target model
 type TokenEstimator struct {
-	// Patterns for improved token estimation
-	wordPattern *regexp.Regexp
-	codePattern *regexp.Regexp
+	tokenizer tokenizer.Tokenizer
 }
 
-// NewTokenEstimator creates a new token estimator
+// NewTokenEstimator creates a token estimator using the default encoding
 func NewTokenEstimator() *TokenEstimator {
-	return &TokenEstimator{
-		wordPattern: regexp.MustCompile(`\b\w+\b`),
-		codePattern: regexp.MustCompile("```[\\s\\S]*?```|`[^`]*`"),
-	}
+	return NewTokenEstimatorForModel("")
+}
+
+// NewTokenEstimatorForModel creates a token estimator using the tokenizer of model
+func NewTokenEstimatorForModel(model string) *TokenEstimator {
+	return &TokenEstimator{tokenizer: tokenizer.ForModel(model)}
+}
+
+// SetModel switches to the tokenizer of model
+func (te *TokenEstimator) SetModel(model string) {
+	te.tokenizer = tokenizer.ForModel(model)
+}
+
+// Tokenizer returns the tokenizer in use
+func (te *TokenEstimator) Tokenizer() tokenizer.Tokenizer {
+	return te.tokenizer
 }
 
 // EstimateSessionMessages estimates tokens for session messages
@@ -27,44 +48,39 @@ func (te *TokenEstimator) EstimateSessionMessages(messages []*session.Message) i
 	totalTokens := 0
 
 	for _, msg := range messages {
-		contentTokens := te.estimateContentTokens(msg.Content)
-		totalTokens += contentTokens + 10 // Role and metadata overhead
+		totalTokens += te.estimateContentTokens(msg.Content) + messageOverheadTokens
+		for _, part := range msg.Parts {
+			totalTokens += te.estimatePart(part.Type, part.Text)
+		}
 
-		// Add tokens for tool calls
 		for _, tc := range msg.ToolCalls {
-			totalTokens += len(tc.Name)/3 + len(tc.ID)/3 + 15 // Tool call overhead
+			args, _ := json.Marshal(tc.Args)
+			totalTokens += te.estimateToolCall(tc.Name, string(args))
 		}
 	}
 
 	return totalTokens
 }
 
-// estimateContentTokens provides more accurate token estimation for content
+// estimateContentTokens counts the tokens of content
 func (te *TokenEstimator) estimateContentTokens(content string) int {
 	if content == "" {
 		return 0
 	}
+	return te.tokenizer.Count(content)
+}
 
-	// Handle code blocks separately
-	codeBlocks := te.codePattern.FindAllString(content, -1)
-	textWithoutCode := te.codePattern.ReplaceAllString(content, "")
-	
-	// Count tokens in regular text
-	words := te.wordPattern.FindAllString(textWithoutCode, -1)
-	regularTokens := len(words)
-	
-	// Add punctuation and spacing tokens (roughly 1 token per 4 characters)
-	nonWordChars := len(textWithoutCode) - len(strings.Join(words, ""))
-	regularTokens += nonWordChars / 4
-	
-	// Count tokens in code blocks (code is more token-dense)
-	codeTokens := 0
-	for _, codeBlock := range codeBlocks {
-		// Code blocks: approximately 2 characters per token
-		codeTokens += len(codeBlock) / 2
+// estimatePart counts a content part; images use a fixed estimate
+func (te *TokenEstimator) estimatePart(partType, text string) int {
+	if partType == string(llm.ContentPartImage) {
+		return imageTokens
 	}
-	
-	return regularTokens + codeTokens
+	return te.estimateContentTokens(text)
+}
+
+// estimateToolCall counts a tool call by its name and JSON arguments
+func (te *TokenEstimator) estimateToolCall(name, arguments string) int {
+	return te.estimateContentTokens(name) + te.estimateContentTokens(arguments) + toolCallOverheadTokens
 }
 
 // EstimateLLMMessages estimates tokens for LLM messages
@@ -72,18 +88,37 @@ func (te *TokenEstimator) EstimateLLMMessages(messages []llm.Message) int {
 	totalTokens := 0
 
 	for _, msg := range messages {
-		contentTokens := te.estimateContentTokens(msg.Content)
-		totalTokens += contentTokens + 10 // Role and metadata overhead
+		totalTokens += te.estimateContentTokens(msg.Content) + messageOverheadTokens
+		totalTokens += te.estimateContentTokens(msg.Reasoning)
+		for _, part := range msg.Parts {
+			totalTokens += te.estimatePart(string(part.Type), part.Text)
+		}
 
-		// Add tokens for tool calls
 		for _, tc := range msg.ToolCalls {
-			totalTokens += len(tc.Function.Name)/3 + len(tc.ID)/3 + 15 // Tool call overhead
+			totalTokens += te.estimateToolCall(tc.Function.Name, tc.Function.Arguments)
 		}
 	}
 
 	return totalTokens
 }
 
+// EstimateTools estimates tokens for tool definitions sent with a request
+func (te *TokenEstimator) EstimateTools(tools []llm.Tool) int {
+	totalTokens := 0
+	for _, tool := range tools {
+		params, _ := json.Marshal(tool.Function.Parameters)
+		totalTokens += te.estimateContentTokens(tool.Function.Name) +
+			te.estimateContentTokens(tool.Function.Description) +
+			te.estimateContentTokens(string(params)) + toolDefOverheadTokens
+	}
+	return totalTokens
+}
+
+// EstimateRequest estimates the prompt tokens of a chat request
+func (te *TokenEstimator) EstimateRequest(req *llm.ChatRequest) int {
+	return te.EstimateLLMMessages(req.Messages) + te.EstimateTools(req.Tools) + replyPrimingTokens
+}
+
 // EstimateString estimates tokens for a string
 func (te *TokenEstimator) EstimateString(content string) int {
 	return te.estimateContentTokens(content)
@@ -2,6 +2,8 @@ package message
 
 import (
 	"testing"
+
+	"alex/internal/session"
 )
 
 func TestTokenEstimator_EstimateContentTokens(t *testing.T) {
@@ -22,26 +24,26 @@ func TestTokenEstimator_EstimateContentTokens(t *testing.T) {
 		{
 			name:     "Simple sentence",
 			content:  "Hello world, how are you?",
-			expected: 6, // "Hello", "world", ",", "how", "are", "you", "?"
+			expected: 7, // "Hello", " world", ",", " how", " are", " you", "?"
 			maxDiff:  2,
 		},
 		{
 			name:     "Code block",
 			content:  "```go\nfunc main() {\n    fmt.Println(\"hello\")\n}\n```",
-			expected: 25, // Code is more token-dense
-			maxDiff:  5,
+			expected: 15, // cl100k_base
+			maxDiff:  4,
 		},
 		{
 			name:     "Mixed content",
 			content:  "Here's some code:\n```python\nprint('hello')\n```\nThat's a simple example.",
 			expected: 20,
-			maxDiff:  5,
+			maxDiff:  4,
 		},
 		{
 			name:     "Long text",
 			content:  "This is a longer piece of text that contains multiple sentences. It should be tokenized more accurately than the old 3-character rule. We expect better estimation here.",
-			expected: 30,
-			maxDiff:  8,
+			expected: 33,
+			maxDiff:  6,
 		},
 	}
 
@@ -113,4 +115,25 @@ func abs(x int) int {
 		return -x
 	}
 	return x
-}
\ No newline at end of file
+}
+
+func TestTokenEstimator_CountsToolCalls(t *testing.T) {
+	te := NewTokenEstimator()
+
+	plain := []*session.Message{{Role: "assistant", Content: "Reading the file"}}
+	withTool := []*session.Message{{
+		Role:    "assistant",
+		Content: "Reading the file",
+		ToolCalls: []session.ToolCall{{
+			ID:   "call_1",
+			Name: "file_read",
+			Args: map[string]interface{}{"file_path": "internal/context/message/compressor.go"},
+		}},
+	}}
+
+	base := te.EstimateSessionMessages(plain)
+	total := te.EstimateSessionMessages(withTool)
+	if total-base <= toolCallOverheadTokens {
+		t.Errorf("tool call arguments not counted: %d without, %d with tool call", base, total)
+	}
+}
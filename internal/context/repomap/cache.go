@@ -0,0 +1,73 @@
+package repomap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion changes when the extracted symbols change format, invalidating old caches
+const cacheVersion = 1
+
+// FileEntry holds the symbols of one source file and the state they were extracted from
+type FileEntry struct {
+	Path    string   `json:"path"` // Relative to the repository root, slash separated
+	ModTime int64    `json:"mod_time"`
+	Size    int64    `json:"size"`
+	Package string   `json:"package,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// cacheFile is the on-disk symbol index of a repository
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Root    string                `json:"root"`
+	Files   map[string]*FileEntry `json:"files"`
+}
+
+// DefaultCacheDir returns where repository maps are cached
+func DefaultCacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".alex", "repomap"), nil
+}
+
+// cachePath - 每个仓库根目录一个缓存文件
+func (g *Generator) cachePath() string {
+	sum := sha256.Sum256([]byte(g.root))
+	return filepath.Join(g.cacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCache returns the cached entries of the repository, empty when there is no valid cache
+func (g *Generator) loadCache() map[string]*FileEntry {
+	data, err := os.ReadFile(g.cachePath())
+	if err != nil {
+		return map[string]*FileEntry{}
+	}
+	var cache cacheFile
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Version != cacheVersion || cache.Root != g.root || cache.Files == nil {
+		return map[string]*FileEntry{}
+	}
+	return cache.Files
+}
+
+// saveCache writes the entries atomically so a concurrent run never reads a partial file
+func (g *Generator) saveCache(files map[string]*FileEntry) error {
+	if err := os.MkdirAll(g.cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create repo map cache directory: %w", err)
+	}
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Root: g.root, Files: files})
+	if err != nil {
+		return fmt.Errorf("failed to encode repo map cache: %w", err)
+	}
+	tmp := g.cachePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write repo map cache: %w", err)
+	}
+	return os.Rename(tmp, g.cachePath())
+}
@@ -0,0 +1,199 @@
+package repomap
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxSymbolsPerFile - 每个文件最多记录的符号数，生成代码等超长文件只保留开头部分
+const maxSymbolsPerFile = 40
+
+// maxSymbolLength - 单个符号签名的最大长度
+const maxSymbolLength = 160
+
+// languagePatterns are the declaration patterns of the languages without a parser.
+// Each match is cut at the first '{' or ':' that opens a body.
+var languagePatterns = map[string][]*regexp.Regexp{
+	".py": {
+		regexp.MustCompile(`^(?:class|(?:async\s+)?def)\s+[A-Za-z]\w*.*`),
+		regexp.MustCompile(`^ {4}(?:async\s+)?def\s+[A-Za-z]\w*.*`),
+	},
+	".js":  jsPatterns,
+	".jsx": jsPatterns,
+	".ts":  jsPatterns,
+	".tsx": jsPatterns,
+	".java": {
+		regexp.MustCompile(`^\s*public\s+(?:[\w<>]+\s+)*(?:class|interface|enum|record)\s+\w+.*`),
+		regexp.MustCompile(`^\s*public\s+(?:static\s+|final\s+|abstract\s+|synchronized\s+)*[\w<>\[\],\s]+\s+\w+\s*\(.*`),
+	},
+	".rs": {
+		regexp.MustCompile(`^\s*pub(?:\([\w:]+\))?\s+(?:async\s+)?(?:fn|struct|enum|trait|type|mod)\s+\w+.*`),
+	},
+	".rb": {
+		regexp.MustCompile(`^\s*(?:class|module|def)\s+[A-Za-z][\w.:]*.*`),
+	},
+}
+
+var jsPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^export\s+(?:default\s+)?(?:async\s+)?(?:function\*?|class|interface|type|enum|const|abstract\s+class)\s+\w+.*`),
+}
+
+// supported reports whether the file at path gets a map entry
+func supported(path string) bool {
+	if strings.HasSuffix(path, "_test.go") {
+		return false
+	}
+	ext := filepath.Ext(path)
+	_, ok := languagePatterns[ext]
+	return ok || ext == ".go"
+}
+
+// extractSymbols returns the package (Go only) and the symbol lines of a source file
+func extractSymbols(path string, src []byte) (string, []string) {
+	if filepath.Ext(path) == ".go" {
+		if pkg, symbols, err := extractGoSymbols(src); err == nil {
+			return pkg, symbols
+		}
+		// 语法错误的文件退回到按行匹配
+		return "", extractWithPatterns(src, goFallbackPatterns)
+	}
+	return "", extractWithPatterns(src, languagePatterns[filepath.Ext(path)])
+}
+
+var goFallbackPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^func\s+(?:\([^)]*\)\s*)?[A-Z]\w*.*`),
+	regexp.MustCompile(`^type\s+[A-Z]\w*.*`),
+}
+
+// extractGoSymbols lists the exported types, functions and methods of a Go file
+func extractGoSymbols(src []byte) (string, []string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var symbols []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.IsExported() {
+					symbols = append(symbols, goTypeSymbol(fset, ts))
+				}
+			}
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() || (d.Recv != nil && !exportedReceiver(d.Recv)) {
+				continue
+			}
+			// 只打印签名
+			signature := *d
+			signature.Doc, signature.Body = nil, nil
+			symbols = append(symbols, printNode(fset, &signature))
+		}
+	}
+	return file.Name.Name, limitSymbols(symbols), nil
+}
+
+// goTypeSymbol describes a type declaration; interfaces list their method names
+func goTypeSymbol(fset *token.FileSet, ts *ast.TypeSpec) string {
+	name := "type " + ts.Name.Name
+	if ts.Assign.IsValid() {
+		name += " ="
+	}
+	switch t := ts.Type.(type) {
+	case *ast.StructType:
+		return name + " struct"
+	case *ast.InterfaceType:
+		var methods []string
+		for _, field := range t.Methods.List {
+			for _, n := range field.Names {
+				methods = append(methods, n.Name)
+			}
+		}
+		if len(methods) == 0 {
+			return name + " interface"
+		}
+		return name + " interface{ " + strings.Join(methods, "; ") + " }"
+	default:
+		return name + " " + printNode(fset, ts.Type)
+	}
+}
+
+// exportedReceiver reports whether a method belongs to an exported type
+func exportedReceiver(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	expr := recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.IsExported()
+		default:
+			return false
+		}
+	}
+}
+
+func printNode(fset *token.FileSet, node any) string {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return truncateSymbol(strings.Join(strings.Fields(b.String()), " "))
+}
+
+// extractWithPatterns returns the lines matching one of the declaration patterns
+func extractWithPatterns(src []byte, patterns []*regexp.Regexp) []string {
+	var symbols []string
+	for _, line := range strings.Split(string(src), "\n") {
+		for _, pattern := range patterns {
+			if match := pattern.FindString(line); match != "" {
+				symbols = append(symbols, cleanDeclaration(match))
+				break
+			}
+		}
+	}
+	return limitSymbols(symbols)
+}
+
+// cleanDeclaration cuts a declaration line before its body
+func cleanDeclaration(line string) string {
+	line = strings.TrimSpace(line)
+	if i := strings.Index(line, "{"); i > 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSuffix(strings.TrimSpace(line), ":")
+	line = strings.TrimSuffix(strings.TrimSpace(line), "=")
+	return truncateSymbol(strings.Join(strings.Fields(line), " "))
+}
+
+func truncateSymbol(symbol string) string {
+	if runes := []rune(symbol); len(runes) > maxSymbolLength {
+		return string(runes[:maxSymbolLength]) + "..."
+	}
+	return symbol
+}
+
+func limitSymbols(symbols []string) []string {
+	if len(symbols) > maxSymbolsPerFile {
+		return symbols[:maxSymbolsPerFile]
+	}
+	return symbols
+}
@@ -0,0 +1,305 @@
+// Package repomap builds a compact map of a repository - packages, exported types,
+// functions and method signatures - ranked by relevance to the current task and fitted
+// to a token budget, for the agent's system prompt.
+package repomap
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"alex/internal/tokenizer"
+)
+
+// DefaultBudget is the default size of a repository map in tokens
+const DefaultBudget = 1024
+
+// 扫描限制，避免在超大仓库中花费过多时间
+const (
+	maxFiles    = 5000
+	maxFileSize = 256 * 1024
+)
+
+// skippedDirs are directories that hold dependencies or build output
+var skippedDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "dist": true, "build": true, "target": true,
+	"__pycache__": true, "venv": true, "testdata": true,
+}
+
+// Options select what a map shows
+type Options struct {
+	// Task ranks files whose path or symbols mention its words first
+	Task string
+	// Touched are files the session read or edited, most recent first
+	Touched []string
+	// Budget is the maximum size of the map in tokens (0 selects DefaultBudget)
+	Budget int
+}
+
+// Generator builds maps of one repository, reusing the symbols cached on disk for
+// files whose modification time and size did not change
+type Generator struct {
+	root      string
+	cacheDir  string
+	tokenizer tokenizer.Tokenizer
+	now       func() time.Time
+}
+
+// NewGenerator creates a generator for the repository at root with the default cache directory
+func NewGenerator(root string) (*Generator, error) {
+	cacheDir, err := DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewGeneratorAt(root, cacheDir), nil
+}
+
+// NewGeneratorAt creates a generator that caches symbols in cacheDir
+func NewGeneratorAt(root, cacheDir string) *Generator {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return &Generator{
+		root:      root,
+		cacheDir:  cacheDir,
+		tokenizer: tokenizer.ForEncoding(tokenizer.CL100kBase),
+		now:       time.Now,
+	}
+}
+
+// SetTokenizer sets the tokenizer the budget is counted with
+func (g *Generator) SetTokenizer(tok tokenizer.Tokenizer) {
+	if tok != nil {
+		g.tokenizer = tok
+	}
+}
+
+// Generate returns the repository map, or an empty string when the repository has no
+// supported source files
+func (g *Generator) Generate(opts Options) (string, error) {
+	entries, err := g.Index()
+	if err != nil {
+		return "", err
+	}
+	budget := opts.Budget
+	if budget == 0 {
+		budget = DefaultBudget
+	}
+	return g.render(rankFiles(entries, opts, g.root, g.now()), len(entries), budget), nil
+}
+
+// Index extracts the symbols of every supported source file, parsing only files that
+// changed since the cached index, and returns the entries sorted by path
+func (g *Generator) Index() ([]*FileEntry, error) {
+	cached := g.loadCache()
+	files := make(map[string]*FileEntry, len(cached))
+	changed := false
+
+	err := filepath.WalkDir(g.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 无法读取的目录跳过，不影响其余部分
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != g.root && (strings.HasPrefix(name, ".") || skippedDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !supported(name) {
+			return nil
+		}
+		if len(files) >= maxFiles {
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		rel, err := filepath.Rel(g.root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry, ok := cached[rel]; ok && entry.ModTime == info.ModTime().UnixNano() && entry.Size == info.Size() {
+			files[rel] = entry
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		pkg, symbols := extractSymbols(name, src)
+		files[rel] = &FileEntry{Path: rel, ModTime: info.ModTime().UnixNano(), Size: info.Size(), Package: pkg, Symbols: symbols}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repository: %w", err)
+	}
+
+	// 删除的文件也需要更新缓存
+	if changed || len(files) != len(cached) {
+		if err := g.saveCache(files); err != nil {
+			log.Printf("[WARN] RepoMap: %v", err)
+		}
+	}
+
+	entries := make([]*FileEntry, 0, len(files))
+	for _, entry := range files {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// render writes the ranked files until the budget is used; a file whose symbols do not
+// fit is listed by path only
+func (g *Generator) render(ranked []*FileEntry, total, budget int) string {
+	if len(ranked) == 0 || budget < 0 {
+		return ""
+	}
+
+	var body strings.Builder
+	used, shown := 0, 0
+	for _, entry := range ranked {
+		heading := entry.Path
+		if entry.Package != "" {
+			heading += " (package " + entry.Package + ")"
+		}
+		block := heading + "\n"
+		for _, symbol := range entry.Symbols {
+			block += "  " + symbol + "\n"
+		}
+
+		tokens := g.tokenizer.Count(block)
+		if used+tokens > budget {
+			block = heading + "\n"
+			tokens = g.tokenizer.Count(block)
+			if used+tokens > budget {
+				continue
+			}
+		}
+		body.WriteString(block)
+		used += tokens
+		shown++
+	}
+	if shown == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d source files, most relevant first:\n%s", shown, total, body.String())
+}
+
+// rankedFile is a file with its relevance score
+type rankedFile struct {
+	entry *FileEntry
+	score int
+}
+
+// rankFiles orders files by relevance: files the session touched, files whose path or
+// symbols mention the task, and recently modified files come first. Files without
+// symbols are only kept when they are relevant.
+func rankFiles(entries []*FileEntry, opts Options, root string, now time.Time) []*FileEntry {
+	terms := taskTerms(opts.Task)
+	touched := make(map[string]int)
+	for i, path := range opts.Touched {
+		rel := relativePath(root, path)
+		if _, seen := touched[rel]; !seen {
+			touched[rel] = i
+		}
+	}
+
+	var ranked []rankedFile
+	for _, entry := range entries {
+		score := 0
+		if i, ok := touched[entry.Path]; ok {
+			score += 10 - min(i, 5)
+		}
+
+		lowerPath := strings.ToLower(entry.Path)
+		for _, term := range terms {
+			if strings.Contains(lowerPath, term) {
+				score += 4
+			}
+			matches := 0
+			for _, symbol := range entry.Symbols {
+				if strings.Contains(strings.ToLower(symbol), term) {
+					matches++
+				}
+			}
+			score += min(matches, 3)
+		}
+
+		switch age := now.Sub(time.Unix(0, entry.ModTime)); {
+		case age < 24*time.Hour:
+			score += 3
+		case age < 7*24*time.Hour:
+			score += 1
+		}
+
+		if score == 0 && len(entry.Symbols) == 0 {
+			continue
+		}
+		ranked = append(ranked, rankedFile{entry: entry, score: score})
+	}
+
+	// 同分时符号多的文件通常更核心
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		if len(ranked[i].entry.Symbols) != len(ranked[j].entry.Symbols) {
+			return len(ranked[i].entry.Symbols) > len(ranked[j].entry.Symbols)
+		}
+		return ranked[i].entry.Path < ranked[j].entry.Path
+	})
+
+	result := make([]*FileEntry, len(ranked))
+	for i, r := range ranked {
+		result[i] = r.entry
+	}
+	return result
+}
+
+var wordPattern = regexp.MustCompile(`[A-Za-z][A-Za-z0-9_]*`)
+
+// stopWords are common task words that match too many paths and symbols
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true, "from": true,
+	"add": true, "fix": true, "make": true, "use": true, "into": true, "when": true, "should": true,
+	"file": true, "files": true, "code": true, "func": true, "type": true, "new": true, "get": true, "set": true,
+}
+
+// taskTerms returns the distinct lower-case words of a task worth matching
+func taskTerms(task string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range wordPattern.FindAllString(task, -1) {
+		word = strings.ToLower(word)
+		if len(word) < 3 || stopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// relativePath converts a touched path to the slash-separated form used in the index
+func relativePath(root, path string) string {
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
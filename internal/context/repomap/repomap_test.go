@@ -0,0 +1,194 @@
+package repomap
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeRepo 在临时目录中创建一个小仓库
+func writeRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// 旧文件不因修改时间加分
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+var sampleRepo = map[string]string{
+	"internal/session/session.go": `package session
+
+type Manager struct{ dir string }
+
+type Store interface {
+	Load(id string) error
+	Save() error
+}
+
+func NewManager(dir string) *Manager { return &Manager{dir: dir} }
+
+func (m *Manager) Start(id string) (*Session, error) { return nil, nil }
+
+func (m *Manager) reset() {}
+
+type Session struct{}
+
+func helper() {}
+`,
+	"internal/session/session_test.go": "package session\n\nfunc TestStart(t *testing.T) {}\n",
+	"cmd/main.go":                      "package main\n\nfunc main() {}\n",
+	"scripts/tool.py":                  "class Builder(Base):\n    def build(self, target: str) -> bool:\n        pass\n    def _private(self):\n        pass\n\ndef run(args):\n    pass\n",
+	"web/api.ts":                       "export async function fetchUser(id: string): Promise<User> {\n}\nconst local = 1\nexport interface User {\n}\n",
+	"broken/broken.go":                 "package broken\n\nfunc Exported() {\n",
+	"node_modules/lib/index.js":        "export function ignored() {}\n",
+}
+
+func TestExtractSymbols(t *testing.T) {
+	root := writeRepo(t, sampleRepo)
+	entries, err := NewGeneratorAt(root, t.TempDir()).Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := map[string]*FileEntry{}
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	if _, ok := byPath["internal/session/session_test.go"]; ok {
+		t.Error("test files should not be indexed")
+	}
+	if _, ok := byPath["node_modules/lib/index.js"]; ok {
+		t.Error("dependency directories should be skipped")
+	}
+
+	tests := []struct {
+		path    string
+		pkg     string
+		symbols []string
+	}{
+		{"internal/session/session.go", "session", []string{
+			"type Manager struct",
+			"type Store interface{ Load; Save }",
+			"func NewManager(dir string) *Manager",
+			"func (m *Manager) Start(id string) (*Session, error)",
+			"type Session struct",
+		}},
+		{"cmd/main.go", "main", nil},
+		{"scripts/tool.py", "", []string{"class Builder(Base)", "def build(self, target: str) -> bool", "def run(args)"}},
+		{"web/api.ts", "", []string{"export async function fetchUser(id: string): Promise<User>", "export interface User"}},
+		{"broken/broken.go", "", []string{"func Exported()"}},
+	}
+	for _, tt := range tests {
+		entry, ok := byPath[tt.path]
+		if !ok {
+			t.Errorf("%s was not indexed", tt.path)
+			continue
+		}
+		if entry.Package != tt.pkg || strings.Join(entry.Symbols, "|") != strings.Join(tt.symbols, "|") {
+			t.Errorf("%s: got package %q symbols %q, want %q %q", tt.path, entry.Package, entry.Symbols, tt.pkg, tt.symbols)
+		}
+	}
+}
+
+func TestGenerate_RanksAndFitsBudget(t *testing.T) {
+	root := writeRepo(t, sampleRepo)
+	g := NewGeneratorAt(root, t.TempDir())
+
+	repoMap, err := g.Generate(Options{Task: "Why does the session manager not start?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(repoMap, "4 of 5 source files, most relevant first:\ninternal/session/session.go (package session)\n") {
+		t.Errorf("the file matching the task should come first:\n%s", repoMap)
+	}
+	if strings.Contains(repoMap, "cmd/main.go") {
+		t.Error("a file without symbols that is not relevant should be left out")
+	}
+
+	// 最近读取的文件排在任务匹配之前
+	repoMap, err = g.Generate(Options{Task: "session", Touched: []string{filepath.Join(root, "web/api.ts")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(repoMap, "first:\nweb/api.ts\n") {
+		t.Errorf("the touched file should come first:\n%s", repoMap)
+	}
+
+	small, err := g.Generate(Options{Task: "session", Budget: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.tokenizer.Count(strings.SplitN(small, "\n", 2)[1]) > 40 || !strings.Contains(small, "internal/session/session.go") {
+		t.Errorf("the map should fit the budget and keep the most relevant file:\n%s", small)
+	}
+	if none, _ := g.Generate(Options{Budget: -1}); none != "" {
+		t.Errorf("a negative budget disables the map, got %q", none)
+	}
+}
+
+func TestIndex_Incremental(t *testing.T) {
+	root := writeRepo(t, sampleRepo)
+	cacheDir := t.TempDir()
+	if _, err := NewGeneratorAt(root, cacheDir).Index(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未修改的文件直接使用缓存：篡改缓存中的符号后应原样返回
+	g := NewGeneratorAt(root, cacheDir)
+	data, err := os.ReadFile(g.cachePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache cacheFile
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatal(err)
+	}
+	cache.Files["cmd/main.go"].Symbols = []string{"func Cached()"}
+	data, _ = json.Marshal(cache)
+	if err := os.WriteFile(g.cachePath(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改过的文件重新解析，删除的文件从缓存中移除
+	if err := os.WriteFile(filepath.Join(root, "web/api.ts"), []byte("export class Client {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "scripts/tool.py")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := g.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, entry := range entries {
+		got[entry.Path] = strings.Join(entry.Symbols, "|")
+	}
+	if got["cmd/main.go"] != "func Cached()" {
+		t.Errorf("unchanged files should come from the cache, got %q", got["cmd/main.go"])
+	}
+	if got["web/api.ts"] != "export class Client" {
+		t.Errorf("changed files should be parsed again, got %q", got["web/api.ts"])
+	}
+	if _, ok := got["scripts/tool.py"]; ok {
+		t.Error("deleted files should be dropped")
+	}
+	if reloaded := g.loadCache(); len(reloaded) != len(entries) {
+		t.Errorf("the cache should be updated, has %d of %d files", len(reloaded), len(entries))
+	}
+}
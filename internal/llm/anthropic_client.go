@@ -0,0 +1,673 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicAPIVersion        = "2023-06-01"
+	anthropicDefaultMaxTokens  = 4096
+	anthropicMinThinkingBudget = 1024
+)
+
+// AnthropicClient talks to the native Anthropic Messages API
+type AnthropicClient struct {
+	httpClient    *http.Client
+	config        *Config
+	streamEnabled bool
+}
+
+// NewAnthropicClient creates a Messages API client for config
+func NewAnthropicClient(config *Config) (*AnthropicClient, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 200 * time.Second
+	}
+
+	return &AnthropicClient{
+		httpClient:    &http.Client{Timeout: timeout},
+		config:        config,
+		streamEnabled: true,
+	}, nil
+}
+
+// anthropicRequest is the Messages API request body
+type anthropicRequest struct {
+	Model       string                  `json:"model"`
+	System      []anthropicContentBlock `json:"system,omitempty"`
+	Messages    []anthropicMessage      `json:"messages"`
+	MaxTokens   int                     `json:"max_tokens"`
+	Temperature *float64                `json:"temperature,omitempty"`
+	Stream      bool                    `json:"stream,omitempty"`
+	Tools       []anthropicTool         `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice    `json:"tool_choice,omitempty"`
+	Thinking    *anthropicThinkingCfg   `json:"thinking,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock covers the text, thinking, tool_use and tool_result block types
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	// Source is the image of an image block
+	Source *anthropicImageSource `json:"source,omitempty"`
+	// CacheControl marks a prompt cache breakpoint ending at this block
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+// ephemeralCache is the only cache_control type the Messages API supports
+var ephemeralCache = &anthropicCacheControl{Type: "ephemeral"}
+
+type anthropicTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description,omitempty"`
+	InputSchema  interface{}            `json:"input_schema"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicThinkingCfg struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// usage converts to Usage; prompt tokens count cached and uncached input alike
+func (u anthropicUsage) usage(outputTokens int) Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: outputTokens,
+		TotalTokens:      prompt + outputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Role       string                  `json:"role"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+type anthropicStreamEvent struct {
+	Type         string                 `json:"type"`
+	Index        int                    `json:"index"`
+	Message      *anthropicResponse     `json:"message,omitempty"`
+	ContentBlock *anthropicContentBlock `json:"content_block,omitempty"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Chat sends a chat request and returns the response
+func (c *AnthropicClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	resp, limiter, reserved, err := c.send(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	log.Printf("[DEBUG] Anthropic response: %s", string(body))
+
+	var anthropicResp anthropicResponse
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	chatResp := anthropicResp.toChatResponse()
+	limiter.Settle(reserved, chatResp.Usage)
+	return chatResp, nil
+}
+
+// ChatStream sends a chat request and translates Anthropic stream events into deltas
+func (c *AnthropicClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	if !c.streamEnabled {
+		return nil, fmt.Errorf("streaming is disabled")
+	}
+
+	resp, limiter, reserved, err := c.send(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	deltaChannel := make(chan StreamDelta, 1000)
+
+	go func() {
+		defer close(deltaChannel)
+
+		state := newAnthropicStreamState()
+		var usage Usage
+		defer func() { limiter.Settle(reserved, usage) }()
+		var streamErr error
+		err := readSSEData(ctx, resp.Body, func(data string) bool {
+			var event anthropicStreamEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				log.Printf("[WARN] Failed to decode Anthropic stream event: %v", err)
+				return true
+			}
+			if event.Type == "error" && event.Error != nil {
+				log.Printf("[ERROR] AnthropicClient: stream error %s: %s", event.Error.Type, event.Error.Message)
+				streamErr = fmt.Errorf("anthropic stream error %s: %s", event.Error.Type, event.Error.Message)
+				return false
+			}
+
+			for _, delta := range state.translate(event) {
+				if delta.Usage.TotalTokens > 0 {
+					usage = delta.Usage
+				}
+				select {
+				case deltaChannel <- delta:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return event.Type != "message_stop"
+		})
+		if streamErr == nil {
+			streamErr = err
+		}
+		if streamErr != nil {
+			sendStreamError(ctx, deltaChannel, streamErr)
+		}
+	}()
+
+	return deltaChannel, nil
+}
+
+// send posts req to the Messages endpoint and returns the successful HTTP response,
+// together with the provider rate limiter and the tokens reserved on it
+func (c *AnthropicClient) send(ctx context.Context, req *ChatRequest, stream bool) (*http.Response, *RateLimiter, int, error) {
+	config := req.Config
+	if config == nil {
+		config = c.config
+	}
+	baseURL, apiKey, model := modelConfigFor(config, req.ModelType)
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	applyCapabilities(req, model)
+	AnthropicPromptCache{}.Prepare(req, "", "")
+	body := buildAnthropicRequest(req, model, config.ThinkingBudget)
+	body.Stream = stream
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	log.Printf("[DEBUG] Anthropic request: %s", string(jsonData))
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(baseURL, "/")+"/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, req)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+		log.Printf("[ERROR] AnthropicClient: HTTP error %d: %s", resp.StatusCode, string(errBody))
+		return nil, nil, 0, newHTTPError(limiter, resp, errBody)
+	}
+
+	return resp, limiter, reserved, nil
+}
+
+// buildAnthropicRequest translates a chat completion request into a Messages API request
+func buildAnthropicRequest(req *ChatRequest, model string, thinkingBudget int) *anthropicRequest {
+	system, messages := buildAnthropicMessages(req.Messages)
+
+	body := &anthropicRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+	}
+	if system != "" {
+		body.System = []anthropicContentBlock{{Type: "text", Text: system}}
+	}
+	if body.MaxTokens == 0 {
+		body.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	if thinkingBudget > 0 {
+		// 扩展思考要求 max_tokens 大于预算，且不能设置 temperature
+		body.Thinking = &anthropicThinkingCfg{Type: "enabled", BudgetTokens: thinkingBudget}
+		if body.MaxTokens <= thinkingBudget {
+			body.MaxTokens = thinkingBudget + anthropicDefaultMaxTokens
+		}
+	} else if req.Temperature > 0 {
+		temperature := req.Temperature
+		if temperature > 1 {
+			temperature = 1
+		}
+		body.Temperature = &temperature
+	}
+
+	for _, tool := range req.Tools {
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object"}
+		}
+		body.Tools = append(body.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	if len(body.Tools) > 0 {
+		switch req.ToolChoice {
+		case "", "auto":
+			body.ToolChoice = &anthropicToolChoice{Type: "auto"}
+		case "required", "any":
+			body.ToolChoice = &anthropicToolChoice{Type: "any"}
+		case "none":
+			body.ToolChoice = &anthropicToolChoice{Type: "none"}
+		default:
+			body.ToolChoice = &anthropicToolChoice{Type: "tool", Name: req.ToolChoice}
+		}
+		if req.ParallelToolCalls != nil && !*req.ParallelToolCalls && body.ToolChoice.Type != "none" {
+			body.ToolChoice.DisableParallelToolUse = true
+		}
+	}
+
+	if req.CacheControl != nil {
+		addAnthropicCacheBreakpoints(body, req)
+	}
+
+	return body
+}
+
+// addAnthropicCacheBreakpoints marks the cached prefix. The API caches tools, system and
+// messages in that order, so a breakpoint on the system prompt also covers the tools.
+// At most 4 breakpoints are allowed; this uses up to 3.
+func addAnthropicCacheBreakpoints(body *anthropicRequest, req *ChatRequest) {
+	switch {
+	case len(body.System) > 0:
+		body.System[len(body.System)-1].CacheControl = ephemeralCache
+	case req.CacheControl.Tools && len(body.Tools) > 0:
+		body.Tools[len(body.Tools)-1].CacheControl = ephemeralCache
+	}
+
+	// 稳定前缀的末尾，压缩不会改写这部分。前缀单独转换一次，得到它在合并后消息中的结束位置
+	_, prefix := buildAnthropicMessages(req.Messages[:min(req.CacheControl.PrefixMessages, len(req.Messages))])
+	if n := len(prefix); n > 0 && n <= len(body.Messages) {
+		if blocks := len(prefix[n-1].Content); blocks > 0 && blocks <= len(body.Messages[n-1].Content) {
+			body.Messages[n-1].Content[blocks-1].CacheControl = ephemeralCache
+		}
+	}
+
+	// 最新一条消息，下一轮请求可以复用整段对话
+	if n := len(body.Messages); n > 0 {
+		markLastBlock(&body.Messages[n-1])
+	}
+}
+
+func markLastBlock(msg *anthropicMessage) {
+	if n := len(msg.Content); n > 0 {
+		msg.Content[n-1].CacheControl = ephemeralCache
+	}
+}
+
+// buildAnthropicMessages moves system messages into the top-level system prompt and converts
+// tool calls and tool results into content blocks. Consecutive messages of the same role are
+// merged because tool results must share one user turn.
+func buildAnthropicMessages(messages []Message) (string, []anthropicMessage) {
+	var system []string
+	var result []anthropicMessage
+
+	for _, msg := range messages {
+		var role string
+		var blocks []anthropicContentBlock
+
+		switch {
+		case msg.Role == "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		case msg.Role == "tool":
+			role = "user"
+			blocks = append(blocks, anthropicContentBlock{Type: "tool_result", ToolUseID: msg.ToolCallId, Content: msg.Content})
+		case msg.Role == "assistant":
+			role = "assistant"
+			if msg.Reasoning != "" && msg.ThinkingSignature != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "thinking", Thinking: msg.Reasoning, Signature: msg.ThinkingSignature})
+			}
+			// 末尾空白会被 API 拒绝
+			if text := strings.TrimRight(msg.Content, " \t\r\n"); text != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: text})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: anthropicToolInput(tc.Function.Arguments),
+				})
+			}
+		default:
+			role = "user"
+			blocks = append(blocks, anthropicUserBlocks(msg)...)
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(result); n > 0 && result[n-1].Role == role {
+			result[n-1].Content = append(result[n-1].Content, blocks...)
+			continue
+		}
+		result = append(result, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	return strings.Join(system, "\n\n"), result
+}
+
+// anthropicUserBlocks converts the text and images of a user message
+func anthropicUserBlocks(msg Message) []anthropicContentBlock {
+	if len(msg.Parts) == 0 {
+		if msg.Content == "" {
+			return nil
+		}
+		return []anthropicContentBlock{{Type: "text", Text: msg.Content}}
+	}
+
+	var blocks []anthropicContentBlock
+	for _, part := range messageParts(msg) {
+		switch {
+		case part.Type != ContentPartImage:
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+		case part.URL != "":
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: &anthropicImageSource{Type: "url", URL: part.URL}})
+		default:
+			blocks = append(blocks, anthropicContentBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: part.MediaType, Data: part.Data}})
+		}
+	}
+	return blocks
+}
+
+// anthropicToolInput turns tool call arguments into the JSON object expected for tool_use input
+func anthropicToolInput(arguments string) json.RawMessage {
+	arguments = strings.TrimSpace(arguments)
+	if arguments == "" {
+		return json.RawMessage("{}")
+	}
+	if !json.Valid([]byte(arguments)) {
+		log.Printf("[WARN] AnthropicClient: invalid tool call arguments, sending empty input: %s", arguments)
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// anthropicFinishReason maps Anthropic stop reasons to OpenAI finish reasons
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return stopReason
+	}
+}
+
+// toChatResponse converts a Messages API response into the OpenAI-style ChatResponse
+func (r *anthropicResponse) toChatResponse() *ChatResponse {
+	message := Message{Role: "assistant"}
+	var content strings.Builder
+	for _, block := range r.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "thinking":
+			message.Reasoning += block.Thinking
+			message.ThinkingSignature = block.Signature
+		case "tool_use":
+			arguments := "{}"
+			var compact bytes.Buffer
+			if len(block.Input) > 0 && json.Compact(&compact, block.Input) == nil {
+				arguments = compact.String()
+			}
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: Function{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	message.Content = content.String()
+
+	return &ChatResponse{
+		ID:      r.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   r.Model,
+		Choices: []Choice{
+			{
+				Index:        0,
+				Message:      message,
+				FinishReason: anthropicFinishReason(r.StopReason),
+			},
+		},
+		Usage: r.Usage.usage(r.Usage.OutputTokens),
+	}
+}
+
+// anthropicStreamState tracks message metadata across stream events
+type anthropicStreamState struct {
+	id         string
+	model      string
+	created    int64
+	inputUsage anthropicUsage
+	// tool_use block index -> whether any input JSON was received
+	toolInput map[int]bool
+}
+
+func newAnthropicStreamState() *anthropicStreamState {
+	return &anthropicStreamState{
+		created:   time.Now().Unix(),
+		toolInput: make(map[int]bool),
+	}
+}
+
+// translate converts one stream event into zero or more StreamDeltas.
+// Tool calls use the content block index as their stream index.
+func (s *anthropicStreamState) translate(event anthropicStreamEvent) []StreamDelta {
+	switch event.Type {
+	case "message_start":
+		if event.Message == nil {
+			return nil
+		}
+		s.id = event.Message.ID
+		s.model = event.Message.Model
+		s.inputUsage = event.Message.Usage
+		return []StreamDelta{s.delta(Message{Role: "assistant"}, "")}
+
+	case "content_block_start":
+		if event.ContentBlock == nil || event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		index := event.Index
+		s.toolInput[index] = false
+		return []StreamDelta{s.delta(Message{ToolCalls: []ToolCall{{
+			Index:    &index,
+			ID:       event.ContentBlock.ID,
+			Type:     "function",
+			Function: Function{Name: event.ContentBlock.Name},
+		}}}, "")}
+
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			return []StreamDelta{s.delta(Message{Content: event.Delta.Text}, "")}
+		case "thinking_delta":
+			return []StreamDelta{s.delta(Message{Reasoning: event.Delta.Thinking}, "")}
+		case "signature_delta":
+			return []StreamDelta{s.delta(Message{ThinkingSignature: event.Delta.Signature}, "")}
+		case "input_json_delta":
+			if event.Delta.PartialJSON == "" {
+				return nil
+			}
+			index := event.Index
+			s.toolInput[index] = true
+			return []StreamDelta{s.delta(Message{ToolCalls: []ToolCall{{
+				Index:    &index,
+				Function: Function{Arguments: event.Delta.PartialJSON},
+			}}}, "")}
+		}
+
+	case "content_block_stop":
+		// 无参数的工具调用不会收到 input_json_delta
+		received, isTool := s.toolInput[event.Index]
+		if !isTool || received {
+			return nil
+		}
+		index := event.Index
+		s.toolInput[index] = true
+		return []StreamDelta{s.delta(Message{ToolCalls: []ToolCall{{
+			Index:    &index,
+			Function: Function{Arguments: "{}"},
+		}}}, "")}
+
+	case "message_delta":
+		delta := s.delta(Message{}, anthropicFinishReason(event.Delta.StopReason))
+		if event.Usage != nil {
+			delta.Usage = s.inputUsage.usage(event.Usage.OutputTokens)
+		}
+		return []StreamDelta{delta}
+	}
+
+	return nil
+}
+
+func (s *anthropicStreamState) delta(message Message, finishReason string) StreamDelta {
+	return StreamDelta{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []Choice{{Index: 0, Delta: message, FinishReason: finishReason}},
+	}
+}
+
+// SupportsStreaming returns true if the client supports streaming
+func (c *AnthropicClient) SupportsStreaming() bool {
+	return c.streamEnabled
+}
+
+// SetStreamingEnabled enables or disables streaming
+func (c *AnthropicClient) SetStreamingEnabled(enabled bool) {
+	c.streamEnabled = enabled
+}
+
+// SetHTTPClient sets a custom HTTP client
+func (c *AnthropicClient) SetHTTPClient(client *http.Client) {
+	if client != nil {
+		c.httpClient = client
+	}
+}
+
+// GetHTTPClient returns the current HTTP client
+func (c *AnthropicClient) GetHTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Close closes the client and cleans up resources
+func (c *AnthropicClient) Close() error {
+	return nil
+}
@@ -0,0 +1,244 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildAnthropicMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "List files"},
+		{Role: "assistant", Content: "Listing ", Reasoning: "need ls", ThinkingSignature: "sig", ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: Function{Name: "file_list", Arguments: `{"path":"."}`}},
+			{ID: "call_2", Type: "function", Function: Function{Name: "todo_read"}},
+		}},
+		{Role: "tool", Content: "a.go", ToolCallId: "call_1", Name: "file_list"},
+		{Role: "tool", Content: "no todos", ToolCallId: "call_2", Name: "todo_read"},
+		{Role: "user", Content: "budget warning"},
+	}
+
+	system, result := buildAnthropicMessages(messages)
+	if system != "You are helpful" {
+		t.Errorf("expected system prompt, got %q", system)
+	}
+	if len(result) != 3 {
+		t.Fatalf("expected user/assistant/user turns, got %d: %+v", len(result), result)
+	}
+
+	assistant := result[1]
+	if len(assistant.Content) != 4 || assistant.Content[0].Type != "thinking" || assistant.Content[1].Text != "Listing" {
+		t.Errorf("unexpected assistant blocks: %+v", assistant.Content)
+	}
+	if string(assistant.Content[2].Input) != `{"path":"."}` || string(assistant.Content[3].Input) != "{}" {
+		t.Errorf("unexpected tool_use input: %s / %s", assistant.Content[2].Input, assistant.Content[3].Input)
+	}
+
+	// 两个工具结果和随后的用户消息合并为同一个 user 轮次
+	results := result[2]
+	if results.Role != "user" || len(results.Content) != 3 {
+		t.Fatalf("expected merged user turn, got %+v", results)
+	}
+	if results.Content[0].Type != "tool_result" || results.Content[0].ToolUseID != "call_1" || results.Content[2].Type != "text" {
+		t.Errorf("unexpected tool_result blocks: %+v", results.Content)
+	}
+}
+
+func TestAnthropicClient_Chat(t *testing.T) {
+	var received anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") != anthropicAPIVersion {
+			t.Errorf("missing Anthropic headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{
+			"id": "msg_1", "model": "claude-test", "role": "assistant",
+			"content": [
+				{"type": "thinking", "thinking": "check the dir", "signature": "sig_1"},
+				{"type": "text", "text": "Let me look."},
+				{"type": "tool_use", "id": "toolu_1", "name": "file_list", "input": {"path": "."}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 7}
+		}`)
+	}))
+	defer server.Close()
+
+	client, err := NewAnthropicClient(&Config{BaseURL: server.URL, APIKey: "test-key", Model: "claude-test", ThinkingBudget: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Chat(context.Background(), &ChatRequest{
+		Messages:    []Message{{Role: "system", Content: "sys"}, {Role: "user", Content: "hi"}},
+		Temperature: 0.7,
+		MaxTokens:   1000,
+		Tools:       []Tool{{Type: "function", Function: Function{Name: "file_list", Parameters: map[string]interface{}{"type": "object"}}}},
+		ToolChoice:  "auto",
+	}, "")
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if len(received.System) != 1 || received.System[0].Text != "sys" || received.Model != "claude-test" || len(received.Tools) != 1 {
+		t.Errorf("unexpected request: %+v", received)
+	}
+	if received.Thinking == nil || received.Thinking.BudgetTokens != 2048 || received.Temperature != nil {
+		t.Errorf("expected thinking without temperature, got %+v", received)
+	}
+	if received.MaxTokens <= 2048 {
+		t.Errorf("expected max_tokens above thinking budget, got %d", received.MaxTokens)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "Let me look." {
+		t.Errorf("unexpected choice: %+v", choice)
+	}
+	if choice.Message.Reasoning != "check the dir" || choice.Message.ThinkingSignature != "sig_1" {
+		t.Errorf("expected thinking in Reasoning, got %+v", choice.Message)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"path":"."}` {
+		t.Errorf("unexpected tool calls: %+v", choice.Message.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 15 || resp.Usage.TotalTokens != 22 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicClient_ChatStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_2","model":"claude-test","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"plan"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig_2"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"lo"}}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_2","name":"grep","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"pattern\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"TODO\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"content_block_start","index":3,"content_block":{"type":"tool_use","id":"toolu_3","name":"todo_read","input":{}}}`,
+		`{"type":"content_block_stop","index":3}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("expected stream request, got %+v (%v)", req, err)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(event), &typed)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewAnthropicClient(&Config{BaseURL: server.URL, APIKey: "test-key", Model: "claude-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deltas, err := client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}, "")
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	accumulator := NewStreamAccumulator()
+	for delta := range deltas {
+		accumulator.Add(delta)
+	}
+	resp := accumulator.Response()
+
+	message := resp.Choices[0].Message
+	if message.Content != "Hello" || message.Reasoning != "plan" || message.ThinkingSignature != "sig_2" {
+		t.Errorf("unexpected streamed message: %+v", message)
+	}
+	if len(message.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", message.ToolCalls)
+	}
+	if message.ToolCalls[0].ID != "toolu_2" || message.ToolCalls[0].Function.Arguments != `{"pattern":"TODO"}` {
+		t.Errorf("unexpected first tool call: %+v", message.ToolCalls[0])
+	}
+	if message.ToolCalls[1].Function.Arguments != "{}" {
+		t.Errorf("expected empty object for argument-less tool, got %q", message.ToolCalls[1].Function.Arguments)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" || resp.ID != "msg_2" {
+		t.Errorf("unexpected response metadata: %+v", resp)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 20 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicClient_ChatStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_3\",\"model\":\"claude-test\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewAnthropicClient(&Config{BaseURL: server.URL, APIKey: "test-key", Model: "claude-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas, err := client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streamErr error
+	for delta := range deltas {
+		if delta.Err != nil {
+			streamErr = delta.Err
+		}
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "overloaded_error") {
+		t.Errorf("expected the overloaded error to end the stream, got %v", streamErr)
+	}
+}
+
+func TestProviderForConfig(t *testing.T) {
+	if p := ProviderForConfig(&Config{BaseURL: "https://api.anthropic.com/v1"}); p.Name() != ProviderAnthropic {
+		t.Errorf("expected anthropic provider, got %s", p.Name())
+	}
+	if p := ProviderForConfig(&Config{BaseURL: "https://openrouter.ai/api/v1"}); p.Name() != ProviderOpenAI {
+		t.Errorf("expected openai provider, got %s", p.Name())
+	}
+
+	SetConfigProvider(func() (*Config, error) {
+		return &Config{BaseURL: "https://api.anthropic.com/v1", APIKey: "test-key", Model: "claude-test"}, nil
+	})
+	defer SetConfigProvider(nil)
+	ClearInstanceCache()
+	defer ClearInstanceCache()
+
+	client, err := GetLLMInstance(BasicModel)
+	if err != nil {
+		t.Fatalf("GetLLMInstance failed: %v", err)
+	}
+	if _, ok := client.(*AnthropicClient); !ok {
+		t.Errorf("expected AnthropicClient, got %T", client)
+	}
+}
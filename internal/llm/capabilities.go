@@ -0,0 +1,237 @@
+package llm
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// CacheStyle describes how a provider caches prompt prefixes
+type CacheStyle string
+
+const (
+	// CacheStyleNone means the provider has no prompt caching
+	CacheStyleNone CacheStyle = "none"
+	// CacheStylePrefix is automatic prefix caching (OpenAI, DeepSeek, Gemini 2.5)
+	CacheStylePrefix CacheStyle = "prefix"
+	// CacheStyleControl needs explicit cache_control breakpoints (Anthropic)
+	CacheStyleControl CacheStyle = "cache_control"
+	// CacheStyleKimi uses the Kimi context cache API
+	CacheStyleKimi CacheStyle = "kimi"
+)
+
+// ModelCapabilities describes the limits and features of a model
+type ModelCapabilities struct {
+	// ContextWindow is the total number of tokens the model accepts, prompt and output included
+	ContextWindow int `json:"context_window"`
+	// MaxOutput is the largest max_tokens the model accepts
+	MaxOutput     int  `json:"max_output"`
+	Tools         bool `json:"tools"`
+	ParallelTools bool `json:"parallel_tools"`
+	Streaming     bool `json:"streaming"`
+	Vision        bool `json:"vision"`
+	// ReasoningField is the response field carrying reasoning text, e.g. reasoning_content
+	ReasoningField string `json:"reasoning_field,omitempty"`
+	// SendReasoning is true when reasoning of earlier turns must be sent back in ReasoningField;
+	// otherwise it is dropped from requests (DeepSeek rejects it)
+	SendReasoning bool       `json:"send_reasoning,omitempty"`
+	CacheStyle    CacheStyle `json:"cache_style,omitempty"`
+	// StructuredOutput is the strongest response_format the model accepts
+	StructuredOutput StructuredOutput `json:"structured_output,omitempty"`
+}
+
+// StructuredOutput - 模型约束 JSON 输出的方式
+type StructuredOutput string
+
+const (
+	StructuredOutputNone       StructuredOutput = ""            // 只能靠提示词约束
+	StructuredOutputJSONObject StructuredOutput = "json_object" // JSON 模式，保证输出合法 JSON 对象
+	StructuredOutputJSONSchema StructuredOutput = "json_schema" // 按给定 schema 约束输出
+)
+
+// fallbackCapabilities is used for models missing from the registry
+var fallbackCapabilities = ModelCapabilities{
+	ContextWindow: 128000,
+	MaxOutput:     4096,
+	Tools:         true,
+	ParallelTools: true,
+	Streaming:     true,
+	CacheStyle:    CacheStyleNone,
+}
+
+// defaultModelCapabilities is keyed by provider/model and matched like the price table
+var defaultModelCapabilities = map[string]ModelCapabilities{
+	"openai/gpt-4o":      {ContextWindow: 128000, MaxOutput: 16384, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONSchema},
+	"openai/gpt-4o-mini": {ContextWindow: 128000, MaxOutput: 16384, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONSchema},
+	"openai/gpt-4.1":     {ContextWindow: 1047576, MaxOutput: 32768, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONSchema},
+	"openai/o3":          {ContextWindow: 200000, MaxOutput: 100000, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONSchema},
+	"openai/o3-mini":     {ContextWindow: 200000, MaxOutput: 100000, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONSchema},
+	"openai/o4-mini":     {ContextWindow: 200000, MaxOutput: 100000, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONSchema},
+
+	"anthropic/claude-3-haiku":    {ContextWindow: 200000, MaxOutput: 4096, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStyleControl},
+	"anthropic/claude-3-opus":     {ContextWindow: 200000, MaxOutput: 4096, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStyleControl},
+	"anthropic/claude-3-5-haiku":  {ContextWindow: 200000, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStyleControl},
+	"anthropic/claude-3-5-sonnet": {ContextWindow: 200000, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStyleControl},
+	"anthropic/claude-3-7-sonnet": {ContextWindow: 200000, MaxOutput: 64000, Tools: true, ParallelTools: true, Streaming: true, Vision: true, ReasoningField: "thinking", SendReasoning: true, CacheStyle: CacheStyleControl},
+	"anthropic/claude-sonnet-4":   {ContextWindow: 200000, MaxOutput: 64000, Tools: true, ParallelTools: true, Streaming: true, Vision: true, ReasoningField: "thinking", SendReasoning: true, CacheStyle: CacheStyleControl},
+	"anthropic/claude-opus-4":     {ContextWindow: 200000, MaxOutput: 32000, Tools: true, ParallelTools: true, Streaming: true, Vision: true, ReasoningField: "thinking", SendReasoning: true, CacheStyle: CacheStyleControl},
+
+	"google/gemini-1.0-pro":   {ContextWindow: 32760, MaxOutput: 8192, Tools: true, Streaming: true, CacheStyle: CacheStyleNone},
+	"google/gemini-1.5-flash": {ContextWindow: 1048576, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStyleNone, StructuredOutput: StructuredOutputJSONObject},
+	"google/gemini-1.5-pro":   {ContextWindow: 2097152, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, Vision: true, CacheStyle: CacheStyleNone, StructuredOutput: StructuredOutputJSONObject},
+	"google/gemini-2.5-flash": {ContextWindow: 1048576, MaxOutput: 65536, Tools: true, ParallelTools: true, Streaming: true, Vision: true, ReasoningField: "thought", CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONObject},
+	"google/gemini-2.5-pro":   {ContextWindow: 1048576, MaxOutput: 65536, Tools: true, ParallelTools: true, Streaming: true, Vision: true, ReasoningField: "thought", CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONObject},
+
+	"deepseek/deepseek-chat":     {ContextWindow: 64000, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONObject},
+	"deepseek/deepseek-v3":       {ContextWindow: 64000, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONObject},
+	"deepseek/deepseek-coder":    {ContextWindow: 64000, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStylePrefix, StructuredOutput: StructuredOutputJSONObject},
+	"deepseek/deepseek-reasoner": {ContextWindow: 64000, MaxOutput: 32768, Streaming: true, ReasoningField: "reasoning_content", CacheStyle: CacheStylePrefix},
+	"deepseek/deepseek-r1":       {ContextWindow: 64000, MaxOutput: 32768, Streaming: true, ReasoningField: "reasoning_content", CacheStyle: CacheStylePrefix},
+
+	"moonshotai/kimi-k2-thinking": {ContextWindow: 262144, MaxOutput: 32768, Tools: true, ParallelTools: true, Streaming: true, ReasoningField: "reasoning_content", SendReasoning: true, CacheStyle: CacheStyleKimi},
+	"moonshotai/kimi-k2":          {ContextWindow: 131072, MaxOutput: 16384, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStyleKimi, StructuredOutput: StructuredOutputJSONObject},
+	"moonshotai/moonshot-v1-8k":   {ContextWindow: 8192, MaxOutput: 4096, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStyleKimi, StructuredOutput: StructuredOutputJSONObject},
+	"moonshotai/moonshot-v1-32k":  {ContextWindow: 32768, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStyleKimi, StructuredOutput: StructuredOutputJSONObject},
+	"moonshotai/moonshot-v1-128k": {ContextWindow: 131072, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStyleKimi, StructuredOutput: StructuredOutputJSONObject},
+	"moonshotai/moonshot-v1-auto": {ContextWindow: 131072, MaxOutput: 8192, Tools: true, ParallelTools: true, Streaming: true, CacheStyle: CacheStyleKimi, StructuredOutput: StructuredOutputJSONObject},
+}
+
+// CapabilityRegistry looks up model capabilities, with user entries taking precedence over the defaults
+type CapabilityRegistry struct {
+	mu        sync.RWMutex
+	overrides map[string]ModelCapabilities
+}
+
+// NewCapabilityRegistry creates a registry with the built-in model table
+func NewCapabilityRegistry() *CapabilityRegistry {
+	return &CapabilityRegistry{overrides: make(map[string]ModelCapabilities)}
+}
+
+// SetOverrides replaces the user entries, keyed by provider/model or model.
+// An entry replaces the built-in one as a whole.
+func (r *CapabilityRegistry) SetOverrides(overrides map[string]ModelCapabilities) {
+	normalized := make(map[string]ModelCapabilities, len(overrides))
+	for model, caps := range overrides {
+		normalized[strings.ToLower(model)] = caps
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overrides = normalized
+}
+
+// Lookup returns the capabilities of model and whether it is known
+func (r *CapabilityRegistry) Lookup(model string) (ModelCapabilities, bool) {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if name == "" {
+		return fallbackCapabilities, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if caps, ok := r.overrides[name]; ok {
+		return caps, true
+	}
+	// OpenRouter 的 :free / :beta 等变体与原模型能力相同
+	if i := strings.Index(name, ":"); i > 0 {
+		name = name[:i]
+	}
+	if caps, ok := matchModel(r.overrides, name); ok {
+		return caps, true
+	}
+	if caps, ok := matchModel(defaultModelCapabilities, name); ok {
+		return caps, true
+	}
+	return fallbackCapabilities, false
+}
+
+var defaultCapabilities = NewCapabilityRegistry()
+
+// ConfigureCapabilities sets the user model entries used by LookupCapabilities
+func ConfigureCapabilities(overrides map[string]ModelCapabilities) {
+	defaultCapabilities.SetOverrides(overrides)
+}
+
+// LookupCapabilities returns the capabilities of model, or conservative defaults for unknown models
+func LookupCapabilities(model string) ModelCapabilities {
+	caps, ok := defaultCapabilities.Lookup(model)
+	if !ok && model != "" {
+		log.Printf("[DEBUG] Capabilities: unknown model %q, using defaults", model)
+	}
+	return caps
+}
+
+// ResolveMaxTokens returns the max_tokens to send to model: the model's max output when
+// requested is 0, and never more than the model accepts
+func ResolveMaxTokens(model string, requested int) int {
+	maxOutput := LookupCapabilities(model).MaxOutput
+	if requested <= 0 || maxOutput <= 0 {
+		return max(requested, maxOutput)
+	}
+	if requested > maxOutput {
+		log.Printf("[DEBUG] Capabilities: clamping max_tokens %d to %d for %s", requested, maxOutput, model)
+		return maxOutput
+	}
+	return requested
+}
+
+// MinOutputTokens is the least room for the reply a request is sent with
+const MinOutputTokens = 1024
+
+// OutputReserve returns the part of the context window kept free for the reply when
+// deciding whether the history must be compressed
+func (c ModelCapabilities) OutputReserve() int {
+	return min(c.MaxOutput, c.ContextWindow/4)
+}
+
+// FitMaxTokens lowers maxTokens so that a prompt of promptTokens and the reply fit the context
+// window of model. ok is false when less than MinOutputTokens would be left for the reply.
+func FitMaxTokens(model string, promptTokens, maxTokens int) (int, bool) {
+	window := LookupCapabilities(model).ContextWindow
+	available := window - promptTokens
+	if available < MinOutputTokens {
+		return maxTokens, false
+	}
+	if maxTokens > available {
+		log.Printf("[DEBUG] Capabilities: lowering max_tokens %d to %d to fit %d prompt tokens in %s", maxTokens, available, promptTokens, model)
+		return available, true
+	}
+	return maxTokens, true
+}
+
+// applyCapabilities adapts req to what model supports before it is sent
+func applyCapabilities(req *ChatRequest, model string) ModelCapabilities {
+	caps := LookupCapabilities(model)
+	req.MaxTokens = ResolveMaxTokens(model, req.MaxTokens)
+
+	if len(req.Tools) > 0 && !caps.Tools {
+		log.Printf("[WARN] Capabilities: %s does not support tool calling, dropping %d tools", model, len(req.Tools))
+		req.Tools = nil
+		req.ToolChoice = ""
+	}
+	if len(req.Tools) > 0 && !caps.ParallelTools && req.ParallelToolCalls == nil {
+		parallel := false
+		req.ParallelToolCalls = &parallel
+	}
+	if !caps.Vision {
+		req.Messages = visionMessages(req.Messages, model)
+	}
+	if req.ResponseFormat != nil {
+		req.ResponseFormat = adaptResponseFormat(req.ResponseFormat, caps.StructuredOutput, model)
+	}
+	return caps
+}
+
+// adaptResponseFormat downgrades format to what the model accepts: a schema becomes plain
+// JSON mode, and nothing is sent for models without JSON output
+func adaptResponseFormat(format *ResponseFormat, supported StructuredOutput, model string) *ResponseFormat {
+	switch {
+	case supported == StructuredOutputNone:
+		log.Printf("[DEBUG] Capabilities: %s does not support response_format, dropping it", model)
+		return nil
+	case format.Type == StructuredOutputJSONSchema && supported != StructuredOutputJSONSchema:
+		return &ResponseFormat{Type: StructuredOutputJSONObject}
+	}
+	return format
+}
@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCapabilityRegistry_Lookup(t *testing.T) {
+	registry := NewCapabilityRegistry()
+
+	tests := []struct {
+		model string
+		want  ModelCapabilities
+		known bool
+	}{
+		{"claude-3-5-sonnet-20241022", defaultModelCapabilities["anthropic/claude-3-5-sonnet"], true},
+		{"anthropic/claude-3-haiku:beta", defaultModelCapabilities["anthropic/claude-3-haiku"], true},
+		{"deepseek/deepseek-chat-v3-0324:free", defaultModelCapabilities["deepseek/deepseek-chat"], true},
+		{"moonshot-v1-8k", defaultModelCapabilities["moonshotai/moonshot-v1-8k"], true},
+		{"o3-mini", defaultModelCapabilities["openai/o3-mini"], true},
+		{"ep-20241022105817-8vxvs", fallbackCapabilities, false},
+		{"", fallbackCapabilities, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got, known := registry.Lookup(tt.model)
+			if got != tt.want || known != tt.known {
+				t.Errorf("Lookup(%q) = %+v, %v; want %+v, %v", tt.model, got, known, tt.want, tt.known)
+			}
+		})
+	}
+}
+
+func TestCapabilityRegistry_Overrides(t *testing.T) {
+	var overrides map[string]ModelCapabilities
+	config := `{"ep-20241022105817-8vxvs": {"context_window": 4096, "max_output": 1024, "tools": true, "streaming": true}}`
+	if err := json.Unmarshal([]byte(config), &overrides); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewCapabilityRegistry()
+	registry.SetOverrides(overrides)
+
+	caps, known := registry.Lookup("EP-20241022105817-8vxvs")
+	if !known || caps.ContextWindow != 4096 || caps.MaxOutput != 1024 || !caps.Tools || caps.ParallelTools {
+		t.Errorf("override not applied: %+v, %v", caps, known)
+	}
+}
+
+func TestResolveMaxTokens(t *testing.T) {
+	tests := []struct {
+		model     string
+		requested int
+		want      int
+	}{
+		{"moonshot-v1-8k", 0, 4096},
+		{"moonshot-v1-8k", 8000, 4096},
+		{"moonshot-v1-8k", 1000, 1000},
+		{"claude-sonnet-4-20250514", 0, 64000},
+		{"unknown-model", 0, fallbackCapabilities.MaxOutput},
+	}
+	for _, tt := range tests {
+		if got := ResolveMaxTokens(tt.model, tt.requested); got != tt.want {
+			t.Errorf("ResolveMaxTokens(%q, %d) = %d, want %d", tt.model, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestApplyCapabilities(t *testing.T) {
+	tools := []Tool{{Type: "function", Function: Function{Name: "file_read"}}}
+
+	req := &ChatRequest{Tools: tools, ToolChoice: "auto"}
+	applyCapabilities(req, "deepseek-reasoner")
+	if req.Tools != nil || req.ToolChoice != "" {
+		t.Errorf("tools should be dropped for a model without tool calling: %+v", req)
+	}
+	if req.MaxTokens != 32768 {
+		t.Errorf("MaxTokens = %d, want 32768", req.MaxTokens)
+	}
+
+	ConfigureCapabilities(map[string]ModelCapabilities{
+		"serial-model": {ContextWindow: 32000, MaxOutput: 2048, Tools: true, Streaming: true},
+	})
+	defer ConfigureCapabilities(nil)
+
+	req = &ChatRequest{Tools: tools, ToolChoice: "auto"}
+	applyCapabilities(req, "serial-model")
+	data, _ := json.Marshal(req)
+	if !strings.Contains(string(data), `"parallel_tool_calls":false`) {
+		t.Errorf("parallel tool calls should be disabled: %s", data)
+	}
+
+	body := buildAnthropicRequest(req, "serial-model", 0)
+	if body.ToolChoice == nil || !body.ToolChoice.DisableParallelToolUse {
+		t.Errorf("anthropic tool choice should disable parallel tool use: %+v", body.ToolChoice)
+	}
+}
+
+func TestApplyCapabilities_ResponseFormat(t *testing.T) {
+	schemaFormat := func() *ResponseFormat {
+		return &ResponseFormat{
+			Type:       StructuredOutputJSONSchema,
+			JSONSchema: &JSONSchemaFormat{Name: "answer", Schema: json.RawMessage(`{"type":"object"}`)},
+		}
+	}
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", `"response_format":{"type":"json_schema","json_schema":{"name":"answer","schema":{"type":"object"}}}`},
+		{"deepseek-chat", `"response_format":{"type":"json_object"}`},
+		{"claude-sonnet-4", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			req := &ChatRequest{ResponseFormat: schemaFormat()}
+			applyCapabilities(req, tt.model)
+			data := mustJSON(t, req)
+			if tt.want == "" && strings.Contains(data, "response_format") {
+				t.Errorf("response_format should be dropped: %s", data)
+			}
+			if tt.want != "" && !strings.Contains(data, tt.want) {
+				t.Errorf("request %s does not contain %s", data, tt.want)
+			}
+		})
+	}
+
+	req := &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, ResponseFormat: &ResponseFormat{Type: StructuredOutputJSONObject}}
+	if body := buildGeminiRequest(req, 0); body.GenerationConfig.ResponseMimeType != "application/json" {
+		t.Errorf("gemini should use JSON mode, got %+v", body.GenerationConfig)
+	}
+}
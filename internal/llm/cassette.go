@@ -0,0 +1,414 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CassetteMode selects whether LLM traffic is recorded to or replayed from a cassette
+type CassetteMode string
+
+const (
+	CassetteRecord CassetteMode = "record"
+	CassetteReplay CassetteMode = "replay"
+)
+
+const (
+	// CassetteEnvVar is the environment variable holding the cassette path
+	CassetteEnvVar = "ALEX_LLM_CASSETTE"
+	// CassetteModeEnvVar selects record or replay, defaulting to replay
+	CassetteModeEnvVar = "ALEX_LLM_CASSETTE_MODE"
+
+	cassetteVersion = 1
+)
+
+// ParseCassetteMode parses a mode name; an empty name means replay
+func ParseCassetteMode(mode string) (CassetteMode, error) {
+	switch CassetteMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", CassetteReplay:
+		return CassetteReplay, nil
+	case CassetteRecord:
+		return CassetteRecord, nil
+	default:
+		return "", fmt.Errorf("invalid cassette mode %q (want record or replay)", mode)
+	}
+}
+
+// CassetteInteraction is one recorded request with its response or full stream
+type CassetteInteraction struct {
+	Key      string          `json:"key"`
+	Request  cassetteRequest `json:"request"`
+	Response *ChatResponse   `json:"response,omitempty"`
+	Stream   []StreamDelta   `json:"stream,omitempty"`
+}
+
+type cassetteFile struct {
+	Version      int                    `json:"version"`
+	Interactions []*CassetteInteraction `json:"interactions"`
+}
+
+// cassetteRequest is the normalized form of a ChatRequest that is hashed into the key.
+// Config, model, sampling parameters and system prompts are left out because they
+// carry credentials, timestamps and machine-specific paths.
+type cassetteRequest struct {
+	Messages   []cassetteMessage `json:"messages"`
+	Tools      []string          `json:"tools,omitempty"`
+	ToolChoice string            `json:"tool_choice,omitempty"`
+}
+
+type cassetteMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content,omitempty"`
+	ToolCalls  []Function `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+var timestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`)
+
+// normalizeCassetteRequest reduces req to the parts that identify a conversation turn
+func normalizeCassetteRequest(req *ChatRequest) cassetteRequest {
+	normalized := cassetteRequest{ToolChoice: req.ToolChoice}
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			continue
+		}
+		m := cassetteMessage{
+			Role:       msg.Role,
+			Content:    timestampPattern.ReplaceAllString(strings.TrimSpace(msg.Content), "<timestamp>"),
+			ToolCallID: msg.ToolCallId,
+		}
+		for _, tc := range msg.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, tc.Function)
+		}
+		normalized.Messages = append(normalized.Messages, m)
+	}
+	for _, tool := range req.Tools {
+		normalized.Tools = append(normalized.Tools, tool.Function.Name)
+	}
+	// 工具定义来自 map，顺序不固定
+	sort.Strings(normalized.Tools)
+	return normalized
+}
+
+// cassetteKey hashes the normalized request
+func cassetteKey(normalized cassetteRequest) string {
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Cassette stores recorded LLM interactions in a JSON file
+type Cassette struct {
+	mu           sync.Mutex
+	path         string
+	mode         CassetteMode
+	interactions []*CassetteInteraction
+	// replay cursor per key, so identical requests are served in recording order
+	played map[string]int
+}
+
+// OpenCassette opens a cassette file. Record mode starts an empty cassette that
+// replaces the file; replay mode requires the file to exist.
+func OpenCassette(path string, mode CassetteMode) (*Cassette, error) {
+	cassette := &Cassette{path: path, mode: mode, played: make(map[string]int)}
+	if mode == CassetteRecord {
+		return cassette, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	if file.Version != cassetteVersion {
+		return nil, fmt.Errorf("unsupported cassette version %d in %s", file.Version, path)
+	}
+	cassette.interactions = file.Interactions
+	return cassette, nil
+}
+
+// Mode returns whether the cassette records or replays
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Len returns the number of recorded interactions
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.interactions)
+}
+
+// record appends an interaction and rewrites the cassette file
+func (c *Cassette) record(interaction *CassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	data, err := json.MarshalIndent(cassetteFile{Version: cassetteVersion, Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	}
+	// 先写临时文件再重命名，避免中断时留下损坏的磁带
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmpPath, c.path)
+}
+
+// lookup returns the next recorded interaction for req. Once all recordings of a
+// request are used up the last one is served again.
+func (c *Cassette) lookup(req *ChatRequest) (*CassetteInteraction, error) {
+	normalized := normalizeCassetteRequest(req)
+	key := cassetteKey(normalized)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []*CassetteInteraction
+	for _, interaction := range c.interactions {
+		if interaction.Key == key {
+			matches = append(matches, interaction)
+		}
+	}
+	if len(matches) == 0 {
+		last := ""
+		if n := len(normalized.Messages); n > 0 {
+			last = normalized.Messages[n-1].Content
+			if runes := []rune(last); len(runes) > 80 {
+				last = string(runes[:80]) + "..."
+			}
+		}
+		return nil, fmt.Errorf("llm cassette miss: no recording for request %s (%d messages, last: %q) in %s",
+			key[:12], len(normalized.Messages), last, c.path)
+	}
+
+	index := min(c.played[key], len(matches)-1)
+	c.played[key]++
+	return matches[index], nil
+}
+
+// CassetteClient records or replays the traffic of a wrapped client
+type CassetteClient struct {
+	cassette *Cassette
+	// inner is nil in replay mode, no request leaves the process
+	inner Client
+}
+
+// NewCassetteClient wraps inner with the cassette; inner may be nil in replay mode
+func NewCassetteClient(cassette *Cassette, inner Client) (*CassetteClient, error) {
+	if cassette == nil {
+		return nil, fmt.Errorf("cassette cannot be nil")
+	}
+	if cassette.mode == CassetteRecord && inner == nil {
+		return nil, fmt.Errorf("record mode needs a client to record from")
+	}
+	return &CassetteClient{cassette: cassette, inner: inner}, nil
+}
+
+// Chat records the response or serves it from the cassette
+func (c *CassetteClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	if c.cassette.mode == CassetteReplay {
+		interaction, err := c.cassette.lookup(req)
+		if err != nil {
+			log.Printf("[ERROR] CassetteClient: %v", err)
+			return nil, err
+		}
+		if interaction.Response != nil {
+			return interaction.Response, nil
+		}
+		// 录制时使用的是流式接口
+		accumulator := NewStreamAccumulator()
+		for _, delta := range interaction.Stream {
+			accumulator.Add(delta)
+		}
+		return accumulator.Response(), nil
+	}
+
+	resp, err := c.inner.Chat(ctx, req, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	normalized := normalizeCassetteRequest(req)
+	if err := c.cassette.record(&CassetteInteraction{Key: cassetteKey(normalized), Request: normalized, Response: resp}); err != nil {
+		log.Printf("[WARN] CassetteClient: failed to record interaction: %v", err)
+	}
+	return resp, nil
+}
+
+// ChatStream records the full stream or replays it from the cassette
+func (c *CassetteClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	if c.cassette.mode == CassetteReplay {
+		interaction, err := c.cassette.lookup(req)
+		if err != nil {
+			log.Printf("[ERROR] CassetteClient: %v", err)
+			return nil, err
+		}
+		deltas := interaction.Stream
+		if len(deltas) == 0 && interaction.Response != nil {
+			deltas = []StreamDelta{responseDelta(interaction.Response)}
+		}
+		out := make(chan StreamDelta, len(deltas))
+		for _, delta := range deltas {
+			out <- delta
+		}
+		close(out)
+		return out, nil
+	}
+
+	inner, err := c.inner.ChatStream(ctx, req, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := normalizeCassetteRequest(req)
+	out := make(chan StreamDelta, 100)
+	go func() {
+		defer close(out)
+
+		var recorded []StreamDelta
+		finished, failed := false, false
+		for delta := range inner {
+			if delta.Err != nil {
+				failed = true
+			}
+			recorded = append(recorded, delta)
+			for _, choice := range delta.Choices {
+				if choice.FinishReason != "" {
+					finished = true
+				}
+			}
+			select {
+			case out <- delta:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// 中断的流不录制，回放时才能得到完整响应
+		if !finished || failed || ctx.Err() != nil {
+			return
+		}
+		if err := c.cassette.record(&CassetteInteraction{Key: cassetteKey(normalized), Request: normalized, Stream: recorded}); err != nil {
+			log.Printf("[WARN] CassetteClient: failed to record stream: %v", err)
+		}
+	}()
+	return out, nil
+}
+
+// responseDelta turns a complete response into a single stream delta
+func responseDelta(resp *ChatResponse) StreamDelta {
+	delta := StreamDelta{ID: resp.ID, Object: "chat.completion.chunk", Created: resp.Created, Model: resp.Model, Usage: resp.Usage}
+	for _, choice := range resp.Choices {
+		delta.Choices = append(delta.Choices, Choice{Index: choice.Index, Delta: choice.Message, FinishReason: choice.FinishReason})
+	}
+	return delta
+}
+
+// SupportsStreaming replays either kind of recording as a stream
+func (c *CassetteClient) SupportsStreaming() bool {
+	if c.cassette.mode == CassetteReplay {
+		return true
+	}
+	streamingClient, ok := c.inner.(StreamingClient)
+	return ok && streamingClient.SupportsStreaming()
+}
+
+// SetStreamingEnabled forwards to the recorded client
+func (c *CassetteClient) SetStreamingEnabled(enabled bool) {
+	if streamingClient, ok := c.inner.(StreamingClient); ok {
+		streamingClient.SetStreamingEnabled(enabled)
+	}
+}
+
+// Active forwards to the recorded client; an empty model means it does not report one
+func (c *CassetteClient) Active() (string, bool) {
+	if reporter, ok := c.inner.(ActiveModelReporter); ok {
+		return reporter.Active()
+	}
+	return "", true
+}
+
+// Close closes the recorded client
+func (c *CassetteClient) Close() error {
+	if c.inner == nil {
+		return nil
+	}
+	return c.inner.Close()
+}
+
+var activeCassette struct {
+	sync.RWMutex
+	cassette *Cassette
+}
+
+// EnableCassette routes every client created by GetLLMInstance through the cassette at path
+func EnableCassette(path string, mode CassetteMode) error {
+	cassette, err := OpenCassette(path, mode)
+	if err != nil {
+		return err
+	}
+
+	activeCassette.Lock()
+	activeCassette.cassette = cassette
+	activeCassette.Unlock()
+
+	// 已缓存的客户端没有经过磁带
+	ClearInstanceCache()
+	log.Printf("[DEBUG] LLM cassette enabled: %s (%s, %d interactions)", path, mode, cassette.Len())
+	return nil
+}
+
+// EnableCassetteFromEnv enables the cassette named by ALEX_LLM_CASSETTE, if set
+func EnableCassetteFromEnv() error {
+	path := os.Getenv(CassetteEnvVar)
+	if path == "" {
+		return nil
+	}
+	mode, err := ParseCassetteMode(os.Getenv(CassetteModeEnvVar))
+	if err != nil {
+		return err
+	}
+	return EnableCassette(path, mode)
+}
+
+// DisableCassette stops recording or replaying
+func DisableCassette() {
+	activeCassette.Lock()
+	activeCassette.cassette = nil
+	activeCassette.Unlock()
+	ClearInstanceCache()
+}
+
+func currentCassette() *Cassette {
+	activeCassette.RLock()
+	defer activeCassette.RUnlock()
+	return activeCassette.cassette
+}
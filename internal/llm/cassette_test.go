@@ -0,0 +1,128 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":"r%d","model":"test-model","choices":[{"index":0,"message":{"role":"assistant","content":"answer %d"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`, n, n)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "session.cassette.json")
+	config := &Config{BaseURL: server.URL, APIKey: "key", Model: "test-model"}
+	newRequest := func(systemPrompt string) *ChatRequest {
+		return &ChatRequest{
+			Messages: []Message{
+				{Role: "system", Content: systemPrompt},
+				{Role: "user", Content: "what time is it?"},
+			},
+			Config: config,
+		}
+	}
+
+	recorder, err := OpenCassette(path, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, _ := NewHTTPClient()
+	client, _ := NewCassetteClient(recorder, inner)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Chat(ctx, newRequest("Updated: 2025-01-02T15:04:05Z"), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	player, err := OpenCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.Len() != 2 {
+		t.Fatalf("expected 2 recorded interactions, got %d", player.Len())
+	}
+	replay, _ := NewCassetteClient(player, nil)
+
+	// 系统提示不同也能命中，同一请求按录制顺序回放
+	for i, want := range []string{"answer 1", "answer 2", "answer 2"} {
+		resp, err := replay.Chat(ctx, newRequest("Updated: 2026-10-16T09:00:00Z"), "")
+		if err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+		if got := resp.Choices[0].Message.Content; got != want {
+			t.Errorf("replay %d: got %q, want %q", i, got, want)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected replay not to hit the server, got %d calls", calls)
+	}
+
+	// 录制的非流式响应也能以流的形式回放
+	deltas, err := replay.ChatStream(ctx, newRequest(""), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accumulator := NewStreamAccumulator()
+	for delta := range deltas {
+		accumulator.Add(delta)
+	}
+	if got := accumulator.Response().Choices[0].Message.Content; got != "answer 2" {
+		t.Errorf("stream replay: got %q", got)
+	}
+}
+
+func TestCassette_RecordStreamAndReplayMiss(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"id\":\"s1\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"id\":\"s1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "stream.cassette.json")
+	req := &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "greet me"}},
+		Config:   &Config{BaseURL: server.URL, APIKey: "key", Model: "test-model"},
+	}
+
+	recorder, _ := OpenCassette(path, CassetteRecord)
+	inner, _ := NewHTTPClient()
+	client, _ := NewCassetteClient(recorder, inner)
+	deltas, err := client.ChatStream(context.Background(), req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range deltas {
+	}
+
+	player, err := OpenCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, _ := NewCassetteClient(player, nil)
+
+	resp, err := replay.Chat(context.Background(), req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Choices[0].Message.Content; got != "Hello" {
+		t.Errorf("expected recorded stream to assemble to Hello, got %q", got)
+	}
+
+	missing := &ChatRequest{Messages: []Message{{Role: "user", Content: "something else"}}}
+	if _, err := replay.ChatStream(context.Background(), missing, ""); err == nil || !strings.Contains(err.Error(), "cassette miss") {
+		t.Errorf("expected a cassette miss error, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package llm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContentPartType - 多模态消息片段的类型
+type ContentPartType string
+
+const (
+	ContentPartText  ContentPartType = "text"
+	ContentPartImage ContentPartType = "image"
+)
+
+// maxImageBytes is the largest image file read into a request
+const maxImageBytes = 20 << 20
+
+// ContentPart is one piece of a multimodal message. An image comes from a local file
+// (Path), inline base64 Data with its MediaType, or a URL. Files are read when the
+// request is built, so sessions only store the path.
+type ContentPart struct {
+	Type      ContentPartType `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Path      string          `json:"path,omitempty"`
+	Data      string          `json:"data,omitempty"`
+	MediaType string          `json:"media_type,omitempty"`
+	URL       string          `json:"url,omitempty"`
+}
+
+// TextPart creates a text part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: ContentPartText, Text: text}
+}
+
+// ImageFilePart creates an image part read from path when the request is sent
+func ImageFilePart(path string) ContentPart {
+	return ContentPart{Type: ContentPartImage, Path: path, MediaType: ImageMediaType(path)}
+}
+
+// ImageDataPart creates an image part from base64 data
+func ImageDataPart(mediaType, data string) ContentPart {
+	return ContentPart{Type: ContentPartImage, MediaType: mediaType, Data: data}
+}
+
+// ImageURLPart creates an image part the provider downloads itself
+func ImageURLPart(url string) ContentPart {
+	return ContentPart{Type: ContentPartImage, URL: url}
+}
+
+// imageMediaTypes are the image formats accepted by OpenAI, Anthropic and Gemini
+var imageMediaTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// ImageMediaType returns the media type of an image file by extension, or "" if it is not an image
+func ImageMediaType(path string) string {
+	return imageMediaTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+// IsImageFile reports whether path has a supported image extension
+func IsImageFile(path string) bool {
+	return ImageMediaType(path) != ""
+}
+
+// describe returns a short name of the image for placeholders and logs
+func (p ContentPart) describe() string {
+	switch {
+	case p.Path != "":
+		return filepath.Base(p.Path)
+	case p.URL != "":
+		return p.URL
+	}
+	return p.MediaType + " image"
+}
+
+// resolveImage returns the part with Data and MediaType filled in from the file, or the URL
+// part unchanged
+func resolveImage(p ContentPart) (ContentPart, error) {
+	if p.Data != "" || p.URL != "" || p.Path == "" {
+		if p.Data != "" && p.MediaType == "" {
+			p.MediaType = "image/png"
+		}
+		return p, nil
+	}
+
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return p, fmt.Errorf("failed to read image: %w", err)
+	}
+	if info.Size() > maxImageBytes {
+		return p, fmt.Errorf("image %s is too large (%d bytes, max %d)", p.Path, info.Size(), maxImageBytes)
+	}
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return p, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	mediaType := p.MediaType
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(filepath.Ext(p.Path))
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = http.DetectContentType(data)
+	}
+	p.MediaType = mediaType
+	p.Data = base64.StdEncoding.EncodeToString(data)
+	return p, nil
+}
+
+// messageParts returns the parts of msg to send: its Content as text followed by Parts.
+// Images that cannot be read become text placeholders.
+func messageParts(msg Message) []ContentPart {
+	parts := make([]ContentPart, 0, len(msg.Parts)+1)
+	if msg.Content != "" {
+		parts = append(parts, TextPart(msg.Content))
+	}
+	for _, part := range msg.Parts {
+		if part.Type != ContentPartImage {
+			parts = append(parts, part)
+			continue
+		}
+		resolved, err := resolveImage(part)
+		if err != nil {
+			log.Printf("[WARN] Content: %v", err)
+			parts = append(parts, TextPart(fmt.Sprintf("[image %s could not be loaded: %v]", part.describe(), err)))
+			continue
+		}
+		parts = append(parts, resolved)
+	}
+	return parts
+}
+
+// openAIContentPart is a part of the OpenAI chat completions content array
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+func openAIContentParts(msg Message) []openAIContentPart {
+	parts := messageParts(msg)
+	result := make([]openAIContentPart, 0, len(parts))
+	for _, part := range parts {
+		switch {
+		case part.Type != ContentPartImage:
+			result = append(result, openAIContentPart{Type: "text", Text: part.Text})
+		case part.URL != "":
+			result = append(result, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: part.URL}})
+		default:
+			url := "data:" + part.MediaType + ";base64," + part.Data
+			result = append(result, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: url}})
+		}
+	}
+	return result
+}
+
+// MarshalJSON sends messages with Parts as an OpenAI content array
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []openAIContentPart `json:"content"`
+	}{message(m), openAIContentParts(m)})
+}
+
+// decodeOpenAIContent reads a content array back into text and image parts
+func decodeOpenAIContent(data json.RawMessage) (string, []ContentPart, error) {
+	var parts []openAIContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return "", nil, err
+	}
+
+	var text []string
+	var result []ContentPart
+	for _, part := range parts {
+		if part.Type == "text" && len(result) == 0 {
+			text = append(text, part.Text)
+			continue
+		}
+		if part.Type == "text" {
+			result = append(result, TextPart(part.Text))
+			continue
+		}
+		if part.ImageURL == nil {
+			continue
+		}
+		if mediaType, payload, ok := parseDataURL(part.ImageURL.URL); ok {
+			result = append(result, ImageDataPart(mediaType, payload))
+		} else {
+			result = append(result, ImageURLPart(part.ImageURL.URL))
+		}
+	}
+	return strings.Join(text, "\n"), result, nil
+}
+
+// parseDataURL splits data:<media type>;base64,<data>
+func parseDataURL(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(header, ";base64"), payload, true
+}
+
+// visionMessages replaces images with text placeholders for models without vision. messages
+// is not modified.
+func visionMessages(messages []Message, model string) []Message {
+	var result []Message
+	for i, msg := range messages {
+		if !hasImages(msg) {
+			continue
+		}
+		if result == nil {
+			result = append([]Message(nil), messages...)
+		}
+
+		out := &result[i]
+		out.Parts = nil
+		var omitted []string
+		for _, part := range msg.Parts {
+			if part.Type == ContentPartImage {
+				omitted = append(omitted, part.describe())
+				continue
+			}
+			out.Parts = append(out.Parts, part)
+		}
+		placeholder := fmt.Sprintf("[%d image(s) omitted: %s does not support images (%s)]", len(omitted), model, strings.Join(omitted, ", "))
+		if out.Content != "" {
+			placeholder = out.Content + "\n" + placeholder
+		}
+		out.Content = placeholder
+	}
+
+	if result == nil {
+		return messages
+	}
+	log.Printf("[DEBUG] Content: %s does not support images, replaced them with placeholders", model)
+	return result
+}
+
+func hasImages(msg Message) bool {
+	for _, part := range msg.Parts {
+		if part.Type == ContentPartImage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngBytes is enough of a PNG for media type detection
+var pngBytes = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func writeTestImage(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "screenshot.png")
+	if err := os.WriteFile(path, pngBytes, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMessage_MarshalContentParts(t *testing.T) {
+	msg := Message{
+		Role:    "user",
+		Content: "what is wrong here?",
+		Parts:   []ContentPart{ImageFilePart(writeTestImage(t)), ImageURLPart("https://example.com/diagram.png")},
+	}
+
+	data := mustJSON(t, msg)
+	for _, want := range []string{
+		`"content":[{"type":"text","text":"what is wrong here?"}`,
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo`,
+		`{"type":"image_url","image_url":{"url":"https://example.com/diagram.png"}}`,
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("%s does not contain %s", data, want)
+		}
+	}
+
+	// 反序列化得到同样的文本和图片
+	var decoded Message
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Content != msg.Content || len(decoded.Parts) != 2 || decoded.Parts[0].MediaType != "image/png" || decoded.Parts[1].URL == "" {
+		t.Errorf("unexpected decoded message %+v", decoded)
+	}
+
+	if plain := mustJSON(t, Message{Role: "user", Content: "hi"}); plain != `{"role":"user","content":"hi"}` {
+		t.Errorf("text messages keep the string content, got %s", plain)
+	}
+}
+
+func TestMessage_MissingImage(t *testing.T) {
+	msg := Message{Role: "user", Parts: []ContentPart{ImageFilePart(filepath.Join(t.TempDir(), "gone.png"))}}
+	if data := mustJSON(t, msg); !strings.Contains(data, "[image gone.png could not be loaded") {
+		t.Errorf("missing images should become a placeholder: %s", data)
+	}
+}
+
+func TestProviderImageFormats(t *testing.T) {
+	messages := []Message{{
+		Role:    "user",
+		Content: "compare",
+		Parts:   []ContentPart{ImageDataPart("image/jpeg", "abcd"), ImageURLPart("https://example.com/a.png")},
+	}}
+
+	_, anthropic := buildAnthropicMessages(messages)
+	blocks := anthropic[0].Content
+	if len(blocks) != 3 || blocks[1].Source.Type != "base64" || blocks[1].Source.MediaType != "image/jpeg" || blocks[2].Source.URL != "https://example.com/a.png" {
+		t.Errorf("unexpected anthropic blocks %s", mustJSON(t, blocks))
+	}
+
+	_, gemini := buildGeminiContents(messages)
+	parts := gemini[0].Parts
+	if len(parts) != 3 || parts[1].InlineData.Data != "abcd" || parts[2].FileData.MimeType != "image/png" {
+		t.Errorf("unexpected gemini parts %s", mustJSON(t, parts))
+	}
+}
+
+func TestApplyCapabilities_Vision(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "look", Parts: []ContentPart{ImageURLPart("https://example.com/a.png")}}}
+
+	req := &ChatRequest{Messages: messages}
+	applyCapabilities(req, "deepseek-chat")
+	if len(req.Messages[0].Parts) != 0 || !strings.Contains(req.Messages[0].Content, "1 image(s) omitted") {
+		t.Errorf("images should be replaced for models without vision: %+v", req.Messages[0])
+	}
+	if len(messages[0].Parts) != 1 {
+		t.Error("applyCapabilities must not modify the caller's messages")
+	}
+
+	req = &ChatRequest{Messages: messages}
+	applyCapabilities(req, "gpt-4o")
+	if len(req.Messages[0].Parts) != 1 {
+		t.Error("vision models should receive the image")
+	}
+}
@@ -0,0 +1,116 @@
+package llm
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HTTPStatusCode extracts the status code from an "HTTP error XXX: ..." error, or returns 0
+func HTTPStatusCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	errStr := err.Error()
+	if !strings.Contains(errStr, "HTTP error ") {
+		return 0
+	}
+
+	// Look for pattern "HTTP error XXX:"
+	parts := strings.Split(errStr, "HTTP error ")
+	statusPart := strings.Split(parts[1], ":")
+	statusCode, parseErr := strconv.Atoi(statusPart[0])
+	if parseErr != nil {
+		return 0
+	}
+	return statusCode
+}
+
+// IsNetworkError checks if an error is network-related and should not be retried
+func IsNetworkError(err error) bool {
+	switch HTTPStatusCode(err) {
+	case 400, 401, 403, 404, 405, 406, 408, 409, 410, 411, 412, 413, 414, 415, 416, 417, 418, 421, 422, 423, 424, 425, 426, 428, 429, 431, 451:
+		// Client errors (4xx) - usually indicate request issues, not transient network problems
+		return true
+	case 500: // Server error - request format issue
+		return true
+		// Note: 502, 503, 504 are temporary server issues and should be retried
+	}
+
+	// Check for common network error patterns
+	networkErrorPatterns := []string{
+		"connection refused",
+		"connection reset",
+		"connection timeout",
+		"dial timeout",
+		"read timeout",
+		"write timeout",
+		"network is unreachable",
+		"no route to host",
+		"host is down",
+		"dns lookup failed",
+		"tls handshake timeout",
+		"certificate verify failed",
+		"ssl handshake failed",
+	}
+
+	lowerErr := strings.ToLower(err.Error())
+	for _, pattern := range networkErrorPatterns {
+		if strings.Contains(lowerErr, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRetriableError checks if an error should be retried (opposite of network error)
+func IsRetriableError(err error) bool {
+	errStr := err.Error()
+
+	// Timeout errors from HTTP client should be retried
+	if strings.Contains(errStr, "timeout") || strings.Contains(errStr, "deadline exceeded") {
+		return true
+	}
+
+	// Temporary server issues that should be retried
+	switch HTTPStatusCode(err) {
+	case 502, 503, 504, 429: // Bad Gateway, Service Unavailable, Gateway Timeout, Rate Limited
+		return true
+	}
+
+	// Temporary network issues that should be retried
+	retriablePatterns := []string{
+		"temporary failure",
+		"server temporarily unavailable",
+		"connection reset by peer",
+		"broken pipe",
+		"EOF",
+	}
+
+	lowerErr := strings.ToLower(errStr)
+	for _, pattern := range retriablePatterns {
+		if strings.Contains(lowerErr, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsProviderOutage reports whether err points at the provider being unavailable (5xx or
+// transport failures) rather than at a problem with the request itself
+func IsProviderOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	if statusCode := HTTPStatusCode(err); statusCode != 0 {
+		return statusCode >= 500
+	}
+	// 连接在流中途断开
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	return IsNetworkError(err) || IsRetriableError(err)
+}
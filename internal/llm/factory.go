@@ -19,6 +19,8 @@ var (
 	}
 	// Global config provider function - can be set by the application
 	globalConfigProvider func() (*Config, error)
+	// instanceOverride replaces every client returned by GetLLMInstance, see OverrideInstance
+	instanceOverride Client
 )
 
 // SetConfigProvider sets the global config provider function
@@ -30,6 +32,9 @@ func SetConfigProvider(provider func() (*Config, error)) {
 // The function takes modelType (basic/reasoning) and creates/returns cached instances
 func GetLLMInstance(modelType ModelType) (Client, error) {
 	if globalConfigProvider == nil {
+		if override := overriddenInstance(); override != nil {
+			return override, nil
+		}
 		return nil, fmt.Errorf("no config provider set - call SetConfigProvider first")
 	}
 
@@ -37,6 +42,13 @@ func GetLLMInstance(modelType ModelType) (Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config: %w", err)
 	}
+	ConfigureRateLimits(config.RateLimits)
+	ConfigurePricing(config.Pricing)
+	ConfigureCapabilities(config.Capabilities)
+	// 测试替身仍然应用上面的限流、价格和能力配置
+	if override := overriddenInstance(); override != nil {
+		return override, nil
+	}
 
 	// Generate cache key based on model type
 	effectiveConfig := getEffectiveConfigForModelType(modelType, config)
@@ -57,10 +69,41 @@ func GetLLMInstance(modelType ModelType) (Client, error) {
 	if client, exists := globalCache.clients[cacheKey]; exists {
 		return client, nil
 	}
-	// Create HTTP client for non-streaming interface
-	client, err := NewHTTPClient()
+
+	// Replay serves every response from the cassette without a provider client
+	cassette := currentCassette()
+	if cassette != nil && cassette.Mode() == CassetteReplay {
+		client, err := NewCassetteClient(cassette, nil)
+		if err != nil {
+			return nil, err
+		}
+		globalCache.clients[cacheKey] = client
+		return client, nil
+	}
+
+	// Pick the provider implementation from the endpoint
+	provider := ProviderForConfig(effectiveConfig)
+	if err := provider.ValidateConfig(effectiveConfig); err != nil {
+		return nil, fmt.Errorf("invalid %s config for %s: %w", provider.Name(), modelType, err)
+	}
+	client, err := provider.CreateClient(effectiveConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP LLM client for %s: %w", modelType, err)
+		return nil, fmt.Errorf("failed to create %s LLM client for %s: %w", provider.Name(), modelType, err)
+	}
+
+	// Wrap the client in a failover chain when fallback models are configured
+	if len(effectiveConfig.Fallbacks) > 0 {
+		client, err = NewFailoverClient(effectiveConfig, client, effectiveConfig.Fallbacks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create failover client for %s: %w", modelType, err)
+		}
+	}
+
+	if cassette != nil {
+		client, err = NewCassetteClient(cassette, client)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Cache the client
@@ -86,6 +129,27 @@ func ClearInstanceCache() {
 	globalCache.clients = make(map[string]Client)
 }
 
+// OverrideInstance makes GetLLMInstance return client for every model type until the
+// returned restore function is called. Tests use it to script the model without a server.
+func OverrideInstance(client Client) (restore func()) {
+	globalCache.mu.Lock()
+	previous := instanceOverride
+	instanceOverride = client
+	globalCache.mu.Unlock()
+
+	return func() {
+		globalCache.mu.Lock()
+		instanceOverride = previous
+		globalCache.mu.Unlock()
+	}
+}
+
+func overriddenInstance() Client {
+	globalCache.mu.RLock()
+	defer globalCache.mu.RUnlock()
+	return instanceOverride
+}
+
 // DefaultClientFactory implements the ClientFactory interface
 type DefaultClientFactory struct {
 	supportedProviders []string
@@ -258,6 +322,10 @@ func getEffectiveConfigForModelType(modelType ModelType, config *Config) *Config
 	// If multi-model configurations exist, use them
 	if config.Models != nil {
 		if modelConfig, exists := config.Models[modelType]; exists {
+			api := modelConfig.API
+			if api == "" {
+				api = config.API
+			}
 			return &Config{
 				APIKey:      modelConfig.APIKey,
 				BaseURL:     modelConfig.BaseURL,
@@ -265,6 +333,10 @@ func getEffectiveConfigForModelType(modelType ModelType, config *Config) *Config
 				Temperature: modelConfig.Temperature,
 				MaxTokens:   modelConfig.MaxTokens,
 				Timeout:     config.Timeout,
+				API:         api,
+
+				ThinkingBudget: config.ThinkingBudget,
+				Fallbacks:      config.Fallbacks,
 			}
 		}
 	}
@@ -0,0 +1,360 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// circuitFailureThreshold is the number of consecutive outage errors that opens a circuit
+	circuitFailureThreshold = 3
+	// circuitCooldown is how long an open circuit waits before a probe request is let through
+	circuitCooldown = time.Minute
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker stops sending requests to a provider after repeated outage errors
+// and lets a single probe through once the cool-down has passed
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     circuitState
+	openedAt  time.Time
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports whether a request may be sent. An open circuit past its cool-down
+// moves to half-open and allows exactly one probe.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// 探测请求尚未结束
+		return false
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the circuit
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.state = circuitClosed
+}
+
+// RecordFailure counts an outage error and reports whether the circuit is now open
+func (b *CircuitBreaker) RecordFailure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// Release ends an interrupted probe without a verdict so the next request probes again
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+// IsOpen reports whether requests are currently being rejected
+func (b *CircuitBreaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != circuitClosed
+}
+
+// circuitBreakers are shared by all clients so an outage seen by one model type applies to all
+var circuitBreakers = struct {
+	sync.Mutex
+	byProvider map[string]*CircuitBreaker
+}{byProvider: make(map[string]*CircuitBreaker)}
+
+// circuitBreakerFor returns the breaker of the provider serving baseURL
+func circuitBreakerFor(baseURL string) *CircuitBreaker {
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+
+	breaker, ok := circuitBreakers.byProvider[baseURL]
+	if !ok {
+		breaker = NewCircuitBreaker(circuitFailureThreshold, circuitCooldown)
+		circuitBreakers.byProvider[baseURL] = breaker
+	}
+	return breaker
+}
+
+// failoverTarget is one provider/model in the failover chain
+type failoverTarget struct {
+	model string
+	// config overrides the request config for fallbacks; nil for the primary
+	config  *Config
+	client  Client
+	breaker *CircuitBreaker
+}
+
+// request returns a copy of req addressed to this target
+func (t *failoverTarget) request(req *ChatRequest) *ChatRequest {
+	targetReq := *req
+	if t.config != nil {
+		targetReq.Config = t.config
+		targetReq.ModelType = ""
+		targetReq.Model = t.config.Model
+		if t.config.MaxTokens > 0 {
+			targetReq.MaxTokens = t.config.MaxTokens
+		}
+	}
+	return &targetReq
+}
+
+// FailoverClient sends requests to the first provider whose circuit is closed,
+// falling through an ordered list of fallback models during outages
+type FailoverClient struct {
+	targets []*failoverTarget
+	mu      sync.Mutex
+	active  int
+}
+
+// NewFailoverClient wraps primary with clients for each fallback model config
+func NewFailoverClient(primaryConfig *Config, primary Client, fallbacks []*ModelConfig) (*FailoverClient, error) {
+	if primaryConfig == nil || primary == nil {
+		return nil, fmt.Errorf("primary config and client are required")
+	}
+
+	targets := []*failoverTarget{{
+		model:   primaryConfig.Model,
+		client:  primary,
+		breaker: circuitBreakerFor(primaryConfig.BaseURL),
+	}}
+
+	for i, fallback := range fallbacks {
+		if fallback == nil {
+			continue
+		}
+		config := &Config{
+			APIKey:      fallback.APIKey,
+			BaseURL:     fallback.BaseURL,
+			Model:       fallback.Model,
+			Temperature: fallback.Temperature,
+			MaxTokens:   fallback.MaxTokens,
+			Timeout:     primaryConfig.Timeout,
+			API:         fallback.API,
+		}
+		provider := ProviderForConfig(config)
+		if err := provider.ValidateConfig(config); err != nil {
+			return nil, fmt.Errorf("invalid fallback %d (%s): %w", i+1, fallback.Model, err)
+		}
+		client, err := provider.CreateClient(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fallback %d (%s): %w", i+1, fallback.Model, err)
+		}
+		targets = append(targets, &failoverTarget{
+			model:   fallback.Model,
+			config:  config,
+			client:  client,
+			breaker: circuitBreakerFor(fallback.BaseURL),
+		})
+	}
+
+	return &FailoverClient{targets: targets}, nil
+}
+
+// Chat sends the request to the first available provider
+func (f *FailoverClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	var resp *ChatResponse
+	_, err := f.try(ctx, false, func(target *failoverTarget) error {
+		var err error
+		resp, err = target.client.Chat(ctx, target.request(req), sessionID)
+		return err
+	})
+	return resp, err
+}
+
+// ChatStream starts a stream on the first available provider
+func (f *FailoverClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	var deltas <-chan StreamDelta
+	target, err := f.try(ctx, true, func(target *failoverTarget) error {
+		var err error
+		deltas, err = target.client.ChatStream(ctx, target.request(req), sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f.watchStream(ctx, target, deltas), nil
+}
+
+// watchStream forwards a stream and settles the provider's breaker when it ends, so an outage
+// error in the middle of a stream counts like one returned when the stream is opened
+func (f *FailoverClient) watchStream(ctx context.Context, target *failoverTarget, deltas <-chan StreamDelta) <-chan StreamDelta {
+	out := make(chan StreamDelta, cap(deltas))
+	go func() {
+		defer close(out)
+		var streamErr error
+		for delta := range deltas {
+			if delta.Err != nil {
+				streamErr = delta.Err
+			}
+			select {
+			case out <- delta:
+			case <-ctx.Done():
+				// 调用方已放弃，读完剩余内容让上游退出
+				for range deltas {
+				}
+				target.breaker.Release()
+				return
+			}
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			target.breaker.Release()
+		case streamErr != nil && IsProviderOutage(streamErr):
+			if target.breaker.RecordFailure() {
+				log.Printf("[WARN] FailoverClient: circuit opened for %s: %v", target.model, streamErr)
+			}
+		default:
+			target.breaker.RecordSuccess()
+		}
+	}()
+	return out
+}
+
+// try runs call against the targets in order and returns the target that served it. An outage
+// error (transport failure, 5xx) moves on to the next target within the same call; the breaker
+// only decides which targets are skipped because they failed repeatedly. With settleLater the
+// caller records the outcome of a successful call, for streams that can still fail.
+func (f *FailoverClient) try(ctx context.Context, settleLater bool, call func(*failoverTarget) error) (*failoverTarget, error) {
+	var lastErr error
+	for i, target := range f.targets {
+		if !target.breaker.Allow() {
+			log.Printf("[DEBUG] FailoverClient: circuit open for %s, skipping", target.model)
+			continue
+		}
+
+		err := call(target)
+		if err == nil {
+			if !settleLater {
+				target.breaker.RecordSuccess()
+			}
+			f.setActive(i)
+			return target, nil
+		}
+		if ctx.Err() != nil {
+			target.breaker.Release()
+			return nil, err
+		}
+		if !IsProviderOutage(err) {
+			// 请求本身的问题，服务商是可用的
+			target.breaker.RecordSuccess()
+			return nil, err
+		}
+
+		lastErr = err
+		if target.breaker.RecordFailure() {
+			log.Printf("[WARN] FailoverClient: circuit opened for %s: %v", target.model, err)
+		}
+		if i < len(f.targets)-1 {
+			log.Printf("[WARN] FailoverClient: %s failed, trying the next model: %v", target.model, err)
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("all providers are unavailable, retry after the cool-down")
+	}
+	return nil, lastErr
+}
+
+func (f *FailoverClient) setActive(index int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.active != index {
+		log.Printf("[WARN] FailoverClient: active model is now %s", f.targets[index].model)
+	}
+	f.active = index
+}
+
+// ActiveModelReporter is implemented by clients that may serve requests with a model other than
+// the configured one; wrappers forward it to the client they wrap
+type ActiveModelReporter interface {
+	// Active returns the model that served the last successful request and whether it is the primary
+	Active() (string, bool)
+}
+
+// Active returns the model that served the last successful request and whether it is the primary
+func (f *FailoverClient) Active() (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.targets[f.active].model, f.active == 0
+}
+
+// SupportsStreaming reports whether the active provider streams
+func (f *FailoverClient) SupportsStreaming() bool {
+	f.mu.Lock()
+	client := f.targets[f.active].client
+	f.mu.Unlock()
+
+	streamingClient, ok := client.(StreamingClient)
+	return ok && streamingClient.SupportsStreaming()
+}
+
+// SetStreamingEnabled enables or disables streaming on every provider
+func (f *FailoverClient) SetStreamingEnabled(enabled bool) {
+	for _, target := range f.targets {
+		if streamingClient, ok := target.client.(StreamingClient); ok {
+			streamingClient.SetStreamingEnabled(enabled)
+		}
+	}
+}
+
+// Close closes all wrapped clients
+func (f *FailoverClient) Close() error {
+	var firstErr error
+	for _, target := range f.targets {
+		if err := target.client.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
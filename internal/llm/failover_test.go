@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 20*time.Millisecond)
+
+	if breaker.RecordFailure() {
+		t.Fatal("expected circuit to stay closed below the threshold")
+	}
+	if !breaker.RecordFailure() || breaker.Allow() {
+		t.Fatal("expected circuit to open at the threshold")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("expected a probe after the cool-down")
+	}
+	if breaker.Allow() {
+		t.Error("expected only one probe while half-open")
+	}
+
+	// 探测失败立即重新打开
+	if !breaker.RecordFailure() {
+		t.Error("expected failed probe to reopen the circuit")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("expected another probe after the cool-down")
+	}
+	breaker.RecordSuccess()
+	if breaker.IsOpen() || !breaker.Allow() {
+		t.Error("expected successful probe to close the circuit")
+	}
+}
+
+func TestFailoverClient_FailsOverPerCall(t *testing.T) {
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"fb","model":"fallback-model","choices":[{"index":0,"message":{"role":"assistant","content":"from fallback"},"finish_reason":"stop"}]}`)
+	}))
+	defer fallback.Close()
+
+	primaryConfig := &Config{BaseURL: primary.URL, APIKey: "key", Model: "primary-model"}
+	primaryClient, err := NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewFailoverClient(primaryConfig, primaryClient, []*ModelConfig{
+		{BaseURL: fallback.URL, APIKey: "key", Model: "fallback-model"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Config: primaryConfig}
+	ctx := context.Background()
+
+	// 主服务商的第一次故障就转到下一个模型
+	resp, err := client.Chat(ctx, req, "")
+	if err != nil {
+		t.Fatalf("expected fallback to serve the request, got %v", err)
+	}
+	if resp.Choices[0].Message.Content != "from fallback" || atomic.LoadInt32(&primaryCalls) != 1 {
+		t.Errorf("unexpected response after %d primary calls: %+v", primaryCalls, resp)
+	}
+	if model, isPrimary := client.Active(); model != "fallback-model" || isPrimary {
+		t.Errorf("expected fallback to be active, got %s (primary %v)", model, isPrimary)
+	}
+
+	// 录制包装后仍能报告当前模型
+	var reporter ActiveModelReporter
+	reporter, _ = NewCassetteClient(&Cassette{mode: CassetteRecord}, client)
+	if model, _ := reporter.Active(); model != "fallback-model" {
+		t.Errorf("expected the cassette to forward the active model, got %q", model)
+	}
+
+	for i := 1; i < circuitFailureThreshold; i++ {
+		if _, err := client.Chat(ctx, req, ""); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+	}
+
+	// 断路器打开期间不再请求主服务商
+	calls := atomic.LoadInt32(&primaryCalls)
+	if _, err := client.Chat(ctx, req, ""); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&primaryCalls) != calls {
+		t.Error("expected open circuit to skip the primary provider")
+	}
+}
+
+func TestFailoverClient_RequestErrorsDoNotFailOver(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer primary.Close()
+
+	var fallbackCalls int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fallbackCalls, 1)
+	}))
+	defer fallback.Close()
+
+	primaryConfig := &Config{BaseURL: primary.URL, APIKey: "key", Model: "primary-model"}
+	primaryClient, _ := NewHTTPClient()
+	client, err := NewFailoverClient(primaryConfig, primaryClient, []*ModelConfig{
+		{BaseURL: fallback.URL, APIKey: "key", Model: "fallback-model"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Config: primaryConfig}
+	for i := 0; i < circuitFailureThreshold+1; i++ {
+		if _, err := client.Chat(context.Background(), req, ""); HTTPStatusCode(err) != http.StatusBadRequest {
+			t.Fatalf("expected 400 from primary, got %v", err)
+		}
+	}
+	if atomic.LoadInt32(&fallbackCalls) != 0 {
+		t.Error("expected request errors not to fail over")
+	}
+}
+
+// TestFailoverClient_StreamErrorsOpenCircuit 测试流中途的故障同样计入断路器
+func TestFailoverClient_StreamErrorsOpenCircuit(t *testing.T) {
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"id\":\"s1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		// 连接在流中途断开
+		panic(http.ErrAbortHandler)
+	}))
+	defer primary.Close()
+
+	primaryConfig := &Config{BaseURL: primary.URL, APIKey: "key", Model: "primary-model"}
+	primaryClient, err := NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewFailoverClient(primaryConfig, primaryClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}, Config: primaryConfig}
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		deltas, err := client.ChatStream(context.Background(), req, "")
+		if err != nil {
+			t.Fatalf("attempt %d: expected the stream to open, got %v", i, err)
+		}
+		var last StreamDelta
+		for delta := range deltas {
+			last = delta
+		}
+		if last.Err == nil || !IsProviderOutage(last.Err) {
+			t.Fatalf("attempt %d: expected the stream to end with an outage error, got %v", i, last.Err)
+		}
+	}
+
+	if !circuitBreakerFor(primary.URL).IsOpen() {
+		t.Error("expected repeated mid-stream failures to open the circuit")
+	}
+	if _, err := client.ChatStream(context.Background(), req, ""); err == nil || atomic.LoadInt32(&primaryCalls) != circuitFailureThreshold {
+		t.Errorf("expected the open circuit to skip the provider, got %v after %d calls", err, primaryCalls)
+	}
+}
@@ -0,0 +1,638 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GeminiClient talks to the native Gemini generateContent API
+type GeminiClient struct {
+	httpClient    *http.Client
+	config        *Config
+	streamEnabled bool
+}
+
+// NewGeminiClient creates a generateContent client for config
+func NewGeminiClient(config *Config) (*GeminiClient, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 200 * time.Second
+	}
+
+	return &GeminiClient{
+		httpClient:    &http.Client{Timeout: timeout},
+		config:        config,
+		streamEnabled: true,
+	}, nil
+}
+
+// geminiRequest is the generateContent request body
+type geminiRequest struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart holds exactly one of text, functionCall or functionResponse
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+}
+
+// geminiBlob is inline base64 data such as an image
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// geminiFileData references an image by URI
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode string `json:"mode"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64              `json:"temperature,omitempty"`
+	MaxOutputTokens int                   `json:"maxOutputTokens,omitempty"`
+	ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+	// ResponseMimeType is application/json in JSON mode
+	ResponseMimeType string `json:"responseMimeType,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+type geminiResponse struct {
+	ResponseID   string `json:"responseId"`
+	ModelVersion string `json:"modelVersion"`
+	Candidates   []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+	} `json:"usageMetadata,omitempty"`
+	// Error is sent in place of a chunk when a stream fails
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error,omitempty"`
+}
+
+// Chat sends a chat request and returns the response
+func (c *GeminiClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	resp, limiter, reserved, err := c.send(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	log.Printf("[DEBUG] Gemini response: %s", string(body))
+
+	var geminiResp geminiResponse
+	if err := json.Unmarshal(body, &geminiResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	message, finishReason := geminiResp.message()
+	usage := geminiResp.usage()
+	limiter.Settle(reserved, usage)
+	return &ChatResponse{
+		ID:      geminiResp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   geminiResp.ModelVersion,
+		Choices: []Choice{{Index: 0, Message: message, FinishReason: finishReason}},
+		Usage:   usage,
+	}, nil
+}
+
+// ChatStream sends a streamGenerateContent request; every chunk carries whole parts
+func (c *GeminiClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	if !c.streamEnabled {
+		return nil, fmt.Errorf("streaming is disabled")
+	}
+
+	resp, limiter, reserved, err := c.send(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	deltaChannel := make(chan StreamDelta, 1000)
+
+	go func() {
+		defer close(deltaChannel)
+
+		created := time.Now().Unix()
+		toolCallCount := 0
+		var usage Usage
+		defer func() { limiter.Settle(reserved, usage) }()
+		var streamErr error
+		err := readSSEData(ctx, resp.Body, func(data string) bool {
+			var chunk geminiResponse
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				log.Printf("[WARN] Failed to decode Gemini stream chunk: %v", err)
+				return true
+			}
+			if chunk.Error != nil {
+				log.Printf("[ERROR] GeminiClient: stream error %d %s: %s", chunk.Error.Code, chunk.Error.Status, chunk.Error.Message)
+				streamErr = fmt.Errorf("gemini stream error %d %s: %s", chunk.Error.Code, chunk.Error.Status, chunk.Error.Message)
+				return false
+			}
+
+			// 工具调用索引在整个流中递增，避免多个分片的调用被合并
+			message, finishReason := chunk.message()
+			for i := range message.ToolCalls {
+				index := toolCallCount + i
+				message.ToolCalls[i].Index = &index
+			}
+			toolCallCount += len(message.ToolCalls)
+
+			delta := StreamDelta{
+				ID:      chunk.ResponseID,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   chunk.ModelVersion,
+				Choices: []Choice{{Index: 0, Delta: message, FinishReason: finishReason}},
+				Usage:   chunk.usage(),
+			}
+			if delta.Usage.TotalTokens > 0 {
+				usage = delta.Usage
+			}
+
+			select {
+			case deltaChannel <- delta:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if streamErr == nil {
+			streamErr = err
+		}
+		if streamErr != nil {
+			sendStreamError(ctx, deltaChannel, streamErr)
+		}
+	}()
+
+	return deltaChannel, nil
+}
+
+// send posts req to generateContent or streamGenerateContent and returns the successful HTTP response,
+// together with the provider rate limiter and the tokens reserved on it
+func (c *GeminiClient) send(ctx context.Context, req *ChatRequest, stream bool) (*http.Response, *RateLimiter, int, error) {
+	config := req.Config
+	if config == nil {
+		config = c.config
+	}
+	baseURL, apiKey, model := modelConfigFor(config, req.ModelType)
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	applyCapabilities(req, model)
+	jsonData, err := json.Marshal(buildGeminiRequest(req, config.ThinkingBudget))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	log.Printf("[DEBUG] Gemini request: %s", string(jsonData))
+
+	endpoint := geminiEndpoint(baseURL, model, stream)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", apiKey)
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, req)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+		log.Printf("[ERROR] GeminiClient: HTTP error %d: %s", resp.StatusCode, string(errBody))
+		return nil, nil, 0, newHTTPError(limiter, resp, errBody)
+	}
+
+	return resp, limiter, reserved, nil
+}
+
+// geminiEndpoint builds the model URL. Base URLs pointing at the OpenAI-compatible
+// layer (".../v1beta/openai") are mapped back to the native API.
+func geminiEndpoint(baseURL, model string, stream bool) string {
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/openai")
+	model = strings.TrimPrefix(model, "models/")
+	if stream {
+		return fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", baseURL, model)
+	}
+	return fmt.Sprintf("%s/models/%s:generateContent", baseURL, model)
+}
+
+// buildGeminiRequest translates a chat completion request into a generateContent request
+func buildGeminiRequest(req *ChatRequest, thinkingBudget int) *geminiRequest {
+	system, contents := buildGeminiContents(req.Messages)
+
+	body := &geminiRequest{
+		Contents: contents,
+		GenerationConfig: &geminiGenerationConfig{
+			MaxOutputTokens: req.MaxTokens,
+		},
+	}
+	if system != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	if req.Temperature > 0 {
+		temperature := req.Temperature
+		body.GenerationConfig.Temperature = &temperature
+	}
+	// Gemini 不支持函数调用与 JSON 模式同时使用
+	if req.ResponseFormat != nil && len(req.Tools) == 0 {
+		body.GenerationConfig.ResponseMimeType = "application/json"
+	}
+	if thinkingBudget > 0 {
+		body.GenerationConfig.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: thinkingBudget, IncludeThoughts: true}
+	}
+
+	if len(req.Tools) > 0 {
+		declarations := make([]geminiFunctionDeclaration, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			declarations = append(declarations, geminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  geminiSchema(tool.Function.Parameters),
+			})
+		}
+		body.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+
+		mode := "AUTO"
+		switch req.ToolChoice {
+		case "required", "any":
+			mode = "ANY"
+		case "none":
+			mode = "NONE"
+		}
+		body.ToolConfig = &geminiToolConfig{}
+		body.ToolConfig.FunctionCallingConfig.Mode = mode
+	}
+
+	return body
+}
+
+// geminiSchemaKeys are the JSON Schema keywords the Gemini Schema object accepts; others such as
+// additionalProperties or $schema make the request fail
+var geminiSchemaKeys = map[string]bool{
+	"type": true, "format": true, "title": true, "description": true, "nullable": true, "enum": true,
+	"items": true, "minItems": true, "maxItems": true, "properties": true, "required": true,
+	"minProperties": true, "maxProperties": true, "minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "anyOf": true, "propertyOrdering": true, "default": true, "example": true,
+}
+
+// geminiSchema converts tool parameters to the subset of JSON Schema Gemini accepts
+func geminiSchema(parameters interface{}) interface{} {
+	if parameters == nil {
+		return nil
+	}
+	schema, ok := parameters.(map[string]interface{})
+	if !ok {
+		// 结构体等类型先转换为通用的 map
+		data, err := json.Marshal(parameters)
+		if err != nil || json.Unmarshal(data, &schema) != nil {
+			return parameters
+		}
+	}
+	return sanitizeGeminiSchema(schema)
+}
+
+func sanitizeGeminiSchema(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			switch {
+			case key == "properties":
+				// 属性名不是关键字，只清理每个属性的 schema
+				if properties, ok := item.(map[string]interface{}); ok {
+					sanitized := make(map[string]interface{}, len(properties))
+					for name, property := range properties {
+						sanitized[name] = sanitizeGeminiSchema(property)
+					}
+					result[key] = sanitized
+				}
+			case key == "type":
+				// ["string", "null"] 形式的类型改为 nullable
+				if types, ok := item.([]interface{}); ok {
+					for _, t := range types {
+						if name, ok := t.(string); ok && name == "null" {
+							result["nullable"] = true
+						} else if _, set := result["type"]; !set {
+							result["type"] = t
+						}
+					}
+					continue
+				}
+				result[key] = item
+			case key == "items" || key == "anyOf":
+				result[key] = sanitizeGeminiSchema(item)
+			case geminiSchemaKeys[key]:
+				// enum、default 等是值而不是 schema，原样保留
+				result[key] = item
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = sanitizeGeminiSchema(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// geminiUserParts converts the text and images of a user message
+func geminiUserParts(msg Message) []geminiPart {
+	var parts []geminiPart
+	for _, part := range messageParts(msg) {
+		switch {
+		case part.Type != ContentPartImage:
+			parts = append(parts, geminiPart{Text: part.Text})
+		case part.URL != "":
+			parts = append(parts, geminiPart{FileData: &geminiFileData{MimeType: ImageMediaType(part.URL), FileURI: part.URL}})
+		default:
+			parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: part.MediaType, Data: part.Data}})
+		}
+	}
+	return parts
+}
+
+// buildGeminiContents moves system messages into the system instruction, converts tool calls
+// into functionCall parts and tool results into functionResponse parts. Consecutive messages
+// of the same role are merged into one content entry.
+func buildGeminiContents(messages []Message) (string, []geminiContent) {
+	var system []string
+	var contents []geminiContent
+	// functionResponse 需要函数名，按调用ID回查
+	callNames := make(map[string]string)
+
+	for _, msg := range messages {
+		var role string
+		var parts []geminiPart
+
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		case "tool":
+			role = "user"
+			name := msg.Name
+			if name == "" {
+				name = callNames[msg.ToolCallId]
+			}
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+				ID:       msg.ToolCallId,
+				Name:     name,
+				Response: map[string]interface{}{"content": msg.Content},
+			}})
+		case "assistant":
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for i, tc := range msg.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+				part := geminiPart{FunctionCall: &geminiFunctionCall{
+					ID:   tc.ID,
+					Name: tc.Function.Name,
+					Args: geminiArgs(tc.Function.Arguments),
+				}}
+				// 思考签名附加在第一个函数调用上
+				if i == 0 {
+					part.ThoughtSignature = msg.ThinkingSignature
+				}
+				parts = append(parts, part)
+			}
+		default:
+			role = "user"
+			parts = append(parts, geminiUserParts(msg)...)
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	return strings.Join(system, "\n\n"), contents
+}
+
+// geminiArgs turns tool call arguments into the JSON object expected for functionCall args
+func geminiArgs(arguments string) json.RawMessage {
+	arguments = strings.TrimSpace(arguments)
+	if arguments == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+// message converts the first candidate into an assistant message and finish reason.
+// Function calls without an ID get a generated one.
+func (r *geminiResponse) message() (Message, string) {
+	message := Message{Role: "assistant"}
+	if len(r.Candidates) == 0 {
+		return message, ""
+	}
+
+	candidate := r.Candidates[0]
+	var content, reasoning strings.Builder
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			id := part.FunctionCall.ID
+			if id == "" {
+				id = geminiCallID(part.FunctionCall.Name)
+			}
+			if part.ThoughtSignature != "" && message.ThinkingSignature == "" {
+				message.ThinkingSignature = part.ThoughtSignature
+			}
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:       id,
+				Type:     "function",
+				Function: Function{Name: part.FunctionCall.Name, Arguments: string(geminiArgs(string(part.FunctionCall.Args)))},
+			})
+		case part.Thought:
+			reasoning.WriteString(part.Text)
+		default:
+			content.WriteString(part.Text)
+		}
+	}
+	message.Content = content.String()
+	message.Reasoning = reasoning.String()
+
+	return message, geminiFinishReason(candidate.FinishReason, len(message.ToolCalls) > 0)
+}
+
+// geminiCallID generates a tool call ID; it must be unique within the session because tool
+// outputs are saved and elided by call ID
+func geminiCallID(name string) string {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("call_%s_%d", name, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("call_%s_%s", name, hex.EncodeToString(suffix))
+}
+
+func (r *geminiResponse) usage() Usage {
+	if r.UsageMetadata == nil {
+		return Usage{}
+	}
+	// 思考 token 按输出计费
+	completion := r.UsageMetadata.CandidatesTokenCount + r.UsageMetadata.ThoughtsTokenCount
+	return Usage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: completion,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+		CachedTokens:     r.UsageMetadata.CachedContentTokenCount,
+	}
+}
+
+// geminiFinishReason maps Gemini finish reasons to OpenAI finish reasons
+func geminiFinishReason(reason string, hasToolCalls bool) string {
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		if hasToolCalls {
+			return "tool_calls"
+		}
+		return "stop"
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return strings.ToLower(reason)
+	}
+}
+
+// SupportsStreaming returns true if the client supports streaming
+func (c *GeminiClient) SupportsStreaming() bool {
+	return c.streamEnabled
+}
+
+// SetStreamingEnabled enables or disables streaming
+func (c *GeminiClient) SetStreamingEnabled(enabled bool) {
+	c.streamEnabled = enabled
+}
+
+// SetHTTPClient sets a custom HTTP client
+func (c *GeminiClient) SetHTTPClient(client *http.Client) {
+	if client != nil {
+		c.httpClient = client
+	}
+}
+
+// GetHTTPClient returns the current HTTP client
+func (c *GeminiClient) GetHTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Close closes the client and cleans up resources
+func (c *GeminiClient) Close() error {
+	return nil
+}
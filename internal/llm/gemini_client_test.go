@@ -0,0 +1,211 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildGeminiContents(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "Find TODOs"},
+		{Role: "assistant", ThinkingSignature: "sig", ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: Function{Name: "grep", Arguments: `{"pattern":"TODO"}`}},
+		}},
+		{Role: "tool", Content: "main.go:1: TODO", ToolCallId: "call_1"},
+	}
+
+	system, contents := buildGeminiContents(messages)
+	if system != "You are helpful" {
+		t.Errorf("expected system instruction, got %q", system)
+	}
+	if len(contents) != 3 || contents[1].Role != "model" || contents[2].Role != "user" {
+		t.Fatalf("unexpected contents: %+v", contents)
+	}
+
+	call := contents[1].Parts[0]
+	if call.FunctionCall == nil || call.FunctionCall.Name != "grep" || string(call.FunctionCall.Args) != `{"pattern":"TODO"}` || call.ThoughtSignature != "sig" {
+		t.Errorf("unexpected functionCall part: %+v", call)
+	}
+
+	// 工具结果没有名字时按调用ID回查
+	response := contents[2].Parts[0].FunctionResponse
+	if response == nil || response.Name != "grep" || response.Response["content"] != "main.go:1: TODO" {
+		t.Errorf("unexpected functionResponse part: %+v", response)
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	parameters := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]interface{}{
+			// 与关键字同名的属性必须保留
+			"additionalProperties": map[string]interface{}{"type": "string"},
+			"path":                 map[string]interface{}{"type": []interface{}{"string", "null"}, "description": "file path"},
+			"options": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+				"default":              map[string]interface{}{"additionalProperties": true},
+			},
+			"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "$ref": "#/x"}},
+		},
+		"required": []interface{}{"path"},
+	}
+
+	data, err := json.Marshal(geminiSchema(parameters))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"properties":{"additionalProperties":{"type":"string"},"options":{"default":{"additionalProperties":true},"type":"object"},` +
+		`"path":{"description":"file path","nullable":true,"type":"string"},"tags":{"items":{"type":"string"},"type":"array"}},"required":["path"],"type":"object"}`
+	if string(data) != want {
+		t.Errorf("unexpected schema\n got %s\nwant %s", data, want)
+	}
+	if geminiCallID("file_read") == geminiCallID("file_read") {
+		t.Error("generated tool call IDs should be unique")
+	}
+}
+
+func TestGeminiClient_Chat(t *testing.T) {
+	var received geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-test:generateContent" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("missing API key header")
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{
+			"responseId": "resp_1", "modelVersion": "gemini-test",
+			"candidates": [{"content": {"role": "model", "parts": [
+				{"text": "thinking about it", "thought": true},
+				{"text": "Searching."},
+				{"functionCall": {"name": "grep", "args": {"pattern": "TODO"}}}
+			]}, "finishReason": "STOP"}],
+			"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "thoughtsTokenCount": 3, "totalTokenCount": 18}
+		}`)
+	}))
+	defer server.Close()
+
+	// OpenAI-compatible base URLs are mapped back to the native API
+	client, err := NewGeminiClient(&Config{BaseURL: server.URL + "/v1beta/openai/", APIKey: "test-key", Model: "gemini-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Chat(context.Background(), &ChatRequest{
+		Messages:  []Message{{Role: "system", Content: "sys"}, {Role: "user", Content: "hi"}},
+		MaxTokens: 1000,
+		Tools:     []Tool{{Type: "function", Function: Function{Name: "grep", Parameters: map[string]interface{}{"type": "object"}}}},
+	}, "")
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if received.SystemInstruction == nil || received.SystemInstruction.Parts[0].Text != "sys" {
+		t.Errorf("expected system instruction, got %+v", received.SystemInstruction)
+	}
+	if len(received.Tools) != 1 || received.Tools[0].FunctionDeclarations[0].Name != "grep" || received.ToolConfig.FunctionCallingConfig.Mode != "AUTO" {
+		t.Errorf("unexpected tools: %+v", received.Tools)
+	}
+
+	choice := resp.Choices[0]
+	if choice.Message.Content != "Searching." || choice.Message.Reasoning != "thinking about it" {
+		t.Errorf("unexpected message: %+v", choice.Message)
+	}
+	if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID == "" {
+		t.Errorf("expected one tool call with generated ID, got %+v", choice)
+	}
+	if resp.Usage.PromptTokens != 10 || resp.Usage.CompletionTokens != 8 || resp.Usage.TotalTokens != 18 {
+		t.Errorf("unexpected usage: %+v", resp.Usage)
+	}
+}
+
+func TestGeminiClient_ChatStream(t *testing.T) {
+	chunks := []string{
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"},{"functionCall":{"name":"file_read","args":{"file_path":"a.go"}}}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"file_read","args":{"file_path":"b.go"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":9,"totalTokenCount":16}}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("unexpected stream URL %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewGeminiClient(&Config{BaseURL: server.URL, APIKey: "test-key", Model: "gemini-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deltas, err := client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}, "")
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+
+	accumulator := NewStreamAccumulator()
+	for delta := range deltas {
+		accumulator.Add(delta)
+	}
+	resp := accumulator.Response()
+
+	message := resp.Choices[0].Message
+	if message.Content != "Hello" {
+		t.Errorf("expected streamed content, got %q", message.Content)
+	}
+	if len(message.ToolCalls) != 2 || message.ToolCalls[1].Function.Arguments != `{"file_path":"b.go"}` {
+		t.Fatalf("expected two separate tool calls, got %+v", message.ToolCalls)
+	}
+	if message.ToolCalls[0].ID == message.ToolCalls[1].ID {
+		t.Errorf("expected distinct tool call IDs, got %q", message.ToolCalls[0].ID)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" || resp.Usage.TotalTokens != 16 {
+		t.Errorf("unexpected finish reason or usage: %+v", resp)
+	}
+}
+
+func TestGeminiClient_ChatStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"error\":{\"code\":503,\"message\":\"The model is overloaded.\",\"status\":\"UNAVAILABLE\"}}\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewGeminiClient(&Config{BaseURL: server.URL, APIKey: "test-key", Model: "gemini-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deltas, err := client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "hi"}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streamErr error
+	for delta := range deltas {
+		if delta.Err != nil {
+			streamErr = delta.Err
+		}
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "UNAVAILABLE") {
+		t.Errorf("expected the error chunk to end the stream, got %v", streamErr)
+	}
+}
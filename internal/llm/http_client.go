@@ -16,6 +16,7 @@ type HTTPLLMClient struct {
 	httpClient       *http.Client
 	cacheManager     *CacheManager
 	kimiCacheManager *KimiCacheManager
+	streamEnabled    bool
 }
 
 // NewHTTPClient creates a new HTTP-based LLM client
@@ -27,12 +28,13 @@ func NewHTTPClient() (*HTTPLLMClient, error) {
 	}
 
 	client := &HTTPLLMClient{
-		httpClient:   httpClient,
-		cacheManager: GetGlobalCacheManager(),
+		httpClient:    httpClient,
+		cacheManager:  GetGlobalCacheManager(),
+		streamEnabled: true,
 	}
 
 	// Initialize Kimi cache manager
-	client.kimiCacheManager = NewKimiCacheManager(client)
+	client.kimiCacheManager = kimiCacheManager()
 
 	return client, nil
 }
@@ -50,7 +52,11 @@ func (c *HTTPLLMClient) getModelConfig(req *ChatRequest) (string, string, string
 		}
 	}
 
-	modelType := req.ModelType
+	return modelConfigFor(config, req.ModelType)
+}
+
+// modelConfigFor returns the endpoint, API key and model configured for modelType
+func modelConfigFor(config *Config, modelType ModelType) (string, string, string) {
 	if modelType == "" {
 		modelType = config.DefaultModelType
 		if modelType == "" {
@@ -69,12 +75,16 @@ func (c *HTTPLLMClient) getModelConfig(req *ChatRequest) (string, string, string
 	return config.BaseURL, config.APIKey, config.Model
 }
 
-// Chat sends a chat request and returns the response
-func (c *HTTPLLMClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
-	if req == nil {
-		return nil, fmt.Errorf("request cannot be nil")
-	}
+// ModelFor returns the model name configured for modelType
+func ModelFor(config *Config, modelType ModelType) string {
+	_, _, model := modelConfigFor(config, modelType)
+	return model
+}
 
+// prepareRequest resolves the model configuration, applies session/Kimi caching and
+// request defaults. It returns the endpoint, API key, extra cache headers and the
+// messages as they were before cache optimization.
+func (c *HTTPLLMClient) prepareRequest(req *ChatRequest, sessionID string) (string, string, map[string]string, []Message) {
 	// Optimize messages using cache
 	originalMessages := req.Messages
 	if sessionID != "" {
@@ -83,8 +93,6 @@ func (c *HTTPLLMClient) Chat(ctx context.Context, req *ChatRequest, sessionID st
 
 	// Get model configuration for this request
 	baseURL, apiKey, model := c.getModelConfig(req)
-	// Ensure streaming is disabled for HTTP mode
-	req.Stream = false
 	log.Printf("[DEBUG] API Provider: %s", baseURL)
 
 	// Debug Kimi cache conditions
@@ -96,33 +104,45 @@ func (c *HTTPLLMClient) Chat(ctx context.Context, req *ChatRequest, sessionID st
 		}
 	}
 
-	// Handle Kimi API context caching
-	var cacheHeaders map[string]string
-	if IsKimiAPI(baseURL) && sessionID != "" && len(req.Messages) > 0 {
-		// 尝试为当前的 messages 和 tools 创建或重用缓存
-		if _, err := c.kimiCacheManager.CreateCacheIfNeeded(sessionID, req.Messages, req.Tools, apiKey); err != nil {
-			log.Printf("WARNING: Failed to create/reuse Kimi cache: %v", err)
-		}
-		// Prepare headers for cache usage (verifies message/tool consistency)
-		cacheHeaders = c.kimiCacheManager.PrepareRequestWithCache(sessionID, req)
-		log.Printf("[DEBUG] Cache created: %s", cacheHeaders)
-
-	}
-
 	// Set defaults
-	c.setRequestDefaults(req)
+	c.setRequestDefaults(req, model)
 
 	// Override model if not set in request
 	if req.Model == "" {
 		req.Model = model
 	}
 
+	// 之前轮次的推理内容只回传给需要它的模型
+	req.Messages = reasoningMessages(req.Messages, req.Model)
+
+	// 按服务商的缓存方式标记稳定前缀（Kimi 需要额外的缓存头）
+	cacheHeaders := PromptCacheFor(baseURL, req.Model).Prepare(req, sessionID, apiKey)
+
 	if req.Model == "qwen/qwen3-coder" {
 		req.Provider = map[string]interface{}{
 			"only": []string{"alibaba"},
 		}
 	}
 
+	return baseURL, apiKey, cacheHeaders, originalMessages
+}
+
+// Chat sends a chat request and returns the response
+func (c *HTTPLLMClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	// Ensure streaming is disabled for HTTP mode
+	req.Stream = false
+	req.StreamOptions = nil
+	baseURL, apiKey, cacheHeaders, originalMessages := c.prepareRequest(req, sessionID)
+
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, req)
+	if err != nil {
+		return nil, err
+	}
+
 	jsonData, err := json.Marshal(req)
 
 	log.Printf("[DEBUG] Request: %s", string(jsonData))
@@ -151,7 +171,7 @@ func (c *HTTPLLMClient) Chat(ctx context.Context, req *ChatRequest, sessionID st
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		log.Printf("[ERROR] HTTPLLMClient: HTTP error %d: %s", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newHTTPError(limiter, resp, body)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -170,41 +190,134 @@ func (c *HTTPLLMClient) Chat(ctx context.Context, req *ChatRequest, sessionID st
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Update cache with the new conversation
-	if sessionID != "" && len(chatResp.Choices) > 0 {
-		// Prepare messages to cache (original user messages + assistant response)
-		newMessages := make([]Message, 0, len(originalMessages)+1)
+	c.updateSessionCache(sessionID, originalMessages, &chatResp)
+	limiter.Settle(reserved, chatResp.Usage)
 
-		// Add original user messages (the ones that weren't already cached)
-		for _, msg := range originalMessages {
-			if msg.Role == "user" {
-				newMessages = append(newMessages, msg)
-			}
+	return &chatResp, nil
+}
+
+// ChatStream sends a chat request and streams the response as server-sent events
+func (c *HTTPLLMClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	if !c.streamEnabled {
+		return nil, fmt.Errorf("streaming is disabled")
+	}
+
+	// Work on a copy so a fallback Chat call sees the caller's original request
+	streamReq := *req
+	streamReq.Stream = true
+	streamReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	baseURL, apiKey, cacheHeaders, originalMessages := c.prepareRequest(&streamReq, sessionID)
+
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, &streamReq)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(&streamReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	log.Printf("[DEBUG] Stream request: %s", string(jsonData))
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	c.setHeaders(httpReq, apiKey, cacheHeaders)
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
 		}
+		log.Printf("[ERROR] HTTPLLMClient: HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newHTTPError(limiter, resp, body)
+	}
+
+	deltaChannel := make(chan StreamDelta, 1000)
 
-		// Add assistant response
-		newMessages = append(newMessages, chatResp.Choices[0].Message)
+	go func() {
+		defer close(deltaChannel)
 
-		// Calculate approximate token usage using compatible method
-		usage := chatResp.GetUsage()
-		tokensUsed := usage.GetTotalTokens()
-		if tokensUsed == 0 {
-			// Rough estimation: ~4 chars per token
-			for _, msg := range newMessages {
-				tokensUsed += len(msg.Content) / 4
+		accumulator := NewStreamAccumulator()
+		err := readSSEStream(ctx, resp.Body, func(delta StreamDelta) bool {
+			accumulator.Add(delta)
+			select {
+			case deltaChannel <- delta:
+				return true
+			case <-ctx.Done():
+				return false
 			}
+		})
+		if err != nil {
+			sendStreamError(ctx, deltaChannel, err)
 		}
 
-		c.cacheManager.UpdateCache(sessionID, newMessages, tokensUsed)
+		if !accumulator.Empty() {
+			streamResp := accumulator.Response()
+			// 中断的回复不能作为会话缓存的前缀
+			if err == nil {
+				c.updateSessionCache(sessionID, originalMessages, streamResp)
+			}
+			limiter.Settle(reserved, streamResp.Usage)
+		}
+	}()
+
+	return deltaChannel, nil
+}
 
+// updateSessionCache records the user messages and assistant reply of a completed call
+func (c *HTTPLLMClient) updateSessionCache(sessionID string, originalMessages []Message, chatResp *ChatResponse) {
+	if sessionID == "" || chatResp == nil || len(chatResp.Choices) == 0 {
+		return
 	}
 
-	return &chatResp, nil
+	// Prepare messages to cache (original user messages + assistant response)
+	newMessages := make([]Message, 0, len(originalMessages)+1)
+
+	// Add original user messages (the ones that weren't already cached)
+	for _, msg := range originalMessages {
+		if msg.Role == "user" {
+			newMessages = append(newMessages, msg)
+		}
+	}
+
+	// Add assistant response
+	newMessages = append(newMessages, chatResp.Choices[0].Message)
+
+	// Calculate approximate token usage using compatible method
+	usage := chatResp.GetUsage()
+	tokensUsed := usage.GetTotalTokens()
+	if tokensUsed == 0 {
+		// Rough estimation: ~4 chars per token
+		for _, msg := range newMessages {
+			tokensUsed += len(msg.Content) / 4
+		}
+	}
+
+	c.cacheManager.UpdateCache(sessionID, newMessages, tokensUsed)
 }
 
-// ChatStream is not supported in HTTP mode
-func (c *HTTPLLMClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
-	return nil, fmt.Errorf("streaming not supported in HTTP mode, use streaming client instead")
+// SupportsStreaming returns true if the client supports streaming
+func (c *HTTPLLMClient) SupportsStreaming() bool {
+	return c.streamEnabled
+}
+
+// SetStreamingEnabled enables or disables streaming
+func (c *HTTPLLMClient) SetStreamingEnabled(enabled bool) {
+	c.streamEnabled = enabled
 }
 
 // SetHTTPClient sets a custom HTTP client
@@ -286,15 +399,16 @@ func (c *HTTPLLMClient) CleanupCachesOnExit() error {
 	return nil
 }
 
-// setRequestDefaults sets default values for the request
-func (c *HTTPLLMClient) setRequestDefaults(req *ChatRequest) {
+// setRequestDefaults sets default values for the request and adapts it to the model's capabilities
+func (c *HTTPLLMClient) setRequestDefaults(req *ChatRequest, model string) {
 	if req.Temperature == 0 {
 		req.Temperature = 0.7 // Default temperature
 	}
 
-	if req.MaxTokens == 0 {
-		req.MaxTokens = 2048 // Default max tokens
+	if req.Model != "" {
+		model = req.Model
 	}
+	applyCapabilities(req, model)
 }
 
 // setHeaders sets common headers for HTTP requests
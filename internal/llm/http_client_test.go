@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -85,3 +86,101 @@ func TestHTTPClient_Chat(t *testing.T) {
 		t.Errorf("Expected 'Test response', got '%s'", response.Choices[0].Message.Content)
 	}
 }
+
+func TestHTTPClient_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Errorf("expected streaming request with usage, got stream=%v options=%v", req.Stream, req.StreamOptions)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"id":"s1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+			`{"id":"s1","choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+			`{"id":"s1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+		}
+		for _, chunk := range chunks {
+			_, _ = w.Write([]byte("data: " + chunk + "\n\n"))
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient()
+	if err != nil {
+		t.Fatalf("NewHTTPClient() failed: %v", err)
+	}
+	if !client.SupportsStreaming() {
+		t.Fatal("expected HTTP client to support streaming")
+	}
+
+	req := &ChatRequest{
+		Messages:  []Message{{Role: "user", Content: "hi"}},
+		ModelType: BasicModel,
+		Config:    &Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model"},
+	}
+
+	deltas, err := client.ChatStream(context.Background(), req, "")
+	if err != nil {
+		t.Fatalf("ChatStream() failed: %v", err)
+	}
+
+	accumulator := NewStreamAccumulator()
+	for delta := range deltas {
+		accumulator.Add(delta)
+	}
+
+	resp := accumulator.Response()
+	if resp.Choices[0].Message.Content != "Hello" {
+		t.Errorf("expected 'Hello', got '%s'", resp.Choices[0].Message.Content)
+	}
+	if usage := resp.GetUsage(); usage.GetTotalTokens() != 5 {
+		t.Errorf("expected 5 total tokens, got %d", usage.GetTotalTokens())
+	}
+	if req.Stream {
+		t.Error("ChatStream should not modify the caller's request")
+	}
+
+	client.SetStreamingEnabled(false)
+	if _, err := client.ChatStream(context.Background(), req, ""); err == nil {
+		t.Error("expected error when streaming is disabled")
+	}
+}
+
+func TestHTTPClient_ChatStreamInterrupted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"id\":\"s1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n"))
+		// 超过缓冲区的行使读取失败
+		_, _ = w.Write([]byte("data: " + strings.Repeat("x", maxSSELineSize+1) + "\n\n"))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ChatRequest{
+		Messages:  []Message{{Role: "user", Content: "hi"}},
+		ModelType: BasicModel,
+		Config:    &Config{BaseURL: server.URL, APIKey: "test-key", Model: "test-model"},
+	}
+	deltas, err := client.ChatStream(context.Background(), req, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last StreamDelta
+	count := 0
+	for delta := range deltas {
+		last = delta
+		count++
+	}
+	if count != 2 || last.Err == nil {
+		t.Errorf("expected the content delta and a final error delta, got %d deltas ending with %+v", count, last)
+	}
+}
@@ -110,7 +110,7 @@ func (kcm *KimiCacheManager) CreateCacheIfNeeded(sessionID string, messages []Me
 // extractCacheablePrefix extracts cacheable prefix from messages
 // This should match the compression strategy's cacheable prefix
 func (kcm *KimiCacheManager) extractCacheablePrefix(messages []Message) []Message {
-	const maxCacheablePrefix = 8 // 与压缩策略保持一致
+	const maxCacheablePrefix = CacheablePrefixMessages // 与压缩策略保持一致
 
 	// 过滤系统消息，找到用户对话的开始
 	var nonSystemMessages []Message
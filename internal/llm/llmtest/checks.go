@@ -0,0 +1,132 @@
+package llmtest
+
+import (
+	"fmt"
+	"strings"
+
+	"alex/internal/llm"
+)
+
+// VerifyToolCallPairing reports the first violation of the OpenAI tool message rules: every
+// tool call of an assistant message is answered by a tool message that follows it directly,
+// and every tool message answers such a call
+func VerifyToolCallPairing(messages []llm.Message) error {
+	for i := 0; i < len(messages); i++ {
+		msg := messages[i]
+		if msg.Role == "tool" {
+			return fmt.Errorf("message %d: tool result %q does not follow an assistant tool call", i, msg.ToolCallId)
+		}
+		if msg.Role != "assistant" || len(msg.ToolCalls) == 0 {
+			continue
+		}
+
+		pending := make(map[string]bool, len(msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			if call.ID == "" {
+				return fmt.Errorf("message %d: tool call %s has no id", i, call.Function.Name)
+			}
+			pending[call.ID] = true
+		}
+		for i+1 < len(messages) && messages[i+1].Role == "tool" {
+			i++
+			id := messages[i].ToolCallId
+			if !pending[id] {
+				return fmt.Errorf("message %d: tool result %q does not match a pending tool call", i, id)
+			}
+			delete(pending, id)
+		}
+		for id := range pending {
+			return fmt.Errorf("message %d: tool call %q has no result", i, id)
+		}
+	}
+	return nil
+}
+
+// ToolCallsPaired checks that tool calls and tool results in the request are paired
+func ToolCallsPaired() Check {
+	return func(req *llm.ChatRequest) error {
+		return VerifyToolCallPairing(req.Messages)
+	}
+}
+
+// HasToolResult checks that the request carries the result of callID and that it contains text
+func HasToolResult(callID, text string) Check {
+	return func(req *llm.ChatRequest) error {
+		for _, msg := range req.Messages {
+			if msg.Role != "tool" || msg.ToolCallId != callID {
+				continue
+			}
+			if !strings.Contains(msg.Content, text) {
+				return fmt.Errorf("result of %s does not contain %q: %q", callID, text, msg.Content)
+			}
+			return nil
+		}
+		return fmt.Errorf("no tool result for %s", callID)
+	}
+}
+
+// OffersTool checks that the request offers the named tool
+func OffersTool(name string) Check {
+	return func(req *llm.ChatRequest) error {
+		for _, tool := range req.Tools {
+			if tool.Function.Name == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("tool %s is not offered", name)
+	}
+}
+
+// Contains checks that some message of the request contains text
+func Contains(text string) Check {
+	return func(req *llm.ChatRequest) error {
+		if findMessage(req.Messages, text) < 0 {
+			return fmt.Errorf("no message contains %q", text)
+		}
+		return nil
+	}
+}
+
+// Lacks checks that no message of the request contains text, e.g. after it was compressed away
+func Lacks(text string) Check {
+	return func(req *llm.ChatRequest) error {
+		if i := findMessage(req.Messages, text); i >= 0 {
+			return fmt.Errorf("message %d (%s) still contains %q", i, req.Messages[i].Role, text)
+		}
+		return nil
+	}
+}
+
+// MaxMessages checks that the request has at most n messages
+func MaxMessages(n int) Check {
+	return func(req *llm.ChatRequest) error {
+		if len(req.Messages) > n {
+			return fmt.Errorf("request has %d messages, want at most %d", len(req.Messages), n)
+		}
+		return nil
+	}
+}
+
+// Streaming checks whether the request asks for a stream
+func Streaming(stream bool) Check {
+	return func(req *llm.ChatRequest) error {
+		if req.Stream != stream {
+			return fmt.Errorf("stream = %v, want %v", req.Stream, stream)
+		}
+		return nil
+	}
+}
+
+func findMessage(messages []llm.Message, text string) int {
+	for i, msg := range messages {
+		if strings.Contains(msg.Content, text) {
+			return i
+		}
+		for _, part := range msg.Parts {
+			if strings.Contains(part.Text, text) {
+				return i
+			}
+		}
+	}
+	return -1
+}
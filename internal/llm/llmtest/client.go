@@ -0,0 +1,94 @@
+package llmtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"alex/internal/llm"
+)
+
+// Client is an llm.StreamingClient that answers from a script without any HTTP.
+// Install it with llm.OverrideInstance to drive code that calls llm.GetLLMInstance.
+type Client struct {
+	*script
+	streaming bool
+	model     string
+}
+
+// NewClient returns a streaming client answering turns in order
+func NewClient(t testing.TB, turns ...Turn) *Client {
+	return &Client{script: newScript(t, turns), streaming: true, model: "llmtest"}
+}
+
+// Install makes llm.GetLLMInstance return the client until the test ends
+func (c *Client) Install() *Client {
+	restore := llm.OverrideInstance(c)
+	c.t.Cleanup(restore)
+	return c
+}
+
+// Chat answers req with the next turn
+func (c *Client) Chat(ctx context.Context, req *llm.ChatRequest, sessionID string) (*llm.ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	turn, index, err := c.turn(req)
+	if err != nil {
+		return nil, err
+	}
+	return turn.response(fmt.Sprintf("chatcmpl-%d", index+1), c.modelOf(req)), nil
+}
+
+// ChatStream answers req with the next turn split into stream deltas
+func (c *Client) ChatStream(ctx context.Context, req *llm.ChatRequest, sessionID string) (<-chan llm.StreamDelta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	turn, index, err := c.turn(req)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := turn.deltas(fmt.Sprintf("chatcmpl-%d", index+1), c.modelOf(req))
+	ch := make(chan llm.StreamDelta, len(deltas))
+	for _, delta := range deltas {
+		ch <- delta
+	}
+	close(ch)
+	return ch, nil
+}
+
+// SupportsStreaming reports whether ChatStream should be used
+func (c *Client) SupportsStreaming() bool {
+	return c.streaming
+}
+
+// SetStreamingEnabled switches between streaming and plain responses
+func (c *Client) SetStreamingEnabled(enabled bool) {
+	c.streaming = enabled
+}
+
+// Close implements llm.Client
+func (c *Client) Close() error {
+	return nil
+}
+
+func (c *Client) turn(req *llm.ChatRequest) (Turn, int, error) {
+	turn, index, ok := c.take(req)
+	if !ok {
+		return Turn{}, 0, fmt.Errorf("llmtest: script exhausted")
+	}
+	if turn.Status != 0 && turn.Status != 200 {
+		// 与 HTTP 客户端相同的错误格式，重试逻辑按状态码判断
+		return Turn{}, index, fmt.Errorf("HTTP error %d: llmtest: scripted error for %s", turn.Status, turnName(turn, index))
+	}
+	return turn, index, nil
+}
+
+func (c *Client) modelOf(req *llm.ChatRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return c.model
+}
@@ -0,0 +1,117 @@
+package llmtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"alex/internal/llm"
+)
+
+func TestServer_StreamAndChat(t *testing.T) {
+	server := NewServer(t,
+		CallTools(
+			ToolCall("call_1", "file_read", map[string]any{"file_path": "/tmp/a.go"}),
+			ToolCall("call_2", "bash", map[string]any{"command": "go test ./..."}),
+		).WithUsage(100, 20),
+		Reply("All tests pass.").Expect(ToolCallsPaired(), HasToolResult("call_2", "ok"), Streaming(false)),
+	)
+
+	client, err := llm.NewStreamingClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &llm.Config{BaseURL: server.URL, APIKey: "key", Model: "test-model"}
+	messages := []llm.Message{{Role: "user", Content: "run the tests"}}
+
+	deltas, err := client.ChatStream(context.Background(), &llm.ChatRequest{Messages: messages, Config: config}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accumulator := llm.NewStreamAccumulator()
+	for delta := range deltas {
+		accumulator.Add(delta)
+	}
+	response := accumulator.Response()
+	calls := response.Choices[0].Message.ToolCalls
+	if len(calls) != 2 || calls[1].ID != "call_2" || calls[1].Function.Arguments != `{"command":"go test ./..."}` {
+		t.Fatalf("tool calls were not reassembled: %+v", calls)
+	}
+	if response.Usage.TotalTokens != 120 {
+		t.Errorf("expected usage in the last chunk, got %+v", response.Usage)
+	}
+
+	messages = append(messages, response.Choices[0].Message,
+		llm.Message{Role: "tool", ToolCallId: "call_1", Content: "package a"},
+		llm.Message{Role: "tool", ToolCallId: "call_2", Content: "ok"})
+	reply, err := client.Chat(context.Background(), &llm.ChatRequest{Messages: messages, Config: config}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Choices[0].Message.Content != "All tests pass." {
+		t.Errorf("unexpected reply %+v", reply.Choices[0].Message)
+	}
+
+	server.AssertDone()
+	if requests := server.Requests(); len(requests) != 2 || !requests[0].Stream {
+		t.Errorf("expected a streaming and a plain request, got %d", len(requests))
+	}
+}
+
+func TestClient_Install(t *testing.T) {
+	client := NewClient(t, Reply("hello"), Fail(503)).Install()
+
+	instance, err := llm.GetLLMInstance(llm.BasicModel)
+	if err != nil || instance != client {
+		t.Fatalf("GetLLMInstance() = %v, %v, want the scripted client", instance, err)
+	}
+	request := &llm.ChatRequest{Messages: []llm.Message{{Role: "user", Content: "hi"}}}
+	response, err := instance.Chat(context.Background(), request, "")
+	if err != nil || response.Choices[0].Message.Content != "hello" {
+		t.Fatalf("Chat() = %v, %v", response, err)
+	}
+	if _, err := instance.Chat(context.Background(), request, ""); llm.HTTPStatusCode(err) != 503 {
+		t.Errorf("expected a scripted 503, got %v", err)
+	}
+	client.AssertDone()
+}
+
+func TestVerifyToolCallPairing(t *testing.T) {
+	call := func(ids ...string) llm.Message {
+		msg := llm.Message{Role: "assistant"}
+		for _, id := range ids {
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall(id, "think", nil))
+		}
+		return msg
+	}
+	result := func(id string) llm.Message {
+		return llm.Message{Role: "tool", ToolCallId: id, Content: "done"}
+	}
+	user := llm.Message{Role: "user", Content: "next"}
+
+	tests := []struct {
+		name     string
+		messages []llm.Message
+		problem  string
+	}{
+		{"paired", []llm.Message{user, call("a", "b"), result("b"), result("a"), user}, ""},
+		{"missing result", []llm.Message{call("a", "b"), result("a"), user}, `tool call "b" has no result`},
+		{"orphan result", []llm.Message{user, result("a")}, "does not follow an assistant tool call"},
+		{"interrupted", []llm.Message{call("a"), user, result("a")}, `tool call "a" has no result`},
+		{"wrong id", []llm.Message{call("a"), result("x")}, "does not match a pending tool call"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyToolCallPairing(tt.messages)
+			if tt.problem == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("VerifyToolCallPairing() = %v, want %q", err, tt.problem)
+			}
+		})
+	}
+}
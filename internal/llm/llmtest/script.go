@@ -0,0 +1,229 @@
+// Package llmtest scripts the model for tests: an in-process OpenAI-compatible server and
+// an llm.Client fake that answer a fixed sequence of turns and record every request.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"alex/internal/llm"
+)
+
+// Check inspects a request before its turn is answered; an error fails the test
+type Check func(req *llm.ChatRequest) error
+
+// Turn is one scripted model response and the checks on the request that triggers it
+type Turn struct {
+	// Name identifies the turn in failure messages
+	Name      string
+	Content   string
+	Reasoning string
+	ToolCalls []llm.ToolCall
+	Usage     llm.Usage
+	// Status other than 0 or 200 makes the server answer with an API error
+	Status int
+	Checks []Check
+}
+
+// Reply returns a turn that answers with content and no tool calls
+func Reply(content string) Turn {
+	return Turn{Content: content}
+}
+
+// CallTools returns a turn that asks for the given tool calls
+func CallTools(calls ...llm.ToolCall) Turn {
+	return Turn{ToolCalls: calls}
+}
+
+// Fail returns a turn that answers with an HTTP error status
+func Fail(status int) Turn {
+	return Turn{Status: status}
+}
+
+// ToolCall builds a tool call with args encoded as JSON
+func ToolCall(id, name string, args map[string]any) llm.ToolCall {
+	data, err := json.Marshal(args)
+	if err != nil {
+		panic(fmt.Sprintf("llmtest: cannot encode arguments of %s: %v", name, err))
+	}
+	return llm.ToolCall{ID: id, Type: "function", Function: llm.Function{Name: name, Arguments: string(data)}}
+}
+
+// Named sets the name shown when a check of the turn fails
+func (t Turn) Named(name string) Turn {
+	t.Name = name
+	return t
+}
+
+// Expect adds checks on the request answered by the turn
+func (t Turn) Expect(checks ...Check) Turn {
+	t.Checks = append(append([]Check(nil), t.Checks...), checks...)
+	return t
+}
+
+// WithUsage sets the token usage reported with the response
+func (t Turn) WithUsage(prompt, completion int) Turn {
+	t.Usage = llm.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+	return t
+}
+
+func (t Turn) finishReason() string {
+	if len(t.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// response builds the non-streaming response of the turn
+func (t Turn) response(id, model string) *llm.ChatResponse {
+	return &llm.ChatResponse{
+		ID:     id,
+		Object: "chat.completion",
+		Model:  model,
+		Choices: []llm.Choice{{
+			Message: llm.Message{
+				Role:      "assistant",
+				Content:   t.Content,
+				Reasoning: t.Reasoning,
+				ToolCalls: t.ToolCalls,
+			},
+			FinishReason: t.finishReason(),
+		}},
+		Usage: t.Usage,
+	}
+}
+
+// deltas splits the turn into stream chunks the way providers send them: content in
+// several pieces, each tool call opened with its id and name followed by argument fragments
+func (t Turn) deltas(id, model string) []llm.StreamDelta {
+	chunk := func(delta llm.Message) llm.StreamDelta {
+		return llm.StreamDelta{ID: id, Object: "chat.completion.chunk", Model: model, Choices: []llm.Choice{{Delta: delta}}}
+	}
+
+	deltas := []llm.StreamDelta{chunk(llm.Message{Role: "assistant", Reasoning: t.Reasoning})}
+	for _, piece := range split(t.Content) {
+		deltas = append(deltas, chunk(llm.Message{Content: piece}))
+	}
+	for i, call := range t.ToolCalls {
+		index := i
+		pieces := split(call.Function.Arguments)
+		if len(pieces) == 0 {
+			pieces = []string{""}
+		}
+		first := llm.ToolCall{Index: &index, ID: call.ID, Type: "function", Function: llm.Function{Name: call.Function.Name, Arguments: pieces[0]}}
+		deltas = append(deltas, chunk(llm.Message{ToolCalls: []llm.ToolCall{first}}))
+		for _, piece := range pieces[1:] {
+			next := llm.ToolCall{Index: &index, Function: llm.Function{Arguments: piece}}
+			deltas = append(deltas, chunk(llm.Message{ToolCalls: []llm.ToolCall{next}}))
+		}
+	}
+
+	last := chunk(llm.Message{})
+	last.Choices[0].FinishReason = t.finishReason()
+	last.Usage = t.Usage
+	return append(deltas, last)
+}
+
+// split cuts s into up to three pieces
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	size := max(len(s)/3, 1)
+	var pieces []string
+	for len(s) > size && len(pieces) < 2 {
+		pieces = append(pieces, s[:size])
+		s = s[size:]
+	}
+	return append(pieces, s)
+}
+
+// script hands out turns in order and records the requests that consumed them
+type script struct {
+	t        testing.TB
+	mu       sync.Mutex
+	turns    []Turn
+	next     int
+	requests []*llm.ChatRequest
+}
+
+func newScript(t testing.TB, turns []Turn) *script {
+	return &script{t: t, turns: turns}
+}
+
+// take records req and returns the next turn; ok is false when the script is exhausted
+func (s *script) take(req *llm.ChatRequest) (Turn, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recorded := *req
+	recorded.Messages = append([]llm.Message(nil), req.Messages...)
+	s.requests = append(s.requests, &recorded)
+
+	if s.next >= len(s.turns) {
+		s.t.Errorf("llmtest: unexpected request %d, the script has %d turns; last message: %s",
+			len(s.requests), len(s.turns), describeLast(req))
+		return Turn{}, 0, false
+	}
+	index := s.next
+	turn := s.turns[index]
+	s.next++
+
+	for _, check := range turn.Checks {
+		if err := check(&recorded); err != nil {
+			s.t.Errorf("llmtest: %s: %v", turnName(turn, index), err)
+		}
+	}
+	return turn, index, true
+}
+
+// Add appends turns to the script
+func (s *script) Add(turns ...Turn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns = append(s.turns, turns...)
+}
+
+// Requests returns the requests received so far
+func (s *script) Requests() []*llm.ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*llm.ChatRequest(nil), s.requests...)
+}
+
+// Remaining returns the number of turns not answered yet
+func (s *script) Remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.turns) - s.next
+}
+
+// AssertDone fails the test if some turns were never requested
+func (s *script) AssertDone() {
+	s.t.Helper()
+	if remaining := s.Remaining(); remaining > 0 {
+		s.t.Errorf("llmtest: %d of %d scripted turns were not requested", remaining, len(s.turns))
+	}
+}
+
+func turnName(turn Turn, index int) string {
+	if turn.Name != "" {
+		return fmt.Sprintf("turn %d (%s)", index+1, turn.Name)
+	}
+	return fmt.Sprintf("turn %d", index+1)
+}
+
+func describeLast(req *llm.ChatRequest) string {
+	if len(req.Messages) == 0 {
+		return "none"
+	}
+	last := req.Messages[len(req.Messages)-1]
+	content := last.Content
+	if len(content) > 200 {
+		content = content[:200] + "..."
+	}
+	return fmt.Sprintf("%s %q", last.Role, strings.TrimSpace(content))
+}
@@ -0,0 +1,95 @@
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"alex/internal/llm"
+)
+
+// Server is an OpenAI-compatible chat completions endpoint that answers from a script.
+// Streaming requests get SSE chunks, others a JSON response.
+type Server struct {
+	*script
+	server *httptest.Server
+	// URL is the base URL to configure as the model endpoint
+	URL string
+}
+
+// NewServer starts a server answering turns in order; it is closed when the test ends
+func NewServer(t testing.TB, turns ...Turn) *Server {
+	s := &Server{script: newScript(t, turns)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// ModelConfig returns a model config pointing at the server
+func (s *Server) ModelConfig(model string) *llm.ModelConfig {
+	return &llm.ModelConfig{BaseURL: s.URL, APIKey: "llmtest", Model: model}
+}
+
+// Close shuts the server down, e.g. to test offline behavior
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		s.t.Errorf("llmtest: unexpected %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+
+	var req llm.ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.t.Errorf("llmtest: cannot decode request: %v", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	turn, index, ok := s.take(&req)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "llmtest: script exhausted")
+		return
+	}
+	if turn.Status != 0 && turn.Status != http.StatusOK {
+		writeError(w, turn.Status, fmt.Sprintf("llmtest: scripted error for %s", turnName(turn, index)))
+		return
+	}
+
+	id := fmt.Sprintf("chatcmpl-%d", index+1)
+	if !req.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(turn.response(id, req.Model))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	for _, delta := range turn.deltas(id, req.Model) {
+		data, err := json.Marshal(delta)
+		if err != nil {
+			s.t.Errorf("llmtest: cannot encode stream chunk: %v", err)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{"message": message, "type": "llmtest_error"},
+	})
+}
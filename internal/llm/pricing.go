@@ -0,0 +1,147 @@
+package llm
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	// CachedInput is the price of prompt tokens served from cache; 0 means same as Input
+	CachedInput float64 `json:"cached_input,omitempty"`
+}
+
+// Cost returns the USD cost of one call with the given usage
+func (p ModelPrice) Cost(usage Usage) float64 {
+	cached := min(usage.GetCachedTokens(), usage.PromptTokens)
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	return (float64(usage.PromptTokens-cached)*p.Input +
+		float64(cached)*cachedPrice +
+		float64(usage.CompletionTokens)*p.Output) / 1_000_000
+}
+
+// fallbackModelPrice is used for models missing from the price table
+var fallbackModelPrice = ModelPrice{Input: 1.0, Output: 3.0}
+
+// defaultModelPrices is keyed by provider/model. Dated or versioned model names
+// match the longest key they start with, e.g. claude-3-5-sonnet-20241022.
+var defaultModelPrices = map[string]ModelPrice{
+	"openai/gpt-4o":               {Input: 2.5, Output: 10, CachedInput: 1.25},
+	"openai/gpt-4o-mini":          {Input: 0.15, Output: 0.6, CachedInput: 0.075},
+	"openai/gpt-4.1":              {Input: 2, Output: 8, CachedInput: 0.5},
+	"openai/gpt-4.1-mini":         {Input: 0.4, Output: 1.6, CachedInput: 0.1},
+	"openai/o3":                   {Input: 2, Output: 8, CachedInput: 0.5},
+	"openai/o3-mini":              {Input: 1.1, Output: 4.4, CachedInput: 0.55},
+	"openai/o4-mini":              {Input: 1.1, Output: 4.4, CachedInput: 0.275},
+	"anthropic/claude-3-5-haiku":  {Input: 0.8, Output: 4, CachedInput: 0.08},
+	"anthropic/claude-3-5-sonnet": {Input: 3, Output: 15, CachedInput: 0.3},
+	"anthropic/claude-3-7-sonnet": {Input: 3, Output: 15, CachedInput: 0.3},
+	"anthropic/claude-sonnet-4":   {Input: 3, Output: 15, CachedInput: 0.3},
+	"anthropic/claude-opus-4":     {Input: 15, Output: 75, CachedInput: 1.5},
+	"google/gemini-2.5-pro":       {Input: 1.25, Output: 10, CachedInput: 0.31},
+	"google/gemini-2.5-flash":     {Input: 0.3, Output: 2.5, CachedInput: 0.075},
+	"deepseek/deepseek-chat":      {Input: 0.27, Output: 1.1, CachedInput: 0.07},
+	"deepseek/deepseek-v3":        {Input: 0.27, Output: 1.1, CachedInput: 0.07},
+	"deepseek/deepseek-reasoner":  {Input: 0.55, Output: 2.19, CachedInput: 0.14},
+	"deepseek/deepseek-r1":        {Input: 0.55, Output: 2.19, CachedInput: 0.14},
+	"moonshotai/kimi-k2":          {Input: 0.6, Output: 2.5, CachedInput: 0.15},
+}
+
+// PricingRegistry looks up model prices, with user overrides taking precedence over the defaults
+type PricingRegistry struct {
+	mu        sync.RWMutex
+	overrides map[string]ModelPrice
+}
+
+// NewPricingRegistry creates a registry with the built-in price table
+func NewPricingRegistry() *PricingRegistry {
+	return &PricingRegistry{overrides: make(map[string]ModelPrice)}
+}
+
+// SetOverrides replaces the user price overrides, keyed by provider/model or model
+func (r *PricingRegistry) SetOverrides(overrides map[string]ModelPrice) {
+	normalized := make(map[string]ModelPrice, len(overrides))
+	for model, price := range overrides {
+		normalized[strings.ToLower(model)] = price
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overrides = normalized
+}
+
+// Lookup returns the price of model and whether it is known
+func (r *PricingRegistry) Lookup(model string) (ModelPrice, bool) {
+	name := strings.ToLower(strings.TrimSpace(model))
+	if name == "" {
+		return ModelPrice{}, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if price, ok := r.overrides[name]; ok {
+		return price, true
+	}
+	// OpenRouter 的免费模型不计费
+	if strings.HasSuffix(name, ":free") {
+		return ModelPrice{}, true
+	}
+	if i := strings.Index(name, ":"); i > 0 {
+		name = name[:i]
+	}
+	if price, ok := matchModel(r.overrides, name); ok {
+		return price, true
+	}
+	return matchModel(defaultModelPrices, name)
+}
+
+// Cost returns the USD cost of one call, using a conservative default price for unknown models
+func (r *PricingRegistry) Cost(model string, usage Usage) float64 {
+	price, ok := r.Lookup(model)
+	if !ok {
+		price = fallbackModelPrice
+	}
+	return price.Cost(usage)
+}
+
+// matchModel matches name exactly, then by the longest model key it starts with,
+// ignoring provider prefixes on both sides
+func matchModel[T any](table map[string]T, name string) (T, bool) {
+	if value, ok := table[name]; ok {
+		return value, true
+	}
+
+	bare := name[strings.LastIndex(name, "/")+1:]
+	var best string
+	var bestValue T
+	for key, value := range table {
+		keyModel := key[strings.LastIndex(key, "/")+1:]
+		if strings.HasPrefix(bare, keyModel) && len(keyModel) > len(best) {
+			best, bestValue = keyModel, value
+		}
+	}
+	return bestValue, best != ""
+}
+
+var defaultPricing = NewPricingRegistry()
+
+// ConfigurePricing sets the user price overrides used by CallCost
+func ConfigurePricing(overrides map[string]ModelPrice) {
+	defaultPricing.SetOverrides(overrides)
+}
+
+// LookupPrice returns the configured price of model and whether it is known
+func LookupPrice(model string) (ModelPrice, bool) {
+	return defaultPricing.Lookup(model)
+}
+
+// CallCost returns the USD cost of one LLM call to model
+func CallCost(model string, usage Usage) float64 {
+	return defaultPricing.Cost(model, usage)
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestPricingRegistry_Lookup(t *testing.T) {
+	registry := NewPricingRegistry()
+
+	tests := []struct {
+		model string
+		want  ModelPrice
+		known bool
+	}{
+		{"deepseek/deepseek-chat", defaultModelPrices["deepseek/deepseek-chat"], true},
+		{"deepseek-chat-v3-0324", defaultModelPrices["deepseek/deepseek-chat"], true},
+		{"claude-3-5-sonnet-20241022", defaultModelPrices["anthropic/claude-3-5-sonnet"], true},
+		{"openai/gpt-4o-mini-2024-07-18", defaultModelPrices["openai/gpt-4o-mini"], true},
+		{"deepseek/deepseek-chat-v3-0324:free", ModelPrice{}, true},
+		{"some-local-model", ModelPrice{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got, known := registry.Lookup(tt.model)
+			if got != tt.want || known != tt.known {
+				t.Errorf("Lookup(%q) = %+v, %v; want %+v, %v", tt.model, got, known, tt.want, tt.known)
+			}
+		})
+	}
+}
+
+func TestPricingRegistry_Overrides(t *testing.T) {
+	registry := NewPricingRegistry()
+	registry.SetOverrides(map[string]ModelPrice{
+		"DeepSeek/DeepSeek-Chat": {Input: 1, Output: 2},
+		"my-local-model":         {Input: 0.5, Output: 0.5},
+	})
+
+	if price, _ := registry.Lookup("deepseek-chat-v3-0324"); price.Input != 1 || price.Output != 2 {
+		t.Errorf("expected override to take precedence, got %+v", price)
+	}
+	if price, known := registry.Lookup("my-local-model"); !known || price.Input != 0.5 {
+		t.Errorf("expected override for unknown model, got %+v, %v", price, known)
+	}
+}
+
+func TestModelPrice_Cost(t *testing.T) {
+	price := ModelPrice{Input: 2, Output: 10, CachedInput: 0.5}
+
+	// OpenAI 格式的缓存命中
+	var usage Usage
+	raw := `{"prompt_tokens":1000000,"completion_tokens":100000,"total_tokens":1100000,"prompt_tokens_details":{"cached_tokens":400000}}`
+	if err := json.Unmarshal([]byte(raw), &usage); err != nil {
+		t.Fatal(err)
+	}
+
+	// 600k * $2 + 400k * $0.5 + 100k * $10
+	want := 1.2 + 0.2 + 1.0
+	if got := price.Cost(usage); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Cost() = %v, want %v", got, want)
+	}
+
+	// 未设置缓存价格时按输入价格计费
+	uncached := ModelPrice{Input: 2, Output: 10}
+	if got := uncached.Cost(Usage{PromptTokens: 1000000, CachedTokens: 500000}); math.Abs(got-2) > 1e-9 {
+		t.Errorf("expected cached tokens at the input price, got %v", got)
+	}
+}
+
+func TestCallCost_UnknownModelUsesFallbackPrice(t *testing.T) {
+	usage := Usage{PromptTokens: 1000000, CompletionTokens: 1000000}
+	want := fallbackModelPrice.Input + fallbackModelPrice.Output
+	if got := CallCost("unknown-model", usage); math.Abs(got-want) > 1e-9 {
+		t.Errorf("CallCost() = %v, want %v", got, want)
+	}
+}
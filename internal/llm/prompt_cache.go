@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"log"
+	"sync"
+)
+
+// CacheablePrefixMessages is the number of conversation messages after the system prompt
+// that stay stable across requests; context compression never rewrites them
+const CacheablePrefixMessages = 4
+
+// PromptCacheControl marks the stable prefix of a request. Providers with explicit
+// caching translate it into their own breakpoints.
+type PromptCacheControl struct {
+	// PrefixMessages is the number of leading messages, system messages included, in the stable prefix
+	PrefixMessages int
+	// Tools is true when the tool definitions belong to the cached prefix
+	Tools bool
+}
+
+// PromptCacheStrategy lets a provider reuse the stable system+tool prefix of a conversation
+type PromptCacheStrategy interface {
+	// Style returns the caching style implemented by the strategy
+	Style() CacheStyle
+	// Prepare marks the cacheable prefix of req and returns extra HTTP headers to send
+	Prepare(req *ChatRequest, sessionID, apiKey string) map[string]string
+	// Release drops any provider-side cache held for the session
+	Release(sessionID, apiKey string) error
+}
+
+// CacheablePrefixLen returns how many leading messages form the stable prefix: the
+// system messages plus CacheablePrefixMessages messages, never splitting a tool call
+// from its results
+func CacheablePrefixLen(messages []Message) int {
+	end := 0
+	for end < len(messages) && messages[end].Role == "system" {
+		end++
+	}
+	end = min(end+CacheablePrefixMessages, len(messages))
+
+	// 工具结果必须紧跟对应的工具调用，前缀不能停在两者之间
+	for end > 0 && end < len(messages) && messages[end].Role == "tool" {
+		end--
+	}
+	if end > 0 && messages[end-1].Role == "assistant" && len(messages[end-1].ToolCalls) > 0 {
+		end--
+	}
+	return end
+}
+
+// markPrefix records the stable prefix of req in req.CacheControl
+func markPrefix(req *ChatRequest) {
+	if prefix := CacheablePrefixLen(req.Messages); prefix > 0 {
+		req.CacheControl = &PromptCacheControl{PrefixMessages: prefix, Tools: len(req.Tools) > 0}
+	}
+}
+
+// NoPromptCache is used for providers without prompt caching
+type NoPromptCache struct{}
+
+func (NoPromptCache) Style() CacheStyle { return CacheStyleNone }
+
+func (NoPromptCache) Prepare(*ChatRequest, string, string) map[string]string { return nil }
+
+func (NoPromptCache) Release(string, string) error { return nil }
+
+// PrefixPromptCache covers providers that cache identical prompt prefixes automatically
+// (OpenAI, DeepSeek). Nothing is sent; hits depend on the prefix staying byte-identical.
+type PrefixPromptCache struct{}
+
+func (PrefixPromptCache) Style() CacheStyle { return CacheStylePrefix }
+
+func (PrefixPromptCache) Prepare(req *ChatRequest, _, _ string) map[string]string {
+	markPrefix(req)
+	return nil
+}
+
+func (PrefixPromptCache) Release(string, string) error { return nil }
+
+// AnthropicPromptCache places cache_control breakpoints on the tools, the system prompt,
+// the end of the stable prefix and the latest message
+type AnthropicPromptCache struct{}
+
+func (AnthropicPromptCache) Style() CacheStyle { return CacheStyleControl }
+
+func (AnthropicPromptCache) Prepare(req *ChatRequest, _, _ string) map[string]string {
+	markPrefix(req)
+	return nil
+}
+
+func (AnthropicPromptCache) Release(string, string) error { return nil }
+
+// KimiPromptCache uploads the stable prefix to the Kimi context cache API and
+// references it by header
+type KimiPromptCache struct {
+	manager *KimiCacheManager
+}
+
+// NewKimiPromptCache wraps a Kimi cache manager
+func NewKimiPromptCache(manager *KimiCacheManager) *KimiPromptCache {
+	return &KimiPromptCache{manager: manager}
+}
+
+func (k *KimiPromptCache) Style() CacheStyle { return CacheStyleKimi }
+
+func (k *KimiPromptCache) Prepare(req *ChatRequest, sessionID, apiKey string) map[string]string {
+	if sessionID == "" || len(req.Messages) == 0 {
+		log.Printf("[DEBUG] KimiPromptCache: no session, cache will not be used")
+		return nil
+	}
+	markPrefix(req)
+
+	// 尝试为当前的 messages 和 tools 创建或重用缓存
+	if _, err := k.manager.CreateCacheIfNeeded(sessionID, req.Messages, req.Tools, apiKey); err != nil {
+		log.Printf("[WARN] KimiPromptCache: failed to create/reuse cache: %v", err)
+	}
+	// 校验前缀和工具一致后才使用缓存
+	return k.manager.PrepareRequestWithCache(sessionID, req)
+}
+
+func (k *KimiPromptCache) Release(sessionID, apiKey string) error {
+	return k.manager.DeleteCache(sessionID, apiKey)
+}
+
+// sharedKimiCache is used by every OpenAI-compatible client so a session owns one Kimi cache
+var sharedKimiCache = struct {
+	once    sync.Once
+	manager *KimiCacheManager
+}{}
+
+func kimiCacheManager() *KimiCacheManager {
+	sharedKimiCache.once.Do(func() {
+		sharedKimiCache.manager = NewKimiCacheManager(nil)
+	})
+	return sharedKimiCache.manager
+}
+
+// PromptCacheFor returns the caching strategy for model served through the
+// OpenAI-compatible API at baseURL
+func PromptCacheFor(baseURL, model string) PromptCacheStrategy {
+	if IsKimiAPI(baseURL) {
+		return NewKimiPromptCache(kimiCacheManager())
+	}
+	switch LookupCapabilities(model).CacheStyle {
+	case CacheStylePrefix:
+		return PrefixPromptCache{}
+	default:
+		// cache_control 与 Kimi 缓存需要各自的原生 API
+		return NoPromptCache{}
+	}
+}
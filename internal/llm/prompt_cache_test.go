@@ -0,0 +1,91 @@
+package llm
+
+import "testing"
+
+func TestCacheablePrefixLen(t *testing.T) {
+	toolCall := []ToolCall{{ID: "call_1", Type: "function", Function: Function{Name: "file_read", Arguments: "{}"}}}
+
+	tests := []struct {
+		name     string
+		messages []Message
+		want     int
+	}{
+		{"empty", nil, 0},
+		{"short conversation", []Message{{Role: "system"}, {Role: "user"}, {Role: "assistant"}}, 3},
+		{
+			"system plus four",
+			[]Message{{Role: "system"}, {Role: "user"}, {Role: "assistant"}, {Role: "user"}, {Role: "assistant"}, {Role: "user"}},
+			5,
+		},
+		{
+			"does not split tool call from result",
+			[]Message{{Role: "system"}, {Role: "user"}, {Role: "assistant"}, {Role: "user"}, {Role: "assistant", ToolCalls: toolCall}, {Role: "tool", ToolCallId: "call_1"}},
+			4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CacheablePrefixLen(tt.messages); got != tt.want {
+				t.Errorf("CacheablePrefixLen() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptCacheFor(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		model   string
+		want    CacheStyle
+	}{
+		{"https://api.moonshot.cn/v1", "kimi-k2-0711-preview", CacheStyleKimi},
+		{"https://api.openai.com/v1", "gpt-4o", CacheStylePrefix},
+		{"https://api.deepseek.com/v1", "deepseek-chat", CacheStylePrefix},
+		{"https://openrouter.ai/api/v1", "anthropic/claude-sonnet-4", CacheStyleNone},
+		{"https://example.com/v1", "unknown-model", CacheStyleNone},
+	}
+	for _, tt := range tests {
+		if got := PromptCacheFor(tt.baseURL, tt.model).Style(); got != tt.want {
+			t.Errorf("PromptCacheFor(%q, %q) = %s, want %s", tt.baseURL, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestAnthropicPromptCache_Breakpoints(t *testing.T) {
+	req := &ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "sys"},
+			{Role: "user", Content: "task"},
+			{Role: "assistant", Content: "plan"},
+			{Role: "user", Content: "more"},
+			{Role: "assistant", Content: "ok"},
+			{Role: "user", Content: "latest"},
+		},
+		Tools: []Tool{{Type: "function", Function: Function{Name: "file_read"}}},
+	}
+	AnthropicPromptCache{}.Prepare(req, "", "")
+	if req.CacheControl == nil || req.CacheControl.PrefixMessages != 5 || !req.CacheControl.Tools {
+		t.Fatalf("unexpected cache control: %+v", req.CacheControl)
+	}
+
+	body := buildAnthropicRequest(req, "claude-test", 0)
+	if body.System[0].CacheControl == nil {
+		t.Error("system prompt should end a cache breakpoint")
+	}
+	if body.Tools[0].CacheControl != nil {
+		t.Error("tools are covered by the system breakpoint")
+	}
+
+	var marked []int
+	for i, msg := range body.Messages {
+		for _, block := range msg.Content {
+			if block.CacheControl != nil {
+				marked = append(marked, i)
+			}
+		}
+	}
+	// 稳定前缀结束于第 4 条对话消息，另一个断点在最新消息上
+	if len(marked) != 2 || marked[0] != 3 || marked[1] != 4 {
+		t.Errorf("breakpoints on messages %v, want [3 4]", marked)
+	}
+}
@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Provider names known to the factory
+const (
+	ProviderOpenAI          = "openai"
+	ProviderOpenAIResponses = "openai-responses"
+	ProviderAnthropic       = "anthropic"
+	ProviderGemini          = "gemini"
+)
+
+// OpenAI endpoints selectable with the api config field
+const (
+	APIChatCompletions = "chat_completions"
+	APIResponses       = "responses"
+)
+
+var providers = map[string]Provider{
+	ProviderOpenAI:          &openAIProvider{},
+	ProviderOpenAIResponses: &openAIResponsesProvider{},
+	ProviderAnthropic:       &anthropicProvider{},
+	ProviderGemini:          &geminiProvider{},
+}
+
+// DetectProviderName returns the provider that serves the given base URL.
+// Everything that is not recognized is treated as OpenAI-compatible.
+func DetectProviderName(baseURL string) string {
+	if IsAnthropicAPI(baseURL) {
+		return ProviderAnthropic
+	}
+	if IsGeminiAPI(baseURL) {
+		return ProviderGemini
+	}
+	return ProviderOpenAI
+}
+
+// GetProvider returns a registered provider by name
+func GetProvider(name string) (Provider, bool) {
+	provider, ok := providers[name]
+	return provider, ok
+}
+
+// ProviderForConfig returns the provider that should handle config. The api field picks
+// the Responses API; otherwise the provider is detected from the base URL.
+func ProviderForConfig(config *Config) Provider {
+	if config != nil {
+		if config.API == APIResponses {
+			return providers[ProviderOpenAIResponses]
+		}
+		if provider, ok := providers[DetectProviderName(config.BaseURL)]; ok {
+			return provider
+		}
+	}
+	return providers[ProviderOpenAI]
+}
+
+// IsAnthropicAPI checks if the base URL is the Anthropic Messages API
+func IsAnthropicAPI(baseURL string) bool {
+	return strings.Contains(baseURL, "api.anthropic.com")
+}
+
+// IsGeminiAPI checks if the base URL is the Gemini API, native or OpenAI-compatible
+func IsGeminiAPI(baseURL string) bool {
+	return strings.Contains(baseURL, "generativelanguage.googleapis.com")
+}
+
+// openAIProvider serves OpenAI-compatible chat completion endpoints
+type openAIProvider struct{}
+
+func (p *openAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+func (p *openAIProvider) CreateClient(config *Config) (Client, error) {
+	// HTTPLLMClient resolves the model config per request
+	return NewHTTPClient()
+}
+
+func (p *openAIProvider) ValidateConfig(config *Config) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	return nil
+}
+
+// openAIResponsesProvider serves the OpenAI Responses API
+type openAIResponsesProvider struct{}
+
+func (p *openAIResponsesProvider) Name() string {
+	return ProviderOpenAIResponses
+}
+
+func (p *openAIResponsesProvider) CreateClient(config *Config) (Client, error) {
+	return NewResponsesClient(config)
+}
+
+func (p *openAIResponsesProvider) ValidateConfig(config *Config) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	if config.APIKey == "" {
+		return fmt.Errorf("api key is required")
+	}
+	return nil
+}
+
+// anthropicProvider serves the native Anthropic Messages API
+type anthropicProvider struct{}
+
+func (p *anthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+func (p *anthropicProvider) CreateClient(config *Config) (Client, error) {
+	return NewAnthropicClient(config)
+}
+
+func (p *anthropicProvider) ValidateConfig(config *Config) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	if config.APIKey == "" {
+		return fmt.Errorf("api key is required")
+	}
+	if config.ThinkingBudget != 0 && config.ThinkingBudget < anthropicMinThinkingBudget {
+		return fmt.Errorf("thinking budget must be at least %d tokens", anthropicMinThinkingBudget)
+	}
+	return nil
+}
+
+// geminiProvider serves the native Gemini generateContent API
+type geminiProvider struct{}
+
+func (p *geminiProvider) Name() string {
+	return ProviderGemini
+}
+
+func (p *geminiProvider) CreateClient(config *Config) (Client, error) {
+	return NewGeminiClient(config)
+}
+
+func (p *geminiProvider) ValidateConfig(config *Config) error {
+	if config == nil {
+		return fmt.Errorf("config cannot be nil")
+	}
+	if config.APIKey == "" {
+		return fmt.Errorf("api key is required")
+	}
+	return nil
+}
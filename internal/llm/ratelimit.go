@@ -0,0 +1,262 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimits are client-side request and token limits for one provider (0 means unlimited)
+type RateLimits struct {
+	RequestsPerMinute int `json:"requests_per_minute,omitempty" yaml:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty" yaml:"tokens_per_minute,omitempty"`
+}
+
+// RateLimitError is returned when a provider rejects a request with HTTP 429
+type RateLimitError struct {
+	StatusCode int
+	// RetryAfter is the delay suggested by the server, 0 if none was sent
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *RateLimitError) Error() string {
+	// 保持 "HTTP error XXX:" 格式以便按状态码分类
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("HTTP error %d: rate limited, retry after %v: %s", e.StatusCode, e.RetryAfter, e.Body)
+	}
+	return fmt.Sprintf("HTTP error %d: rate limited: %s", e.StatusCode, e.Body)
+}
+
+// tokenBucket refills continuously up to capacity. Reservations may drive it negative;
+// the debt is the time the caller has to wait.
+type tokenBucket struct {
+	capacity   float64
+	tokens     float64
+	ratePerSec float64
+	last       time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity:   float64(perMinute),
+		tokens:     float64(perMinute),
+		ratePerSec: float64(perMinute) / 60,
+		last:       time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.ratePerSec
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// reserve takes n tokens and returns how long to wait until they are available
+func (b *tokenBucket) reserve(n float64, now time.Time) time.Duration {
+	b.refill(now)
+	// 超过容量的单个请求最多等待一个完整周期
+	if n > b.capacity {
+		n = b.capacity
+	}
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.ratePerSec * float64(time.Second))
+}
+
+// RateLimiter throttles all requests to one provider across clients and goroutines
+type RateLimiter struct {
+	mu           sync.Mutex
+	configured   bool
+	limits       RateLimits
+	requests     *tokenBucket
+	tokens       *tokenBucket
+	blockedUntil time.Time
+}
+
+// NewRateLimiter creates a limiter with the given per-minute limits
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits replaces the limits; buckets are only reset when the limits change
+func (l *RateLimiter) SetLimits(limits RateLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.configured && l.limits == limits {
+		return
+	}
+	l.configured = true
+	l.limits = limits
+	l.requests = newTokenBucket(limits.RequestsPerMinute)
+	l.tokens = newTokenBucket(limits.TokensPerMinute)
+}
+
+// Wait blocks until one request with the estimated token count may be sent
+func (l *RateLimiter) Wait(ctx context.Context, estimatedTokens int) error {
+	l.mu.Lock()
+	now := time.Now()
+	var wait time.Duration
+	if l.blockedUntil.After(now) {
+		wait = l.blockedUntil.Sub(now)
+	}
+	if l.requests != nil {
+		wait = max(wait, l.requests.reserve(1, now))
+	}
+	if l.tokens != nil {
+		wait = max(wait, l.tokens.reserve(float64(estimatedTokens), now))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	log.Printf("[DEBUG] RateLimiter: waiting %v before sending request", wait)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Penalize holds back every request to the provider for d, e.g. after a 429 with Retry-After
+func (l *RateLimiter) Penalize(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// Settle corrects the token bucket once the actual usage of a request is known
+func (l *RateLimiter) Settle(reserved int, usage Usage) {
+	if usage.TotalTokens == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens == nil {
+		return
+	}
+	l.tokens.refill(time.Now())
+	l.tokens.tokens -= float64(usage.TotalTokens - reserved)
+	if l.tokens.tokens > l.tokens.capacity {
+		l.tokens.tokens = l.tokens.capacity
+	}
+}
+
+// rateLimiters are shared per provider host by every client in the process
+var rateLimiters = struct {
+	sync.Mutex
+	byHost map[string]*RateLimiter
+}{byHost: make(map[string]*RateLimiter)}
+
+// providerHost reduces a base URL to the host used as the rate-limit key
+func providerHost(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return baseURL
+	}
+	return u.Host
+}
+
+// ConfigureRateLimits sets the limits per provider, keyed by host or base URL
+func ConfigureRateLimits(limits map[string]RateLimits) {
+	for provider, providerLimits := range limits {
+		rateLimiterFor(provider).SetLimits(providerLimits)
+	}
+}
+
+// rateLimiterFor returns the limiter of the provider serving baseURL
+func rateLimiterFor(baseURL string) *RateLimiter {
+	host := providerHost(baseURL)
+
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+
+	limiter, ok := rateLimiters.byHost[host]
+	if !ok {
+		limiter = NewRateLimiter(RateLimits{})
+		rateLimiters.byHost[host] = limiter
+	}
+	return limiter
+}
+
+// estimateRequestTokens roughly estimates the prompt size of req (~4 chars per token)
+func estimateRequestTokens(req *ChatRequest) int {
+	chars := 0
+	for _, msg := range req.Messages {
+		chars += len(msg.Content) + len(msg.Reasoning)
+		for _, tc := range msg.ToolCalls {
+			chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+	}
+	return chars/4 + 1
+}
+
+// waitForRateLimit blocks until the provider serving baseURL may accept req.
+// It returns the limiter and the number of tokens reserved for the request.
+func waitForRateLimit(ctx context.Context, baseURL string, req *ChatRequest) (*RateLimiter, int, error) {
+	limiter := rateLimiterFor(baseURL)
+	reserved := estimateRequestTokens(req)
+	if err := limiter.Wait(ctx, reserved); err != nil {
+		return nil, 0, fmt.Errorf("rate limit wait cancelled: %w", err)
+	}
+	return limiter, reserved, nil
+}
+
+// newHTTPError builds the error for a non-200 response. Rate-limit responses become a
+// RateLimitError and hold back further requests to the provider for the suggested delay.
+func newHTTPError(limiter *RateLimiter, resp *http.Response, body []byte) error {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+	}
+
+	retryAfter := parseRetryAfter(resp.Header)
+	if limiter != nil {
+		limiter.Penalize(retryAfter)
+	}
+	return &RateLimitError{StatusCode: resp.StatusCode, RetryAfter: retryAfter, Body: string(body)}
+}
+
+// parseRetryAfter reads retry-after-ms or Retry-After (seconds or HTTP date)
+func parseRetryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_RequestsPerMinute(t *testing.T) {
+	// 每分钟 600 次 => 每 100ms 补充一次
+	limiter := NewRateLimiter(RateLimits{RequestsPerMinute: 600})
+	limiter.requests.tokens = 1
+
+	ctx := context.Background()
+	start := time.Now()
+	if err := limiter.Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected first request to pass immediately, waited %v", elapsed)
+	}
+
+	start = time.Now()
+	if err := limiter.Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("expected second request to wait for a refill, waited %v", elapsed)
+	}
+}
+
+func TestRateLimiter_PenalizeAndCancel(t *testing.T) {
+	limiter := NewRateLimiter(RateLimits{})
+	limiter.Penalize(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected wait to be cancelled, got %v", err)
+	}
+}
+
+func TestRateLimiter_SettleCorrectsTokenEstimate(t *testing.T) {
+	limiter := NewRateLimiter(RateLimits{TokensPerMinute: 1000})
+	if err := limiter.Wait(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+	limiter.Settle(100, Usage{TotalTokens: 400})
+	if tokens := limiter.tokens.tokens; tokens > 601 || tokens < 599 {
+		t.Errorf("expected ~600 tokens left after settling, got %v", tokens)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"missing", http.Header{}, 0},
+		{"seconds", http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{"milliseconds", http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"9"}}, 1500 * time.Millisecond},
+		{"invalid", http.Header{"Retry-After": {"soon"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header); got != tt.want {
+				t.Errorf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(http.Header{"Retry-After": {date}}); got <= 0 || got > 10*time.Second {
+		t.Errorf("expected HTTP date to give a positive delay, got %v", got)
+	}
+}
+
+func TestHTTPClient_RateLimitError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &ChatRequest{
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		Config:   &Config{BaseURL: server.URL, APIKey: "key", Model: "test-model"},
+	}
+
+	_, err = client.Chat(context.Background(), req, "")
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("expected RateLimitError, got %v", err)
+	}
+	if rateErr.RetryAfter != 2*time.Second {
+		t.Errorf("expected 2s retry delay, got %v", rateErr.RetryAfter)
+	}
+	if HTTPStatusCode(err) != http.StatusTooManyRequests {
+		t.Errorf("expected status 429 to be classifiable, got %d", HTTPStatusCode(err))
+	}
+
+	limiter := rateLimiterFor(server.URL)
+	limiter.mu.Lock()
+	blocked := time.Until(limiter.blockedUntil)
+	limiter.mu.Unlock()
+	if blocked <= time.Second {
+		t.Errorf("expected provider limiter to be held back, remaining %v", blocked)
+	}
+}
@@ -0,0 +1,43 @@
+package llm
+
+// reasoningMessages returns messages as they should be sent to model over the
+// OpenAI-compatible API: reasoning of earlier assistant turns is moved to the model's
+// reasoning field when the model wants it back, and dropped otherwise. Fields that
+// only exist locally are never sent. messages is not modified.
+func reasoningMessages(messages []Message, model string) []Message {
+	caps := LookupCapabilities(model)
+	field := ""
+	if caps.SendReasoning {
+		field = caps.ReasoningField
+	}
+
+	var result []Message
+	for i, msg := range messages {
+		if msg.Reasoning == "" && msg.ReasoningSummary == "" && msg.Think == "" && msg.ThinkingSignature == "" && msg.ReasoningContent == "" {
+			continue
+		}
+		// 只在需要修改时复制，避免影响调用方持有的消息
+		if result == nil {
+			result = append([]Message(nil), messages...)
+		}
+
+		out := &result[i]
+		reasoning := out.Reasoning
+		out.Reasoning, out.ReasoningContent = "", ""
+		out.ReasoningSummary, out.Think, out.ThinkingSignature = "", "", ""
+		if out.Role != "assistant" {
+			continue
+		}
+		switch field {
+		case "reasoning_content":
+			out.ReasoningContent = reasoning
+		case "reasoning":
+			out.Reasoning = reasoning
+		}
+	}
+
+	if result == nil {
+		return messages
+	}
+	return result
+}
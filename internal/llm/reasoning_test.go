@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessage_UnmarshalReasoningContent(t *testing.T) {
+	var delta StreamDelta
+	data := `{"choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"Let me think"}}]}`
+	if err := json.Unmarshal([]byte(data), &delta); err != nil {
+		t.Fatal(err)
+	}
+	if got := delta.Choices[0].Delta; got.Reasoning != "Let me think" || got.ReasoningContent != "" {
+		t.Errorf("expected reasoning_content in Reasoning, got %+v", got)
+	}
+
+	// OpenRouter 使用 reasoning 字段
+	var msg Message
+	if err := json.Unmarshal([]byte(`{"role":"assistant","content":"hi","reasoning":"because"}`), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Reasoning != "because" || msg.Content != "hi" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+}
+
+func TestStreamAccumulator_ReasoningContent(t *testing.T) {
+	accumulator := NewStreamAccumulator()
+	for _, data := range []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"step 1, "}}]}`,
+		`{"choices":[{"index":0,"delta":{"reasoning_content":"step 2"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"answer"},"finish_reason":"stop"}]}`,
+	} {
+		var delta StreamDelta
+		if err := json.Unmarshal([]byte(data), &delta); err != nil {
+			t.Fatal(err)
+		}
+		accumulator.Add(delta)
+	}
+
+	message := accumulator.Response().Choices[0].Message
+	if message.Reasoning != "step 1, step 2" || message.Content != "answer" {
+		t.Errorf("unexpected accumulated message %+v", message)
+	}
+}
+
+func TestReasoningMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello", Reasoning: "greet back", Think: "local only"},
+	}
+
+	tests := []struct {
+		model string
+		want  string
+	}{
+		// DeepSeek 拒绝回传的 reasoning_content
+		{"deepseek-reasoner", `{"role":"assistant","content":"hello"}`},
+		{"kimi-k2-thinking", `{"role":"assistant","content":"hello","reasoning_content":"greet back"}`},
+		{"gpt-4o", `{"role":"assistant","content":"hello"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got := reasoningMessages(messages, tt.model)
+			data, _ := json.Marshal(got[1])
+			if string(data) != tt.want {
+				t.Errorf("reasoningMessages() sent %s, want %s", data, tt.want)
+			}
+		})
+	}
+
+	if messages[1].Reasoning != "greet back" || messages[1].Think != "local only" {
+		t.Error("reasoningMessages must not modify its input")
+	}
+	plain := []Message{{Role: "user", Content: "hi"}}
+	if got := reasoningMessages(plain, "deepseek-reasoner"); &got[0] != &plain[0] {
+		t.Error("messages without reasoning should be returned as is")
+	}
+	if strings.Contains(mustJSON(t, reasoningMessages(messages, "")), "think") {
+		t.Error("think is never sent")
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,725 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ResponseChain links a conversation to the last response stored by the provider, so the
+// next request sends previous_response_id and only the messages added since
+type ResponseChain struct {
+	ResponseID string `json:"response_id"`
+	Model      string `json:"model"`
+	// Messages is the number of conversation messages the response covers, its output included;
+	// leading system messages are not counted because instructions are sent with every request
+	Messages int `json:"messages"`
+	// Fingerprint identifies those messages; the chain is only used while a request starts with them
+	Fingerprint string `json:"fingerprint"`
+}
+
+// ResponsesClient talks to the OpenAI Responses API
+type ResponsesClient struct {
+	httpClient    *http.Client
+	config        *Config
+	streamEnabled bool
+}
+
+// NewResponsesClient creates a Responses API client for config
+func NewResponsesClient(config *Config) (*ResponsesClient, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 200 * time.Second
+	}
+
+	return &ResponsesClient{
+		httpClient:    &http.Client{Timeout: timeout},
+		config:        config,
+		streamEnabled: true,
+	}, nil
+}
+
+// responsesRequest is the /responses request body
+type responsesRequest struct {
+	Model              string              `json:"model"`
+	Instructions       string              `json:"instructions,omitempty"`
+	Input              []responsesItem     `json:"input"`
+	Tools              []responsesTool     `json:"tools,omitempty"`
+	ToolChoice         string              `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	Temperature        *float64            `json:"temperature,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	Store              bool                `json:"store"`
+	PreviousResponseID string              `json:"previous_response_id,omitempty"`
+	Reasoning          *responsesReasoning `json:"reasoning,omitempty"`
+	Text               *responsesText      `json:"text,omitempty"`
+}
+
+// responsesItem is an input or output item: a message, a function call, a function call
+// output or reasoning
+type responsesItem struct {
+	Type      string             `json:"type"`
+	ID        string             `json:"id,omitempty"`
+	Role      string             `json:"role,omitempty"`
+	Content   []responsesContent `json:"content,omitempty"`
+	CallID    string             `json:"call_id,omitempty"`
+	Name      string             `json:"name,omitempty"`
+	Arguments string             `json:"arguments,omitempty"`
+	// Output is a pointer because an empty function call output must still be sent
+	Output  *string            `json:"output,omitempty"`
+	Summary []responsesContent `json:"summary,omitempty"`
+	Status  string             `json:"status,omitempty"`
+}
+
+// responsesContent is a content part: input_text, input_image, output_text, refusal,
+// summary_text or reasoning_text
+type responsesContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+}
+
+// responsesTool is a function tool; unlike chat completions the function fields are not nested
+type responsesTool struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type responsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type responsesText struct {
+	Format responsesFormat `json:"format"`
+}
+
+type responsesFormat struct {
+	Type   string          `json:"type"`
+	Name   string          `json:"name,omitempty"`
+	Schema json.RawMessage `json:"schema,omitempty"`
+	Strict bool            `json:"strict,omitempty"`
+}
+
+type responsesResponse struct {
+	ID                string          `json:"id"`
+	Model             string          `json:"model"`
+	CreatedAt         int64           `json:"created_at"`
+	Status            string          `json:"status"`
+	Output            []responsesItem `json:"output"`
+	Usage             *responsesUsage `json:"usage,omitempty"`
+	Error             *responsesError `json:"error,omitempty"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+}
+
+type responsesUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type responsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// responsesEvent is one server-sent event; the payload repeats the event type
+type responsesEvent struct {
+	Type         string             `json:"type"`
+	Response     *responsesResponse `json:"response,omitempty"`
+	Item         *responsesItem     `json:"item,omitempty"`
+	OutputIndex  int                `json:"output_index"`
+	SummaryIndex int                `json:"summary_index"`
+	Delta        string             `json:"delta"`
+	Code         string             `json:"code"`
+	Message      string             `json:"message"`
+}
+
+// Chat sends a request and returns the response
+func (c *ResponsesClient) Chat(ctx context.Context, req *ChatRequest, sessionID string) (*ChatResponse, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	resp, call, err := c.send(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	log.Printf("[DEBUG] Responses API response: %s", string(body))
+
+	var response responsesResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if response.Status == "failed" && response.Error != nil {
+		call.limiter.Settle(call.reserved, Usage{})
+		return nil, fmt.Errorf("response failed: %s: %s", response.Error.Code, response.Error.Message)
+	}
+
+	message := response.message()
+	usage := response.usage()
+	call.limiter.Settle(call.reserved, usage)
+	call.finish(req, response.ID, message)
+
+	return &ChatResponse{
+		ID:      response.ID,
+		Object:  "chat.completion",
+		Created: response.CreatedAt,
+		Model:   response.Model,
+		Choices: []Choice{{Index: 0, Message: message, FinishReason: response.finishReason(message)}},
+		Usage:   usage,
+	}, nil
+}
+
+// ChatStream sends a streaming request and converts the Responses API events into deltas
+func (c *ResponsesClient) ChatStream(ctx context.Context, req *ChatRequest, sessionID string) (<-chan StreamDelta, error) {
+	if req == nil {
+		return nil, fmt.Errorf("request cannot be nil")
+	}
+
+	if !c.streamEnabled {
+		return nil, fmt.Errorf("streaming is disabled")
+	}
+
+	resp, call, err := c.send(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	deltaChannel := make(chan StreamDelta, 1000)
+
+	go func() {
+		defer close(deltaChannel)
+
+		var id, model string
+		created := time.Now().Unix()
+		// 工具调用按出现顺序编号，output_index 还包括消息和推理条目
+		toolIndexes := make(map[int]int)
+		var streamedText bool
+		var usage Usage
+		defer func() { call.limiter.Settle(call.reserved, usage) }()
+
+		send := func(message Message, finishReason string, deltaUsage Usage) bool {
+			delta := StreamDelta{
+				ID:      id,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   model,
+				Choices: []Choice{{Index: 0, Delta: message, FinishReason: finishReason}},
+				Usage:   deltaUsage,
+			}
+			select {
+			case deltaChannel <- delta:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var streamErr error
+		err := readSSEData(ctx, resp.Body, func(data string) bool {
+			var event responsesEvent
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				log.Printf("[WARN] Failed to decode Responses API event: %v", err)
+				return true
+			}
+
+			switch event.Type {
+			case "response.created":
+				if event.Response != nil {
+					id, model = event.Response.ID, event.Response.Model
+				}
+				return send(Message{Role: "assistant"}, "", Usage{})
+			case "response.output_text.delta", "response.refusal.delta":
+				streamedText = true
+				return send(Message{Content: event.Delta}, "", Usage{})
+			case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+				return send(Message{Reasoning: event.Delta}, "", Usage{})
+			case "response.reasoning_summary_part.added":
+				// 多段摘要之间空一行
+				if event.SummaryIndex > 0 {
+					return send(Message{Reasoning: "\n\n"}, "", Usage{})
+				}
+			case "response.output_item.added":
+				if event.Item == nil || event.Item.Type != "function_call" {
+					return true
+				}
+				index := len(toolIndexes)
+				toolIndexes[event.OutputIndex] = index
+				return send(Message{ToolCalls: []ToolCall{{
+					Index:    &index,
+					ID:       event.Item.CallID,
+					Type:     "function",
+					Function: Function{Name: event.Item.Name, Arguments: event.Item.Arguments},
+				}}}, "", Usage{})
+			case "response.function_call_arguments.delta":
+				index, ok := toolIndexes[event.OutputIndex]
+				if !ok {
+					return true
+				}
+				return send(Message{ToolCalls: []ToolCall{{Index: &index, Function: Function{Arguments: event.Delta}}}}, "", Usage{})
+			case "response.completed", "response.incomplete":
+				if event.Response == nil {
+					return false
+				}
+				message := event.Response.message()
+				usage = event.Response.usage()
+				call.finish(req, event.Response.ID, message)
+				// 部分兼容服务只发送最终事件，未以增量出现的输出在这里补发
+				if !streamedText && message.Content != "" && !send(Message{Content: message.Content}, "", Usage{}) {
+					return false
+				}
+				if len(toolIndexes) == 0 {
+					for i, toolCall := range message.ToolCalls {
+						index := i
+						toolCall.Index = &index
+						if !send(Message{ToolCalls: []ToolCall{toolCall}}, "", Usage{}) {
+							return false
+						}
+					}
+				}
+				send(Message{}, event.Response.finishReason(message), usage)
+				return false
+			case "response.failed":
+				streamErr = fmt.Errorf("response failed")
+				if event.Response != nil && event.Response.Error != nil {
+					log.Printf("[ERROR] ResponsesClient: response failed: %s: %s", event.Response.Error.Code, event.Response.Error.Message)
+					streamErr = fmt.Errorf("response failed: %s: %s", event.Response.Error.Code, event.Response.Error.Message)
+				}
+				return false
+			case "error":
+				log.Printf("[ERROR] ResponsesClient: stream error %s: %s", event.Code, event.Message)
+				streamErr = fmt.Errorf("responses stream error %s: %s", event.Code, event.Message)
+				return false
+			}
+			return true
+		})
+		if streamErr == nil {
+			streamErr = err
+		}
+		if streamErr != nil {
+			sendStreamError(ctx, deltaChannel, streamErr)
+		}
+	}()
+
+	return deltaChannel, nil
+}
+
+// responsesCall is the state of one request needed after the response arrives
+type responsesCall struct {
+	limiter  *RateLimiter
+	reserved int
+	model    string
+	// conversation holds the messages sent, in full, without the leading system messages
+	conversation []Message
+}
+
+// finish advances the request's response chain to the new response
+func (call *responsesCall) finish(req *ChatRequest, responseID string, output Message) {
+	if req.ResponseChain == nil || responseID == "" {
+		return
+	}
+	covered := append(append([]Message(nil), call.conversation...), output)
+	*req.ResponseChain = ResponseChain{
+		ResponseID:  responseID,
+		Model:       call.model,
+		Messages:    len(covered),
+		Fingerprint: fingerprintMessages(covered),
+	}
+}
+
+// send posts req to /responses and returns the successful HTTP response. A chained request
+// whose previous response is gone (expired or deleted) is sent again with the full input.
+func (c *ResponsesClient) send(ctx context.Context, req *ChatRequest, stream bool) (*http.Response, *responsesCall, error) {
+	config := req.Config
+	if config == nil {
+		config = c.config
+	}
+	baseURL, apiKey, model := modelConfigFor(config, req.ModelType)
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	applyCapabilities(req, model)
+	body, conversation := buildResponsesRequest(req, model, config.ThinkingBudget)
+	body.Stream = stream
+
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.post(ctx, baseURL, apiKey, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && body.PreviousResponseID != "" {
+		errBody, _ := io.ReadAll(resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+		log.Printf("[WARN] ResponsesClient: previous response %s is gone, resending the full input: %s", body.PreviousResponseID, string(errBody))
+		*req.ResponseChain = ResponseChain{}
+		body.PreviousResponseID = ""
+		body.Input = buildResponsesInput(conversation)
+		if resp, err = c.post(ctx, baseURL, apiKey, body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errBody, _ := io.ReadAll(resp.Body)
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+		log.Printf("[ERROR] ResponsesClient: HTTP error %d: %s", resp.StatusCode, string(errBody))
+		return nil, nil, newHTTPError(limiter, resp, errBody)
+	}
+
+	return resp, &responsesCall{limiter: limiter, reserved: reserved, model: model, conversation: conversation}, nil
+}
+
+// post sends body to the /responses endpoint of baseURL
+func (c *ResponsesClient) post(ctx context.Context, baseURL, apiKey string, body *responsesRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	log.Printf("[DEBUG] Responses API request: %s", string(jsonData))
+
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/responses"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	if body.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// buildResponsesRequest translates a chat completion request. Leading system messages become
+// the instructions; when the request continues its response chain only the new messages are
+// sent as input. It also returns the conversation the response chain is computed from.
+func buildResponsesRequest(req *ChatRequest, model string, thinkingBudget int) (*responsesRequest, []Message) {
+	instructions, conversation := splitInstructions(req.Messages)
+
+	body := &responsesRequest{
+		Model:             model,
+		Instructions:      instructions,
+		ToolChoice:        req.ToolChoice,
+		ParallelToolCalls: req.ParallelToolCalls,
+		MaxOutputTokens:   req.MaxTokens,
+		Store:             true,
+	}
+
+	input := conversation
+	if previous, covered, ok := chainedPrefix(req.ResponseChain, model, conversation); ok {
+		body.PreviousResponseID = previous
+		input = conversation[covered:]
+		log.Printf("[DEBUG] ResponsesClient: continuing %s with %d new messages", previous, len(input))
+	}
+	body.Input = buildResponsesInput(input)
+
+	if isResponsesReasoningModel(model) {
+		body.Reasoning = &responsesReasoning{Summary: "auto", Effort: reasoningEffort(thinkingBudget)}
+	} else if req.Temperature > 0 {
+		temperature := req.Temperature
+		body.Temperature = &temperature
+	}
+
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, responsesTool{
+			Type:        "function",
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	if body.ToolChoice == "any" {
+		body.ToolChoice = "required"
+	}
+	if len(body.Tools) == 0 {
+		body.ToolChoice = ""
+		body.ParallelToolCalls = nil
+	}
+
+	if format := req.ResponseFormat; format != nil {
+		text := &responsesText{Format: responsesFormat{Type: string(format.Type)}}
+		if format.JSONSchema != nil {
+			text.Format.Name = format.JSONSchema.Name
+			text.Format.Schema = format.JSONSchema.Schema
+			text.Format.Strict = format.JSONSchema.Strict
+		}
+		body.Text = text
+	}
+
+	return body, conversation
+}
+
+// splitInstructions separates the leading system messages from the conversation
+func splitInstructions(messages []Message) (string, []Message) {
+	var system []string
+	i := 0
+	for ; i < len(messages) && messages[i].Role == "system"; i++ {
+		if messages[i].Content != "" {
+			system = append(system, messages[i].Content)
+		}
+	}
+	return strings.Join(system, "\n\n"), messages[i:]
+}
+
+// chainedPrefix returns the previous response id and the number of messages it covers when
+// conversation still starts with them and has new messages to send
+func chainedPrefix(chain *ResponseChain, model string, conversation []Message) (string, int, bool) {
+	if chain == nil || chain.ResponseID == "" || chain.Model != model {
+		return "", 0, false
+	}
+	if chain.Messages <= 0 || chain.Messages >= len(conversation) {
+		return "", 0, false
+	}
+	if fingerprintMessages(conversation[:chain.Messages]) != chain.Fingerprint {
+		log.Printf("[DEBUG] ResponsesClient: conversation changed since %s, sending full input", chain.ResponseID)
+		return "", 0, false
+	}
+	return chain.ResponseID, chain.Messages, true
+}
+
+// fingerprintMessages hashes the parts of messages the provider keeps: roles, content,
+// images, tool calls and tool results. Tool call arguments are compared as JSON values
+// because sessions store them decoded.
+func fingerprintMessages(messages []Message) string {
+	hash := sha256.New()
+	for _, msg := range messages {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00", msg.Role, msg.Content, msg.ToolCallId)
+		for _, part := range msg.Parts {
+			fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\x00", part.Type, part.Text, part.Path, part.URL)
+		}
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(hash, "%s\x00%s\x00%s\x00", tc.ID, tc.Function.Name, canonicalArguments(tc.Function.Arguments))
+		}
+		hash.Write([]byte{0x1e})
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// canonicalArguments re-encodes JSON arguments with sorted keys and no whitespace
+func canonicalArguments(arguments string) string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(arguments), &value); err != nil {
+		return arguments
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return arguments
+	}
+	return string(data)
+}
+
+// buildResponsesInput converts messages into input items: assistant tool calls become
+// function_call items and tool results function_call_output items
+func buildResponsesInput(messages []Message) []responsesItem {
+	items := make([]responsesItem, 0, len(messages))
+	for _, msg := range messages {
+		switch msg.Role {
+		case "tool":
+			output := msg.Content
+			items = append(items, responsesItem{Type: "function_call_output", CallID: msg.ToolCallId, Output: &output})
+		case "assistant":
+			if msg.Content != "" {
+				items = append(items, responsesItem{
+					Type:    "message",
+					Role:    "assistant",
+					Content: []responsesContent{{Type: "output_text", Text: msg.Content}},
+				})
+			}
+			for _, tc := range msg.ToolCalls {
+				arguments := tc.Function.Arguments
+				if strings.TrimSpace(arguments) == "" {
+					arguments = "{}"
+				}
+				items = append(items, responsesItem{Type: "function_call", CallID: tc.ID, Name: tc.Function.Name, Arguments: arguments})
+			}
+		default:
+			// 对话中间的系统消息（如压缩摘要）保留原位置
+			items = append(items, responsesItem{Type: "message", Role: msg.Role, Content: responsesUserContent(msg)})
+		}
+	}
+	return items
+}
+
+// responsesUserContent converts the text and images of a user or system message
+func responsesUserContent(msg Message) []responsesContent {
+	var content []responsesContent
+	for _, part := range messageParts(msg) {
+		switch {
+		case part.Type != ContentPartImage:
+			content = append(content, responsesContent{Type: "input_text", Text: part.Text})
+		case part.URL != "":
+			content = append(content, responsesContent{Type: "input_image", ImageURL: part.URL})
+		default:
+			content = append(content, responsesContent{Type: "input_image", ImageURL: "data:" + part.MediaType + ";base64," + part.Data})
+		}
+	}
+	if len(content) == 0 {
+		content = append(content, responsesContent{Type: "input_text", Text: ""})
+	}
+	return content
+}
+
+// isResponsesReasoningModel reports whether model is an OpenAI reasoning model; these accept
+// reasoning settings and reject temperature
+func isResponsesReasoningModel(model string) bool {
+	name := strings.ToLower(strings.TrimPrefix(model, "openai/"))
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5", "codex"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reasoningEffort maps the thinking budget onto the effort levels; 0 keeps the model default
+func reasoningEffort(thinkingBudget int) string {
+	switch {
+	case thinkingBudget <= 0:
+		return ""
+	case thinkingBudget < 4096:
+		return "low"
+	case thinkingBudget < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// message converts the output items into an assistant message: text, function calls and
+// reasoning summaries
+func (r *responsesResponse) message() Message {
+	message := Message{Role: "assistant"}
+	var content, reasoning []string
+	for _, item := range r.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				switch part.Type {
+				case "output_text":
+					content = append(content, part.Text)
+				case "refusal":
+					content = append(content, part.Refusal)
+				}
+			}
+		case "function_call":
+			message.ToolCalls = append(message.ToolCalls, ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: Function{Name: item.Name, Arguments: item.Arguments},
+			})
+		case "reasoning":
+			parts := item.Summary
+			if len(parts) == 0 {
+				parts = item.Content
+			}
+			for _, part := range parts {
+				reasoning = append(reasoning, part.Text)
+			}
+		}
+	}
+	message.Content = strings.Join(content, "")
+	message.Reasoning = strings.Join(reasoning, "\n\n")
+	return message
+}
+
+func (r *responsesResponse) usage() Usage {
+	if r.Usage == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     r.Usage.InputTokens,
+		CompletionTokens: r.Usage.OutputTokens,
+		TotalTokens:      r.Usage.TotalTokens,
+		CachedTokens:     r.Usage.InputTokensDetails.CachedTokens,
+	}
+}
+
+// finishReason maps the response status to an OpenAI finish reason
+func (r *responsesResponse) finishReason(message Message) string {
+	if r.Status == "incomplete" && r.IncompleteDetails != nil {
+		switch r.IncompleteDetails.Reason {
+		case "max_output_tokens":
+			return "length"
+		case "content_filter":
+			return "content_filter"
+		}
+		return r.IncompleteDetails.Reason
+	}
+	if len(message.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// SupportsStreaming returns true if the client supports streaming
+func (c *ResponsesClient) SupportsStreaming() bool {
+	return c.streamEnabled
+}
+
+// SetStreamingEnabled enables or disables streaming
+func (c *ResponsesClient) SetStreamingEnabled(enabled bool) {
+	c.streamEnabled = enabled
+}
+
+// SetHTTPClient sets a custom HTTP client
+func (c *ResponsesClient) SetHTTPClient(client *http.Client) {
+	if client != nil {
+		c.httpClient = client
+	}
+}
+
+// GetHTTPClient returns the current HTTP client
+func (c *ResponsesClient) GetHTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Close closes the client and cleans up resources
+func (c *ResponsesClient) Close() error {
+	return nil
+}
@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildResponsesRequest(t *testing.T) {
+	req := &ChatRequest{
+		Messages: []Message{
+			{Role: "system", Content: "You are Alex."},
+			{Role: "user", Content: "What is in the screenshot?", Parts: []ContentPart{ImageDataPart("image/png", "aGk=")}},
+			{Role: "assistant", Content: "Let me check.", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: Function{Name: "file_read", Arguments: ""}}}},
+			{Role: "tool", ToolCallId: "call_1", Content: ""},
+		},
+		Tools:          []Tool{{Type: "function", Function: Function{Name: "file_read", Description: "Read a file", Parameters: map[string]any{"type": "object"}}}},
+		ToolChoice:     "auto",
+		Temperature:    0.7,
+		MaxTokens:      1000,
+		ResponseFormat: &ResponseFormat{Type: StructuredOutputJSONObject},
+	}
+
+	body, conversation := buildResponsesRequest(req, "o3", 8000)
+	if body.Instructions != "You are Alex." || len(conversation) != 3 {
+		t.Fatalf("system messages should become instructions: %q, %d messages", body.Instructions, len(conversation))
+	}
+	data, _ := json.Marshal(body)
+	for _, want := range []string{
+		`{"type":"message","role":"user","content":[{"type":"input_text","text":"What is in the screenshot?"},{"type":"input_image","image_url":"data:image/png;base64,aGk="}]}`,
+		`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Let me check."}]}`,
+		`{"type":"function_call","call_id":"call_1","name":"file_read","arguments":"{}"}`,
+		`{"type":"function_call_output","call_id":"call_1","output":""}`,
+		`"tools":[{"type":"function","name":"file_read","description":"Read a file","parameters":{"type":"object"}}]`,
+		`"max_output_tokens":1000`,
+		`"store":true`,
+		`"reasoning":{"effort":"medium","summary":"auto"}`,
+		`"text":{"format":{"type":"json_object"}}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("request is missing %s:\n%s", want, data)
+		}
+	}
+	// 推理模型不接受 temperature
+	if body.Temperature != nil {
+		t.Error("temperature must not be sent to reasoning models")
+	}
+}
+
+func TestResponsesClient_ChainsPreviousResponse(t *testing.T) {
+	var bodies []map[string]any
+	expired := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		_ = json.Unmarshal(data, &body)
+		bodies = append(bodies, body)
+
+		if expired && body["previous_response_id"] != nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"Previous response not found"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(bodies) == 1 {
+			_, _ = fmt.Fprint(w, `{"id":"resp_1","model":"gpt-4.1","status":"completed","output":[
+				{"type":"function_call","id":"fc_1","call_id":"call_1","name":"bash","arguments":"{\"command\": \"ls\"}"}],
+				"usage":{"input_tokens":50,"input_tokens_details":{"cached_tokens":10},"output_tokens":5,"total_tokens":55}}`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"id":"resp_%d","model":"gpt-4.1","status":"completed","output":[
+			{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Two files."}]}]}`, len(bodies))
+	}))
+	defer server.Close()
+
+	client, err := NewResponsesClient(&Config{BaseURL: server.URL + "/v1", APIKey: "key", Model: "gpt-4.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &ResponseChain{}
+	messages := []Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "List the files"}}
+
+	response, err := client.Chat(context.Background(), &ChatRequest{Messages: messages, ResponseChain: chain}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := response.Choices[0].Message
+	if response.Choices[0].FinishReason != "tool_calls" || message.ToolCalls[0].ID != "call_1" || response.Usage.CachedTokens != 10 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	if chain.ResponseID != "resp_1" || chain.Messages != 2 {
+		t.Fatalf("chain was not advanced: %+v", chain)
+	}
+
+	// 会话中的参数经过解码再编码，键的格式不同也应视为同一条消息
+	message.ToolCalls[0].Function.Arguments = `{"command":"ls"}`
+	messages = append(messages, message, Message{Role: "tool", ToolCallId: "call_1", Content: "a.go b.go"})
+	if _, err := client.Chat(context.Background(), &ChatRequest{Messages: messages, ResponseChain: chain}, ""); err != nil {
+		t.Fatal(err)
+	}
+	second := bodies[1]
+	input, _ := second["input"].([]any)
+	if second["previous_response_id"] != "resp_1" || second["instructions"] != "Be brief." || len(input) != 1 {
+		t.Fatalf("expected only the tool output after resp_1, got %v", second)
+	}
+	if item := input[0].(map[string]any); item["type"] != "function_call_output" || item["output"] != "a.go b.go" {
+		t.Errorf("unexpected input item %v", item)
+	}
+	if chain.ResponseID != "resp_2" || chain.Messages != 4 {
+		t.Fatalf("chain was not advanced: %+v", chain)
+	}
+
+	// 上一次响应过期后重新发送完整输入
+	expired = true
+	messages = append(messages, Message{Role: "assistant", Content: "Two files."}, Message{Role: "user", Content: "Thanks"})
+	if _, err := client.Chat(context.Background(), &ChatRequest{Messages: messages, ResponseChain: chain}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 4 || bodies[3]["previous_response_id"] != nil || len(bodies[3]["input"].([]any)) != 5 {
+		t.Errorf("expected the full input after the 404, got %v", bodies[len(bodies)-1])
+	}
+	if chain.ResponseID != "resp_4" {
+		t.Errorf("chain should restart from the new response: %+v", chain)
+	}
+
+	// 对话被压缩改写后不能再接着旧响应
+	compressed := []Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "summary"}, {Role: "user", Content: "next"}}
+	if previous, _, ok := chainedPrefix(chain, "gpt-4.1", compressed[1:]); ok {
+		t.Errorf("a changed conversation must not continue %s", previous)
+	}
+}
+
+func TestResponsesClient_Stream(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","response":{"id":"resp_9","model":"o4-mini","status":"in_progress","output":[]}}`,
+		`{"type":"response.reasoning_summary_part.added","output_index":0,"summary_index":0}`,
+		`{"type":"response.reasoning_summary_text.delta","output_index":0,"summary_index":0,"delta":"Check the tests."}`,
+		`{"type":"response.reasoning_summary_part.added","output_index":0,"summary_index":1}`,
+		`{"type":"response.reasoning_summary_text.delta","output_index":0,"summary_index":1,"delta":"Then run them."}`,
+		`{"type":"response.output_text.delta","output_index":1,"content_index":0,"delta":"Running "}`,
+		`{"type":"response.output_text.delta","output_index":1,"content_index":0,"delta":"tests."}`,
+		`{"type":"response.output_item.added","output_index":2,"item":{"type":"function_call","call_id":"call_7","name":"bash","arguments":""}}`,
+		`{"type":"response.function_call_arguments.delta","output_index":2,"delta":"{\"command\":"}`,
+		`{"type":"response.function_call_arguments.delta","output_index":2,"delta":"\"go test\"}"}`,
+		`{"type":"response.completed","response":{"id":"resp_9","model":"o4-mini","status":"completed","output":[
+			{"type":"reasoning","summary":[{"type":"summary_text","text":"Check the tests."},{"type":"summary_text","text":"Then run them."}]},
+			{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Running tests."}]},
+			{"type":"function_call","call_id":"call_7","name":"bash","arguments":"{\"command\":\"go test\"}"}],
+			"usage":{"input_tokens":100,"output_tokens":40,"total_tokens":140}}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var payload struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal([]byte(strings.ReplaceAll(event, "\n", "")), &payload)
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", payload.Type, strings.ReplaceAll(event, "\n", ""))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewResponsesClient(&Config{BaseURL: server.URL, APIKey: "key", Model: "o4-mini"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &ResponseChain{}
+	deltas, err := client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "run the tests"}}, ResponseChain: chain}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accumulator := NewStreamAccumulator()
+	for delta := range deltas {
+		accumulator.Add(delta)
+	}
+
+	response := accumulator.Response()
+	message := response.Choices[0].Message
+	if message.Content != "Running tests." || message.Reasoning != "Check the tests.\n\nThen run them." {
+		t.Errorf("unexpected message %+v", message)
+	}
+	if len(message.ToolCalls) != 1 || message.ToolCalls[0].ID != "call_7" || message.ToolCalls[0].Function.Arguments != `{"command":"go test"}` {
+		t.Errorf("unexpected tool calls %+v", message.ToolCalls)
+	}
+	if response.ID != "resp_9" || response.Choices[0].FinishReason != "tool_calls" || response.Usage.TotalTokens != 140 {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if chain.ResponseID != "resp_9" || chain.Messages != 2 || chain.Fingerprint != fingerprintMessages([]Message{{Role: "user", Content: "run the tests"}, message}) {
+		t.Errorf("the streamed response should advance the chain: %+v", chain)
+	}
+}
+
+func TestResponsesClient_StreamFailed(t *testing.T) {
+	events := []string{
+		`{"type":"response.created","response":{"id":"resp_10","model":"o4-mini","status":"in_progress","output":[]}}`,
+		`{"type":"response.output_text.delta","output_index":0,"content_index":0,"delta":"Runn"}`,
+		`{"type":"response.failed","response":{"id":"resp_10","status":"failed","error":{"code":"server_error","message":"The server had an error"}}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewResponsesClient(&Config{BaseURL: server.URL, APIKey: "key", Model: "o4-mini"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &ResponseChain{}
+	deltas, err := client.ChatStream(context.Background(), &ChatRequest{Messages: []Message{{Role: "user", Content: "run the tests"}}, ResponseChain: chain}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamErr error
+	for delta := range deltas {
+		if delta.Err != nil {
+			streamErr = delta.Err
+		}
+	}
+	if streamErr == nil || !strings.Contains(streamErr.Error(), "server_error") {
+		t.Errorf("expected the failed response to end the stream with an error, got %v", streamErr)
+	}
+	if chain.ResponseID != "" {
+		t.Errorf("a failed response should not advance the chain: %+v", chain)
+	}
+}
+
+func TestProviderForConfig_ResponsesAPI(t *testing.T) {
+	if name := ProviderForConfig(&Config{BaseURL: "https://api.openai.com/v1", API: APIResponses}).Name(); name != ProviderOpenAIResponses {
+		t.Errorf("api=responses should select the Responses API, got %s", name)
+	}
+	if name := ProviderForConfig(&Config{BaseURL: "https://api.openai.com/v1"}).Name(); name != ProviderOpenAI {
+		t.Errorf("chat completions stay the default, got %s", name)
+	}
+
+	config := &Config{API: APIResponses, Models: map[ModelType]*ModelConfig{
+		BasicModel:     {BaseURL: "https://api.openai.com/v1", Model: "gpt-4.1"},
+		ReasoningModel: {BaseURL: "https://api.openai.com/v1", Model: "o3", API: APIChatCompletions},
+	}}
+	if api := getEffectiveConfigForModelType(BasicModel, config).API; api != APIResponses {
+		t.Errorf("model configs inherit the api, got %q", api)
+	}
+	if api := getEffectiveConfigForModelType(ReasoningModel, config).API; api != APIChatCompletions {
+		t.Errorf("a model config overrides the api, got %q", api)
+	}
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// maxSSELineSize is the largest single SSE line accepted; tool call arguments can be large
+const maxSSELineSize = 1024 * 1024 // 1MB
+
+// readSSEStream reads an OpenAI-compatible server-sent event stream and emits every
+// decoded StreamDelta. emit returns false to stop reading early. The body is closed
+// when the stream ends; the error reports a stream that broke off.
+func readSSEStream(ctx context.Context, body io.ReadCloser, emit func(StreamDelta) bool) error {
+	return readSSEData(ctx, body, func(data string) bool {
+		var delta StreamDelta
+		if err := json.Unmarshal([]byte(data), &delta); err != nil {
+			// Log error but continue processing
+			log.Printf("[WARN] Failed to decode stream chunk: %v", err)
+			return true
+		}
+		return emit(delta)
+	})
+}
+
+// readSSEData reads a server-sent event stream and passes the payload of every
+// "data:" line to handle until the stream ends, "[DONE]" is received or handle
+// returns false. Event names are ignored; providers repeat the event type in the payload.
+// A read error is returned so the stream is not mistaken for a complete response.
+func readSSEData(ctx context.Context, body io.ReadCloser, handle func(data string) bool) error {
+	defer func() {
+		if err := body.Close(); err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(body)
+	// 增加缓冲区大小以处理大型tool calls arguments (默认64KB -> 1MB)
+	buf := make([]byte, maxSSELineSize)
+	scanner.Buffer(buf, maxSSELineSize)
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		line := scanner.Text()
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		// Parse SSE format: "data: {...}"
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		// Check for end of stream
+		if data == "[DONE]" {
+			return nil
+		}
+
+		if !handle(data) {
+			return nil
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil || ctx.Err() != nil {
+		return nil
+	}
+	log.Printf("[ERROR] Scanner error while reading stream: %v", err)
+	// 特别检查缓冲区溢出错误
+	if err == bufio.ErrTooLong {
+		return fmt.Errorf("stream line exceeds %d bytes: %w", maxSSELineSize, err)
+	}
+	return fmt.Errorf("stream interrupted: %w", err)
+}
+
+// sendStreamError ends a stream with a delta carrying err
+func sendStreamError(ctx context.Context, deltas chan<- StreamDelta, err error) {
+	select {
+	case deltas <- StreamDelta{Err: err}:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"sort"
+	"strings"
+)
+
+// StreamAccumulator assembles streaming deltas into a complete ChatResponse.
+// Content and reasoning are concatenated, tool calls are merged by their stream index
+// so incremental argument fragments end up in a single ToolCall.
+type StreamAccumulator struct {
+	id           string
+	model        string
+	created      int64
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	think        strings.Builder
+	signature    strings.Builder
+	toolCalls    map[int]*ToolCall
+	finishReason string
+	usage        Usage
+	deltaCount   int
+}
+
+// NewStreamAccumulator creates an empty stream accumulator
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{
+		toolCalls: make(map[int]*ToolCall),
+	}
+}
+
+// Add merges one streaming delta into the accumulated response
+func (a *StreamAccumulator) Add(delta StreamDelta) {
+	a.deltaCount++
+
+	if delta.ID != "" {
+		a.id = delta.ID
+	}
+	if delta.Model != "" {
+		a.model = delta.Model
+	}
+	if delta.Created != 0 {
+		a.created = delta.Created
+	}
+	if usage := delta.GetUsage(); usage.GetTotalTokens() > 0 {
+		a.usage = usage
+	}
+
+	for _, choice := range delta.Choices {
+		// Only the first choice is used by the agent
+		if choice.Index != 0 {
+			continue
+		}
+
+		d := choice.Delta
+		if d.Role != "" {
+			a.role = d.Role
+		}
+		a.content.WriteString(d.Content)
+		a.reasoning.WriteString(d.Reasoning)
+		a.think.WriteString(d.Think)
+		a.signature.WriteString(d.ThinkingSignature)
+
+		for i, tc := range d.ToolCalls {
+			index := i
+			if tc.Index != nil {
+				index = *tc.Index
+			}
+
+			existing, ok := a.toolCalls[index]
+			if !ok {
+				existing = &ToolCall{Type: "function"}
+				a.toolCalls[index] = existing
+			}
+			if tc.ID != "" {
+				existing.ID = tc.ID
+			}
+			if tc.Type != "" {
+				existing.Type = tc.Type
+			}
+			if tc.Function.Name != "" {
+				existing.Function.Name = tc.Function.Name
+			}
+			existing.Function.Arguments += tc.Function.Arguments
+		}
+
+		if choice.FinishReason != "" {
+			a.finishReason = choice.FinishReason
+		}
+	}
+}
+
+// Empty reports whether no content, reasoning or tool calls have been received
+func (a *StreamAccumulator) Empty() bool {
+	return a.content.Len() == 0 && a.reasoning.Len() == 0 && len(a.toolCalls) == 0
+}
+
+// DeltaCount returns the number of deltas received so far
+func (a *StreamAccumulator) DeltaCount() int {
+	return a.deltaCount
+}
+
+// Response builds the assembled ChatResponse
+func (a *StreamAccumulator) Response() *ChatResponse {
+	role := a.role
+	if role == "" {
+		role = "assistant"
+	}
+
+	message := Message{
+		Role:      role,
+		Content:   a.content.String(),
+		Reasoning: a.reasoning.String(),
+		Think:     a.think.String(),
+
+		ThinkingSignature: a.signature.String(),
+	}
+
+	indexes := make([]int, 0, len(a.toolCalls))
+	for index := range a.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		message.ToolCalls = append(message.ToolCalls, *a.toolCalls[index])
+	}
+
+	return &ChatResponse{
+		ID:      a.id,
+		Object:  "chat.completion",
+		Created: a.created,
+		Model:   a.model,
+		Choices: []Choice{
+			{
+				Index:        0,
+				Message:      message,
+				FinishReason: a.finishReason,
+			},
+		},
+		Usage: a.usage,
+	}
+}
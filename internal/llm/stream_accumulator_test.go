@@ -0,0 +1,51 @@
+package llm
+
+import "testing"
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestStreamAccumulator_MergesToolCalls(t *testing.T) {
+	accumulator := NewStreamAccumulator()
+	if !accumulator.Empty() {
+		t.Fatal("new accumulator should be empty")
+	}
+
+	deltas := []StreamDelta{
+		{Choices: []Choice{{Delta: Message{Role: "assistant", Content: "Let me check"}}}},
+		{Choices: []Choice{{Delta: Message{ToolCalls: []ToolCall{
+			{Index: intPtr(1), ID: "call_b", Type: "function", Function: Function{Name: "file_list", Arguments: `{"path":`}},
+		}}}}},
+		{Choices: []Choice{{Delta: Message{ToolCalls: []ToolCall{
+			{Index: intPtr(0), ID: "call_a", Type: "function", Function: Function{Name: "file_read", Arguments: `{"file_path":"a.go"}`}},
+		}}}}},
+		{Choices: []Choice{{Delta: Message{ToolCalls: []ToolCall{
+			{Index: intPtr(1), Function: Function{Arguments: `"."}`}},
+		}}, FinishReason: "tool_calls"}}},
+	}
+	for _, delta := range deltas {
+		accumulator.Add(delta)
+	}
+
+	if accumulator.DeltaCount() != len(deltas) {
+		t.Errorf("expected %d deltas, got %d", len(deltas), accumulator.DeltaCount())
+	}
+
+	choice := accumulator.Response().Choices[0]
+	if choice.Message.Content != "Let me check" {
+		t.Errorf("unexpected content: %q", choice.Message.Content)
+	}
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("expected finish reason 'tool_calls', got %q", choice.FinishReason)
+	}
+	if len(choice.Message.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(choice.Message.ToolCalls))
+	}
+	if choice.Message.ToolCalls[0].ID != "call_a" || choice.Message.ToolCalls[1].ID != "call_b" {
+		t.Errorf("tool calls not ordered by index: %+v", choice.Message.ToolCalls)
+	}
+	if args := choice.Message.ToolCalls[1].Function.Arguments; args != `{"path":"."}` {
+		t.Errorf("arguments not merged: %s", args)
+	}
+}
@@ -1,7 +1,6 @@
 package llm
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,7 +8,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -92,12 +90,19 @@ func (c *StreamingLLMClient) Chat(ctx context.Context, req *ChatRequest, session
 	req.Stream = false
 
 	// Set defaults
-	c.setRequestDefaults(req)
+	c.setRequestDefaults(req, model)
 
 	// Override model if not set in request
 	if req.Model == "" {
 		req.Model = model
 	}
+	req.Messages = reasoningMessages(req.Messages, req.Model)
+	cacheHeaders := PromptCacheFor(baseURL, req.Model).Prepare(req, sessionID, apiKey)
+
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, req)
+	if err != nil {
+		return nil, err
+	}
 
 	jsonData, err := json.Marshal(req)
 	if err != nil {
@@ -109,7 +114,7 @@ func (c *StreamingLLMClient) Chat(ctx context.Context, req *ChatRequest, session
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	c.setHeaders(httpReq, apiKey)
+	c.setHeaders(httpReq, apiKey, cacheHeaders)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -123,13 +128,14 @@ func (c *StreamingLLMClient) Chat(ctx context.Context, req *ChatRequest, session
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newHTTPError(limiter, resp, body)
 	}
 
 	var chatResp ChatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	limiter.Settle(reserved, chatResp.Usage)
 
 	return &chatResp, nil
 }
@@ -151,12 +157,19 @@ func (c *StreamingLLMClient) ChatStream(ctx context.Context, req *ChatRequest, s
 	req.Stream = true
 
 	// Set defaults
-	c.setRequestDefaults(req)
+	c.setRequestDefaults(req, model)
 
 	// Override model if not set in request
 	if req.Model == "" {
 		req.Model = model
 	}
+	req.Messages = reasoningMessages(req.Messages, req.Model)
+	cacheHeaders := PromptCacheFor(baseURL, req.Model).Prepare(req, sessionID, apiKey)
+	limiter, reserved, err := waitForRateLimit(ctx, baseURL, req)
+	if err != nil {
+		return nil, err
+	}
+
 	jsonData, err := json.Marshal(req)
 	log.Printf("DEBUG: Request: %+v", string(jsonData))
 
@@ -168,7 +181,7 @@ func (c *StreamingLLMClient) ChatStream(ctx context.Context, req *ChatRequest, s
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	c.setHeaders(httpReq, apiKey)
+	c.setHeaders(httpReq, apiKey, cacheHeaders)
 	httpReq.Header.Set("Accept", "text/event-stream")
 	httpReq.Header.Set("Cache-Control", "no-cache")
 
@@ -182,62 +195,28 @@ func (c *StreamingLLMClient) ChatStream(ctx context.Context, req *ChatRequest, s
 		if err := resp.Body.Close(); err != nil {
 			log.Printf("Error closing response body: %v", err)
 		}
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
+		return nil, newHTTPError(limiter, resp, body)
 	}
 
 	deltaChannel := make(chan StreamDelta, 1000) // Increased buffer size for better streaming performance
 
 	go func() {
 		defer close(deltaChannel)
-		defer func() {
-			if err := resp.Body.Close(); err != nil {
-				log.Printf("Error closing response body: %v", err)
+		var usage Usage
+		defer func() { limiter.Settle(reserved, usage) }()
+		err := readSSEStream(ctx, resp.Body, func(delta StreamDelta) bool {
+			if delta.Usage.TotalTokens > 0 {
+				usage = delta.Usage
 			}
-		}()
-
-		scanner := bufio.NewScanner(resp.Body)
-		// 增加缓冲区大小以处理大型tool calls arguments (默认64KB -> 1MB)
-		maxTokenSize := 1024 * 1024 // 1MB
-		buf := make([]byte, maxTokenSize)
-		scanner.Buffer(buf, maxTokenSize)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			// Skip empty lines and comments
-			if line == "" || strings.HasPrefix(line, ":") {
-				continue
+			select {
+			case deltaChannel <- delta:
+				return true
+			case <-ctx.Done():
+				return false
 			}
-
-			// Parse SSE format: "data: {...}"
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-
-				// Check for end of stream
-				if data == "[DONE]" {
-					return
-				}
-
-				var delta StreamDelta
-				if err := json.Unmarshal([]byte(data), &delta); err != nil {
-					// Log error but continue processing
-					continue
-				}
-
-				select {
-				case deltaChannel <- delta:
-				case <-ctx.Done():
-					return
-				}
-			}
-		}
-
-		if err := scanner.Err(); err != nil {
-			log.Printf("[ERROR] Scanner error while reading stream: %v", err)
-			// 特别检查缓冲区溢出错误
-			if err == bufio.ErrTooLong {
-				log.Printf("[ERROR] Scanner buffer overflow - line too long for buffer size %d", maxTokenSize)
-			}
-			return
+		})
+		if err != nil {
+			sendStreamError(ctx, deltaChannel, err)
 		}
 	}()
 
@@ -260,21 +239,25 @@ func (c *StreamingLLMClient) Close() error {
 	return nil
 }
 
-// setRequestDefaults sets default values for the request
-func (c *StreamingLLMClient) setRequestDefaults(req *ChatRequest) {
+// setRequestDefaults sets default values for the request and adapts it to the model's capabilities
+func (c *StreamingLLMClient) setRequestDefaults(req *ChatRequest, model string) {
 	if req.Temperature == 0 {
 		req.Temperature = 0.7 // Default temperature
 	}
 
-	if req.MaxTokens == 0 {
-		req.MaxTokens = 2048 // Default max tokens
+	if req.Model != "" {
+		model = req.Model
 	}
+	applyCapabilities(req, model)
 }
 
 // setHeaders sets common headers for HTTP requests
-func (c *StreamingLLMClient) setHeaders(req *http.Request, apiKey string) {
+func (c *StreamingLLMClient) setHeaders(req *http.Request, apiKey string, cacheHeaders map[string]string) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
+	for key, value := range cacheHeaders {
+		req.Header.Set(key, value)
+	}
 	apiKeyPreview := apiKey
 	// Use rune-based slicing to properly handle UTF-8 characters in API key
 	keyRunes := []rune(apiKeyPreview)
@@ -1,7 +1,9 @@
 package llm
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"time"
 )
@@ -21,6 +23,49 @@ type Message struct {
 	Reasoning        string `json:"reasoning,omitempty"`
 	ReasoningSummary string `json:"reasoning_summary,omitempty"`
 	Think            string `json:"think,omitempty"`
+
+	// ReasoningContent is the wire field used by DeepSeek, Kimi and Qwen. Responses are
+	// read into Reasoning; it is only set on requests to models that want it back.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+
+	// Anthropic extended thinking signature, required to send thinking blocks back
+	ThinkingSignature string `json:"thinking_signature,omitempty"`
+
+	// Parts are sent after Content, e.g. images; see MarshalJSON for the wire format
+	Parts []ContentPart `json:"-"`
+}
+
+// UnmarshalJSON reads reasoning_content into Reasoning so callers see a single field,
+// and content arrays into Content and Parts
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	wire := struct {
+		*message
+		Content json.RawMessage `json:"content,omitempty"`
+	}{message: (*message)(m)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	m.Content, m.Parts = "", nil
+	switch content := bytes.TrimSpace(wire.Content); {
+	case len(content) > 0 && content[0] == '[':
+		text, parts, err := decodeOpenAIContent(content)
+		if err != nil {
+			return err
+		}
+		m.Content, m.Parts = text, parts
+	case len(content) > 0 && content[0] == '"':
+		if err := json.Unmarshal(content, &m.Content); err != nil {
+			return err
+		}
+	}
+	// 部分服务商两个字段都返回，内容相同
+	if m.Reasoning == "" {
+		m.Reasoning = m.ReasoningContent
+	}
+	m.ReasoningContent = ""
+	return nil
 }
 
 // ChatRequest represents a request to the LLM
@@ -31,11 +76,20 @@ type ChatRequest struct {
 	MaxTokens   int                    `json:"max_tokens,omitempty"`
 	Stream      bool                   `json:"stream,omitempty"`
 	Provider    map[string]interface{} `json:"provider,omitempty"`
+	// Streaming options (OpenAI-compatible), e.g. include usage in the final chunk
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
 	// Tool calling support
 	Tools      []Tool `json:"tools,omitempty"`
 	ToolChoice string `json:"tool_choice,omitempty"`
-	// Kimi API context caching support
-	CacheControl interface{} `json:"cache_control,omitempty"`
+	// ParallelToolCalls is only sent when set, i.e. to turn parallel tool calls off
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	// ResponseFormat asks for JSON output; it is downgraded or dropped for models that lack it
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// Stable prefix marked by the prompt cache strategy - not serialized to JSON
+	CacheControl *PromptCacheControl `json:"-"`
+	// ResponseChain is the previous response kept by the provider. Clients with server-side
+	// state (Responses API) send only the new messages and update it after a response.
+	ResponseChain *ResponseChain `json:"-"`
 	// Model type selection for multi-model configurations - not serialized to JSON
 	ModelType ModelType `json:"-"`
 
@@ -43,36 +97,37 @@ type ChatRequest struct {
 	Config *Config `json:"-"`
 }
 
+// ResponseFormat is the OpenAI-compatible response_format
+type ResponseFormat struct {
+	Type       StructuredOutput  `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat names the schema a json_schema response must follow
+type JSONSchemaFormat struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
+}
+
+// StreamOptions controls OpenAI-compatible streaming behaviour
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
 // ChatResponse represents a response from the LLM
-// Supports both OpenAI and Gemini API response formats
 type ChatResponse struct {
 	ID      string   `json:"id"`
 	Object  string   `json:"object"`
 	Created int64    `json:"created"`
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
-
-	// OpenAI format
-	Usage Usage `json:"usage,omitempty"`
-
-	// Gemini format - for compatibility
-	UsageMetadata Usage `json:"usageMetadata,omitempty"`
+	Usage   Usage    `json:"usage,omitempty"`
 }
 
-// GetUsage returns the usage information, supporting both OpenAI and Gemini formats
+// GetUsage returns the usage information
 func (r *ChatResponse) GetUsage() Usage {
-	// Check if OpenAI format has any token data
-	if r.Usage.GetTotalTokens() > 0 {
-		return r.Usage
-	}
-
-	// Fall back to Gemini format
-	if r.UsageMetadata.GetTotalTokens() > 0 {
-		return r.UsageMetadata
-	}
-
-	// Return empty usage if neither format has data
-	return Usage{}
+	return r.Usage
 }
 
 // Choice represents a choice in the response
@@ -84,45 +139,55 @@ type Choice struct {
 }
 
 // Usage represents token usage information
-// Supports both OpenAI and Gemini API response formats
 type Usage struct {
-	// OpenAI format (snake_case)
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 
-	// Gemini format (camelCase) - for compatibility
-	PromptTokenCount     int `json:"promptTokenCount"`
-	CandidatesTokenCount int `json:"candidatesTokenCount"`
-	TotalTokenCount      int `json:"totalTokenCount"`
+	// Prompt tokens served from the provider's cache (part of PromptTokens).
+	// Kimi and the native clients report cached_tokens directly.
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// OpenAI reports cache hits under prompt_tokens_details
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	// DeepSeek reports cache hits as prompt_cache_hit_tokens
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens,omitempty"`
+	// Prompt tokens written to the cache (Anthropic cache_creation_input_tokens)
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
-// GetPromptTokens returns the prompt tokens count, supporting both API formats
+// PromptTokensDetails is the OpenAI breakdown of prompt tokens
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// GetPromptTokens returns the prompt tokens count
 func (u *Usage) GetPromptTokens() int {
-	if u.PromptTokens > 0 {
-		return u.PromptTokens
-	}
-	return u.PromptTokenCount
+	return u.PromptTokens
 }
 
-// GetCompletionTokens returns the completion tokens count, supporting both API formats
+// GetCompletionTokens returns the completion tokens count
 func (u *Usage) GetCompletionTokens() int {
-	if u.CompletionTokens > 0 {
-		return u.CompletionTokens
-	}
-	return u.CandidatesTokenCount
+	return u.CompletionTokens
 }
 
-// GetTotalTokens returns the total tokens count, supporting both API formats
+// GetTotalTokens returns the total tokens count
 func (u *Usage) GetTotalTokens() int {
-	if u.TotalTokens > 0 {
-		return u.TotalTokens
+	return u.TotalTokens
+}
+
+// GetCachedTokens returns the prompt tokens read from cache, whichever way the provider reports them
+func (u *Usage) GetCachedTokens() int {
+	switch {
+	case u.CachedTokens > 0:
+		return u.CachedTokens
+	case u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0:
+		return u.PromptTokensDetails.CachedTokens
+	default:
+		return u.PromptCacheHitTokens
 	}
-	return u.TotalTokenCount
 }
 
 // StreamDelta represents a streaming response chunk
-// Supports both OpenAI and other provider streaming formats
 type StreamDelta struct {
 	ID      string   `json:"id"`
 	Object  string   `json:"object"`
@@ -135,6 +200,9 @@ type StreamDelta struct {
 
 	// Additional provider-specific fields
 	Provider string `json:"provider,omitempty"`
+
+	// Err is set on the last delta of a stream that failed before it completed
+	Err error `json:"-"`
 }
 
 // GetUsage returns the usage information from streaming delta
@@ -157,6 +225,8 @@ type ModelConfig struct {
 	APIKey      string  `json:"api_key"`
 	Temperature float64 `json:"temperature,omitempty"`
 	MaxTokens   int     `json:"max_tokens,omitempty"`
+	// API selects the OpenAI endpoint: chat_completions (default) or responses
+	API string `json:"api,omitempty"`
 }
 
 // Config represents LLM client configuration with multi-model support
@@ -168,12 +238,29 @@ type Config struct {
 	Temperature float64       `json:"temperature,omitempty"`
 	MaxTokens   int           `json:"max_tokens,omitempty"`
 	Timeout     time.Duration `json:"timeout,omitempty"`
+	// API selects the OpenAI endpoint: chat_completions (default) or responses
+	API string `json:"api,omitempty"`
+
+	// Extended thinking budget in tokens for providers that support it (0 disables)
+	ThinkingBudget int `json:"thinking_budget,omitempty"`
 
 	// Multi-model configurations
 	Models map[ModelType]*ModelConfig `json:"models,omitempty"`
 
 	// Default model type to use when none specified
 	DefaultModelType ModelType `json:"default_model_type,omitempty"`
+
+	// Ordered fallback models used when the primary provider is unavailable
+	Fallbacks []*ModelConfig `json:"fallbacks,omitempty"`
+
+	// Client-side rate limits keyed by provider host or base URL
+	RateLimits map[string]RateLimits `json:"rate_limits,omitempty"`
+
+	// Model price overrides keyed by provider/model
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+
+	// Model capability entries keyed by provider/model, replacing the built-in ones
+	Capabilities map[string]ModelCapabilities `json:"capabilities,omitempty"`
 }
 
 // Client interface defines LLM client operations
@@ -196,6 +283,8 @@ type StreamReader interface {
 
 // ToolCall represents an OpenAI-standard tool call
 type ToolCall struct {
+	// Index identifies the tool call a streaming delta belongs to; only set in stream chunks
+	Index    *int     `json:"index,omitempty"`
 	ID       string   `json:"id"`
 	Type     string   `json:"type"`
 	Function Function `json:"function"`
@@ -0,0 +1,341 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Action is the outcome of a permission rule
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+	ActionAsk   Action = "ask"
+)
+
+// Rule matches tool calls by tool name and an optional wildcard pattern on the call's subject
+// (the bash command, the file path, ...). "*" matches any sequence of characters.
+// A wildcard allow rule never matches a bash command that chains, pipes, redirects or
+// substitutes commands; such commands need a rule for the exact command.
+type Rule struct {
+	Tool    string `json:"tool"`
+	Pattern string `json:"pattern,omitempty"`
+	Action  Action `json:"action"`
+}
+
+// Config holds the persisted permission settings
+type Config struct {
+	// DefaultAction applies to mutating tools that match no rule; read-only tools are allowed
+	DefaultAction Action `json:"default_action,omitempty"`
+	// NonInteractiveAction replaces "ask" when no user can be prompted (CI runs)
+	NonInteractiveAction Action `json:"non_interactive_action,omitempty"`
+	Rules                []Rule `json:"rules,omitempty"`
+}
+
+// Approval is the user's answer to a permission prompt
+type Approval int
+
+const (
+	ApprovalDeny Approval = iota
+	ApprovalOnce
+	ApprovalSession
+	ApprovalAlways
+)
+
+// Request describes a tool call waiting for approval
+type Request struct {
+	Tool    string
+	Subject string
+	Args    map[string]interface{}
+	// Pattern is the rule pattern stored for "allow for session" and "always allow"
+	Pattern string
+}
+
+// Prompter asks the user to approve a tool call
+type Prompter func(ctx context.Context, req Request) (Approval, error)
+
+// Notifier tells the user about a tool call refused because no one could be asked
+type Notifier func(req Request)
+
+// Manager evaluates permission rules and asks for approval when needed
+type Manager struct {
+	mu             sync.Mutex
+	promptMu       sync.Mutex
+	config         Config
+	sessionRules   []Rule
+	prompter       Prompter
+	notifier       Notifier
+	nonInteractive bool
+	persist        func(Rule) error
+}
+
+// NewManager creates a permission manager. persist is called for "always allow" answers.
+func NewManager(cfg *Config, persist func(Rule) error) *Manager {
+	m := &Manager{persist: persist}
+	if cfg != nil {
+		m.config = *cfg
+		m.config.Rules = append([]Rule(nil), cfg.Rules...)
+	}
+	if m.config.DefaultAction == "" {
+		m.config.DefaultAction = ActionAsk
+	}
+	if m.config.NonInteractiveAction == "" {
+		m.config.NonInteractiveAction = ActionDeny
+	}
+	return m
+}
+
+// SetPrompter sets the function used to ask the user for approval
+func (m *Manager) SetPrompter(prompter Prompter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prompter = prompter
+}
+
+// SetNotifier sets the function called when a call that needs approval is denied without prompting
+func (m *Manager) SetNotifier(notifier Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = notifier
+}
+
+// SetNonInteractive disables prompting; "ask" decisions fall back to NonInteractiveAction
+func (m *Manager) SetNonInteractive(nonInteractive bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nonInteractive = nonInteractive
+}
+
+// Check returns nil if the tool call may run, or an error explaining why it was refused
+func (m *Manager) Check(ctx context.Context, toolName string, args map[string]interface{}, readOnly bool) error {
+	subject := Subject(toolName, args)
+
+	switch m.Evaluate(toolName, subject, readOnly) {
+	case ActionAllow:
+		return nil
+	case ActionDeny:
+		return fmt.Errorf("permission denied by rule for %s", describe(toolName, subject))
+	}
+
+	// 同一时间只弹出一个确认提示，并在拿到锁后重新评估（可能刚刚被允许）
+	m.promptMu.Lock()
+	defer m.promptMu.Unlock()
+
+	if m.Evaluate(toolName, subject, readOnly) == ActionAllow {
+		return nil
+	}
+
+	m.mu.Lock()
+	prompter := m.prompter
+	notifier := m.notifier
+	nonInteractive := m.nonInteractive || prompter == nil
+	fallback := m.config.NonInteractiveAction
+	m.mu.Unlock()
+
+	req := Request{Tool: toolName, Subject: subject, Args: args, Pattern: suggestPattern(toolName, subject)}
+	if nonInteractive {
+		if fallback == ActionAllow {
+			return nil
+		}
+		if notifier != nil {
+			notifier(req)
+		}
+		return fmt.Errorf("permission required for %s but running non-interactively; add a permissions rule to allow it", describe(toolName, subject))
+	}
+
+	approval, err := prompter(ctx, req)
+	if err != nil {
+		return fmt.Errorf("permission prompt failed: %w", err)
+	}
+
+	rule := Rule{Tool: toolName, Pattern: req.Pattern, Action: ActionAllow}
+	switch approval {
+	case ApprovalOnce:
+		return nil
+	case ApprovalSession:
+		m.mu.Lock()
+		m.sessionRules = append(m.sessionRules, rule)
+		m.mu.Unlock()
+		return nil
+	case ApprovalAlways:
+		m.mu.Lock()
+		m.config.Rules = append(m.config.Rules, rule)
+		m.mu.Unlock()
+		if m.persist != nil {
+			if err := m.persist(rule); err != nil {
+				log.Printf("[WARN] Permissions: Failed to persist rule for %s: %v", toolName, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("permission denied by user for %s", describe(toolName, subject))
+	}
+}
+
+// Evaluate resolves the action for a tool call without prompting.
+// Deny rules win over allow rules, which win over ask rules.
+func (m *Manager) Evaluate(toolName, subject string, readOnly bool) Action {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matched := make(map[Action]bool)
+	for _, rules := range [][]Rule{m.config.Rules, m.sessionRules} {
+		for _, rule := range rules {
+			if rule.Matches(toolName, subject) {
+				matched[rule.Action] = true
+			}
+		}
+	}
+
+	switch {
+	case matched[ActionDeny]:
+		return ActionDeny
+	case matched[ActionAllow]:
+		return ActionAllow
+	case matched[ActionAsk]:
+		return ActionAsk
+	case readOnly:
+		return ActionAllow
+	default:
+		return m.config.DefaultAction
+	}
+}
+
+// Matches reports whether the rule applies to the tool call
+func (r Rule) Matches(toolName, subject string) bool {
+	tool := r.Tool
+	if tool == "" {
+		tool = "*"
+	}
+	if !matchWildcard(tool, toolName) {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	// "ls *" 不能放行 "ls; rm -rf ~"
+	if r.Action == ActionAllow && toolName == "bash" && hasWildcards(r.Pattern) && hasShellOperators(subject) {
+		return false
+	}
+	return matchWildcard(r.Pattern, subject)
+}
+
+// shellOperators are the sequences that let one bash command run another
+var shellOperators = []string{";", "&", "|", "`", "$(", ">", "<", "\n", "\r"}
+
+// hasShellOperators reports whether a shell command does more than run one program
+func hasShellOperators(command string) bool {
+	for _, op := range shellOperators {
+		if strings.Contains(command, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectKeys are the argument names used as the subject of a tool call, in priority order
+var subjectKeys = []string{"command", "file_path", "path", "url", "query", "pattern", "code"}
+
+// Subject extracts the argument rules are matched against
+func Subject(toolName string, args map[string]interface{}) string {
+	for _, key := range subjectKeys {
+		if value, ok := args[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// suggestPattern builds the pattern remembered when the user allows a call beyond this once.
+// Shell commands are allowed by program name, other tools as a whole. A command with shell
+// operators is only remembered as the exact command.
+func suggestPattern(toolName, subject string) string {
+	if toolName != "bash" {
+		return ""
+	}
+	if hasShellOperators(subject) {
+		return escapeWildcards(subject)
+	}
+	fields := strings.Fields(subject)
+	if len(fields) == 0 {
+		return ""
+	}
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	return fields[0] + " *"
+}
+
+// escapeWildcards makes a subject a pattern that matches only itself
+func escapeWildcards(subject string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`).Replace(subject)
+}
+
+// hasWildcards reports whether a pattern contains an unescaped "*" or "?"
+func hasWildcards(pattern string) bool {
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*' || r == '?':
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches s against a pattern where "*" matches any sequence, "?" one character
+// and a backslash makes the next character literal
+func matchWildcard(pattern, s string) bool {
+	if pattern == "*" {
+		return true
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		if escaped {
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+			continue
+		}
+		switch r {
+		case '\\':
+			escaped = true
+		case '*':
+			sb.WriteString("(?s:.*)")
+		case '?':
+			sb.WriteString("(?s:.)")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		sb.WriteString(regexp.QuoteMeta(`\`))
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(s)
+}
+
+func describe(toolName, subject string) string {
+	if subject == "" {
+		return toolName
+	}
+	runes := []rune(subject)
+	if len(runes) > 80 {
+		subject = string(runes[:77]) + "..."
+	}
+	return fmt.Sprintf("%s(%s)", toolName, subject)
+}
@@ -121,6 +121,12 @@ func (p *PromptLoader) GetReActThinkingPrompt(taskCtx *types.ReactTaskContext) (
 		variables["SystemContext"] = taskCtx.ProjectSummary.Context
 	}
 
+	// Repository map, the section is left out when there is none
+	variables["RepoMap"] = ""
+	if taskCtx.RepoMap != "" {
+		variables["RepoMap"] = "\n## Repository Map\n" + taskCtx.RepoMap
+	}
+
 	return p.RenderPrompt("coder", variables)
 }
 
@@ -142,6 +148,12 @@ func (p *PromptLoader) GetUserContextPrompt(conversationHistory, currentRequest
 	return p.RenderPrompt("user_context", variables)
 }
 
+// ProjectMemory returns the project memory rendered into the ReAct prompt: the content
+// of ALEX.md in workingDir, or a default line
+func (p *PromptLoader) ProjectMemory(workingDir string) string {
+	return p.loadProjectMemory(workingDir)
+}
+
 // loadProjectMemory loads project memory from ALEX.md file if it exists
 func (p *PromptLoader) loadProjectMemory(workingDir string) string {
 	defaultMemory := "You are a helpful assistant that can help the user with their tasks."
@@ -0,0 +1,498 @@
+// Package schema validates model output against a JSON Schema.
+//
+// Only the subset of JSON Schema that is useful for describing answers is
+// supported: type, enum, const, properties, required, additionalProperties,
+// items, length and range limits, pattern, allOf/anyOf/oneOf/not and local
+// $ref pointers. Unknown keywords such as format are ignored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kaptinlin/jsonrepair"
+)
+
+// ErrInvalidJSON is returned by Decode when the text contains no JSON, even after repair
+var ErrInvalidJSON = errors.New("answer is not valid JSON")
+
+// Schema is a parsed JSON Schema document
+type Schema struct {
+	raw  json.RawMessage
+	root interface{}
+}
+
+// Load reads a JSON Schema from path
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses a JSON Schema document
+func Parse(data []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, fmt.Errorf("invalid schema: expected an object or boolean, got %s", typeOf(root))
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &Schema{raw: compact.Bytes(), root: root}, nil
+}
+
+// Raw returns the schema document as compact JSON
+func (s *Schema) Raw() json.RawMessage {
+	return s.raw
+}
+
+// RootType returns the type the schema requires at the top level, or "" if it is not a single type
+func (s *Schema) RootType() string {
+	node, ok := s.root.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	t, _ := node["type"].(string)
+	return t
+}
+
+// ValidationError lists every place where a value does not match the schema
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "does not match schema: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks a decoded JSON value against the schema
+func (s *Schema) Validate(value interface{}) error {
+	v := validator{root: s.root}
+	v.validate(s.root, value, "$")
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// Result is an answer that matched the schema
+type Result struct {
+	// JSON is the validated value, indented
+	JSON string
+	// Repaired is true when the answer needed jsonrepair to parse
+	Repaired bool
+}
+
+// Decode extracts the JSON value from a model answer and validates it. Markdown code fences
+// and text around the value are ignored; malformed JSON is repaired with jsonrepair.
+// The error is ErrInvalidJSON or a *ValidationError.
+func (s *Schema) Decode(answer string) (*Result, error) {
+	data, repaired, err := extractJSON(answer)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	if err := s.Validate(value); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	return &Result{JSON: out.String(), Repaired: repaired}, nil
+}
+
+// extractJSON returns the JSON value in answer and whether it had to be repaired
+func extractJSON(answer string) ([]byte, bool, error) {
+	text := strings.TrimSpace(answer)
+	if json.Valid([]byte(text)) {
+		return []byte(text), false, nil
+	}
+	// 只有整个回答包在代码块中时才去掉围栏，字符串里的代码块要保留
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimSpace(stripCodeFence(text))
+		if json.Valid([]byte(text)) {
+			return []byte(text), false, nil
+		}
+	}
+
+	// 模型常在 JSON 前后加说明文字
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return nil, false, ErrInvalidJSON
+	}
+	if end := strings.LastIndexAny(text, "}]"); end > start && json.Valid([]byte(text[start:end+1])) {
+		return []byte(text[start : end+1]), false, nil
+	}
+
+	repaired, err := jsonrepair.JSONRepair(text[start:])
+	if err != nil || !json.Valid([]byte(repaired)) {
+		return nil, false, ErrInvalidJSON
+	}
+	return []byte(repaired), true, nil
+}
+
+// stripCodeFence returns the body of the ``` fenced block text starts with, or text unchanged
+func stripCodeFence(text string) string {
+	start := strings.Index(text, "```")
+	if start < 0 {
+		return text
+	}
+	body := text[start+3:]
+	// 跳过语言标记，如 ```json
+	if newline := strings.IndexByte(body, '\n'); newline >= 0 {
+		body = body[newline+1:]
+	}
+	if end := strings.Index(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return body
+}
+
+type validator struct {
+	root     interface{}
+	problems []string
+	// refs are the $ref targets followed for the current value, to stop on cycles
+	refs []string
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+// matches reports whether value matches node without recording problems
+func (v *validator) matches(node, value interface{}) bool {
+	sub := validator{root: v.root, refs: v.refs}
+	sub.validate(node, value, "$")
+	return len(sub.problems) == 0
+}
+
+func (v *validator) validate(node, value interface{}, path string) {
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(n, value, path)
+	}
+}
+
+// validateChild validates a property or item; $ref cycles are tracked per value
+func (v *validator) validateChild(node, value interface{}, path string) {
+	refs := v.refs
+	v.refs = nil
+	v.validate(node, value, path)
+	v.refs = refs
+}
+
+func (v *validator) validateObjectSchema(node map[string]interface{}, value interface{}, path string) {
+	if ref, ok := node["$ref"].(string); ok {
+		for _, active := range v.refs {
+			if active == ref {
+				v.fail(path, "cyclic $ref %q", ref)
+				return
+			}
+		}
+		target, err := v.resolve(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.refs = append(v.refs, ref)
+		v.validate(target, value, path)
+		v.refs = v.refs[:len(v.refs)-1]
+	}
+
+	if t, ok := node["type"]; ok && !matchesType(t, value) {
+		v.fail(path, "expected %s, got %s", describeType(t), typeOf(value))
+		return
+	}
+	if enum, ok := node["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "must be one of %s", compactJSON(enum))
+		}
+	}
+	if constant, ok := node["const"]; ok && !reflect.DeepEqual(constant, value) {
+		v.fail(path, "must be %s", compactJSON(constant))
+	}
+
+	v.validateCombinators(node, value, path)
+
+	switch val := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(node, val, path)
+	case []interface{}:
+		v.validateArray(node, val, path)
+	case string:
+		v.validateString(node, val, path)
+	case float64:
+		v.validateNumber(node, val, path)
+	}
+}
+
+func (v *validator) validateCombinators(node map[string]interface{}, value interface{}, path string) {
+	if all, ok := node["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(sub, value, path)
+		}
+	}
+	if anyOf, ok := node["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.matches(sub, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "must match at least one schema in anyOf")
+		}
+	}
+	if oneOf, ok := node["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if v.matches(sub, value) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(path, "must match exactly one schema in oneOf, matched %d", count)
+		}
+	}
+	if not, ok := node["not"]; ok && v.matches(not, value) {
+		v.fail(path, "must not match the schema in not")
+	}
+}
+
+func (v *validator) validateObject(node map[string]interface{}, value map[string]interface{}, path string) {
+	if required, ok := node["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := value[key]; !present {
+					v.fail(path, "missing required property %q", key)
+				}
+			}
+		}
+	}
+
+	properties, _ := node["properties"].(map[string]interface{})
+	additional, hasAdditional := node["additionalProperties"]
+
+	// 按键排序，保证错误信息稳定
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		if sub, ok := properties[key]; ok {
+			v.validateChild(sub, value[key], childPath)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			v.fail(path, "unexpected property %q", key)
+			continue
+		}
+		v.validateChild(additional, value[key], childPath)
+	}
+
+	if n, ok := number(node["minProperties"]); ok && float64(len(value)) < n {
+		v.fail(path, "must have at least %v properties", n)
+	}
+	if n, ok := number(node["maxProperties"]); ok && float64(len(value)) > n {
+		v.fail(path, "must have at most %v properties", n)
+	}
+}
+
+func (v *validator) validateArray(node map[string]interface{}, value []interface{}, path string) {
+	if items, ok := node["items"]; ok {
+		for i, item := range value {
+			v.validateChild(items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+	if n, ok := number(node["minItems"]); ok && float64(len(value)) < n {
+		v.fail(path, "must have at least %v items", n)
+	}
+	if n, ok := number(node["maxItems"]); ok && float64(len(value)) > n {
+		v.fail(path, "must have at most %v items", n)
+	}
+	if unique, _ := node["uniqueItems"].(bool); unique {
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if reflect.DeepEqual(value[i], value[j]) {
+					v.fail(path, "items %d and %d are equal", i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(node map[string]interface{}, value string, path string) {
+	length := float64(len([]rune(value)))
+	if n, ok := number(node["minLength"]); ok && length < n {
+		v.fail(path, "must be at least %v characters", n)
+	}
+	if n, ok := number(node["maxLength"]); ok && length > n {
+		v.fail(path, "must be at most %v characters", n)
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(path, "invalid pattern %q in schema: %v", pattern, err)
+		} else if !re.MatchString(value) {
+			v.fail(path, "must match pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(node map[string]interface{}, value float64, path string) {
+	if n, ok := number(node["minimum"]); ok && value < n {
+		v.fail(path, "must be >= %v", n)
+	}
+	if n, ok := number(node["maximum"]); ok && value > n {
+		v.fail(path, "must be <= %v", n)
+	}
+	if n, ok := number(node["exclusiveMinimum"]); ok && value <= n {
+		v.fail(path, "must be > %v", n)
+	}
+	if n, ok := number(node["exclusiveMaximum"]); ok && value >= n {
+		v.fail(path, "must be < %v", n)
+	}
+	if n, ok := number(node["multipleOf"]); ok && n > 0 {
+		if q := value / n; math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(path, "must be a multiple of %v", n)
+		}
+	}
+}
+
+// resolve follows a local JSON pointer such as #/$defs/item
+func (v *validator) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref %q: only local references are supported", ref)
+	}
+	node := v.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if node, ok = object[token]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return node, nil
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []interface{}:
+		for _, candidate := range t {
+			if name, ok := candidate.(string); ok && isType(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return typeOf(value) == name
+	}
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func describeType(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			parts = append(parts, fmt.Sprint(name))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const reviewSchema = `{
+  "type": "object",
+  "required": ["verdict", "issues"],
+  "additionalProperties": false,
+  "properties": {
+    "verdict": {"enum": ["approve", "reject"]},
+    "score": {"type": "integer", "minimum": 0, "maximum": 10},
+    "issues": {"type": "array", "items": {"$ref": "#/$defs/issue"}}
+  },
+  "$defs": {
+    "issue": {
+      "type": "object",
+      "required": ["file"],
+      "properties": {"file": {"type": "string", "minLength": 1}, "line": {"type": ["integer", "null"]}}
+    }
+  }
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := Parse([]byte(reviewSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		answer  string
+		problem string
+	}{
+		{"valid", `{"verdict":"approve","score":7,"issues":[{"file":"main.go","line":null}]}`, ""},
+		{"missing required", `{"verdict":"approve"}`, `$: missing required property "issues"`},
+		{"enum", `{"verdict":"maybe","issues":[]}`, `$.verdict: must be one of ["approve","reject"]`},
+		{"integer", `{"verdict":"reject","score":7.5,"issues":[]}`, "$.score: expected integer, got number"},
+		{"range", `{"verdict":"reject","score":11,"issues":[]}`, "$.score: must be <= 10"},
+		{"additional property", `{"verdict":"reject","issues":[],"extra":1}`, `$: unexpected property "extra"`},
+		{"ref", `{"verdict":"reject","issues":[{"file":""}]}`, "$.issues[0].file: must be at least 1 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Decode(tt.answer)
+			if tt.problem == "" {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("Decode() error = %v, want %q", err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestSchema_DecodeExtractsAndRepairs(t *testing.T) {
+	s, err := Parse([]byte(`{"type":"object","required":["name"],"properties":{"name":{"type":"string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		answer   string
+		repaired bool
+	}{
+		{"plain", `{"name":"alex"}`, false},
+		{"code fence", "Here you go:\n```json\n{\"name\": \"alex\"}\n```", false},
+		{"fenced answer", "```json\n{\"name\": \"alex\"}\n```", false},
+		{"surrounding text", `The result is {"name":"alex"}. Done.`, false},
+		{"trailing comma", `{"name": "alex",}`, true},
+		{"single quotes", `{'name': 'alex'}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Decode(tt.answer)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if result.Repaired != tt.repaired {
+				t.Errorf("Repaired = %v, want %v", result.Repaired, tt.repaired)
+			}
+			if result.JSON != "{\n  \"name\": \"alex\"\n}" {
+				t.Errorf("unexpected JSON %q", result.JSON)
+			}
+		})
+	}
+
+	if _, err := s.Decode("I could not find the name."); !errors.Is(err, ErrInvalidJSON) {
+		t.Errorf("expected ErrInvalidJSON, got %v", err)
+	}
+}
+
+// TestSchema_DecodeKeepsFencesInStrings 测试字符串里的代码块不会被当成包裹回答的围栏
+func TestSchema_DecodeKeepsFencesInStrings(t *testing.T) {
+	s, err := Parse([]byte(`{"type":"object","required":["summary"],"properties":{"summary":{"type":"string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := `{"summary":"Fixed it:\n` + "```go\\nfunc f() {}\\n```" + `\n"}`
+	result, err := s.Decode(answer)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if result.Repaired || !strings.Contains(result.JSON, "func f() {}") {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+// TestSchema_CyclicRef 测试循环引用报告为校验问题而不是无限递归
+func TestSchema_CyclicRef(t *testing.T) {
+	s, err := Parse([]byte(`{"$defs":{"a":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Validate(map[string]interface{}{})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), `cyclic $ref "#/$defs/a"`) {
+		t.Errorf("expected a cyclic $ref problem, got %v", err)
+	}
+
+	// 经过 anyOf 的循环同样会停止
+	s, err = Parse([]byte(`{"$defs":{"a":{"anyOf":[{"$ref":"#/$defs/b"}]},"b":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(map[string]interface{}{}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+
+	// 递归结构中同一个 $ref 用于不同的值是合法的
+	s, err = Parse([]byte(`{"$defs":{"node":{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#/$defs/node"}}}}},"$ref":"#/$defs/node"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := map[string]interface{}{"children": []interface{}{map[string]interface{}{"children": []interface{}{}}}}
+	if err := s.Validate(tree); err != nil {
+		t.Errorf("expected a recursive schema to validate a tree, got %v", err)
+	}
+}
+
+func TestParse_RejectsInvalidSchema(t *testing.T) {
+	if _, err := Parse([]byte(`"object"`)); err == nil {
+		t.Error("a string is not a schema")
+	}
+	s, err := Parse([]byte(`{"type": "object"}`))
+	if err != nil || s.RootType() != "object" || string(s.Raw()) != `{"type":"object"}` {
+		t.Errorf("Parse() = %v, %v", s, err)
+	}
+}
@@ -0,0 +1,96 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OutputsDir returns the directory holding the tool outputs spilled from a session
+func (m *Manager) OutputsDir(sessionID string) string {
+	return filepath.Join(m.sessionsDir, sessionID+"_outputs")
+}
+
+// SaveToolOutput writes the output of a tool call to the session's outputs directory
+// and returns its path. An output that is already saved is not written again.
+func (m *Manager) SaveToolOutput(sessionID, callID, content string) (string, error) {
+	if sessionID == "" || callID == "" {
+		return "", fmt.Errorf("session and tool call IDs are required")
+	}
+
+	dir := m.OutputsDir(sessionID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create outputs directory: %w", err)
+	}
+
+	path := filepath.Join(dir, sanitizeFileName(callID)+".txt")
+	if info, err := os.Stat(path); err == nil && info.Size() == int64(len(content)) {
+		return path, nil
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write tool output: %w", err)
+	}
+	return path, nil
+}
+
+// ToolOutputPath returns the file of a saved tool output by its handle, the tool call ID
+func (m *Manager) ToolOutputPath(sessionID, handle string) (string, error) {
+	if sessionID == "" || handle == "" {
+		return "", fmt.Errorf("session and output handle are required")
+	}
+	path := filepath.Join(m.OutputsDir(sessionID), sanitizeFileName(handle)+".txt")
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("no saved output %q in this session", handle)
+	}
+	return path, nil
+}
+
+// cleanupSessionOutputs removes the tool outputs saved for a session
+func (m *Manager) cleanupSessionOutputs(sessionID string) {
+	if err := os.RemoveAll(m.OutputsDir(sessionID)); err != nil {
+		fmt.Printf("Warning: failed to remove tool outputs of session %s: %v\n", sessionID, err)
+	}
+}
+
+// collectOrphanOutputs removes outputs directories of sessions that are neither loaded nor on disk
+func (m *Manager) collectOrphanOutputs() {
+	entries, err := os.ReadDir(m.sessionsDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		sessionID, ok := strings.CutSuffix(entry.Name(), "_outputs")
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		m.mutex.RLock()
+		_, loaded := m.sessions[sessionID]
+		m.mutex.RUnlock()
+		if loaded {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m.sessionsDir, sessionID+".json")); os.IsNotExist(err) {
+			m.cleanupSessionOutputs(sessionID)
+		}
+	}
+}
+
+// sanitizeFileName replaces characters that are not safe in file names. A name that had to
+// change gets a short hash of the original, so different call IDs never share a file.
+func sanitizeFileName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	if sanitized == name {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return sanitized + "-" + hex.EncodeToString(sum[:4])
+}
@@ -24,6 +24,16 @@ type Session struct {
 	// Kimi API context caching
 	KimiCacheID string `json:"kimi_cache_id,omitempty"`
 
+	// Last response stored by the OpenAI Responses API, continued with previous_response_id
+	ResponseChain *ResponseChain `json:"response_chain,omitempty"`
+
+	// Accumulated LLM usage across all tasks
+	TokensUsed int     `json:"tokens_used,omitempty"`
+	Cost       float64 `json:"cost,omitempty"`
+
+	// Context compression runs and the tokens they saved
+	Compression *CompressionStats `json:"compression,omitempty"`
+
 	mutex sync.RWMutex
 }
 
@@ -35,6 +45,42 @@ type Message struct {
 	ToolID    string                 `json:"tool_id,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
+
+	// Reasoning is the model's reasoning/thinking text for an assistant message
+	Reasoning string `json:"reasoning,omitempty"`
+	// ThinkingSignature lets Anthropic and Gemini verify thinking sent back in later turns
+	ThinkingSignature string `json:"thinking_signature,omitempty"`
+	// Parts are images and extra text attached after Content; images are stored by path or URL
+	Parts []ContentPart `json:"parts,omitempty"`
+}
+
+// ContentPart is a text or image part of a message
+type ContentPart struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// ResponseChain is the last response stored by the provider and the messages it covers
+type ResponseChain struct {
+	ResponseID  string `json:"response_id"`
+	Model       string `json:"model"`
+	Messages    int    `json:"messages"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// CompressionStats records context compression in a session
+type CompressionStats struct {
+	Strategy     string    `json:"strategy"`      // Strategy of the last run
+	Runs         int       `json:"runs"`          // Number of runs
+	Elided       int       `json:"elided"`        // Stale tool outputs replaced by stubs
+	TokensBefore int       `json:"tokens_before"` // Prompt tokens before the last run
+	TokensAfter  int       `json:"tokens_after"`  // Prompt tokens after the last run
+	TokensSaved  int       `json:"tokens_saved"`  // Tokens removed by all runs
+	LastRun      time.Time `json:"last_run"`
 }
 
 // ToolCall represents a tool execution request
@@ -193,8 +239,9 @@ func (m *Manager) DeleteSession(sessionID string) error {
 		return fmt.Errorf("failed to delete session file: %w", err)
 	}
 
-	// Also clean up the session's todo file
+	// Also clean up the session's todo file and saved tool outputs
 	m.cleanupSessionTodoFile(sessionID)
+	m.cleanupSessionOutputs(sessionID)
 
 	return nil
 }
@@ -222,6 +269,9 @@ func (m *Manager) CleanupExpiredSessions(maxAge time.Duration) error {
 		}
 	}
 
+	// Tool outputs left behind by sessions deleted by hand
+	m.collectOrphanOutputs()
+
 	return nil
 }
 
@@ -367,6 +417,9 @@ func (s *Session) SetConfig(key string, value interface{}) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	if s.Config == nil {
+		s.Config = make(map[string]interface{})
+	}
 	s.Config[key] = value
 	s.Updated = time.Now()
 }
@@ -388,6 +441,23 @@ func (s *Session) ClearMessages() {
 	s.Updated = time.Now()
 }
 
+// AddUsage accumulates the tokens and USD cost of one LLM call
+func (s *Session) AddUsage(tokens int, cost float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.TokensUsed += tokens
+	s.Cost += cost
+}
+
+// GetUsage returns the accumulated tokens and USD cost of the session
+func (s *Session) GetUsage() (int, float64) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.TokensUsed, s.Cost
+}
+
 // SetKimiCacheID sets the Kimi cache ID for the session
 func (s *Session) SetKimiCacheID(cacheID string) {
 	s.mutex.Lock()
@@ -414,6 +484,60 @@ func (s *Session) ClearKimiCacheID() {
 	s.Updated = time.Now()
 }
 
+// SetResponseChain records the last response stored by the provider
+func (s *Session) SetResponseChain(chain *ResponseChain) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ResponseChain = chain
+	s.Updated = time.Now()
+}
+
+// GetResponseChain returns a copy of the response chain, or nil if there is none
+func (s *Session) GetResponseChain() *ResponseChain {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.ResponseChain == nil {
+		return nil
+	}
+	chain := *s.ResponseChain
+	return &chain
+}
+
+// RecordCompression adds a compression run that elided tool outputs and ran strategy (empty
+// when only outputs were elided), shrinking the prompt from tokensBefore to tokensAfter
+func (s *Session) RecordCompression(strategy string, elided, tokensBefore, tokensAfter int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Compression == nil {
+		s.Compression = &CompressionStats{}
+	}
+	if strategy != "" {
+		s.Compression.Strategy = strategy
+		s.Compression.Runs++
+	}
+	s.Compression.Elided += elided
+	s.Compression.TokensBefore = tokensBefore
+	s.Compression.TokensAfter = tokensAfter
+	s.Compression.TokensSaved += max(tokensBefore-tokensAfter, 0)
+	s.Compression.LastRun = time.Now()
+	s.Updated = time.Now()
+}
+
+// GetCompressionStats returns a copy of the compression stats, or nil if nothing was compressed
+func (s *Session) GetCompressionStats() *CompressionStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.Compression == nil {
+		return nil
+	}
+	stats := *s.Compression
+	return &stats
+}
+
 // cleanupSessionTodoFile removes any existing todo file for the session
 func (m *Manager) cleanupSessionTodoFile(sessionID string) {
 	todoFile := filepath.Join(m.sessionsDir, sessionID+"_todo.md")
@@ -487,3 +487,76 @@ func TestSession_ThreadSafety(t *testing.T) {
 		t.Errorf("Expected 10 messages, got %d", len(session.Messages))
 	}
 }
+
+// TestSession_RecordCompression 测试压缩记录累计节省的token
+func TestSession_RecordCompression(t *testing.T) {
+	session := &Session{}
+	if session.GetCompressionStats() != nil {
+		t.Fatal("Expected no stats before compression")
+	}
+
+	session.RecordCompression("cache_friendly", 0, 12000, 3000)
+	session.RecordCompression("sliding_window", 1, 9000, 4000)
+	session.RecordCompression("", 2, 5000, 3000)
+
+	stats := session.GetCompressionStats()
+	if stats.Strategy != "sliding_window" || stats.Runs != 2 || stats.Elided != 3 {
+		t.Errorf("Expected the last strategy, 2 runs and 3 elided outputs, got %+v", stats)
+	}
+	if stats.TokensBefore != 5000 || stats.TokensAfter != 3000 || stats.TokensSaved != 16000 {
+		t.Errorf("Unexpected token counts %+v", stats)
+	}
+}
+
+// TestSession_ToolOutputs 测试保存的工具输出随会话删除，孤立的输出目录被回收
+func TestSession_ToolOutputs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if _, err := manager.StartSession("outputs"); err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+
+	path, err := manager.SaveToolOutput("outputs", "call/1", "full output")
+	if err != nil {
+		t.Fatalf("Failed to save output: %v", err)
+	}
+	if found, err := manager.ToolOutputPath("outputs", "call/1"); err != nil || found != path {
+		t.Errorf("Expected the saved output at %s, got %s, %v", path, found, err)
+	}
+	if _, err := manager.ToolOutputPath("outputs", "call_2"); err == nil {
+		t.Error("Expected an error for an unknown handle")
+	}
+	// 清理文件名后相同的调用 ID 不能共用一个文件
+	other, err := manager.SaveToolOutput("outputs", "call_1", "other output")
+	if err != nil || other == path {
+		t.Fatalf("Expected call_1 to get its own file, got %s, %v", other, err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "full output" {
+		t.Errorf("Expected the output of call/1 to be kept, got %q", content)
+	}
+
+	// 会话文件已删除的输出目录
+	orphan := manager.OutputsDir("gone")
+	if err := os.MkdirAll(orphan, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.CleanupExpiredSessions(time.Hour); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("Expected the orphan outputs to be removed")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("Expected the outputs of a live session to be kept")
+	}
+
+	if err := manager.DeleteSession("outputs"); err != nil {
+		t.Fatalf("Failed to delete session: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Error("Expected the outputs to be deleted with the session")
+	}
+}
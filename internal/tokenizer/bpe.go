@@ -0,0 +1,193 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxPieceBytes bounds the quadratic merge loop; longer pieces are merged in chunks
+	maxPieceBytes = 4096
+	// maxCachedPieces bounds the piece cache, which is cleared when full
+	maxCachedPieces = 50000
+)
+
+// BPE is a byte-level byte-pair encoder using tiktoken-format ranks
+type BPE struct {
+	name  string
+	ranks map[string]int
+	split Splitter
+
+	mu    sync.RWMutex
+	cache map[string]int
+}
+
+// NewBPE creates an encoder from merge ranks, where a lower rank merges first
+func NewBPE(name string, ranks map[string]int, split Splitter) *BPE {
+	return &BPE{name: name, ranks: ranks, split: split, cache: make(map[string]int)}
+}
+
+// LoadBPE loads a tiktoken vocab file (one "base64-token rank" pair per line)
+func LoadBPE(name, path string, split Splitter) (*BPE, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	ranks, err := ReadRanks(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return NewBPE(name, ranks, split), nil
+}
+
+// ReadRanks parses tiktoken-format merge ranks
+func ReadRanks(r io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rankText, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing rank", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(rankText)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ranks[string(decoded)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("empty vocab")
+	}
+	return ranks, nil
+}
+
+// Name returns the encoding name
+func (b *BPE) Name() string {
+	return b.name
+}
+
+// Count returns the number of tokens in text
+func (b *BPE) Count(text string) int {
+	total := 0
+	b.split(text, func(piece string) {
+		total += b.countPiece(piece)
+	})
+	return total
+}
+
+// Encode returns the token ids of text
+func (b *BPE) Encode(text string) []int {
+	var ids []int
+	b.split(text, func(piece string) {
+		if rank, ok := b.ranks[piece]; ok {
+			ids = append(ids, rank)
+			return
+		}
+		for len(piece) > 0 {
+			chunk := piece[:min(len(piece), maxPieceBytes)]
+			piece = piece[len(chunk):]
+			ids = append(ids, b.mergeChunk(chunk)...)
+		}
+	})
+	return ids
+}
+
+func (b *BPE) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+
+	b.mu.RLock()
+	count, ok := b.cache[piece]
+	b.mu.RUnlock()
+	if ok {
+		return count
+	}
+
+	for rest := piece; len(rest) > 0; {
+		chunk := rest[:min(len(rest), maxPieceBytes)]
+		rest = rest[len(chunk):]
+		count += len(b.mergeChunk(chunk))
+	}
+
+	b.mu.Lock()
+	if len(b.cache) >= maxCachedPieces {
+		b.cache = make(map[string]int)
+	}
+	b.cache[piece] = count
+	b.mu.Unlock()
+	return count
+}
+
+// mergeChunk repeatedly merges the adjacent pair with the lowest rank, as tiktoken does
+func (b *BPE) mergeChunk(piece string) []int {
+	// parts[i] is the start offset of the i-th part; the last entry is len(piece)
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+
+	pairRank := func(i int) int {
+		if i+2 >= len(parts) {
+			return math.MaxInt
+		}
+		if rank, ok := b.ranks[piece[parts[i]:parts[i+2]]]; ok {
+			return rank
+		}
+		return math.MaxInt
+	}
+
+	ranks := make([]int, len(parts))
+	for i := range ranks {
+		ranks[i] = pairRank(i)
+	}
+
+	for len(parts) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-2; i++ {
+			if ranks[i] < bestRank {
+				best, bestRank = i, ranks[i]
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts = append(parts[:best+1], parts[best+2:]...)
+		ranks = append(ranks[:best+1], ranks[best+2:]...)
+		ranks[best] = pairRank(best)
+		if best > 0 {
+			ranks[best-1] = pairRank(best - 1)
+		}
+	}
+
+	ids := make([]int, 0, len(parts)-1)
+	for i := 0; i+1 < len(parts); i++ {
+		rank, ok := b.ranks[piece[parts[i]:parts[i+1]]]
+		if !ok {
+			// 词表未覆盖的单字节，真实词表不会出现
+			rank = -1
+		}
+		ids = append(ids, rank)
+	}
+	return ids
+}
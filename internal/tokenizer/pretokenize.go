@@ -0,0 +1,222 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Splitter cuts text into the pieces BPE is applied to, calling emit for each one
+type Splitter func(text string, emit func(piece string))
+
+// 手写实现 tiktoken 的预分词正则，避免依赖支持 lookahead 的正则库
+//
+// cl100k_base:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// o200k_base 把单词按大小写切分，缩写作为后缀，标点后可跟 '/'
+
+// SplitCL100k pre-tokenizes text like the cl100k_base pattern
+func SplitCL100k(text string, emit func(piece string)) {
+	for i := 0; i < len(text); {
+		n := contraction(text[i:])
+		if n == 0 {
+			n = cl100kWord(text[i:])
+		}
+		if n == 0 {
+			n = numberRun(text[i:])
+		}
+		if n == 0 {
+			n = punctuationRun(text[i:], false)
+		}
+		if n == 0 {
+			n = whitespaceRun(text[i:])
+		}
+		emit(text[i : i+n])
+		i += n
+	}
+}
+
+// SplitO200k pre-tokenizes text like the o200k_base pattern
+func SplitO200k(text string, emit func(piece string)) {
+	for i := 0; i < len(text); {
+		n := o200kWord(text[i:])
+		if n == 0 {
+			n = numberRun(text[i:])
+		}
+		if n == 0 {
+			n = punctuationRun(text[i:], true)
+		}
+		if n == 0 {
+			n = whitespaceRun(text[i:])
+		}
+		emit(text[i : i+n])
+		i += n
+	}
+}
+
+// runeAt decodes the rune at s[i:]; invalid bytes count as one punctuation rune
+func runeAt(s string, i int) (rune, int) {
+	if i >= len(s) {
+		return -1, 0
+	}
+	return utf8.DecodeRuneInString(s[i:])
+}
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+// isOther matches [^\s\p{L}\p{N}]
+func isOther(r rune) bool {
+	return r >= 0 && !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// isPrefix matches [^\r\n\p{L}\p{N}]
+func isPrefix(r rune) bool {
+	return r >= 0 && !isNewline(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// contraction matches (?i:'s|'t|'re|'ve|'m|'ll|'d)
+func contraction(s string) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	lower := func(b byte) byte { return b | 0x20 }
+	switch lower(s[1]) {
+	case 's', 't', 'm', 'd':
+		return 2
+	}
+	if len(s) >= 3 {
+		switch string([]byte{lower(s[1]), lower(s[2])}) {
+		case "re", "ve", "ll":
+			return 3
+		}
+	}
+	return 0
+}
+
+// optionalPrefix returns the width of a leading [^\r\n\p{L}\p{N}] followed by a rune accepted by next
+func optionalPrefix(s string, next func(rune) bool) int {
+	r, w := runeAt(s, 0)
+	if !isPrefix(r) {
+		return 0
+	}
+	if r2, _ := runeAt(s, w); next(r2) {
+		return w
+	}
+	return 0
+}
+
+// cl100kWord matches [^\r\n\p{L}\p{N}]?\p{L}+
+func cl100kWord(s string) int {
+	i := optionalPrefix(s, unicode.IsLetter)
+	start := i
+	for {
+		r, w := runeAt(s, i)
+		if w == 0 || !unicode.IsLetter(r) {
+			break
+		}
+		i += w
+	}
+	if i == start {
+		return 0
+	}
+	return i
+}
+
+func isUpperClass(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+func isLowerClass(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// o200kWord matches [^\r\n\p{L}\p{N}]?(Upper*Lower+|Upper+Lower*) followed by an optional contraction
+func o200kWord(s string) int {
+	i := optionalPrefix(s, func(r rune) bool { return isUpperClass(r) || isLowerClass(r) })
+	start := i
+	for {
+		r, w := runeAt(s, i)
+		if w == 0 || !isUpperClass(r) {
+			break
+		}
+		i += w
+	}
+	for {
+		r, w := runeAt(s, i)
+		if w == 0 || !isLowerClass(r) {
+			break
+		}
+		i += w
+	}
+	if i == start {
+		return 0
+	}
+	return i + contraction(s[i:])
+}
+
+// numberRun matches \p{N}{1,3}
+func numberRun(s string) int {
+	i := 0
+	for n := 0; n < 3; n++ {
+		r, w := runeAt(s, i)
+		if w == 0 || !unicode.IsNumber(r) {
+			break
+		}
+		i += w
+	}
+	return i
+}
+
+// punctuationRun matches ` ?[^\s\p{L}\p{N}]+[\r\n]*`, with '/' allowed in the tail for o200k
+func punctuationRun(s string, slashTail bool) int {
+	i := 0
+	if len(s) > 0 && s[0] == ' ' {
+		i = 1
+	}
+	start := i
+	for {
+		r, w := runeAt(s, i)
+		if w == 0 || !isOther(r) {
+			break
+		}
+		i += w
+	}
+	if i == start {
+		return 0
+	}
+	for i < len(s) && (s[i] == '\r' || s[i] == '\n' || (slashTail && s[i] == '/')) {
+		i++
+	}
+	return i
+}
+
+// whitespaceRun matches \s*[\r\n]+|\s+(?!\S)|\s+ and falls back to one rune for anything else
+func whitespaceRun(s string) int {
+	end, lastNewline := 0, -1
+	var lastWidth int
+	for {
+		r, w := runeAt(s, end)
+		if w == 0 || !unicode.IsSpace(r) {
+			break
+		}
+		if isNewline(r) {
+			lastNewline = end + w
+		}
+		lastWidth = w
+		end += w
+	}
+	switch {
+	case end == 0:
+		// 无效的 UTF-8 字节等无法归类的输入
+		_, w := runeAt(s, 0)
+		return max(w, 1)
+	case lastNewline > 0:
+		return lastNewline
+	case end == len(s) || end == lastWidth:
+		return end
+	default:
+		// 留下最后一个空白字符给后面的单词
+		return end - lastWidth
+	}
+}
@@ -0,0 +1,144 @@
+package tokenizer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Tokenizer counts the tokens a model sees for a piece of text
+type Tokenizer interface {
+	// Name returns the encoding name, e.g. cl100k_base
+	Name() string
+	// Count returns the number of tokens in text
+	Count(text string) int
+}
+
+// 支持的编码
+const (
+	CL100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// VocabDirEnv overrides the directory vocab files are loaded from
+const VocabDirEnv = "ALEX_TOKENIZER_DIR"
+
+// o200kModelPrefixes are the model families that use o200k_base; everything else
+// is counted with cl100k_base, which is close enough for non-OpenAI models
+var o200kModelPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"}
+
+// EncodingForModel returns the encoding used to count tokens for model
+func EncodingForModel(model string) string {
+	name := strings.ToLower(strings.TrimSpace(model))
+	name = name[strings.LastIndex(name, "/")+1:]
+	for _, prefix := range o200kModelPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return O200kBase
+		}
+	}
+	return CL100kBase
+}
+
+var encodings = struct {
+	sync.Mutex
+	byName map[string]Tokenizer
+}{byName: make(map[string]Tokenizer)}
+
+// ForModel returns the tokenizer for model. Encodings are loaded once and shared.
+func ForModel(model string) Tokenizer {
+	return ForEncoding(EncodingForModel(model))
+}
+
+// ForEncoding returns the tokenizer for the named encoding. When its vocab file is
+// not installed it falls back to an approximate tokenizer with the same pre-tokenizer.
+func ForEncoding(encoding string) Tokenizer {
+	encodings.Lock()
+	defer encodings.Unlock()
+
+	if tok, ok := encodings.byName[encoding]; ok {
+		return tok
+	}
+
+	split := splitterFor(encoding)
+	var tok Tokenizer
+	path := vocabPath(encoding)
+	bpe, err := LoadBPE(encoding, path, split)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[WARN] Tokenizer: failed to load %s from %s: %v", encoding, path, err)
+		} else {
+			log.Printf("[DEBUG] Tokenizer: %s not found at %s, using approximate counts", encoding, path)
+		}
+		tok = NewApproximate(encoding, split)
+	} else {
+		tok = bpe
+	}
+
+	encodings.byName[encoding] = tok
+	return tok
+}
+
+// Reset drops the loaded encodings, e.g. after installing vocab files
+func Reset() {
+	encodings.Lock()
+	defer encodings.Unlock()
+	encodings.byName = make(map[string]Tokenizer)
+}
+
+// vocabPath returns where the tiktoken vocab file of encoding is expected
+func vocabPath(encoding string) string {
+	dir := os.Getenv(VocabDirEnv)
+	if dir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			homeDir = "."
+		}
+		dir = filepath.Join(homeDir, ".alex", "tokenizers")
+	}
+	return filepath.Join(dir, encoding+".tiktoken")
+}
+
+// splitterFor returns the pre-tokenizer matching encoding
+func splitterFor(encoding string) Splitter {
+	if encoding == O200kBase {
+		return SplitO200k
+	}
+	return SplitCL100k
+}
+
+// Approximate counts tokens without a vocab: every pre-tokenized piece is at
+// least one token, longer ASCII pieces about one token per 5 bytes and non-ASCII
+// text about one token per character.
+type Approximate struct {
+	name  string
+	split Splitter
+}
+
+// NewApproximate creates an approximate tokenizer using split as pre-tokenizer
+func NewApproximate(name string, split Splitter) *Approximate {
+	return &Approximate{name: name, split: split}
+}
+
+// Name returns the name of the approximated encoding
+func (a *Approximate) Name() string {
+	return a.name + " (approximate)"
+}
+
+// Count returns the approximate number of tokens in text
+func (a *Approximate) Count(text string) int {
+	total := 0
+	a.split(text, func(piece string) {
+		ascii, other := 0, 0
+		for _, r := range piece {
+			if r < 0x80 {
+				ascii++
+			} else {
+				other++
+			}
+		}
+		total += max(1, ascii/5+other)
+	})
+	return total
+}
@@ -0,0 +1,133 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRanks builds a tiny vocab: every single byte plus a few merges
+func testRanks() map[string]int {
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, merge := range []string{"ab", "bc", "abc", " a", " abc"} {
+		ranks[merge] = 256 + i
+	}
+	return ranks
+}
+
+func TestBPE_Encode(t *testing.T) {
+	bpe := NewBPE("test", testRanks(), SplitCL100k)
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"abc", []int{258}},
+		{"xbc", []int{'x', 257}},
+		{"abcab", []int{258, 256}},
+		{"abc abc", []int{258, 260}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := bpe.Encode(tt.text)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+		if count := bpe.Count(tt.text); count != len(tt.want) {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, count, len(tt.want))
+		}
+	}
+}
+
+func TestSplitCL100k(t *testing.T) {
+	got := collect(SplitCL100k, "Hello world, how's it going?\n\n  x 123456")
+	want := []string{"Hello", " world", ",", " how", "'s", " it", " going", "?\n\n", " ", " x", " ", "123", "456"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitCL100k = %q, want %q", got, want)
+	}
+}
+
+func TestSplitO200k(t *testing.T) {
+	got := collect(SplitO200k, "HelloWorld's path/to  \n")
+	want := []string{"Hello", "World's", " path", "/to", "  \n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitO200k = %q, want %q", got, want)
+	}
+}
+
+func TestSplitKeepsAllBytes(t *testing.T) {
+	text := "中文 mixed\tcontent\r\n\xff\xfe 42!!\n"
+	for _, split := range []Splitter{SplitCL100k, SplitO200k} {
+		if joined := strings.Join(collect(split, text), ""); joined != text {
+			t.Errorf("pieces do not reassemble the input: %q", joined)
+		}
+	}
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o-mini":                O200kBase,
+		"openai/gpt-4.1":             O200kBase,
+		"o3-mini":                    O200kBase,
+		"gpt-4":                      CL100kBase,
+		"moonshotai/kimi-k2:free":    CL100kBase,
+		"claude-3-5-sonnet-20241022": CL100kBase,
+		"":                           CL100kBase,
+	}
+	for model, want := range tests {
+		if got := EncodingForModel(model); got != want {
+			t.Errorf("EncodingForModel(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestForEncoding_LoadsVocabFromDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(VocabDirEnv, dir)
+	Reset()
+	defer Reset()
+
+	if _, ok := ForEncoding(CL100kBase).(*Approximate); !ok {
+		t.Fatalf("expected approximate tokenizer without a vocab file")
+	}
+
+	var vocab strings.Builder
+	for token, rank := range testRanks() {
+		fmt.Fprintf(&vocab, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	if err := os.WriteFile(filepath.Join(dir, CL100kBase+".tiktoken"), []byte(vocab.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Reset()
+
+	tok := ForModel("gpt-4")
+	if tok.Name() != CL100kBase {
+		t.Fatalf("expected BPE tokenizer, got %s", tok.Name())
+	}
+	if count := tok.Count("abc abc"); count != 2 {
+		t.Errorf("Count = %d, want 2", count)
+	}
+}
+
+func TestApproximate_Count(t *testing.T) {
+	tok := NewApproximate(CL100kBase, SplitCL100k)
+	if got := tok.Count("Hello world"); got != 2 {
+		t.Errorf("Count(Hello world) = %d, want 2", got)
+	}
+	if got := tok.Count("你好世界"); got != 4 {
+		t.Errorf("Count(你好世界) = %d, want 4", got)
+	}
+}
+
+func collect(split Splitter, text string) []string {
+	var pieces []string
+	split(text, func(piece string) { pieces = append(pieces, piece) })
+	return pieces
+}
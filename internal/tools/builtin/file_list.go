@@ -20,6 +20,10 @@ func (t *FileListTool) Name() string {
 	return "file_list"
 }
 
+func (t *FileListTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *FileListTool) Description() string {
 	return "List files and directories in a specified path. Supports recursive listing."
 }
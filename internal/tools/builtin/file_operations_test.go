@@ -2,10 +2,13 @@ package builtin
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"alex/internal/session"
 )
 
 func TestFileReadTool(t *testing.T) {
@@ -107,6 +110,97 @@ func TestFileReadTool(t *testing.T) {
 	}
 }
 
+func TestFileReadTool_Image(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "diagram.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := CreateFileReadTool().Execute(context.Background(), map[string]interface{}{"file_path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Data["image_path"] != path || result.Data["media_type"] != "image/png" {
+		t.Errorf("expected an image attachment, got %+v", result.Data)
+	}
+	if !strings.Contains(result.Content, "attached") {
+		t.Errorf("unexpected content %q", result.Content)
+	}
+}
+
+func TestReadOutputTool(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	manager, err := session.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.StartSession("outputs"); err != nil {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	for i := 1; i <= 500; i++ {
+		fmt.Fprintf(&output, "line %d\n", i)
+	}
+	if _, err := manager.SaveToolOutput("outputs", "call_1", output.String()); err != nil {
+		t.Fatal(err)
+	}
+	tool := CreateReadOutputToolWithSessionManager(manager)
+
+	tests := []struct {
+		name     string
+		args     map[string]interface{}
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "first page",
+			args:     map[string]interface{}{"handle": "call_1"},
+			contains: []string{"lines 1-200 of 500", "  200 line 200", "continue with offset=201"},
+			excludes: []string{"line 201"},
+		},
+		{
+			name:     "offset and limit",
+			args:     map[string]interface{}{"handle": "call_1", "offset": float64(490), "limit": float64(20)},
+			contains: []string{"lines 490-500 of 500", "  500 line 500"},
+			excludes: []string{"line 489", "continue with"},
+		},
+		{
+			name:     "pattern",
+			args:     map[string]interface{}{"handle": "call_1", "pattern": `^line 4\d\d$`, "limit": float64(5)},
+			contains: []string{"100 of 500 lines from line 1 match", "  400 line 400", "  404 line 404", "continue with offset=405"},
+			excludes: []string{"line 405", "line 40\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tool.Validate(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			result, err := tool.Execute(context.Background(), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result.Content, want) {
+					t.Errorf("expected %q in %q", want, result.Content)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(result.Content, unwanted) {
+					t.Errorf("unexpected %q in output", unwanted)
+				}
+			}
+		})
+	}
+
+	if _, err := tool.Execute(context.Background(), map[string]interface{}{"handle": "call_9"}); err == nil {
+		t.Error("expected an error for an unknown handle")
+	}
+	if err := tool.Validate(map[string]interface{}{"handle": "call_1", "pattern": "("}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
 func TestFileUpdateTool(t *testing.T) {
 	tool := CreateFileUpdateTool()
 
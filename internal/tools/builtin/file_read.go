@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"alex/internal/llm"
 )
 
 // FileReadTool implements file reading functionality
@@ -18,8 +20,12 @@ func (t *FileReadTool) Name() string {
 	return "file_read"
 }
 
+func (t *FileReadTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *FileReadTool) Description() string {
-	return "Read the contents of a file. Supports reading specific line ranges."
+	return "Read the contents of a file. Supports reading specific line ranges. Image files (png, jpg, gif, webp) are attached as images for models with vision."
 }
 
 func (t *FileReadTool) Parameters() map[string]interface{} {
@@ -85,6 +91,11 @@ func (t *FileReadTool) Execute(ctx context.Context, args map[string]interface{})
 		return nil, fmt.Errorf("file does not exist: %s", filePath)
 	}
 
+	// 图片不按文本读取，交给支持视觉的模型查看
+	if mediaType := llm.ImageMediaType(resolvedPath); mediaType != "" {
+		return readImageFile(filePath, resolvedPath, mediaType)
+	}
+
 	// Read file content
 	content, err := os.ReadFile(resolvedPath)
 	if err != nil {
@@ -157,4 +168,22 @@ func (t *FileReadTool) Execute(ctx context.Context, args map[string]interface{})
 			"displayed_lines": len(lines),
 		},
 	}, nil
-}
\ No newline at end of file
+}
+
+// readImageFile returns an image file as an attachment; the agent sends image_path as an image part
+func readImageFile(filePath, resolvedPath, mediaType string) (*ToolResult, error) {
+	info, err := os.Stat(resolvedPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return &ToolResult{
+		Content: fmt.Sprintf("Image file %s (%s, %d bytes) is attached below.", filePath, mediaType, info.Size()),
+		Data: map[string]interface{}{
+			"file_path":     filePath,
+			"resolved_path": resolvedPath,
+			"file_size":     info.Size(),
+			"image_path":    resolvedPath,
+			"media_type":    mediaType,
+		},
+	}, nil
+}
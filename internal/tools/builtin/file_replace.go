@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"alex/internal/checkpoint"
 )
 
 // FileReplaceTool implements file content replacement functionality
@@ -57,6 +59,11 @@ func (t *FileReplaceTool) Execute(ctx context.Context, args map[string]interface
 	resolver := GetPathResolverFromContext(ctx)
 	resolvedPath := resolver.ResolvePath(filePath)
 
+	// 写入前记录检查点（在创建目录之前，以便撤销时能删除新建的目录）
+	if err := checkpoint.FromContext(ctx).Snapshot(resolvedPath); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint file: %w", err)
+	}
+
 	// Create parent directories if needed
 	dir := filepath.Dir(resolvedPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	
+	"alex/internal/checkpoint"
 	"alex/internal/utils"
 )
 
@@ -71,17 +72,22 @@ func (t *FileUpdateTool) Execute(ctx context.Context, args map[string]any) (*Too
 
 	// Handle new file creation case (empty old_string)
 	if oldString == "" {
+		// Check if file already exists
+		if _, err := os.Stat(resolvedPath); err == nil {
+			return nil, fmt.Errorf("file already exists: %s", filePath)
+		}
+
+		// 记录检查点（在创建目录之前，以便撤销时能删除新建的目录）
+		if err := checkpoint.FromContext(ctx).Snapshot(resolvedPath); err != nil {
+			return nil, fmt.Errorf("failed to checkpoint file: %w", err)
+		}
+
 		// Create parent directories if needed
 		dir := filepath.Dir(resolvedPath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, fmt.Errorf("failed to create directories: %w", err)
 		}
 
-		// Check if file already exists
-		if _, err := os.Stat(resolvedPath); err == nil {
-			return nil, fmt.Errorf("file already exists: %s", filePath)
-		}
-
 		// Write new file
 		err := os.WriteFile(resolvedPath, []byte(newString), 0644)
 		if err != nil {
@@ -136,6 +142,11 @@ func (t *FileUpdateTool) Execute(ctx context.Context, args map[string]any) (*Too
 	// Generate diff data for CLI display
 	diff := utils.GenerateUnifiedDiff(originalContent, newContent, filePath, utils.DefaultDiffOptions)
 	
+	// 写入前记录检查点
+	if err := checkpoint.FromContext(ctx).Snapshot(resolvedPath); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint file: %w", err)
+	}
+
 	// Write the modified content
 	err = os.WriteFile(resolvedPath, []byte(newContent), 0644)
 	if err != nil {
@@ -0,0 +1,193 @@
+package builtin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"alex/internal/session"
+)
+
+const (
+	defaultReadOutputLines = 200
+	maxReadOutputLines     = 2000
+	// 单行和整体输出的上限，避免分页结果本身又被截断
+	maxReadOutputLineLength = 500
+	maxReadOutputBytes      = 24 * 1024
+)
+
+// ReadOutputTool pages through tool outputs that were too large for the conversation
+type ReadOutputTool struct {
+	sessionManager *session.Manager
+}
+
+// CreateReadOutputToolWithSessionManager creates the read_output tool for the outputs of the current session
+func CreateReadOutputToolWithSessionManager(sessionManager *session.Manager) *ReadOutputTool {
+	return &ReadOutputTool{sessionManager: sessionManager}
+}
+
+func (t *ReadOutputTool) Name() string {
+	return "read_output"
+}
+
+func (t *ReadOutputTool) IsReadOnly() bool {
+	return true
+}
+
+func (t *ReadOutputTool) Description() string {
+	return "Read a saved tool output that was truncated or elided from the conversation. Page through it by line offset, or search it with a regular expression to list the matching lines."
+}
+
+func (t *ReadOutputTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"handle": map[string]interface{}{
+				"type":        "string",
+				"description": "Handle of the saved output, as given in the truncation note",
+			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Line to start from (1-based, default 1)",
+				"minimum":     1,
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of lines to return (default %d)", defaultReadOutputLines),
+				"minimum":     1,
+				"maximum":     maxReadOutputLines,
+			},
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression; only matching lines are returned, with their line numbers",
+			},
+		},
+		"required": []string{"handle"},
+	}
+}
+
+func (t *ReadOutputTool) Validate(args map[string]interface{}) error {
+	validator := NewValidationFramework().
+		AddRequiredStringField("handle", "Handle of the saved output").
+		AddOptionalIntField("offset", "Line to start from (1-based)", 1, 0).
+		AddOptionalIntField("limit", "Maximum number of lines", 1, maxReadOutputLines).
+		AddOptionalStringField("pattern", "Regular expression to search for")
+
+	if err := validator.Validate(args); err != nil {
+		return err
+	}
+	if pattern, ok := args["pattern"].(string); ok && pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *ReadOutputTool) Execute(ctx context.Context, args map[string]interface{}) (*ToolResult, error) {
+	if t.sessionManager == nil {
+		return nil, fmt.Errorf("read_output requires session manager - tool not properly initialized")
+	}
+	sessionID, ok := t.sessionManager.GetSessionID()
+	if !ok {
+		return nil, fmt.Errorf("read_output requires an active session")
+	}
+
+	handle := args["handle"].(string)
+	path, err := t.sessionManager.ToolOutputPath(sessionID, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := intArg(args, "offset", 1)
+	limit := intArg(args, "limit", defaultReadOutputLines)
+	var re *regexp.Regexp
+	if pattern, ok := args["pattern"].(string); ok && pattern != "" {
+		re = regexp.MustCompile(pattern)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open saved output: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var b strings.Builder
+	total, shown, first, last, matches := 0, 0, 0, 0, 0
+	full := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		total++
+		if total < offset {
+			continue
+		}
+		line := scanner.Text()
+		if re != nil && !re.MatchString(line) {
+			continue
+		}
+		matches++
+		if full {
+			continue
+		}
+		if runes := []rune(line); len(runes) > maxReadOutputLineLength {
+			line = string(runes[:maxReadOutputLineLength]) + fmt.Sprintf(" ... [%d more characters]", len(runes)-maxReadOutputLineLength)
+		}
+		entry := fmt.Sprintf("%5d %s\n", total, line)
+		if shown >= limit || b.Len()+len(entry) > maxReadOutputBytes {
+			full = true
+			continue
+		}
+		b.WriteString(entry)
+		if first == 0 {
+			first = total
+		}
+		last = total
+		shown++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read saved output: %w", err)
+	}
+
+	var header string
+	switch {
+	case re != nil:
+		header = fmt.Sprintf("Output %s: %d of %d lines from line %d match %q, showing %d", handle, matches, max(total-offset+1, 0), offset, re.String(), shown)
+	case shown == 0:
+		header = fmt.Sprintf("Output %s has %d lines, nothing from line %d", handle, total, offset)
+	default:
+		header = fmt.Sprintf("Output %s: lines %d-%d of %d", handle, first, last, total)
+	}
+	content := header + "\n" + b.String()
+	if full {
+		content += fmt.Sprintf("[more lines follow; continue with offset=%d]\n", last+1)
+	}
+
+	return &ToolResult{
+		Content: content,
+		Data: map[string]interface{}{
+			"handle":      handle,
+			"path":        path,
+			"total_lines": total,
+			"first_line":  first,
+			"last_line":   last,
+			"shown":       shown,
+			"matches":     matches,
+			"truncated":   full,
+		},
+	}, nil
+}
+
+// intArg returns an integer argument, JSON numbers arrive as float64
+func intArg(args map[string]interface{}, name string, def int) int {
+	switch v := args[name].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return def
+}
@@ -45,6 +45,7 @@ func GetAllBuiltinToolsWithAgent(configManager *config.Manager, sessionManager *
 		CreateFileUpdateTool(),
 		CreateFileReplaceTool(),
 		CreateFileListTool(),
+		CreateReadOutputToolWithSessionManager(sessionManager),
 
 		// Search tools (conditionally include grep tools if ripgrep is available)
 		CreateFindTool(),
@@ -88,6 +89,8 @@ func GetToolByNameWithConfig(name string, configManager *config.Manager) Tool {
 		return CreateFileReplaceTool()
 	case "file_list":
 		return CreateFileListTool()
+	case "read_output":
+		return CreateReadOutputToolWithSessionManager(nil)
 	case "grep":
 		return CreateGrepTool()
 	case "ripgrep":
@@ -153,6 +156,7 @@ func GetToolsByCategoryWithConfig(configManager *config.Manager) map[string][]To
 			CreateFileUpdateTool(),
 			CreateFileReplaceTool(),
 			CreateFileListTool(),
+			CreateReadOutputToolWithSessionManager(nil),
 		},
 		"search": searchTools,
 		"web": {
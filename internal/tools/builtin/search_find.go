@@ -19,6 +19,10 @@ func (t *FindTool) Name() string {
 	return "find"
 }
 
+func (t *FindTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *FindTool) Description() string {
 	return "Find files and directories by name or pattern using the find command."
 }
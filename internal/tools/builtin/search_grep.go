@@ -18,6 +18,10 @@ func (t *GrepTool) Name() string {
 	return "grep"
 }
 
+func (t *GrepTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *GrepTool) Description() string {
 	return "Search for patterns in files using grep."
 }
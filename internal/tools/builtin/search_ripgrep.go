@@ -18,6 +18,10 @@ func (t *RipgrepTool) Name() string {
 	return "ripgrep"
 }
 
+func (t *RipgrepTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *RipgrepTool) Description() string {
 	return "Search for patterns in files using ripgrep (rg). Faster than grep."
 }
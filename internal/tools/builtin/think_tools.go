@@ -17,6 +17,10 @@ func (t *ThinkTool) Name() string {
 	return "think"
 }
 
+func (t *ThinkTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *ThinkTool) Description() string {
 	return "Allows the model to think and reason. Tool parameters contain the content to think about, tool result returns the model's thinking process as-is."
 }
@@ -29,6 +29,10 @@ func (t *TodoReadTool) Name() string {
 	return "todo_read"
 }
 
+func (t *TodoReadTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *TodoReadTool) Description() string {
 	return "Read the current session's todo list including the final goal and todo items."
 }
@@ -27,3 +27,16 @@ type Tool interface {
 	// Validate checks if the provided arguments are valid for this tool
 	Validate(args map[string]interface{}) error
 }
+
+// ReadOnlyTool is an optional interface for tools that never modify files or other state.
+// Read-only tool calls within one turn may be executed concurrently.
+type ReadOnlyTool interface {
+	IsReadOnly() bool
+}
+
+// IsReadOnlyTool reports whether a tool declares itself read-only; tools that do not
+// implement ReadOnlyTool are treated as mutating
+func IsReadOnlyTool(tool Tool) bool {
+	readOnly, ok := tool.(ReadOnlyTool)
+	return ok && readOnly.IsReadOnly()
+}
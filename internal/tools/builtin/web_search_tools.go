@@ -71,6 +71,10 @@ func (t *WebSearchTool) Name() string {
 	return "web_search"
 }
 
+func (t *WebSearchTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *WebSearchTool) Description() string {
 	return "Search the web for current information using Tavily API. Returns relevant search results with summaries and URLs."
 }
@@ -356,6 +360,10 @@ func (t *NewsSearchTool) Name() string {
 	return "news_search"
 }
 
+func (t *NewsSearchTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *NewsSearchTool) Description() string {
 	return "Search for recent news articles and current events using Tavily API. Focuses on news sources and recent content."
 }
@@ -396,6 +404,10 @@ func (t *AcademicSearchTool) Name() string {
 	return "academic_search"
 }
 
+func (t *AcademicSearchTool) IsReadOnly() bool {
+	return true
+}
+
 func (t *AcademicSearchTool) Description() string {
 	return "Search for academic papers, research, and scholarly content using Tavily API. Focuses on academic and research sources."
 }
@@ -14,6 +14,17 @@ const (
 	MessageTypeTool      MessageType = "tool"
 )
 
+// ContentPart is a text or image part attached to a message. An image is given by
+// a file path, base64 data with its media type, or a URL.
+type ContentPart struct {
+	Type      string `json:"type"` // "text" or "image"
+	Text      string `json:"text,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
 // BaseMessage defines the core message interface
 type BaseMessage interface {
 	GetRole() string
@@ -67,6 +78,7 @@ type LLMMessage struct {
 	Reasoning        string         `json:"reasoning,omitempty"`
 	ReasoningSummary string         `json:"reasoning_summary,omitempty"`
 	Think            string         `json:"think,omitempty"`
+	Parts            []ContentPart  `json:"parts,omitempty"`
 }
 
 // LLMToolCall represents LLM protocol tool call
@@ -92,6 +104,7 @@ type SessionMessage struct {
 	ToolID    string                 `json:"tool_id,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
 	Timestamp time.Time              `json:"timestamp"`
+	Parts     []ContentPart          `json:"parts,omitempty"`
 }
 
 // SessionToolCall represents session storage tool call
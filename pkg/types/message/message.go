@@ -18,6 +18,9 @@ type Message struct {
 	Reasoning        string `json:"reasoning,omitempty"`
 	ReasoningSummary string `json:"reasoning_summary,omitempty"`
 	Think            string `json:"think,omitempty"`
+
+	// Parts are images and extra text sent after Content
+	Parts []ContentPart `json:"parts,omitempty"`
 }
 
 // NewMessage creates a new unified message
@@ -109,6 +112,7 @@ func (m *Message) ToLLMMessage() LLMMessage {
 		Reasoning:        m.Reasoning,
 		ReasoningSummary: m.ReasoningSummary,
 		Think:            m.Think,
+		Parts:            m.Parts,
 	}
 	
 	// Convert tool calls
@@ -130,6 +134,7 @@ func (m *Message) ToSessionMessage() SessionMessage {
 		ToolID:    m.ToolCallID,
 		Metadata:  make(map[string]interface{}),
 		Timestamp: m.Timestamp,
+		Parts:     m.Parts,
 	}
 	
 	// Copy metadata and add reasoning fields if present
@@ -166,6 +171,7 @@ func FromLLMMessage(llmMsg LLMMessage) *Message {
 		Reasoning:        llmMsg.Reasoning,
 		ReasoningSummary: llmMsg.ReasoningSummary,
 		Think:            llmMsg.Think,
+		Parts:            llmMsg.Parts,
 		Metadata:         make(map[string]interface{}),
 		Timestamp:        time.Now(),
 		ToolCalls:        make([]*ToolCallImpl, 0),
@@ -189,6 +195,7 @@ func FromSessionMessage(sessionMsg SessionMessage) *Message {
 		Metadata:  make(map[string]interface{}),
 		Timestamp: sessionMsg.Timestamp,
 		ToolCalls: make([]*ToolCallImpl, 0),
+		Parts:     sessionMsg.Parts,
 	}
 	
 	// Copy metadata and extract reasoning fields
@@ -188,6 +188,7 @@ type ReactTaskContext struct {
 	TokensUsed       int                    `json:"tokens_used"`       // 已使用token数
 	PromptTokens     int                    `json:"prompt_tokens"`     // 累计输入token数
 	CompletionTokens int                    `json:"completion_tokens"` // 累计输出token数
+	Cost             float64                `json:"cost"`              // 累计费用（美元）
 	Metadata         map[string]interface{} `json:"metadata"`          // 元数据
 	// Directory context information
 	WorkingDir    string                `json:"working_dir"`              // 对话发起时的工作目录
@@ -195,6 +196,7 @@ type ReactTaskContext struct {
 
 	// Project and environment information
 	ProjectSummary *ProjectSummary `json:"project_summary,omitempty"` // 项目和系统环境汇总
+	RepoMap        string          `json:"repo_map,omitempty"`        // 按任务相关性排序的代码结构
 }
 
 // ReactExecutionStep - ReAct执行步骤
@@ -223,6 +225,7 @@ type ReactTaskResult struct {
 	TokensUsed       int                    `json:"tokens_used"`        // 总token使用量
 	PromptTokens     int                    `json:"prompt_tokens"`      // 输入token数
 	CompletionTokens int                    `json:"completion_tokens"`  // 输出token数
+	Cost             float64                `json:"cost"`               // 费用（美元）
 	Metadata         map[string]interface{} `json:"metadata,omitempty"` // 额外元数据
 	Error            string                 `json:"error,omitempty"`    // 错误信息
 }
@@ -259,6 +262,8 @@ type ReactConfig struct {
 	LogLevel            string        `json:"log_level"`            // 日志级别
 	Temperature         float64       `json:"temperature"`          // LLM温度参数
 	MaxTokens           int           `json:"max_tokens"`           // 最大token数
+	MaxTaskTokens       int           `json:"max_task_tokens"`      // 单个任务的token预算，0表示不限制
+	MaxTaskCost         float64       `json:"max_task_cost"`        // 单个任务的预估费用上限（美元），0表示不限制
 }
 
 // ReactConfig默认配置常量